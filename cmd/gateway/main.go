@@ -15,45 +15,8 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
 )
 
-type WebApp interface {
-	Start() error
-	Shutdown(ctx context.Context) error
-}
-
-func startApp(webApp WebApp, config app.Config, logger *slog.Logger) {
-	logger.Debug(fmt.Sprintf("web app starts at %s with configuration: %+v", config.Web.Host+":"+config.Web.Port, config))
-
-	go func() {
-		err := webApp.Start()
-		if err != nil {
-			panic(err)
-		}
-	}()
-}
-
-func shutdownApp(webApp WebApp, logger *slog.Logger) {
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	logger.Debug("shutdown web app ...")
-
-	const shutdownTimeout = time.Minute
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-
-	err := webApp.Shutdown(ctx)
-	if err != nil {
-		panic(err)
-	}
-
-	cancel()
-	logger.Debug("web app exited")
-}
-
 func main() {
 	var configPath string
 	pflag.StringVarP(&configPath, "config", "c", "configs/gateway.yaml", "Config file path")
@@ -72,18 +35,35 @@ func main() {
 		Balancer:               &kafka.LeastBytes{},
 		AllowAutoTopicCreation: true,
 	}
-	defer kafkaWriter.Close()
 
 	requestBacklog := retryer.NewKafkaRequestBacklog(nil, kafkaWriter, logger)
 
-	delivery := gateway.New(
-		carAPI.New(config.CarsApiAddr, http.DefaultClient, requestBacklog, config.MaxRequestFails, logger),
-		rentalAPI.New(config.RentalApiAddr, http.DefaultClient, requestBacklog, config.MaxRequestFails, logger),
-		paymentAPI.New(config.PaymentApiAddr, http.DefaultClient, requestBacklog, config.MaxRequestFails, logger),
-		logger,
-	)
-	webApp := app.NewFiberApp(config.Web, delivery, logger)
+	client := new(http.Client)
+	carsAPI := carAPI.New(config.CarsApiAddr, client, requestBacklog, config.MaxRequestFails, logger)
+	rentalsAPI := rentalAPI.New(config.RentalApiAddr, client, requestBacklog, config.MaxRequestFails, logger)
+	paymentsAPI := paymentAPI.New(config.PaymentApiAddr, client, requestBacklog, config.MaxRequestFails, logger)
+
+	delivery := gateway.New(carsAPI, rentalsAPI, paymentsAPI, config.Rentals, logger)
+	webApp, err := app.NewFiberApp(config.Web, delivery, logger)
+	if err != nil {
+		panic(err)
+	}
+	client.Transport = webApp.Faults().Transport(http.DefaultTransport) // the faults are set through the gateway
+
+	expirer := gateway.NewReservationExpirer(carsAPI, rentalsAPI, paymentsAPI, config.Reservations.GracePeriod, logger)
+
+	lifecycle := app.NewLifecycle(config.Shutdown, logger)
+	lifecycle.AddWebApp(webApp)
+	lifecycle.Go(func(ctx context.Context) {
+		expirer.Run(ctx, config.Reservations.CheckInterval)
+	})
+	lifecycle.AddKafka("backlog writer", kafkaWriter)
+
+	logger.Debug(fmt.Sprintf("web app starts at %s with configuration: %+v", config.Web.Host+":"+config.Web.Port, config))
 
-	startApp(webApp, config, logger)
-	shutdownApp(webApp, logger)
+	err = lifecycle.Run()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/notifier/delivery"
+	"github.com/Inspirate789/ds-lab2/internal/notifier/repository"
+	"github.com/Inspirate789/ds-lab2/internal/notifier/sender"
+	"github.com/Inspirate789/ds-lab2/internal/notifier/usecase"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/migrations"
+	_ "github.com/lib/pq"
+	"github.com/lmittmann/tint"
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/pflag"
+	"io"
+	"log/slog"
+	"os"
+)
+
+func newSender(config app.NotificationSenderConfig, logger *slog.Logger) (usecase.Sender, io.Closer, error) {
+	switch config.Kind {
+	case "", "stdout":
+		return sender.NewWriter(os.Stdout), io.NopCloser(nil), nil
+	case "file":
+		return sender.NewFile(config.File)
+	case "smtp":
+		smtpSender := sender.NewSMTP(
+			config.SMTP.Host,
+			config.SMTP.Port,
+			config.SMTP.Username,
+			config.SMTP.Password.Reveal(),
+			config.SMTP.From,
+			logger,
+		)
+
+		return smtpSender, io.NopCloser(nil), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown notification sender %q: stdout, file or smtp expected", config.Kind)
+	}
+}
+
+func main() {
+	var configPath, migrationsPath string
+	pflag.StringVarP(&configPath, "config", "c", "configs/notifier.yaml", "Config file path")
+	pflag.StringVarP(&migrationsPath, "migrations", "", "migrations", "Migrations directory path")
+	pflag.Parse()
+
+	config, err := app.ReadLocalConfig(configPath)
+	if err != nil {
+		panic(err)
+	}
+
+	logger := slog.New(tint.NewHandler(os.Stdout, &tint.Options{Level: slog.Level(config.Logging.Level)}))
+
+	if pflag.Arg(0) == "migrate" {
+		err = migrations.RunCommand(context.Background(), pflag.Args()[1:], config.DB.ConnectionString, migrationsPath, logger)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	db, err := app.ConnectDB(context.Background(), config.DB, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	if !config.DB.SkipMigrations {
+		err = migrations.Do(config.DB.ConnectionString, migrationsPath, logger)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	notificationSender, closer, err := newSender(config.Notifier.Sender, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	templates, err := usecase.NewTemplates(config.Notifier.Templates)
+	if err != nil {
+		panic(err)
+	}
+
+	repo := repository.NewSqlxRepository(db, logger)
+	useCase := usecase.New(repo, notificationSender, templates, config.Notifier, logger)
+	notifierDelivery := delivery.New(useCase, logger)
+	webApp, err := app.NewFiberApp(config.Web, notifierDelivery, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	eventReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     config.Kafka.Addresses,
+		GroupID:     config.Notifier.GroupID,
+		GroupTopics: config.Notifier.Topics,
+	})
+
+	lifecycle := app.NewLifecycle(config.Shutdown, logger)
+	lifecycle.AddWebApp(webApp)
+	lifecycle.Go(func(ctx context.Context) {
+		notifierDelivery.Consume(ctx, eventReader)
+	})
+	lifecycle.Go(useCase.RunReminders)
+	lifecycle.AddKafka("event reader", eventReader)
+	lifecycle.AddCloser("sender", closer)
+	lifecycle.AddCloser("db", db)
+
+	logger.Debug(fmt.Sprintf("web app starts at %s with configuration: %+v", config.Web.Host+":"+config.Web.Port, config))
+
+	err = lifecycle.Run()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
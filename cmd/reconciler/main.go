@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	carAPI "github.com/Inspirate789/ds-lab2/internal/car/api"
+	paymentAPI "github.com/Inspirate789/ds-lab2/internal/payment/api"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/internal/reconciler"
+	rentalAPI "github.com/Inspirate789/ds-lab2/internal/rental/api"
+	"github.com/Inspirate789/ds-lab2/pkg/retryer"
+	"github.com/lmittmann/tint"
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/pflag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	var configPath, mode string
+	pflag.StringVarP(&configPath, "config", "c", "configs/reconciler.yaml", "Config file path")
+	pflag.StringVarP(&mode, "mode", "m", "", "Override the configured mode: dry-run or apply")
+	pflag.Parse()
+
+	config, err := app.ReadLocalConfig(configPath)
+	if err != nil {
+		panic(err)
+	}
+
+	if mode != "" {
+		config.Reconciler.Mode = mode
+	}
+
+	logger := slog.New(tint.NewHandler(os.Stdout, &tint.Options{Level: slog.Level(config.Logging.Level)}))
+
+	kafkaWriter := &kafka.Writer{
+		Addr:                   kafka.TCP(config.Kafka.Addresses...),
+		Topic:                  config.Kafka.Topic,
+		Balancer:               &kafka.LeastBytes{},
+		AllowAutoTopicCreation: true,
+	}
+	defer kafkaWriter.Close()
+
+	requestBacklog := retryer.NewKafkaRequestBacklog(nil, kafkaWriter, logger)
+
+	carsAPI := carAPI.New(config.CarsApiAddr, http.DefaultClient, requestBacklog, config.MaxRequestFails, logger)
+	rentalsAPI := rentalAPI.New(config.RentalApiAddr, http.DefaultClient, requestBacklog, config.MaxRequestFails, logger)
+	paymentsAPI := paymentAPI.New(config.PaymentApiAddr, http.DefaultClient, requestBacklog, config.MaxRequestFails, logger)
+
+	rec, err := reconciler.New(carsAPI, rentalsAPI, paymentsAPI, config.Reconciler, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if config.Reconciler.Interval > 0 {
+		rec.Run(ctx, config.Reconciler.Interval)
+		return
+	}
+
+	_, err = rec.Reconcile(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		cancel()
+		os.Exit(1)
+	}
+}
@@ -2,57 +2,43 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
 	"github.com/Inspirate789/ds-lab2/internal/rental/delivery"
 	"github.com/Inspirate789/ds-lab2/internal/rental/repository"
 	"github.com/Inspirate789/ds-lab2/internal/rental/usecase"
 	"github.com/Inspirate789/ds-lab2/pkg/migrations"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/jmoiron/sqlx"
+	"github.com/Inspirate789/ds-lab2/pkg/outbox"
+	"github.com/Inspirate789/ds-lab2/pkg/sqlxutils"
 	_ "github.com/lib/pq"
 	"github.com/lmittmann/tint"
+	"github.com/segmentio/kafka-go"
 	"github.com/spf13/pflag"
 	"log/slog"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
 )
 
-type WebApp interface {
-	Start() error
-	Shutdown(ctx context.Context) error
-}
+// newRepository opens the configured store; the memory driver keeps the data in the process
+// and has no outbox to relay events from.
+func newRepository(config app.Config, migrationsPath string, logger *slog.Logger) (usecase.Repository, *sqlxutils.DB, error) {
+	if config.DB.DriverName == app.MemoryDriver {
+		return repository.NewMemoryRepository(logger), nil, nil
+	}
 
-func startApp(webApp WebApp, config app.Config, logger *slog.Logger) {
-	logger.Debug(fmt.Sprintf("web app starts at %s with configuration: %+v", config.Web.Host+":"+config.Web.Port, config))
+	db, err := app.ConnectDB(context.Background(), config.DB, logger)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	go func() {
-		err := webApp.Start()
+	if !config.DB.SkipMigrations {
+		err = migrations.Do(config.DB.ConnectionString, migrationsPath, logger)
 		if err != nil {
-			panic(err)
+			return nil, nil, errors.Join(err, db.Close())
 		}
-	}()
-}
-
-func shutdownApp(webApp WebApp, logger *slog.Logger) {
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	logger.Debug("shutdown web app ...")
-
-	const shutdownTimeout = time.Minute
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
-
-	err := webApp.Shutdown(ctx)
-	if err != nil {
-		panic(err)
 	}
 
-	cancel()
-	logger.Debug("web app exited")
+	return repository.NewSqlxRepository(db, logger), db, nil
 }
 
 func main() {
@@ -68,27 +54,53 @@ func main() {
 
 	logger := slog.New(tint.NewHandler(os.Stdout, &tint.Options{Level: slog.Level(config.Logging.Level)}))
 
-	db, err := sqlx.Connect(config.DB.DriverName, config.DB.ConnectionString)
-	if err != nil {
-		panic(err)
-	}
-
-	defer func(db *sqlx.DB) {
-		err = db.Close()
+	if pflag.Arg(0) == "migrate" {
+		err = migrations.RunCommand(context.Background(), pflag.Args()[1:], config.DB.ConnectionString, migrationsPath, logger)
 		if err != nil {
-			panic(err)
+			logger.Error(err.Error())
+			os.Exit(1)
 		}
-	}(db)
 
-	err = migrations.Do(config.DB.ConnectionString, migrationsPath, logger)
+		return
+	}
+
+	repo, db, err := newRepository(config, migrationsPath, logger)
 	if err != nil {
 		panic(err)
 	}
 
-	repo := repository.NewSqlxRepository(db, logger)
 	useCase := usecase.New(repo, logger)
-	webApp := app.NewFiberApp(config.Web, delivery.New(useCase, logger), logger)
+	webApp, err := app.NewFiberApp(config.Web, delivery.New(useCase, logger), logger)
+	if err != nil {
+		panic(err)
+	}
+
+	eventWriter := &kafka.Writer{
+		Addr:                   kafka.TCP(config.Kafka.Addresses...),
+		Topic:                  config.Outbox.Topic,
+		Balancer:               &kafka.Hash{}, // events of an aggregate share a partition to keep their order
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+
+	lifecycle := app.NewLifecycle(config.Shutdown, logger)
+	lifecycle.AddWebApp(webApp)
 
-	startApp(webApp, config, logger)
-	shutdownApp(webApp, logger)
+	if db != nil {
+		relay := outbox.NewRelay(db.DB, eventWriter, config.Outbox.BatchSize, logger)
+		lifecycle.Go(func(ctx context.Context) {
+			relay.Run(ctx, config.Outbox.Interval)
+		})
+		lifecycle.AddCloser("db", db)
+	}
+
+	lifecycle.AddKafka("event writer", eventWriter)
+
+	logger.Debug(fmt.Sprintf("web app starts at %s with configuration: %+v", config.Web.Host+":"+config.Web.Port, config))
+
+	err = lifecycle.Run()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
 }
@@ -7,11 +7,12 @@ import (
 	"github.com/lmittmann/tint"
 	"github.com/segmentio/kafka-go"
 	"github.com/spf13/pflag"
+	"go.uber.org/multierr"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"time"
 )
 
 func main() {
@@ -33,25 +34,36 @@ func main() {
 
 	requestBacklog := retryer.NewKafkaRequestBacklog(kafkaReader, nil, logger)
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	if config.Retryer.RequestTimeout == 0 {
+		config.Retryer.RequestTimeout = 10 * time.Second
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	client := &http.Client{Timeout: config.Retryer.RequestTimeout}
 
-	for {
-		select {
-		case <-quit:
-			cancel()
-			kafkaReader.Close()
-			return
-		default:
+	lifecycle := app.NewLifecycle(config.Shutdown, logger)
+	lifecycle.Go(func(ctx context.Context) {
+		for ctx.Err() == nil {
 			err := requestBacklog.HandleRequest(ctx, func(req *http.Request) error {
-				_, err := http.DefaultClient.Do(req)
-				return err
+				resp, err := client.Do(req)
+				if err != nil {
+					return err
+				}
+
+				// the body is drained, so the connection is reused
+				_, err = io.Copy(io.Discard, resp.Body)
+
+				return multierr.Append(err, resp.Body.Close())
 			})
-			if err != nil {
+			if err != nil && ctx.Err() == nil {
 				logger.Error(err.Error())
 			}
 		}
+	})
+	lifecycle.AddKafka("backlog reader", kafkaReader)
+
+	err = lifecycle.Run()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 }
@@ -1,12 +1,13 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/Inspirate789/ds-lab2/internal/car/delivery"
 	"github.com/Inspirate789/ds-lab2/internal/models"
 	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/pkg/errors"
 	"github.com/sony/gobreaker/v2"
 	"go.uber.org/multierr"
@@ -14,6 +15,8 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -29,8 +32,8 @@ type RequestBacklog interface {
 }
 
 type cars struct {
-	items      []models.Car
-	totalCount uint64
+	items []models.Car
+	info  pagination.Page
 }
 
 type car struct {
@@ -116,12 +119,32 @@ func (api *CarsAPI) HealthCheck(ctx context.Context) (err error) {
 
 }
 
-func (api *CarsAPI) getCars(ctx context.Context, offset, limit uint64, showAll bool) (res []models.Car, totalCount uint64, err error) {
-	endpoint := api.baseURL + fmt.Sprintf("/api/v1/cars?offset=%d&limit=%d&showAll=%v", offset, limit, showAll)
+func periodQuery(from, to time.Time) url.Values {
+	query := make(url.Values)
+
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+
+	return query
+}
+
+func (api *CarsAPI) getCars(ctx context.Context, page pagination.Request, showAll bool, from, to time.Time) (res []models.Car, info pagination.Page, err error) {
+	query := periodQuery(from, to)
+	for key, values := range page.Values() {
+		query[key] = values
+	}
+	query.Set("showAll", strconv.FormatBool(showAll))
+
+	endpoint := api.baseURL + "/api/v1/cars?" + query.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
-		return nil, 0, err
+		return nil, pagination.Page{}, err
 	}
 
 	resp, err := api.client.Do(req)
@@ -131,43 +154,82 @@ func (api *CarsAPI) getCars(ctx context.Context, offset, limit uint64, showAll b
 			err = errors.Wrap(err, ErrServiceUnavailable)
 		}
 
-		return nil, 0, err
+		return nil, pagination.Page{}, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, 0, err
+		return nil, pagination.Page{}, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, 0, errors.New(string(body))
+		return nil, pagination.Page{}, errors.New(string(body))
 	}
 
 	var cars delivery.CarsDTO
 
 	err = json.Unmarshal(body, &cars)
 	if err != nil {
-		return nil, 0, err
+		return nil, pagination.Page{}, err
 	}
 
-	return cars.ToModel(), cars.Count, nil
+	return cars.ToModel()
 }
 
-func (api *CarsAPI) GetCars(ctx context.Context, offset, limit uint64, showAll bool) ([]models.Car, uint64, error) {
+func (api *CarsAPI) GetCars(ctx context.Context, page pagination.Request, showAll bool, from, to time.Time) ([]models.Car, pagination.Page, error) {
 	res, err := api.carsCB.Execute(func() (cars, error) {
-		items, totalCount, err := api.getCars(ctx, offset, limit, showAll)
+		items, info, err := api.getCars(ctx, page, showAll, from, to)
 		return cars{
-			items:      items,
-			totalCount: totalCount,
+			items: items,
+			info:  info,
 		}, err
 	})
 	if err != nil {
 		api.logger.Warn(err.Error())
-		return make([]models.Car, 0), 0, nil
+		return make([]models.Car, 0), pagination.Page{}, nil
 	}
 
-	return res.items, res.totalCount, nil
+	return res.items, res.info, nil
+}
+
+// GetReservations lists the car locks; it bypasses the circuit breaker, as callers need the actual data.
+func (api *CarsAPI) GetReservations(ctx context.Context, page pagination.Request) ([]models.CarReservation, pagination.Page, error) {
+	endpoint := api.baseURL + "/api/v1/cars/reservations?" + page.Values().Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = errors.Wrap(err, ErrServiceUnavailable)
+		}
+
+		return nil, pagination.Page{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, pagination.Page{}, errors.New(string(body))
+	}
+
+	var reservations delivery.CarReservationsDTO
+
+	err = json.Unmarshal(body, &reservations)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	return reservations.ToModel()
 }
 
 func (api *CarsAPI) getCar(ctx context.Context, carUID string) (res models.Car, found bool, err error) {
@@ -226,14 +288,21 @@ func (api *CarsAPI) GetCar(ctx context.Context, carUID string) (models.Car, bool
 	return res.item, res.found, nil
 }
 
-func (api *CarsAPI) LockCar(ctx context.Context, carUID string) (res models.Car, found, success bool, err error) {
-	endpoint := api.baseURL + "/api/v1/cars/" + carUID + "/lock"
+func (api *CarsAPI) LockCar(ctx context.Context, carUID string, from, to time.Time, lock models.CarLock) (res models.Car, found, success bool, err error) {
+	endpoint := api.baseURL + "/api/v1/cars/" + carUID + "/lock?" + periodQuery(from, to).Encode()
+
+	body, err := json.Marshal(delivery.NewCarLockDTO(lock))
+	if err != nil {
+		return models.Car{}, false, false, err
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		return models.Car{}, false, false, err
 	}
 
+	req.Header.Set("Content-Type", "application/json")
+
 	resp, err := api.client.Do(req)
 	if err != nil {
 		var DNSError *net.DNSError
@@ -245,7 +314,7 @@ func (api *CarsAPI) LockCar(ctx context.Context, carUID string) (res models.Car,
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err = io.ReadAll(resp.Body)
 	if err != nil {
 		return models.Car{}, false, false, err
 	}
@@ -268,12 +337,102 @@ func (api *CarsAPI) LockCar(ctx context.Context, carUID string) (res models.Car,
 	return car.ToModel(), true, true, nil
 }
 
-func (api *CarsAPI) UnlockCar(ctx context.Context, carUID string) (err error) {
-	endpoint := api.baseURL + "/api/v1/cars/" + carUID + "/lock"
+func (api *CarsAPI) AttachRental(ctx context.Context, carUID string, from, to time.Time, rentalUID string) (found bool, err error) {
+	endpoint := api.baseURL + "/api/v1/cars/" + carUID + "/lock/rental?" + periodQuery(from, to).Encode()
+
+	body, err := json.Marshal(delivery.CarRentalDTO{RentalUID: rentalUID})
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = nil
+		}
+
+		return true, multierr.Combine(err, api.backlog.Push(ctx, req))
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, errors.New(string(body))
+	}
+
+	return true, nil
+}
+
+func (api *CarsAPI) RenewLock(ctx context.Context, carUID string, from, to time.Time, owner string, ttl time.Duration) (found bool, err error) {
+	endpoint := api.baseURL + "/api/v1/cars/" + carUID + "/lock/renew?" + periodQuery(from, to).Encode()
+
+	renewal := delivery.CarLockRenewalDTO{Owner: owner}
+	if ttl > 0 {
+		renewal.TTL = ttl.String()
+	}
+
+	body, err := json.Marshal(renewal)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = errors.Wrap(err, ErrServiceUnavailable)
+		}
+
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, errors.New(string(body))
+	}
+
+	return true, nil
+}
+
+func (api *CarsAPI) UnlockCar(ctx context.Context, carUID string, from, to time.Time, holder string) (found, allowed, changed bool, err error) {
+	query := periodQuery(from, to)
+	if holder != "" {
+		query.Set("holder", holder)
+	}
+
+	endpoint := api.baseURL + "/api/v1/cars/" + carUID + "/lock?" + query.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
 	if err != nil {
-		return err
+		return false, false, false, err
 	}
 
 	resp, err := api.client.Do(req)
@@ -283,18 +442,72 @@ func (api *CarsAPI) UnlockCar(ctx context.Context, carUID string) (err error) {
 			err = errors.Wrap(err, ErrServiceUnavailable)
 		}
 
-		return multierr.Combine(err, api.backlog.Push(ctx, req))
+		return false, false, false, multierr.Combine(err, api.backlog.Push(ctx, req))
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return false, false, false, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.New(string(body))
+	if resp.StatusCode == http.StatusNotFound {
+		return false, false, false, nil
+	} else if resp.StatusCode == http.StatusForbidden {
+		return true, false, false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, false, false, errors.New(string(body))
 	}
 
-	return nil
+	var dto delivery.CarUnlockDTO
+
+	err = json.Unmarshal(body, &dto)
+	if err != nil {
+		return false, false, false, err
+	}
+
+	return true, true, dto.Changed, nil
+}
+
+func (api *CarsAPI) ForceUnlockCar(ctx context.Context, carUID string, from, to time.Time) (found, changed bool, err error) {
+	query := periodQuery(from, to)
+	query.Set("force", "true")
+
+	endpoint := api.baseURL + "/api/v1/cars/" + carUID + "/lock?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return false, false, err
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = errors.Wrap(err, ErrServiceUnavailable)
+		}
+
+		return false, false, multierr.Combine(err, api.backlog.Push(ctx, req))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, false, errors.New(string(body))
+	}
+
+	var dto delivery.CarUnlockDTO
+
+	err = json.Unmarshal(body, &dto)
+	if err != nil {
+		return false, false, err
+	}
+
+	return true, dto.Changed, nil
 }
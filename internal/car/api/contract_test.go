@@ -0,0 +1,294 @@
+package api_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/car/api"
+	"github.com/Inspirate789/ds-lab2/internal/car/delivery"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/contract"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+const contractPath = "../../../contracts/gateway-cars.json"
+
+const (
+	carUID        = "109b42f3-198d-4c89-9276-a7520a7120ab"
+	unknownCarUID = "4f8a1e3b-9a4c-4c6e-8f53-2a4d86e07d1a"
+	rentalUID     = "8d5d3c36-2c4e-4b57-9a8d-7b0f5e4c1a20"
+	owner         = "gateway-rental-1"
+)
+
+var (
+	from = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	to   = time.Date(2030, 1, 5, 0, 0, 0, 0, time.UTC)
+)
+
+var (
+	carExists = contract.State{
+		Name:   "car exists",
+		Params: map[string]string{"carUid": carUID},
+	}
+	carNotExists = contract.State{
+		Name:   "car does not exist",
+		Params: map[string]string{"carUid": unknownCarUID},
+	}
+	carLocked = contract.State{
+		Name: "car is locked",
+		Params: map[string]string{
+			"carUid": carUID,
+			"from":   from.Format(time.RFC3339),
+			"to":     to.Format(time.RFC3339),
+			"owner":  owner,
+		},
+	}
+)
+
+type ContractSuite struct {
+	suite.Suite
+}
+
+func (s *ContractSuite) TestGatewayContract(t provider.T) {
+	t.Epic("Contracts")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	consumer := contract.NewConsumer("gateway", "cars")
+	carsAPI := api.New("http://cars", consumer.Client(), nil, 1, logger)
+
+	t.WithNewStep("get a car", func(sCtx provider.StepCtx) {
+		// arrange
+		expected := delivery.NewCarDTO(models.Car{
+			ID:                 1,
+			CarUID:             carUID,
+			Brand:              "Mercedes Benz",
+			Model:              "GLA 250",
+			RegistrationNumber: "ЛО777Х799",
+			Power:              249,
+			Price:              3500,
+			Type:               models.Sedan,
+			Availability:       true,
+		})
+		consumer.Expect("get a car", carExists, http.StatusOK, expected)
+		// act
+		car, found, err := carsAPI.GetCar(ctx, carUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().Equal(expected.ToModel(), car)
+	})
+
+	t.WithNewStep("get an unknown car", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("get an unknown car", carNotExists, http.StatusNotFound, nil)
+		// act
+		_, found, err := carsAPI.GetCar(ctx, unknownCarUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+	})
+
+	t.WithNewStep("list all cars for a period", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("list all cars for a period", carExists, http.StatusOK, map[string]any{
+			"items": []map[string]any{{"car_uid": carUID, "price": 3500, "availability": true}},
+			"count": 1,
+		})
+		// act
+		cars, info, err := carsAPI.GetCars(ctx, pagination.Request{Limit: 10}, true, from, to)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Len(cars, 1)
+		sCtx.Require().Equal(carUID, cars[0].CarUID)
+		sCtx.Require().True(cars[0].Availability)
+		sCtx.Require().EqualValues(1, info.TotalCount)
+	})
+
+	t.WithNewStep("lock a car", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("lock a car", carExists, http.StatusOK, map[string]any{"car_uid": carUID, "price": 3500})
+		// act
+		car, found, success, err := carsAPI.LockCar(ctx, carUID, from, to, models.CarLock{Owner: owner})
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(success)
+		sCtx.Require().Equal(carUID, car.CarUID)
+		sCtx.Require().EqualValues(3500, car.Price)
+	})
+
+	t.WithNewStep("lock a locked car", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("lock a locked car", carLocked, http.StatusLocked, nil)
+		// act
+		_, found, success, err := carsAPI.LockCar(ctx, carUID, from, to, models.CarLock{Owner: "gateway-rental-2"})
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().False(success)
+	})
+
+	t.WithNewStep("lock an unknown car", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("lock an unknown car", carNotExists, http.StatusNotFound, nil)
+		// act
+		_, found, success, err := carsAPI.LockCar(ctx, unknownCarUID, from, to, models.CarLock{Owner: owner})
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+		sCtx.Require().False(success)
+	})
+
+	t.WithNewStep("attach a rental to a lock", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("attach a rental to a lock", carLocked, http.StatusOK, nil)
+		// act
+		found, err := carsAPI.AttachRental(ctx, carUID, from, to, rentalUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+	})
+
+	t.WithNewStep("attach a rental to a missing lock", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("attach a rental to a missing lock", carExists, http.StatusNotFound, nil)
+		// act
+		found, err := carsAPI.AttachRental(ctx, carUID, from, to, rentalUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+	})
+
+	t.WithNewStep("renew a lease", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("renew a lease", carLocked, http.StatusOK, nil)
+		// act
+		found, err := carsAPI.RenewLock(ctx, carUID, from, to, owner, 5*time.Minute)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+	})
+
+	t.WithNewStep("renew a missing lease", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("renew a missing lease", carExists, http.StatusNotFound, nil)
+		// act
+		found, err := carsAPI.RenewLock(ctx, carUID, from, to, owner, 0)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+	})
+
+	t.WithNewStep("unlock a car", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("unlock a car", carLocked, http.StatusOK, delivery.CarUnlockDTO{Changed: true})
+		// act
+		found, allowed, changed, err := carsAPI.UnlockCar(ctx, carUID, from, to, owner)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().True(changed)
+	})
+
+	t.WithNewStep("unlock a car locked by another holder", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("unlock a car locked by another holder", carLocked, http.StatusForbidden, nil)
+		// act
+		found, allowed, changed, err := carsAPI.UnlockCar(ctx, carUID, from, to, "gateway-rental-2")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().False(changed)
+	})
+
+	t.WithNewStep("force unlock a car", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("force unlock a car", carLocked, http.StatusOK, delivery.CarUnlockDTO{Changed: true})
+		// act
+		found, changed, err := carsAPI.ForceUnlockCar(ctx, carUID, from, to)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(changed)
+	})
+
+	t.WithNewStep("unlock a car which is not locked", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("unlock a car which is not locked", carExists, http.StatusOK, delivery.CarUnlockDTO{Changed: false})
+		// act
+		found, allowed, changed, err := carsAPI.UnlockCar(ctx, carUID, from, to, owner)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().False(changed)
+	})
+
+	t.WithNewStep("unlock an unknown car", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("unlock an unknown car", carNotExists, http.StatusNotFound, nil)
+		// act
+		found, _, _, err := carsAPI.UnlockCar(ctx, unknownCarUID, from, to, owner)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+	})
+
+	t.WithNewStep("list car locks", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("list car locks", carLocked, http.StatusOK, map[string]any{
+			"items": []map[string]any{{
+				"carUid":   carUID,
+				"dateFrom": from.Format(time.RFC3339),
+				"dateTo":   to.Format(time.RFC3339),
+				"owner":    owner,
+			}},
+			"count": 1,
+		})
+		// act
+		reservations, info, err := carsAPI.GetReservations(ctx, pagination.Request{Limit: 10})
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Len(reservations, 1)
+		sCtx.Require().Equal(owner, reservations[0].Owner)
+		sCtx.Require().True(from.Equal(reservations[0].DateFrom))
+		sCtx.Require().EqualValues(1, info.TotalCount)
+	})
+
+	// act
+	err := consumer.Contract().Save(contractPath)
+	// assert
+	t.Require().NoError(err)
+}
+
+func TestContract(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(ContractSuite))
+}
@@ -0,0 +1,91 @@
+package delivery_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/car/delivery"
+	"github.com/Inspirate789/ds-lab2/internal/car/repository"
+	"github.com/Inspirate789/ds-lab2/internal/car/usecase"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/contract"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+const contractPath = "../../../contracts/gateway-cars.json"
+
+type ContractSuite struct {
+	suite.Suite
+}
+
+// setUp brings the repository to the provider state; the cars keep the uids of the consumer.
+func setUp(repo *repository.MemoryRepository, state contract.State) error {
+	switch state.Name {
+	case "car exists", "car does not exist":
+		return nil
+	case "car is locked":
+		from, err := time.Parse(time.RFC3339, state.Params["from"])
+		if err != nil {
+			return err
+		}
+
+		to, err := time.Parse(time.RFC3339, state.Params["to"])
+		if err != nil {
+			return err
+		}
+
+		_, found, success, err := repo.LockCar(context.Background(), state.Params["carUid"], from, to, models.CarLock{
+			Owner: state.Params["owner"],
+		})
+		if err != nil {
+			return err
+		} else if !found || !success {
+			return fmt.Errorf("lock car %s", state.Params["carUid"])
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown provider state %q", state.Name)
+	}
+}
+
+func (s *ContractSuite) TestGatewayContract(t provider.T) {
+	t.Epic("Contracts")
+	t.Severity(allure.CRITICAL)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	c, err := contract.Load(contractPath)
+	t.Require().NoError(err)
+
+	for _, interaction := range c.Interactions {
+		t.WithNewStep(interaction.Description, func(sCtx provider.StepCtx) {
+			// arrange
+			repo := repository.NewMemoryRepository(repository.SeedCars, logger)
+			err := setUp(repo, interaction.State)
+			sCtx.Require().NoError(err)
+			webApp, err := app.NewFiberApp(
+				app.WebConfig{PathPrefix: "/api/v1/cars"},
+				delivery.New(usecase.New(repo, time.Minute, logger), logger),
+				logger,
+			)
+			sCtx.Require().NoError(err)
+			// act
+			err = contract.Verify(webApp, interaction, nil)
+			// assert
+			sCtx.Require().NoError(err)
+		})
+	}
+}
+
+func TestContract(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(ContractSuite))
+}
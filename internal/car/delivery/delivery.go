@@ -5,18 +5,24 @@ import (
 	"github.com/Inspirate789/ds-lab2/internal/car/delivery/errors"
 	"github.com/Inspirate789/ds-lab2/internal/models"
 	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"log/slog"
-	"math"
 	"strconv"
+	"time"
 )
 
 type UseCase interface {
 	app.HealthChecker
-	GetCars(ctx context.Context, offset, limit uint64, showAll bool) (res []models.Car, totalCount uint64, err error)
+	GetCars(ctx context.Context, page pagination.Request, showAll bool, from, to time.Time) (res []models.Car, info pagination.Page, err error)
 	GetCar(ctx context.Context, carUID string) (res models.Car, found bool, err error)
-	LockCar(ctx context.Context, carUID string) (res models.Car, found, success bool, err error)
-	UnlockCar(ctx context.Context, carUID string) (err error)
+	LockCar(ctx context.Context, carUID string, from, to time.Time, lock models.CarLock) (res models.Car, found, success bool, err error)
+	AttachRental(ctx context.Context, carUID string, from, to time.Time, rentalUID string) (found bool, err error)
+	RenewLock(ctx context.Context, carUID string, from, to time.Time, owner string, ttl time.Duration) (found bool, err error)
+	UnlockCar(ctx context.Context, carUID string, from, to time.Time, holder string) (found, allowed, changed bool, err error)
+	ForceUnlockCar(ctx context.Context, carUID string, from, to time.Time) (found, changed bool, err error)
+	GetReservations(ctx context.Context, page pagination.Request) (res []models.CarReservation, info pagination.Page, err error)
 }
 
 type Delivery struct {
@@ -37,22 +43,19 @@ func (d *Delivery) HealthCheck(ctx context.Context) error {
 
 func (d *Delivery) AddHandlers(router fiber.Router) {
 	router.Get("/", d.getCars)
+	router.Get("/reservations", d.getReservations)
 	router.Get("/:carUID", d.getCar)
 	router.Post("/:carUID/lock", d.lockCar)
 	router.Delete("/:carUID/lock", d.unlockCar)
+	router.Put("/:carUID/lock/rental", d.attachRental)
+	router.Post("/:carUID/lock/renew", d.renewLock)
 }
 
 func (d *Delivery) getCars(ctx *fiber.Ctx) error {
-	offset, err := strconv.ParseUint(ctx.Query("offset"), 10, 64)
+	page, err := pagination.ParseRequest(ctx.Query("offset"), ctx.Query("limit"), ctx.Query("cursor"))
 	if err != nil {
-		d.logger.Debug("cars offset not set, use default 0")
-		offset = 0
-	}
-
-	limit, err := strconv.ParseUint(ctx.Query("limit"), 10, 64)
-	if err != nil {
-		d.logger.Debug("cars limit not set, return all cars")
-		limit = math.MaxInt64
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPage.Map())
 	}
 
 	showAll, err := strconv.ParseBool(ctx.Query("showAll"))
@@ -61,12 +64,47 @@ func (d *Delivery) getCars(ctx *fiber.Ctx) error {
 		showAll = false
 	}
 
-	cars, totalCount, err := d.useCase.GetCars(ctx.Context(), offset, limit, showAll)
+	from, to := time.Now(), time.Time{}
+	if ctx.Query("from") != "" {
+		from, err = time.Parse(time.RFC3339, ctx.Query("from"))
+		if err != nil {
+			d.logger.Error(err.Error())
+			return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPeriod.Map())
+		}
+	}
+	if ctx.Query("to") != "" {
+		to, err = time.Parse(time.RFC3339, ctx.Query("to"))
+		if err != nil {
+			d.logger.Error(err.Error())
+			return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPeriod.Map())
+		}
+
+		if !to.After(from) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPeriod.Map())
+		}
+	}
+
+	cars, info, err := d.useCase.GetCars(ctx.Context(), page, showAll, from, to)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewCarsDTO(cars, info))
+}
+
+func (d *Delivery) getReservations(ctx *fiber.Ctx) error {
+	page, err := pagination.ParseRequest(ctx.Query("offset"), ctx.Query("limit"), ctx.Query("cursor"))
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPage.Map())
+	}
+
+	reservations, info, err := d.useCase.GetReservations(ctx.Context(), page)
 	if err != nil {
 		return err
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(NewCarsDTO(cars, totalCount))
+	return ctx.Status(fiber.StatusOK).JSON(NewCarReservationsDTO(reservations, info))
 }
 
 func (d *Delivery) getCar(ctx *fiber.Ctx) error {
@@ -82,10 +120,48 @@ func (d *Delivery) getCar(ctx *fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(NewCarDTO(car))
 }
 
+func parsePeriod(ctx *fiber.Ctx) (from, to time.Time, err error) {
+	from, err = time.Parse(time.RFC3339, ctx.Query("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	to, err = time.Parse(time.RFC3339, ctx.Query("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, errors.ErrInvalidPeriod
+	}
+
+	return from, to, nil
+}
+
 func (d *Delivery) lockCar(ctx *fiber.Ctx) error {
 	carUID := ctx.Params("carUID")
 
-	car, found, success, err := d.useCase.LockCar(ctx.Context(), carUID)
+	from, to, err := parsePeriod(ctx)
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPeriod.Map())
+	}
+
+	var dto CarLockDTO
+
+	err = ctx.BodyParser(&dto)
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidLock.Map())
+	}
+
+	lock, err := dto.ToModel()
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidLock.Map())
+	}
+
+	car, found, success, err := d.useCase.LockCar(ctx.Context(), carUID, from, to, lock)
 	if err != nil {
 		return err
 	} else if !found {
@@ -100,9 +176,94 @@ func (d *Delivery) lockCar(ctx *fiber.Ctx) error {
 func (d *Delivery) unlockCar(ctx *fiber.Ctx) error {
 	carUID := ctx.Params("carUID")
 
-	err := d.useCase.UnlockCar(ctx.Context(), carUID)
+	from, to, err := parsePeriod(ctx)
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPeriod.Map())
+	}
+
+	// Forced unlocks release the locks left behind, whoever holds them
+	if ctx.QueryBool("force") {
+		found, changed, err := d.useCase.ForceUnlockCar(ctx.Context(), carUID, from, to)
+		if err != nil {
+			return err
+		} else if !found {
+			return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrCarNotFound.Map())
+		}
+
+		return ctx.Status(fiber.StatusOK).JSON(CarUnlockDTO{Changed: changed})
+	}
+
+	found, allowed, changed, err := d.useCase.UnlockCar(ctx.Context(), carUID, from, to, ctx.Query("holder"))
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrCarNotFound.Map())
+	} else if !allowed {
+		return ctx.Status(fiber.StatusForbidden).JSON(errors.ErrCarLockNotOwned.Map())
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(CarUnlockDTO{Changed: changed})
+}
+
+func (d *Delivery) attachRental(ctx *fiber.Ctx) error {
+	carUID := ctx.Params("carUID")
+
+	from, to, err := parsePeriod(ctx)
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPeriod.Map())
+	}
+
+	var dto CarRentalDTO
+
+	err = ctx.BodyParser(&dto)
+	if err != nil || uuid.Validate(dto.RentalUID) != nil {
+		if err != nil {
+			d.logger.Error(err.Error())
+		}
+
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidRentalUID.Map())
+	}
+
+	found, err := d.useCase.AttachRental(ctx.Context(), carUID, from, to, dto.RentalUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrReservationNotFound.Map())
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func (d *Delivery) renewLock(ctx *fiber.Ctx) error {
+	carUID := ctx.Params("carUID")
+
+	from, to, err := parsePeriod(ctx)
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPeriod.Map())
+	}
+
+	var dto CarLockRenewalDTO
+
+	err = ctx.BodyParser(&dto)
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidLock.Map())
+	}
+
+	owner, ttl, err := dto.ToModel()
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidLock.Map())
+	}
+
+	found, err := d.useCase.RenewLock(ctx.Context(), carUID, from, to, owner, ttl)
 	if err != nil {
 		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrLeaseNotFound.Map())
 	}
 
 	return ctx.SendStatus(fiber.StatusOK)
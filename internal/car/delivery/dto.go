@@ -1,6 +1,13 @@
 package delivery
 
-import "github.com/Inspirate789/ds-lab2/internal/models"
+import (
+	"errors"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/google/uuid"
+	"time"
+)
 
 type CarDTO struct {
 	ID                 int64          `json:"id"`
@@ -45,27 +52,255 @@ func (car CarDTO) ToModel() models.Car {
 type CarsDTO struct {
 	Items []CarDTO `json:"items"`
 	Count uint64   `json:"count"`
+	Next  string   `json:"next,omitempty"`
+	Prev  string   `json:"prev,omitempty"`
 }
 
-func NewCarsDTO(cars []models.Car, totalCount uint64) CarsDTO {
+func NewCarsDTO(cars []models.Car, info pagination.Page) CarsDTO {
 	items := make([]CarDTO, 0, len(cars))
 
 	for _, car := range cars {
 		items = append(items, NewCarDTO(car))
 	}
 
-	return CarsDTO{
+	dto := CarsDTO{
 		Items: items,
-		Count: totalCount,
+		Count: info.TotalCount,
 	}
+
+	if info.Next != nil {
+		dto.Next = info.Next.String()
+	}
+
+	if info.Prev != nil {
+		dto.Prev = info.Prev.String()
+	}
+
+	return dto
 }
 
-func (cars CarsDTO) ToModel() []models.Car {
+func (cars CarsDTO) ToModel() ([]models.Car, pagination.Page, error) {
 	model := make([]models.Car, 0, len(cars.Items))
 
 	for _, car := range cars.Items {
 		model = append(model, car.ToModel())
 	}
 
-	return model
+	info := pagination.Page{TotalCount: cars.Count}
+
+	if cars.Next != "" {
+		next, err := pagination.ParseCursor(cars.Next)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+
+		info.Next = &next
+	}
+
+	if cars.Prev != "" {
+		prev, err := pagination.ParseCursor(cars.Prev)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+
+		info.Prev = &prev
+	}
+
+	return model, info, nil
+}
+
+// CarLockDTO describes the holder of a car lock, the owner or the rental; a lock without a holder is rejected.
+type CarLockDTO struct {
+	RentalUID string `json:"rentalUid,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+func NewCarLockDTO(lock models.CarLock) CarLockDTO {
+	dto := CarLockDTO{
+		RentalUID: lock.RentalUID,
+		Owner:     lock.Owner,
+	}
+
+	if !lock.ExpiresAt.IsZero() {
+		dto.ExpiresAt = lock.ExpiresAt.Format(time.RFC3339)
+	}
+
+	return dto
+}
+
+func (lock CarLockDTO) ToModel() (models.CarLock, error) {
+	const maxOwnerLength = 80
+
+	if lock.Owner == "" && lock.RentalUID == "" {
+		return models.CarLock{}, errors.New("lock holder not set")
+	}
+
+	if lock.RentalUID != "" {
+		err := uuid.Validate(lock.RentalUID)
+		if err != nil {
+			return models.CarLock{}, err
+		}
+	}
+
+	if len(lock.Owner) > maxOwnerLength {
+		return models.CarLock{}, fmt.Errorf("lock owner longer than %d bytes", maxOwnerLength)
+	}
+
+	var expiresAt time.Time
+	if lock.ExpiresAt != "" {
+		var err error
+
+		expiresAt, err = time.Parse(time.RFC3339, lock.ExpiresAt)
+		if err != nil {
+			return models.CarLock{}, err
+		}
+	}
+
+	return models.CarLock{
+		RentalUID: lock.RentalUID,
+		Owner:     lock.Owner,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// CarLockRenewalDTO extends the lease of the owner for ttl, a duration like "5m";
+// the lease ttl of the service is used if it is omitted.
+type CarLockRenewalDTO struct {
+	Owner string `json:"owner"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+func (renewal CarLockRenewalDTO) ToModel() (owner string, ttl time.Duration, err error) {
+	if renewal.Owner == "" {
+		return "", 0, errors.New("lock owner not set")
+	}
+
+	if renewal.TTL != "" {
+		ttl, err = time.ParseDuration(renewal.TTL)
+		if err != nil {
+			return "", 0, err
+		} else if ttl <= 0 {
+			return "", 0, errors.New("lease ttl must be positive")
+		}
+	}
+
+	return renewal.Owner, ttl, nil
+}
+
+// CarUnlockDTO tells whether the car was locked for the period, so a repeated unlock can be told apart.
+type CarUnlockDTO struct {
+	Changed bool `json:"changed"`
+}
+
+type CarRentalDTO struct {
+	RentalUID string `json:"rentalUid"`
+}
+
+type CarReservationDTO struct {
+	ID       int64  `json:"id"`
+	CarUID   string `json:"carUid"`
+	DateFrom string `json:"dateFrom"`
+	DateTo   string `json:"dateTo"`
+	CarLockDTO
+}
+
+func NewCarReservationDTO(reservation models.CarReservation) CarReservationDTO {
+	return CarReservationDTO{
+		ID:         reservation.ID,
+		CarUID:     reservation.CarUID,
+		DateFrom:   reservation.DateFrom.Format(time.RFC3339),
+		DateTo:     reservation.DateTo.Format(time.RFC3339),
+		CarLockDTO: NewCarLockDTO(reservation.CarLock),
+	}
+}
+
+func (reservation CarReservationDTO) ToModel() (models.CarReservation, error) {
+	dateFrom, err := time.Parse(time.RFC3339, reservation.DateFrom)
+	if err != nil {
+		return models.CarReservation{}, err
+	}
+
+	dateTo, err := time.Parse(time.RFC3339, reservation.DateTo)
+	if err != nil {
+		return models.CarReservation{}, err
+	}
+
+	lock, err := reservation.CarLockDTO.ToModel()
+	if err != nil {
+		return models.CarReservation{}, err
+	}
+
+	return models.CarReservation{
+		ID:       reservation.ID,
+		CarUID:   reservation.CarUID,
+		DateFrom: dateFrom,
+		DateTo:   dateTo,
+		CarLock:  lock,
+	}, nil
+}
+
+type CarReservationsDTO struct {
+	Items []CarReservationDTO `json:"items"`
+	Count uint64              `json:"count"`
+	Next  string              `json:"next,omitempty"`
+	Prev  string              `json:"prev,omitempty"`
+}
+
+func NewCarReservationsDTO(reservations []models.CarReservation, info pagination.Page) CarReservationsDTO {
+	items := make([]CarReservationDTO, 0, len(reservations))
+
+	for _, reservation := range reservations {
+		items = append(items, NewCarReservationDTO(reservation))
+	}
+
+	dto := CarReservationsDTO{
+		Items: items,
+		Count: info.TotalCount,
+	}
+
+	if info.Next != nil {
+		dto.Next = info.Next.String()
+	}
+
+	if info.Prev != nil {
+		dto.Prev = info.Prev.String()
+	}
+
+	return dto
+}
+
+func (reservations CarReservationsDTO) ToModel() ([]models.CarReservation, pagination.Page, error) {
+	model := make([]models.CarReservation, 0, len(reservations.Items))
+
+	for _, dto := range reservations.Items {
+		reservation, err := dto.ToModel()
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+
+		model = append(model, reservation)
+	}
+
+	info := pagination.Page{TotalCount: reservations.Count}
+
+	if reservations.Next != "" {
+		next, err := pagination.ParseCursor(reservations.Next)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+
+		info.Next = &next
+	}
+
+	if reservations.Prev != "" {
+		prev, err := pagination.ParseCursor(reservations.Prev)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+
+		info.Prev = &prev
+	}
+
+	return model, info, nil
 }
@@ -11,6 +11,13 @@ func (e CarError) Map() map[string]any {
 }
 
 const (
-	ErrCarNotFound    CarError = "car not found"
-	ErrCarAlreadyRent CarError = "car already rent"
+	ErrCarNotFound         CarError = "car not found"
+	ErrCarAlreadyRent      CarError = "car already rent"
+	ErrInvalidPeriod       CarError = "invalid reservation period"
+	ErrInvalidPage         CarError = "invalid page request"
+	ErrInvalidLock         CarError = "invalid car lock"
+	ErrInvalidRentalUID    CarError = "invalid rental uid"
+	ErrReservationNotFound CarError = "car reservation not found"
+	ErrLeaseNotFound       CarError = "car lock of the owner not found or expired"
+	ErrCarLockNotOwned     CarError = "car locked by another holder"
 )
@@ -0,0 +1,453 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/car/usecase"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/google/uuid"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConformanceSuite holds the behaviour every repository implementation must have.
+type ConformanceSuite struct {
+	suite.Suite
+	repo   usecase.Repository
+	newCar func(t provider.T) string
+}
+
+// lockConcurrently starts the lock attempts at once and returns the owners of the successful ones.
+func (s *ConformanceSuite) lockConcurrently(t provider.T, carUID string, periods [][2]time.Time) []string {
+	ctx := context.Background()
+	start := make(chan struct{})
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		winners []string
+		errs    []error
+	)
+
+	for i, period := range periods {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			owner := "flow-" + strconv.Itoa(i)
+			<-start
+
+			_, found, success, err := s.repo.LockCar(ctx, carUID, period[0], period[1], models.CarLock{Owner: owner})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, err)
+			} else if found && success {
+				winners = append(winners, owner)
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	t.Require().Empty(errs)
+
+	return winners
+}
+
+func (s *ConformanceSuite) TestConcurrentLockSamePeriod(t provider.T) {
+	t.Epic("Car locks")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	const attempts = 16
+
+	carUID := s.newCar(t)
+	from := time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+	periods := make([][2]time.Time, attempts)
+
+	for i := range periods {
+		periods[i] = [2]time.Time{from, from.AddDate(0, 0, 3)}
+	}
+	// act
+	winners := s.lockConcurrently(t, carUID, periods)
+	// assert
+	t.Require().Len(winners, 1)
+
+	held := s.reservations(t, carUID)
+	t.Require().Len(held, 1)
+	t.Require().Equal(winners[0], held[0].Owner)
+}
+
+func (s *ConformanceSuite) TestConcurrentLockOverlappingPeriods(t provider.T) {
+	t.Epic("Car locks")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	const attempts = 16
+
+	carUID := s.newCar(t)
+	from := time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)
+	periods := make([][2]time.Time, attempts)
+
+	for i := range periods {
+		dateFrom := from.Add(time.Duration(i) * time.Hour) // every period overlaps all the others
+		periods[i] = [2]time.Time{dateFrom, dateFrom.AddDate(0, 0, 2)}
+	}
+	// act
+	winners := s.lockConcurrently(t, carUID, periods)
+	// assert
+	t.Require().Len(winners, 1)
+}
+
+func (s *ConformanceSuite) TestConcurrentLockDisjointPeriods(t provider.T) {
+	t.Epic("Car locks")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	const attempts = 8
+
+	carUID := s.newCar(t)
+	from := time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC)
+	periods := make([][2]time.Time, attempts)
+
+	for i := range periods {
+		dateFrom := from.AddDate(0, 0, 2*i)
+		periods[i] = [2]time.Time{dateFrom, dateFrom.AddDate(0, 0, 1)}
+	}
+	// act
+	winners := s.lockConcurrently(t, carUID, periods)
+	// assert
+	t.Require().Len(winners, attempts)
+}
+
+func (s *ConformanceSuite) TestLockUnknownCar(t provider.T) {
+	t.Epic("Car locks")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	from := time.Date(2030, 4, 1, 0, 0, 0, 0, time.UTC)
+	// act
+	_, found, success, err := s.repo.LockCar(context.Background(), uuid.NewString(), from, from.AddDate(0, 0, 1), models.CarLock{})
+	// assert
+	t.Require().NoError(err)
+	t.Require().False(found)
+	t.Require().False(success)
+}
+
+func (s *ConformanceSuite) TestAttachRental(t provider.T) {
+	t.Epic("Car locks")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	carUID := s.newCar(t)
+	from := time.Date(2030, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	rentalUID := uuid.NewString()
+	expiresAt := time.Date(2030, 4, 30, 12, 0, 0, 0, time.UTC)
+
+	_, _, success, err := s.repo.LockCar(ctx, carUID, from, to, models.CarLock{Owner: "flow", ExpiresAt: expiresAt})
+	t.Require().NoError(err)
+	t.Require().True(success)
+	// act
+	found, err := s.repo.AttachRental(ctx, carUID, from, to, rentalUID)
+	t.Require().NoError(err)
+	repeated, err := s.repo.AttachRental(ctx, carUID, from, to, rentalUID)
+	t.Require().NoError(err)
+	other, err := s.repo.AttachRental(ctx, carUID, from, to, uuid.NewString())
+	t.Require().NoError(err)
+	// assert
+	t.Require().True(found)
+	t.Require().True(repeated)
+	t.Require().False(other)
+
+	held := s.reservations(t, carUID)
+	t.Require().Len(held, 1)
+	t.Require().Equal(models.CarLock{RentalUID: rentalUID, Owner: "flow", ExpiresAt: expiresAt}, models.CarLock{
+		RentalUID: held[0].RentalUID,
+		Owner:     held[0].Owner,
+		ExpiresAt: held[0].ExpiresAt.UTC(),
+	})
+}
+
+func (s *ConformanceSuite) TestUnlockChecksHolder(t provider.T) {
+	t.Epic("Car locks")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	carUID := s.newCar(t)
+	from := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	rentalUID := uuid.NewString()
+
+	_, _, success, err := s.repo.LockCar(ctx, carUID, from, to, models.CarLock{Owner: "flow"})
+	t.Require().NoError(err)
+	t.Require().True(success)
+	found, err := s.repo.AttachRental(ctx, carUID, from, to, rentalUID)
+	t.Require().NoError(err)
+	t.Require().True(found)
+	// act
+	_, other, _, err := s.repo.UnlockCar(ctx, carUID, from, to, "other-flow")
+	t.Require().NoError(err)
+	_, anonymous, _, err := s.repo.UnlockCar(ctx, carUID, from, to, "")
+	t.Require().NoError(err)
+	held := s.reservations(t, carUID)
+	_, byRental, changed, err := s.repo.UnlockCar(ctx, carUID, from, to, rentalUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().False(other)
+	t.Require().False(anonymous)
+	t.Require().Len(held, 1)
+	t.Require().True(byRental)
+	t.Require().True(changed)
+	t.Require().Empty(s.reservations(t, carUID))
+}
+
+func (s *ConformanceSuite) TestOwnerlessLockIsReleasedOnlyByForce(t provider.T) {
+	t.Epic("Car locks")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	carUID := s.newCar(t)
+	from := time.Date(2030, 7, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	_, _, success, err := s.repo.LockCar(ctx, carUID, from, to, models.CarLock{})
+	t.Require().NoError(err)
+	t.Require().True(success)
+	// act
+	_, anonymous, _, err := s.repo.UnlockCar(ctx, carUID, from, to, "")
+	t.Require().NoError(err)
+	_, other, _, err := s.repo.UnlockCar(ctx, carUID, from, to, "other-flow")
+	t.Require().NoError(err)
+	held := s.reservations(t, carUID)
+	found, changed, err := s.repo.ForceUnlockCar(ctx, carUID, from, to)
+	t.Require().NoError(err)
+	// assert
+	t.Require().False(anonymous)
+	t.Require().False(other)
+	t.Require().Len(held, 1)
+	t.Require().True(found)
+	t.Require().True(changed)
+	t.Require().Empty(s.reservations(t, carUID))
+}
+
+func (s *ConformanceSuite) TestUnlockReportsOutcome(t provider.T) {
+	t.Epic("Car locks")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	carUID := s.newCar(t)
+	from := time.Date(2030, 8, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	_, _, success, err := s.repo.LockCar(ctx, carUID, from, to, models.CarLock{Owner: "flow"})
+	t.Require().NoError(err)
+	t.Require().True(success)
+	// act
+	found, allowed, changed, err := s.repo.UnlockCar(ctx, carUID, from, to, "flow")
+	t.Require().NoError(err)
+	repeatFound, repeatAllowed, repeatChanged, err := s.repo.UnlockCar(ctx, carUID, from, to, "flow")
+	t.Require().NoError(err)
+	unknownFound, _, _, err := s.repo.UnlockCar(ctx, uuid.NewString(), from, to, "flow")
+	t.Require().NoError(err)
+	// assert
+	t.Require().True(found)
+	t.Require().True(allowed)
+	t.Require().True(changed)
+	t.Require().True(repeatFound)
+	t.Require().True(repeatAllowed)
+	t.Require().False(repeatChanged)
+	t.Require().False(unknownFound)
+}
+
+func (s *ConformanceSuite) TestRenewAndReleaseExpiredLocks(t provider.T) {
+	t.Epic("Car locks")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	carUID := s.newCar(t)
+	now := time.Now()
+	from := time.Date(2030, 7, 1, 0, 0, 0, 0, time.UTC)
+	periods := [][2]time.Time{
+		{from, from.AddDate(0, 0, 1)},                  // expired
+		{from.AddDate(0, 0, 2), from.AddDate(0, 0, 3)}, // expired, but attached to a rental
+		{from.AddDate(0, 0, 4), from.AddDate(0, 0, 5)}, // renewed
+	}
+
+	for _, period := range periods {
+		_, _, success, err := s.repo.LockCar(ctx, carUID, period[0], period[1], models.CarLock{Owner: "flow", ExpiresAt: now.Add(time.Second)})
+		t.Require().NoError(err)
+		t.Require().True(success)
+	}
+
+	found, err := s.repo.AttachRental(ctx, carUID, periods[1][0], periods[1][1], uuid.NewString())
+	t.Require().NoError(err)
+	t.Require().True(found)
+	renewed, err := s.repo.RenewLock(ctx, carUID, periods[2][0], periods[2][1], "flow", now.Add(time.Hour))
+	t.Require().NoError(err)
+	t.Require().True(renewed)
+	notOwned, err := s.repo.RenewLock(ctx, carUID, periods[2][0], periods[2][1], "other-flow", now.Add(time.Hour))
+	t.Require().NoError(err)
+	t.Require().False(notOwned)
+	// act
+	expired, err := s.repo.GetExpiredLocks(ctx, now.Add(time.Minute), pagination.MaxLimit)
+	t.Require().NoError(err)
+
+	for _, reservation := range expired {
+		if reservation.CarUID == carUID {
+			released, err := s.repo.ReleaseExpiredLock(ctx, reservation, now.Add(time.Minute))
+			t.Require().NoError(err)
+			t.Require().True(released)
+		}
+	}
+	// assert
+	held := s.reservations(t, carUID)
+	t.Require().Len(held, 2)
+	t.Require().Equal(periods[1][0], held[0].DateFrom.UTC())
+	t.Require().Equal(periods[2][0], held[1].DateFrom.UTC())
+}
+
+func (s *ConformanceSuite) reservations(t provider.T, carUID string) []models.CarReservation {
+	res := make([]models.CarReservation, 0)
+	page := pagination.Request{Limit: pagination.MaxLimit}
+
+	for {
+		reservations, info, err := s.repo.GetReservations(context.Background(), page)
+		t.Require().NoError(err)
+
+		for _, reservation := range reservations {
+			if reservation.CarUID == carUID {
+				res = append(res, reservation)
+			}
+		}
+
+		if info.Next == nil {
+			return res
+		}
+
+		page.Cursor = info.Next
+	}
+}
+
+func (s *ConformanceSuite) TestGetCarsAvailability(t provider.T) {
+	t.Epic("Cars")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	carUID := s.newCar(t)
+	from := time.Date(2030, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 2)
+
+	_, before, err := s.repo.GetCars(ctx, pagination.Request{Limit: 1}, false, from, to)
+	t.Require().NoError(err)
+	_, _, success, err := s.repo.LockCar(ctx, carUID, from, to, models.CarLock{Owner: "flow"})
+	t.Require().NoError(err)
+	t.Require().True(success)
+	// act
+	_, after, err := s.repo.GetCars(ctx, pagination.Request{Limit: 1}, false, from, to)
+	t.Require().NoError(err)
+	all := s.cars(t, true, from, to)
+	adjacent := s.cars(t, false, to, to.AddDate(0, 0, 1))
+	// assert
+	t.Require().Equal(before.TotalCount-1, after.TotalCount)
+	t.Require().Contains(all, carUID)
+	t.Require().False(all[carUID].Availability)
+	t.Require().Contains(adjacent, carUID)
+	t.Require().True(adjacent[carUID].Availability)
+}
+
+func (s *ConformanceSuite) TestGetCarsPages(t provider.T) {
+	t.Epic("Cars")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	from := time.Date(2030, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	for range 5 {
+		s.newCar(t)
+	}
+	// act
+	ids := make([]int64, 0)
+	page := pagination.Request{Limit: 2}
+
+	var total uint64
+
+	for {
+		cars, info, err := s.repo.GetCars(ctx, page, true, from, to)
+		t.Require().NoError(err)
+
+		for _, car := range cars {
+			ids = append(ids, car.ID)
+		}
+
+		total = info.TotalCount
+		if info.Next == nil {
+			break
+		}
+
+		page.Cursor = info.Next
+	}
+
+	byOffset, offsetInfo, err := s.repo.GetCars(ctx, pagination.Request{Offset: 1, Limit: 2}, true, from, to)
+	t.Require().NoError(err)
+	second, secondInfo, err := s.repo.GetCars(ctx, pagination.Request{Limit: 2, Cursor: &pagination.Cursor{ID: ids[1]}}, true, from, to)
+	t.Require().NoError(err)
+	first, _, err := s.repo.GetCars(ctx, pagination.Request{Limit: 2, Cursor: secondInfo.Prev}, true, from, to)
+	t.Require().NoError(err)
+	// assert
+	t.Require().Len(ids, int(total))
+	t.Require().True(slices.IsSorted(ids))
+	t.Require().Equal(ids[1:3], carIDs(byOffset))
+	t.Require().NotNil(offsetInfo.Prev)
+	t.Require().Equal(ids[2:4], carIDs(second))
+	t.Require().Equal(ids[0:2], carIDs(first))
+}
+
+// cars returns the cars of all pages by uid.
+func (s *ConformanceSuite) cars(t provider.T, showAll bool, from, to time.Time) map[string]models.Car {
+	res := make(map[string]models.Car)
+	page := pagination.Request{Limit: pagination.MaxLimit}
+
+	for {
+		cars, info, err := s.repo.GetCars(context.Background(), page, showAll, from, to)
+		t.Require().NoError(err)
+
+		for _, car := range cars {
+			res[car.CarUID] = car
+		}
+
+		if info.Next == nil {
+			return res
+		}
+
+		page.Cursor = info.Next
+	}
+}
+
+func carIDs(cars []models.Car) []int64 {
+	ids := make([]int64, 0, len(cars))
+
+	for _, car := range cars {
+		ids = append(ids, car.ID)
+	}
+
+	return ids
+}
@@ -1,6 +1,10 @@
 package repository
 
-import "github.com/Inspirate789/ds-lab2/internal/models"
+import (
+	"database/sql"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"time"
+)
 
 type CarDTO struct {
 	ID                 int64          `db:"id"`
@@ -12,7 +16,6 @@ type CarDTO struct {
 	Price              uint64         `db:"price"`
 	Type               models.CarType `db:"type"`
 	Availability       bool           `db:"availability"`
-	TotalCount         uint64         `db:"total_count"`
 }
 
 func (car CarDTO) ToModel() models.Car {
@@ -31,16 +34,48 @@ func (car CarDTO) ToModel() models.Car {
 
 type CarsDTO []CarDTO
 
-func (cars CarsDTO) ToModel() ([]models.Car, uint64) {
+func (cars CarsDTO) ToModel() []models.Car {
 	result := make([]models.Car, 0, len(cars))
 
 	for _, car := range cars {
 		result = append(result, car.ToModel())
 	}
 
-	if len(cars) != 0 {
-		return result, cars[0].TotalCount
-	} else {
-		return result, 0
+	return result
+}
+
+type CarReservationDTO struct {
+	ID        int64          `db:"id"`
+	CarUID    string         `db:"car_uid"`
+	DateFrom  time.Time      `db:"date_from"`
+	DateTo    time.Time      `db:"date_to"`
+	RentalUID sql.NullString `db:"rental_uid"`
+	Owner     sql.NullString `db:"owner"`
+	ExpiresAt sql.NullTime   `db:"expires_at"`
+}
+
+func (reservation CarReservationDTO) ToModel() models.CarReservation {
+	return models.CarReservation{
+		ID:       reservation.ID,
+		CarUID:   reservation.CarUID,
+		DateFrom: reservation.DateFrom,
+		DateTo:   reservation.DateTo,
+		CarLock: models.CarLock{
+			RentalUID: reservation.RentalUID.String,
+			Owner:     reservation.Owner.String,
+			ExpiresAt: reservation.ExpiresAt.Time,
+		},
+	}
+}
+
+type CarReservationsDTO []CarReservationDTO
+
+func (reservations CarReservationsDTO) ToModel() []models.CarReservation {
+	result := make([]models.CarReservation, 0, len(reservations))
+
+	for _, reservation := range reservations {
+		result = append(result, reservation.ToModel())
 	}
+
+	return result
 }
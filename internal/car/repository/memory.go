@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SeedCars are the cars the migrations insert.
+var SeedCars = []models.Car{{
+	CarUID:             "109b42f3-198d-4c89-9276-a7520a7120ab",
+	Brand:              "Mercedes Benz",
+	Model:              "GLA 250",
+	RegistrationNumber: "ЛО777Х799",
+	Power:              249,
+	Price:              3500,
+	Type:               models.Sedan,
+}}
+
+var errEmptyPeriod = errors.New("empty reservation period")
+
+// MemoryRepository keeps the cars in memory with the semantics of SqlxRepository, for tests and demos
+// without a database. Events are not published.
+type MemoryRepository struct {
+	mu           sync.RWMutex
+	cars         []models.Car // in id order
+	reservations []models.CarReservation
+	lastCarID    int64
+	lastID       int64
+	logger       *slog.Logger
+}
+
+func NewMemoryRepository(cars []models.Car, logger *slog.Logger) *MemoryRepository {
+	r := &MemoryRepository{logger: logger}
+
+	for _, car := range cars {
+		r.AddCar(car)
+	}
+
+	return r
+}
+
+// AddCar stores the car with a new id.
+func (r *MemoryRepository) AddCar(car models.Car) models.Car {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastCarID++
+	car.ID = r.lastCarID
+	r.cars = append(r.cars, car)
+
+	return car
+}
+
+func (r *MemoryRepository) HealthCheck(context.Context) error {
+	return nil
+}
+
+func (r *MemoryRepository) GetCars(_ context.Context, page pagination.Request, showAll bool, from, to time.Time) ([]models.Car, pagination.Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cars := make([]models.Car, 0, len(r.cars))
+
+	for _, car := range r.cars {
+		car.Availability = !r.reserved(car.CarUID, from, to)
+		if showAll || car.Availability {
+			cars = append(cars, car)
+		}
+	}
+
+	id := func(car models.Car) int64 { return car.ID }
+	res, info := pagination.Paginate(pagination.Window(cars, page, id), page, id)
+	info.TotalCount = uint64(len(cars))
+
+	return res, info, nil
+}
+
+func (r *MemoryRepository) GetCar(_ context.Context, carUID string) (models.Car, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.car(carUID)
+	if i < 0 {
+		return models.Car{}, false, nil
+	}
+
+	car := r.cars[i]
+	now := time.Now()
+	car.Availability = !slices.ContainsFunc(r.reservations, func(reservation models.CarReservation) bool {
+		return reservation.CarUID == carUID && !now.Before(reservation.DateFrom) && now.Before(reservation.DateTo)
+	})
+
+	return car, true, nil
+}
+
+func (r *MemoryRepository) LockCar(_ context.Context, carUID string, from, to time.Time, lock models.CarLock) (res models.Car, found, success bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.car(carUID)
+	if i < 0 {
+		return models.Car{}, false, false, nil
+	} else if !from.Before(to) {
+		return models.Car{}, true, false, errEmptyPeriod
+	} else if r.reserved(carUID, from, to) {
+		return models.Car{}, true, false, nil
+	}
+
+	r.lastID++
+	r.reservations = append(r.reservations, models.CarReservation{
+		ID:       r.lastID,
+		CarUID:   carUID,
+		DateFrom: from,
+		DateTo:   to,
+		CarLock:  lock,
+	})
+
+	return r.cars[i], true, true, nil
+}
+
+func (r *MemoryRepository) AttachRental(_ context.Context, carUID string, from, to time.Time, rentalUID string) (found bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.reservation(carUID, from, to)
+	if i < 0 || (r.reservations[i].RentalUID != "" && r.reservations[i].RentalUID != rentalUID) {
+		return false, nil
+	}
+
+	r.reservations[i].RentalUID = rentalUID
+
+	return true, nil
+}
+
+func (r *MemoryRepository) GetReservations(_ context.Context, page pagination.Request) ([]models.CarReservation, pagination.Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id := func(reservation models.CarReservation) int64 { return reservation.ID }
+	res, info := pagination.Paginate(pagination.Window(r.reservations, page, id), page, id)
+	info.TotalCount = uint64(len(r.reservations))
+
+	return res, info, nil
+}
+
+func (r *MemoryRepository) RenewLock(_ context.Context, carUID string, from, to time.Time, owner string, expiresAt time.Time) (found bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.reservation(carUID, from, to)
+	if i < 0 {
+		return false, nil
+	}
+
+	lock := &r.reservations[i].CarLock
+	if lock.Owner == "" || lock.Owner != owner || (!lock.ExpiresAt.IsZero() && !lock.ExpiresAt.After(time.Now())) {
+		return false, nil
+	}
+
+	lock.ExpiresAt = expiresAt
+
+	return true, nil
+}
+
+func (r *MemoryRepository) UnlockCar(_ context.Context, carUID string, from, to time.Time, holder string) (found, allowed, changed bool, err error) {
+	found, allowed, changed = r.unlockCar(carUID, from, to, func(lock models.CarLock) bool { return lock.HeldBy(holder) })
+
+	return found, allowed, changed, nil
+}
+
+func (r *MemoryRepository) ForceUnlockCar(_ context.Context, carUID string, from, to time.Time) (found, changed bool, err error) {
+	found, _, changed = r.unlockCar(carUID, from, to, func(models.CarLock) bool { return true })
+
+	return found, changed, nil
+}
+
+func (r *MemoryRepository) unlockCar(carUID string, from, to time.Time, heldBy func(lock models.CarLock) bool) (found, allowed, changed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.car(carUID) < 0 {
+		return false, false, false
+	}
+
+	i := r.reservation(carUID, from, to)
+	if i < 0 {
+		return true, true, false
+	} else if !heldBy(r.reservations[i].CarLock) {
+		return true, false, false
+	}
+
+	r.reservations = slices.Delete(r.reservations, i, i+1)
+
+	return true, true, true
+}
+
+func (r *MemoryRepository) GetExpiredLocks(_ context.Context, before time.Time, limit uint64) ([]models.CarReservation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]models.CarReservation, 0)
+
+	for _, reservation := range r.reservations {
+		if expiredLock(reservation, before) {
+			res = append(res, reservation)
+		}
+	}
+
+	slices.SortStableFunc(res, func(a, b models.CarReservation) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+
+	return res[:min(uint64(len(res)), limit)], nil
+}
+
+func (r *MemoryRepository) ReleaseExpiredLock(_ context.Context, reservation models.CarReservation, before time.Time) (released bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.reservations, func(held models.CarReservation) bool { return held.ID == reservation.ID })
+	if i < 0 || !expiredLock(r.reservations[i], before) {
+		return false, nil
+	}
+
+	r.reservations = slices.Delete(r.reservations, i, i+1)
+
+	return true, nil
+}
+
+func expiredLock(reservation models.CarReservation, before time.Time) bool {
+	return reservation.RentalUID == "" && !reservation.ExpiresAt.IsZero() && reservation.ExpiresAt.Before(before)
+}
+
+func (r *MemoryRepository) car(carUID string) int {
+	return slices.IndexFunc(r.cars, func(car models.Car) bool { return car.CarUID == carUID })
+}
+
+func (r *MemoryRepository) reservation(carUID string, from, to time.Time) int {
+	return slices.IndexFunc(r.reservations, func(reservation models.CarReservation) bool {
+		return reservation.CarUID == carUID && reservation.DateFrom.Equal(from) && reservation.DateTo.Equal(to)
+	})
+}
+
+// reserved reports whether a reservation of the car overlaps the half-open period.
+func (r *MemoryRepository) reserved(carUID string, from, to time.Time) bool {
+	return slices.ContainsFunc(r.reservations, func(reservation models.CarReservation) bool {
+		return reservation.CarUID == carUID && reservation.DateFrom.Before(to) && from.Before(reservation.DateTo)
+	})
+}
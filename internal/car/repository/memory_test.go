@@ -0,0 +1,32 @@
+package repository_test
+
+import (
+	"github.com/Inspirate789/ds-lab2/internal/car/repository"
+	"github.com/google/uuid"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+type MemoryRepositorySuite struct {
+	ConformanceSuite
+}
+
+func (s *MemoryRepositorySuite) BeforeAll(provider.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	repo := repository.NewMemoryRepository(repository.SeedCars, logger)
+
+	s.repo = repo
+	s.newCar = func(provider.T) string {
+		car := repository.SeedCars[0]
+		car.CarUID = uuid.NewString()
+
+		return repo.AddCar(car).CarUID
+	}
+}
+
+func TestMemoryRepository(t *testing.T) {
+	suite.RunSuite(t, new(MemoryRepositorySuite))
+}
@@ -0,0 +1,72 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/pkg/migrations"
+	"github.com/Inspirate789/ds-lab2/pkg/postgrestest"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+const insertFlaggedCarQuery = `
+	insert into cars(car_uid, brand, model, registration_number, power, price, type, availability)
+	values ($1, 'Mercedes Benz', 'GLA 250', 'ЛО777Х799', 249, 3500, 'SEDAN', $2);
+`
+
+type MigrationsSuite struct {
+	suite.Suite
+	dsn string
+}
+
+func (s *MigrationsSuite) TestReservations(t provider.T) {
+	t.Epic("Cars")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	migrator, err := migrations.New(s.dsn, "../../../migrations/car", logger)
+	t.Require().NoError(err)
+	defer migrator.Close()
+
+	db, err := sqlx.Connect("postgres", s.dsn)
+	t.Require().NoError(err)
+	defer db.Close()
+
+	t.Require().NoError(migrator.Goto(ctx, 1))
+
+	rentedUID, freeUID := uuid.NewString(), uuid.NewString()
+	_, err = db.Exec(insertFlaggedCarQuery, rentedUID, false)
+	t.Require().NoError(err)
+	_, err = db.Exec(insertFlaggedCarQuery, freeUID, true)
+	t.Require().NoError(err)
+	// act
+	upErr := migrator.Goto(ctx, 2)
+
+	var reserved []string
+	reservedErr := db.Select(&reserved, `select car_uid from car_reservations where period @> now();`)
+
+	downErr := migrator.Goto(ctx, 1)
+
+	var rented []string
+	rentedErr := db.Select(&rented, `select car_uid from cars where not availability;`)
+	// assert
+	t.Require().NoError(upErr)
+	t.Require().NoError(reservedErr)
+	t.Require().NoError(downErr)
+	t.Require().NoError(rentedErr)
+	t.Require().Equal([]string{rentedUID}, reserved)
+	t.Require().Equal([]string{rentedUID}, rented)
+}
+
+func TestMigrations(t *testing.T) {
+	suite.RunSuite(t, &MigrationsSuite{dsn: postgrestest.Start(t, "cars")})
+}
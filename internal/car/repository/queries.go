@@ -1,10 +1,56 @@
 package repository
 
 const (
-	// WARNING: when OFFSET is at least as great as the number of rows returned from the base query, no rows are returned.
-	// So we get no full_count, either. If that's a rare case, just run a second query for the count in this case.
-	selectCarsQuery = `select *, count(*) over () as total_count from cars where $3 = true or availability = true offset $1 limit $2;`
-	selectCarQuery  = `select * from cars where car_uid = $1 limit 1;`
-	lockCarQuery    = `update cars set availability = false where car_uid = $1 and availability = true returning *;`
-	unlockCarQuery  = `update cars set availability = true where car_uid = $1;`
+	carsWithAvailability = `
+		select c.*, not exists (
+			select 1 from car_reservations r where r.car_uid = c.car_uid and r.period && tstzrange($2, $3)
+		) as availability
+		from cars c
+	`
+	selectCarsQuery = `
+		select * from (` + carsWithAvailability + `) cars
+		where ($1 = true or availability = true) and id > $4 and id < $5
+		order by id
+		offset $6 limit $7;
+	`
+	selectCarsBackwardQuery = `
+		select * from (` + carsWithAvailability + `) cars
+		where ($1 = true or availability = true) and id > $4 and id < $5
+		order by id desc
+		offset $6 limit $7;
+	`
+	countCarsQuery = `select count(*) from (` + carsWithAvailability + `) cars where $1 = true or availability = true;`
+	selectCarQuery = `
+		select c.*, not exists (
+			select 1 from car_reservations r where r.car_uid = c.car_uid and r.period @> now()
+		) as availability
+		from cars c
+		where car_uid = $1
+		limit 1;
+	`
+	selectCarForUpdateQuery         = `select *, false as availability from cars where car_uid = $1 limit 1 for update;`
+	reservationsQuery               = `select id, car_uid, lower(period) as date_from, upper(period) as date_to, rental_uid, owner, expires_at from car_reservations`
+	selectReservationsQuery         = reservationsQuery + ` where id > $1 and id < $2 order by id offset $3 limit $4;`
+	selectReservationsBackwardQuery = reservationsQuery + ` where id > $1 and id < $2 order by id desc offset $3 limit $4;`
+	countReservationsQuery          = `select count(*) from car_reservations;`
+	insertReservationQuery          = `
+		insert into car_reservations(car_uid, period, rental_uid, owner, expires_at)
+		values ($1, tstzrange($2, $3), $4, $5, $6);
+	`
+	selectReservationQuery  = reservationsQuery + ` where car_uid = $1 and period = tstzrange($2, $3) limit 1;`
+	selectExpiredLocksQuery = reservationsQuery + `
+		where rental_uid is null and expires_at < $1
+		order by expires_at
+		limit $2;
+	`
+	renewLockQuery = `
+		update car_reservations set expires_at = $5
+		where car_uid = $1 and period = tstzrange($2, $3) and owner = $4 and (expires_at is null or expires_at > now());
+	`
+	deleteReservationByIDQuery = `delete from car_reservations where id = $1;`
+	deleteExpiredLockQuery     = `delete from car_reservations where id = $1 and rental_uid is null and expires_at < $2;`
+	attachRentalQuery          = `
+		update car_reservations set rental_uid = $4
+		where car_uid = $1 and period = tstzrange($2, $3) and (rental_uid is null or rental_uid = $4);
+	`
 )
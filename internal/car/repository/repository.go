@@ -5,17 +5,21 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/outbox"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/Inspirate789/ds-lab2/pkg/sqlxutils"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"log/slog"
+	"time"
 )
 
 type SqlxRepository struct {
-	db     *sqlx.DB
+	db     *sqlxutils.DB
 	logger *slog.Logger
 }
 
-func NewSqlxRepository(db *sqlx.DB, logger *slog.Logger) *SqlxRepository {
+func NewSqlxRepository(db *sqlxutils.DB, logger *slog.Logger) *SqlxRepository {
 	return &SqlxRepository{
 		db:     db,
 		logger: logger,
@@ -26,19 +30,28 @@ func (r *SqlxRepository) HealthCheck(ctx context.Context) error {
 	return r.db.PingContext(ctx)
 }
 
-func (r *SqlxRepository) GetCars(ctx context.Context, offset, limit uint64, showAll bool) ([]models.Car, uint64, error) {
+func (r *SqlxRepository) GetCars(ctx context.Context, page pagination.Request, showAll bool, from, to time.Time) ([]models.Car, pagination.Page, error) {
+	query := selectCarsQuery
+	if page.Backward() {
+		query = selectCarsBackwardQuery
+	}
+
+	after, before := page.Bounds()
 	cars := make(CarsDTO, 0)
 
-	err := sqlxutils.Select(ctx, r.db, &cars, selectCarsQuery, offset, limit, showAll)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, 0, nil
-	} else if err != nil {
-		return nil, 0, err
+	err := sqlxutils.Select(ctx, r.db.Reader(), &cars, query, showAll, from, to, after, before, page.Offset, page.Limit+1)
+	if err != nil {
+		return nil, pagination.Page{}, err
 	}
 
-	model, totalCount := cars.ToModel()
+	cars, info := pagination.Paginate(cars, page, func(car CarDTO) int64 { return car.ID })
 
-	return model, totalCount, nil
+	err = sqlxutils.Get(ctx, r.db.Reader(), &info.TotalCount, countCarsQuery, showAll, from, to)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	return cars.ToModel(), info, nil
 }
 
 func (r *SqlxRepository) GetCar(ctx context.Context, carUID string) (models.Car, bool, error) {
@@ -54,36 +67,220 @@ func (r *SqlxRepository) GetCar(ctx context.Context, carUID string) (models.Car,
 	return dto.ToModel(), true, nil
 }
 
-func (r *SqlxRepository) LockCar(ctx context.Context, carUID string) (res models.Car, found, success bool, err error) {
+// LockCar reserves the car for the period. Locks of a car are serialized by its row lock, and the exclusion
+// constraint on the reservations rejects an overlapping period, so of concurrent attempts only one succeeds.
+func (r *SqlxRepository) LockCar(ctx context.Context, carUID string, from, to time.Time, lock models.CarLock) (res models.Car, found, success bool, err error) {
 	var dto CarDTO
 
 	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
-		err = sqlxutils.Get(ctx, r.db, &dto, selectCarQuery, carUID)
+		found = false // the transaction may be run again
+
+		err := sqlxutils.Get(ctx, tx, &dto, selectCarForUpdateQuery, carUID)
 		if errors.Is(err, sql.ErrNoRows) {
-			err = nil
 			return nil
 		} else if err != nil {
 			return err
-		} else {
-			found = true
 		}
 
-		return sqlxutils.Get(ctx, r.db, &dto, lockCarQuery, carUID)
+		found = true
+
+		_, err = sqlxutils.Exec(ctx, tx, insertReservationQuery, carUID, from, to,
+			nullString(lock.RentalUID), nullString(lock.Owner), sql.NullTime{Time: lock.ExpiresAt, Valid: !lock.ExpiresAt.IsZero()},
+		)
+		if err != nil {
+			return err
+		}
+
+		return writeLockEvent(ctx, tx, models.EventCarLocked, carUID, from, to)
 	})
-	if errors.Is(err, sql.ErrNoRows) {
-		err = nil
-	} else {
-		success = true
+	if isExclusionViolation(err) {
+		return models.Car{}, true, false, nil
+	} else if err != nil {
+		return models.Car{}, found, false, err
 	}
 
-	return dto.ToModel(), found, success, err
+	return dto.ToModel(), found, found, nil
 }
 
-func (r *SqlxRepository) UnlockCar(ctx context.Context, carUID string) error {
-	_, err := sqlxutils.Exec(ctx, r.db, unlockCarQuery, carUID)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil
+// AttachRental records the rental holding the reservation; a reservation held by another rental is not found.
+func (r *SqlxRepository) AttachRental(ctx context.Context, carUID string, from, to time.Time, rentalUID string) (found bool, err error) {
+	res, err := sqlxutils.Exec(ctx, r.db, attachRentalQuery, carUID, from, to, rentalUID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsCount, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsCount != 0, nil
+}
+
+func (r *SqlxRepository) GetReservations(ctx context.Context, page pagination.Request) ([]models.CarReservation, pagination.Page, error) {
+	query := selectReservationsQuery
+	if page.Backward() {
+		query = selectReservationsBackwardQuery
+	}
+
+	after, before := page.Bounds()
+	reservations := make(CarReservationsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db.Reader(), &reservations, query, after, before, page.Offset, page.Limit+1)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	reservations, info := pagination.Paginate(reservations, page, func(reservation CarReservationDTO) int64 { return reservation.ID })
+
+	err = sqlxutils.Get(ctx, r.db.Reader(), &info.TotalCount, countReservationsQuery)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	return reservations.ToModel(), info, nil
+}
+
+// RenewLock extends the lease of the owner on the reservation; an expired lease cannot be renewed.
+func (r *SqlxRepository) RenewLock(ctx context.Context, carUID string, from, to time.Time, owner string, expiresAt time.Time) (found bool, err error) {
+	res, err := sqlxutils.Exec(ctx, r.db, renewLockQuery, carUID, from, to, owner, sql.NullTime{Time: expiresAt, Valid: !expiresAt.IsZero()})
+	if err != nil {
+		return false, err
+	}
+
+	rowsCount, err := res.RowsAffected()
+	if err != nil {
+		return false, err
 	}
 
-	return err
+	return rowsCount != 0, nil
+}
+
+// UnlockCar releases the reservation if the holder, the lock owner or the rental, holds it.
+// A car not reserved for the period is reported as unchanged.
+func (r *SqlxRepository) UnlockCar(ctx context.Context, carUID string, from, to time.Time, holder string) (found, allowed, changed bool, err error) {
+	return r.unlockCar(ctx, carUID, from, to, func(lock models.CarLock) bool { return lock.HeldBy(holder) })
+}
+
+// ForceUnlockCar releases the reservation whoever holds it, including the reservations with no holder recorded.
+func (r *SqlxRepository) ForceUnlockCar(ctx context.Context, carUID string, from, to time.Time) (found, changed bool, err error) {
+	found, _, changed, err = r.unlockCar(ctx, carUID, from, to, func(models.CarLock) bool { return true })
+
+	return found, changed, err
+}
+
+func (r *SqlxRepository) unlockCar(ctx context.Context, carUID string, from, to time.Time, heldBy func(lock models.CarLock) bool) (found, allowed, changed bool, err error) {
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		found, allowed, changed = false, false, false // the transaction may be run again
+
+		var (
+			car         CarDTO
+			reservation CarReservationDTO
+		)
+
+		// Lock the car as LockCar does, so the events of the car are written in the order of the changes
+		err := sqlxutils.Get(ctx, tx, &car, selectCarForUpdateQuery, carUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		found = true
+
+		err = sqlxutils.Get(ctx, tx, &reservation, selectReservationQuery, carUID, from, to)
+		if errors.Is(err, sql.ErrNoRows) {
+			allowed = true
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		allowed = heldBy(reservation.ToModel().CarLock)
+		if !allowed {
+			return nil
+		}
+
+		_, err = sqlxutils.Exec(ctx, tx, deleteReservationByIDQuery, reservation.ID)
+		if err != nil {
+			return err
+		}
+
+		changed = true
+
+		return writeLockEvent(ctx, tx, models.EventCarUnlocked, carUID, from, to)
+	})
+	if err != nil {
+		return false, false, false, err
+	}
+
+	return found, allowed, changed, nil
+}
+
+func (r *SqlxRepository) GetExpiredLocks(ctx context.Context, before time.Time, limit uint64) ([]models.CarReservation, error) {
+	reservations := make(CarReservationsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db, &reservations, selectExpiredLocksQuery, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return reservations.ToModel(), nil
+}
+
+// ReleaseExpiredLock deletes the reservation unless it has been attached to a rental or renewed meanwhile.
+func (r *SqlxRepository) ReleaseExpiredLock(ctx context.Context, reservation models.CarReservation, before time.Time) (released bool, err error) {
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		released = false // the transaction may be run again
+
+		var car CarDTO
+
+		err := sqlxutils.Get(ctx, tx, &car, selectCarForUpdateQuery, reservation.CarUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		res, err := sqlxutils.Exec(ctx, tx, deleteExpiredLockQuery, reservation.ID, before)
+		if err != nil {
+			return err
+		}
+
+		rowsCount, err := res.RowsAffected()
+		if err != nil || rowsCount == 0 {
+			return err
+		}
+
+		released = true
+
+		return writeLockEvent(ctx, tx, models.EventCarUnlocked, reservation.CarUID, reservation.DateFrom, reservation.DateTo)
+	})
+
+	return released, err
+}
+
+func writeLockEvent(ctx context.Context, tx *sqlx.Tx, eventType, carUID string, from, to time.Time) error {
+	return outbox.Write(ctx, tx, outbox.Event{
+		AggregateType: models.AggregateCar,
+		AggregateUID:  carUID,
+		Type:          eventType,
+		Payload: models.CarLockEvent{
+			CarUID:   carUID,
+			DateFrom: from,
+			DateTo:   to,
+		},
+	})
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func isExclusionViolation(err error) bool {
+	const exclusionViolation = "23P01"
+
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == exclusionViolation
 }
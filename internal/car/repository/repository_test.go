@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"github.com/Inspirate789/ds-lab2/internal/car/repository"
+	"github.com/Inspirate789/ds-lab2/pkg/migrations"
+	"github.com/Inspirate789/ds-lab2/pkg/postgrestest"
+	"github.com/Inspirate789/ds-lab2/pkg/sqlxutils"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+const insertCarQuery = `
+	insert into cars(car_uid, brand, model, registration_number, power, price, type)
+	values ($1, 'Mercedes Benz', 'GLA 250', 'ЛО777Х799', 249, 3500, 'SEDAN');
+`
+
+type SqlxRepositorySuite struct {
+	ConformanceSuite
+	dsn string
+	db  *sqlx.DB
+}
+
+func (s *SqlxRepositorySuite) BeforeAll(t provider.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	err := migrations.Do(s.dsn, "../../../migrations/car", logger)
+	t.Require().NoError(err)
+
+	s.db, err = sqlx.Connect("postgres", s.dsn)
+	t.Require().NoError(err)
+
+	s.repo = repository.NewSqlxRepository(sqlxutils.NewDB(s.db, nil), logger)
+	s.newCar = func(t provider.T) string {
+		carUID := uuid.NewString()
+
+		_, err := s.db.Exec(insertCarQuery, carUID)
+		t.Require().NoError(err)
+
+		return carUID
+	}
+}
+
+func (s *SqlxRepositorySuite) AfterAll(t provider.T) {
+	t.Require().NoError(s.db.Close())
+}
+
+func TestSqlxRepository(t *testing.T) {
+	suite.RunSuite(t, &SqlxRepositorySuite{dsn: postgrestest.Start(t, "cars")})
+}
@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"context"
+	"go.uber.org/multierr"
+	"log/slog"
+	"time"
+)
+
+// RunLeaseSweeper releases the expired car locks which were not attached to a rental,
+// e.g. when the rental flow holding the lock died before creating the rental.
+func (u *UseCase) RunLeaseSweeper(ctx context.Context, interval time.Duration) {
+	if u.leaseTTL <= 0 || interval <= 0 {
+		u.logger.Warn("lease ttl or sweep interval not set, lease expiry disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := u.ReleaseExpiredLocks(ctx, time.Now())
+			if err != nil {
+				u.logger.Error(err.Error())
+			}
+		}
+	}
+}
+
+func (u *UseCase) ReleaseExpiredLocks(ctx context.Context, now time.Time) error {
+	const batchSize = 100
+
+	reservations, err := u.repo.GetExpiredLocks(ctx, now, batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, reservation := range reservations {
+		// the lock may be attached or renewed meanwhile, then it is kept
+		released, releaseErr := u.repo.ReleaseExpiredLock(ctx, reservation, now)
+		if releaseErr != nil {
+			err = multierr.Append(err, releaseErr)
+		} else if released {
+			u.logger.Info("expired car lock released",
+				slog.String("car_uid", reservation.CarUID),
+				slog.String("owner", reservation.Owner),
+				slog.Time("date_from", reservation.DateFrom),
+				slog.Time("date_to", reservation.DateTo),
+			)
+		}
+	}
+
+	return err
+}
@@ -3,26 +3,37 @@ package usecase
 import (
 	"context"
 	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"log/slog"
+	"time"
 )
 
 type Repository interface {
 	HealthCheck(ctx context.Context) error
-	GetCars(ctx context.Context, offset, limit uint64, showAll bool) (res []models.Car, totalCount uint64, err error)
+	GetCars(ctx context.Context, page pagination.Request, showAll bool, from, to time.Time) (res []models.Car, info pagination.Page, err error)
 	GetCar(ctx context.Context, carUID string) (res models.Car, found bool, err error)
-	LockCar(ctx context.Context, carUID string) (res models.Car, found, success bool, err error)
-	UnlockCar(ctx context.Context, carUID string) (err error)
+	LockCar(ctx context.Context, carUID string, from, to time.Time, lock models.CarLock) (res models.Car, found, success bool, err error)
+	AttachRental(ctx context.Context, carUID string, from, to time.Time, rentalUID string) (found bool, err error)
+	RenewLock(ctx context.Context, carUID string, from, to time.Time, owner string, expiresAt time.Time) (found bool, err error)
+	UnlockCar(ctx context.Context, carUID string, from, to time.Time, holder string) (found, allowed, changed bool, err error)
+	ForceUnlockCar(ctx context.Context, carUID string, from, to time.Time) (found, changed bool, err error)
+	GetReservations(ctx context.Context, page pagination.Request) (res []models.CarReservation, info pagination.Page, err error)
+	GetExpiredLocks(ctx context.Context, before time.Time, limit uint64) (res []models.CarReservation, err error)
+	ReleaseExpiredLock(ctx context.Context, reservation models.CarReservation, before time.Time) (released bool, err error)
 }
 
 type UseCase struct {
-	repo   Repository
-	logger *slog.Logger
+	repo     Repository
+	leaseTTL time.Duration
+	logger   *slog.Logger
 }
 
-func New(repo Repository, logger *slog.Logger) *UseCase {
+// New creates the use case; locks not attached to a rental are leased for leaseTTL, zero disables the expiry.
+func New(repo Repository, leaseTTL time.Duration, logger *slog.Logger) *UseCase {
 	return &UseCase{
-		repo:   repo,
-		logger: logger,
+		repo:     repo,
+		leaseTTL: leaseTTL,
+		logger:   logger,
 	}
 }
 
@@ -30,18 +41,64 @@ func (u *UseCase) HealthCheck(ctx context.Context) error {
 	return u.repo.HealthCheck(ctx)
 }
 
-func (u *UseCase) GetCars(ctx context.Context, offset, limit uint64, showAll bool) (res []models.Car, totalCount uint64, err error) {
-	return u.repo.GetCars(ctx, offset, limit, showAll)
+// GetCars reports the availability for [from, to); a zero to probes the single instant from.
+// The delivery rejects an empty or inverted period.
+func (u *UseCase) GetCars(ctx context.Context, page pagination.Request, showAll bool, from, to time.Time) (res []models.Car, info pagination.Page, err error) {
+	if to.IsZero() {
+		to = from.Add(time.Microsecond)
+	}
+
+	return u.repo.GetCars(ctx, page, showAll, from, to)
 }
 
 func (u *UseCase) GetCar(ctx context.Context, carUID string) (res models.Car, found bool, err error) {
 	return u.repo.GetCar(ctx, carUID)
 }
 
-func (u *UseCase) LockCar(ctx context.Context, carUID string) (res models.Car, found, success bool, err error) {
-	return u.repo.LockCar(ctx, carUID)
+func (u *UseCase) LockCar(ctx context.Context, carUID string, from, to time.Time, lock models.CarLock) (res models.Car, found, success bool, err error) {
+	if lock.RentalUID == "" && lock.ExpiresAt.IsZero() && u.leaseTTL > 0 {
+		lock.ExpiresAt = time.Now().Add(u.leaseTTL)
+	}
+
+	return u.repo.LockCar(ctx, carUID, from, to, lock)
+}
+
+// RenewLock extends the lease of the owner for ttl, or the configured lease ttl if it is zero.
+func (u *UseCase) RenewLock(ctx context.Context, carUID string, from, to time.Time, owner string, ttl time.Duration) (found bool, err error) {
+	if ttl <= 0 {
+		ttl = u.leaseTTL
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	return u.repo.RenewLock(ctx, carUID, from, to, owner, expiresAt)
+}
+
+func (u *UseCase) AttachRental(ctx context.Context, carUID string, from, to time.Time, rentalUID string) (found bool, err error) {
+	return u.repo.AttachRental(ctx, carUID, from, to, rentalUID)
+}
+
+func (u *UseCase) UnlockCar(ctx context.Context, carUID string, from, to time.Time, holder string) (found, allowed, changed bool, err error) {
+	return u.repo.UnlockCar(ctx, carUID, from, to, holder)
+}
+
+// ForceUnlockCar releases the reservation whoever holds it, for the repairs of the locks left behind.
+func (u *UseCase) ForceUnlockCar(ctx context.Context, carUID string, from, to time.Time) (found, changed bool, err error) {
+	found, changed, err = u.repo.ForceUnlockCar(ctx, carUID, from, to)
+	if err == nil && changed {
+		u.logger.Warn("car lock released by force",
+			slog.String("car_uid", carUID),
+			slog.Time("date_from", from),
+			slog.Time("date_to", to),
+		)
+	}
+
+	return found, changed, err
 }
 
-func (u *UseCase) UnlockCar(ctx context.Context, carUID string) (err error) {
-	return u.repo.UnlockCar(ctx, carUID)
+func (u *UseCase) GetReservations(ctx context.Context, page pagination.Request) (res []models.CarReservation, info pagination.Page, err error) {
+	return u.repo.GetReservations(ctx, page)
 }
@@ -3,7 +3,9 @@ package gateway_test
 import (
 	"context"
 	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/stretchr/testify/mock"
+	"time"
 )
 
 type carsApiMock struct {
@@ -14,9 +16,9 @@ func (api *carsApiMock) HealthCheck(ctx context.Context) error {
 	return api.Called(ctx).Error(0)
 }
 
-func (api *carsApiMock) GetCars(ctx context.Context, offset, limit uint64, showAll bool) (res []models.Car, totalCount uint64, err error) {
-	args := api.Called(ctx, offset, limit, showAll)
-	return args.Get(0).([]models.Car), args.Get(1).(uint64), args.Error(2)
+func (api *carsApiMock) GetCars(ctx context.Context, page pagination.Request, showAll bool, from, to time.Time) (res []models.Car, info pagination.Page, err error) {
+	args := api.Called(ctx, page, showAll, from, to)
+	return args.Get(0).([]models.Car), args.Get(1).(pagination.Page), args.Error(2)
 }
 
 func (api *carsApiMock) GetCar(ctx context.Context, carUID string) (res models.Car, found bool, err error) {
@@ -24,12 +26,17 @@ func (api *carsApiMock) GetCar(ctx context.Context, carUID string) (res models.C
 	return args.Get(0).(models.Car), args.Bool(1), args.Error(2)
 }
 
-func (api *carsApiMock) LockCar(ctx context.Context, carUID string) (res models.Car, found, success bool, err error) {
-	args := api.Called(ctx, carUID)
+func (api *carsApiMock) LockCar(ctx context.Context, carUID string, from, to time.Time, lock models.CarLock) (res models.Car, found, success bool, err error) {
+	args := api.Called(ctx, carUID, from, to, lock)
 	return args.Get(0).(models.Car), args.Bool(1), args.Bool(2), args.Error(3)
 }
 
-func (api *carsApiMock) UnlockCar(ctx context.Context, carUID string) (err error) {
-	args := api.Called(ctx, carUID)
-	return args.Error(0)
+func (api *carsApiMock) AttachRental(ctx context.Context, carUID string, from, to time.Time, rentalUID string) (found bool, err error) {
+	args := api.Called(ctx, carUID, from, to, rentalUID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (api *carsApiMock) UnlockCar(ctx context.Context, carUID string, from, to time.Time, holder string) (found, allowed, changed bool, err error) {
+	args := api.Called(ctx, carUID, from, to, holder)
+	return args.Bool(0), args.Bool(1), args.Bool(2), args.Error(3)
 }
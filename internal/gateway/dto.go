@@ -1,16 +1,58 @@
 package gateway
 
 import (
+	"github.com/Inspirate789/ds-lab2/internal/gateway/pricing"
 	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"time"
 )
 
 type CarRentalRequest struct {
-	CarUID   string `json:"carUid"`   // UUID
-	DateFrom string `json:"dateFrom"` // ISO 8601
-	DateTo   string `json:"dateTo"`   // ISO 8601
+	CarUID    string `json:"carUid"`              // UUID
+	DateFrom  string `json:"dateFrom"`            // ISO 8601
+	DateTo    string `json:"dateTo"`              // ISO 8601
+	PromoCode string `json:"promoCode,omitempty"` // optional
 }
 
+type PriceItemDTO struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	Amount      int64  `json:"amount"`
+}
+
+type RentalQuoteDTO struct {
+	CarUID         string         `json:"carUid"`
+	DateFrom       string         `json:"dateFrom"`
+	DateTo         string         `json:"dateTo"`
+	Days           uint64         `json:"days"`
+	PricingVersion string         `json:"pricingVersion"`
+	Items          []PriceItemDTO `json:"items"`
+	Total          uint64         `json:"total"`
+}
+
+func NewRentalQuoteDTO(carUID string, dateFrom, dateTo time.Time, quote pricing.Quote) RentalQuoteDTO {
+	items := make([]PriceItemDTO, 0, len(quote.Items))
+
+	for _, item := range quote.Items {
+		items = append(items, PriceItemDTO{
+			Rule:        item.Rule,
+			Description: item.Description,
+			Amount:      item.Amount,
+		})
+	}
+
+	return RentalQuoteDTO{
+		CarUID:         carUID,
+		DateFrom:       dateFrom.Format(time.DateOnly),
+		DateTo:         dateTo.Format(time.DateOnly),
+		Days:           quote.Days,
+		PricingVersion: quote.Version,
+		Items:          items,
+		Total:          quote.Total,
+	}
+}
+
+// CarRentalPayment is the payment of the rental, its price is in major units as the rental prices are.
 type CarRentalPayment struct {
 	PaymentUID string               `json:"paymentUid,omitempty"`
 	Status     models.PaymentStatus `json:"status,omitempty"`
@@ -18,12 +60,13 @@ type CarRentalPayment struct {
 }
 
 type CarRentalResponse struct {
-	RentalUID string              `json:"rentalUid,omitempty"`
-	Status    models.RentalStatus `json:"status,omitempty"`
-	CarUID    string              `json:"carUid,omitempty"`
-	DateFrom  string              `json:"dateFrom,omitempty"`
-	DateTo    string              `json:"dateTo,omitempty"`
-	Payment   CarRentalPayment    `json:"payment,omitempty"`
+	RentalUID      string              `json:"rentalUid,omitempty"`
+	Status         models.RentalStatus `json:"status,omitempty"`
+	CarUID         string              `json:"carUid,omitempty"`
+	DateFrom       string              `json:"dateFrom,omitempty"`
+	DateTo         string              `json:"dateTo,omitempty"`
+	Payment        CarRentalPayment    `json:"payment,omitempty"`
+	PricingVersion string              `json:"pricingVersion,omitempty"`
 }
 
 func NewRentalResponse(rental models.Rental, payment models.Payment) CarRentalResponse {
@@ -36,8 +79,9 @@ func NewRentalResponse(rental models.Rental, payment models.Payment) CarRentalRe
 		Payment: CarRentalPayment{
 			PaymentUID: payment.PaymentUID,
 			Status:     payment.Status,
-			Price:      payment.Price,
+			Price:      uint64(payment.Price.Major()),
 		},
+		PricingVersion: rental.PricingVersion,
 	}
 }
 
@@ -52,7 +96,7 @@ type CarDTO struct {
 	Availability       bool           `json:"available,omitempty"`
 }
 
-func NewCarsDTO(cars []models.Car, page, pageSize, totalCount uint64) map[string]any {
+func NewCarsDTO(cars []models.Car, page, pageSize uint64, info pagination.Page) map[string]any {
 	items := make([]CarDTO, 0, len(cars))
 
 	for _, car := range cars {
@@ -68,12 +112,17 @@ func NewCarsDTO(cars []models.Car, page, pageSize, totalCount uint64) map[string
 		})
 	}
 
-	return map[string]any{
-		"page":          page,
+	res := map[string]any{
 		"pageSize":      pageSize,
-		"totalElements": totalCount,
+		"totalElements": info.TotalCount,
 		"items":         items,
 	}
+
+	if page != 0 {
+		res["page"] = page
+	}
+
+	return res
 }
 
 type RentalCarDTO struct {
@@ -83,6 +132,7 @@ type RentalCarDTO struct {
 	RegistrationNumber string `json:"registrationNumber,omitempty"`
 }
 
+// RentalPayment is a payment of the rental, its price is in major units as the rental prices are.
 type RentalPayment struct {
 	PaymentUID string               `json:"paymentUid,omitempty"`
 	Status     models.PaymentStatus `json:"status,omitempty"`
@@ -90,20 +140,34 @@ type RentalPayment struct {
 }
 
 type RentalDTO struct {
-	RentalUID string              `json:"rentalUid,omitempty"`
-	DateFrom  string              `json:"dateFrom,omitempty"`
-	DateTo    string              `json:"dateTo,omitempty"`
-	Status    models.RentalStatus `json:"status,omitempty"`
-	Car       RentalCarDTO        `json:"car,omitempty"`
-	Payment   RentalPayment       `json:"payment,omitempty"`
+	RentalUID      string              `json:"rentalUid,omitempty"`
+	DateFrom       string              `json:"dateFrom,omitempty"`
+	DateTo         string              `json:"dateTo,omitempty"`
+	PickedUpAt     string              `json:"pickedUpAt,omitempty"`
+	ReturnedAt     string              `json:"returnedAt,omitempty"`
+	Status         models.RentalStatus `json:"status,omitempty"`
+	Car            RentalCarDTO        `json:"car,omitempty"`
+	Payment        RentalPayment       `json:"payment,omitempty"`
+	Surcharge      *RentalPayment      `json:"surcharge,omitempty"`
+	PricingVersion string              `json:"pricingVersion,omitempty"`
 }
 
-func NewRentalDTO(rental models.Rental, car models.Car, payment models.Payment) RentalDTO {
-	return RentalDTO{
-		RentalUID: rental.RentalUID,
-		DateFrom:  rental.DateFrom.Format(time.DateOnly),
-		DateTo:    rental.DateTo.Format(time.DateOnly),
-		Status:    rental.Status,
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func NewRentalDTO(rental models.Rental, car models.Car, payment, surcharge models.Payment) RentalDTO {
+	dto := RentalDTO{
+		RentalUID:  rental.RentalUID,
+		DateFrom:   rental.DateFrom.Format(time.DateOnly),
+		DateTo:     rental.DateTo.Format(time.DateOnly),
+		PickedUpAt: formatTimestamp(rental.PickedUpAt),
+		ReturnedAt: formatTimestamp(rental.ReturnedAt),
+		Status:     rental.Status,
 		Car: RentalCarDTO{
 			CarUID:             car.CarUID,
 			Brand:              car.Brand,
@@ -113,16 +177,27 @@ func NewRentalDTO(rental models.Rental, car models.Car, payment models.Payment)
 		Payment: RentalPayment{
 			PaymentUID: payment.PaymentUID,
 			Status:     payment.Status,
-			Price:      payment.Price,
+			Price:      uint64(payment.Price.Major()),
 		},
+		PricingVersion: rental.PricingVersion,
 	}
+
+	if rental.SurchargePaymentUID != "" {
+		dto.Surcharge = &RentalPayment{
+			PaymentUID: rental.SurchargePaymentUID,
+			Status:     surcharge.Status,
+			Price:      uint64(surcharge.Price.Major()),
+		}
+	}
+
+	return dto
 }
 
-func NewRentalsDTO(rentals []models.Rental, cars map[string]models.Car, payments []models.Payment, _, _, _ uint64) []RentalDTO {
+func NewRentalsDTO(rentals []models.Rental, cars map[string]models.Car, payments []models.Payment, surcharges map[string]models.Payment) []RentalDTO {
 	items := make([]RentalDTO, 0, len(rentals))
 
 	for i := range rentals {
-		items = append(items, NewRentalDTO(rentals[i], cars[rentals[i].CarUID], payments[i]))
+		items = append(items, NewRentalDTO(rentals[i], cars[rentals[i].CarUID], payments[i], surcharges[rentals[i].RentalUID]))
 	}
 
 	return items
@@ -0,0 +1,945 @@
+package gateway_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/gateway"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	paymentProvider "github.com/Inspirate789/ds-lab2/internal/payment/provider"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	username         = "Test Max"
+	carUID           = "109b42f3-198d-4c89-9276-a7520a7120ab"
+	unknownCarUID    = "4f1e7c2a-9b3d-4e85-a6f0-2d8c5b7e9a13"
+	unknownRentalUID = "e1c2f4b0-6d3a-4f7e-9b21-5c8a0d9e7f43"
+)
+
+// day is the midnight (UTC) of the day offset days from today.
+func day(offset int) time.Time {
+	return time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, offset)
+}
+
+func rentalRequest(carUID string, from, to int) gateway.CarRentalRequest {
+	return gateway.CarRentalRequest{
+		CarUID:   carUID,
+		DateFrom: day(from).Format(time.DateOnly),
+		DateTo:   day(to).Format(time.DateOnly),
+	}
+}
+
+type period struct {
+	from, to int // days from today
+}
+
+type e2eCase struct {
+	name     string
+	rental   *period // the car rented before the request
+	setUp    func(env *environment, rentalUID string) error
+	faults   []fault
+	username string // the renter if empty
+	method   string
+	path     string // ":rentalUID" is replaced with the uid of the rental
+	body     any
+	status   int
+	message  string // part of the response body
+	want     state
+	backlog  []string
+	replayed *state // the state once the backlog is replayed, if the case checks it
+}
+
+type E2ESuite struct {
+	suite.Suite
+}
+
+func (s *E2ESuite) run(t provider.T, cases []e2eCase) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	for _, c := range cases {
+		t.WithNewStep(c.name, func(sCtx provider.StepCtx) {
+			// arrange
+			env := newEnvironment(logger)
+
+			var rentalUID string
+			if c.rental != nil {
+				var err error
+				rentalUID, err = env.startRental(username, carUID, day(c.rental.from), day(c.rental.to))
+				sCtx.Require().NoError(err)
+			}
+
+			if c.setUp != nil {
+				sCtx.Require().NoError(c.setUp(env, rentalUID))
+			}
+
+			env.services.inject(c.faults...)
+
+			user := c.username
+			if user == "" {
+				user = username
+			}
+			// act
+			status, body, err := env.do(c.method, strings.ReplaceAll(c.path, ":rentalUID", rentalUID), user, c.body)
+			// assert
+			sCtx.Require().NoError(err)
+			sCtx.Require().Equal(c.status, status, body)
+			sCtx.Require().Contains(body, c.message)
+
+			actual, err := env.state()
+			sCtx.Require().NoError(err)
+			sCtx.Require().Equal(c.want.locks, actual.locks, "car locks")
+			sCtx.Require().ElementsMatch(c.want.rentals, actual.rentals, "rentals")
+			sCtx.Require().ElementsMatch(c.want.payments, actual.payments, "payments")
+			sCtx.Require().ElementsMatch(c.backlog, env.backlog.entries(), "backlog")
+
+			if c.replayed != nil {
+				env.services.inject()
+				sCtx.Require().NoError(env.backlog.replay(env.services))
+
+				actual, err = env.state()
+				sCtx.Require().NoError(err)
+				sCtx.Require().Equal(c.replayed.locks, actual.locks, "car locks after replay")
+				sCtx.Require().ElementsMatch(c.replayed.rentals, actual.rentals, "rentals after replay")
+				sCtx.Require().ElementsMatch(c.replayed.payments, actual.payments, "payments after replay")
+			}
+		})
+	}
+}
+
+func decline(env *environment, _ string) error {
+	env.provider.SetMode(paymentProvider.ModeDecline)
+	return nil
+}
+
+func (s *E2ESuite) TestStartRental(t provider.T) {
+	t.Epic("Rental flows")
+	t.Severity(allure.BLOCKER)
+
+	s.run(t, []e2eCase{{
+		name:    "reserve a car for the future",
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 3, 5),
+		status:  http.StatusOK,
+		message: `"status":"RESERVED"`,
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalReserved}, payments: []models.PaymentStatus{models.PaymentPaid}},
+	}, {
+		name:    "rent a car from today",
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 0, 2),
+		status:  http.StatusOK,
+		message: `"status":"PAID"`,
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalInProgress}, payments: []models.PaymentStatus{models.PaymentPaid}},
+	}, {
+		name:    "rent an unknown car",
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(unknownCarUID, 3, 5),
+		status:  http.StatusNotFound,
+		message: "car not found",
+	}, {
+		name: "rent a locked car",
+		setUp: func(env *environment, _ string) error {
+			_, _, _, err := env.cars.LockCar(context.Background(), carUID, day(3), day(5), models.CarLock{Owner: "another rental"})
+			return err
+		},
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 3, 5),
+		status:  http.StatusLocked,
+		message: "car already rent",
+		want:    state{locks: 1},
+	}, {
+		name:    "payment service is down: car is unlocked",
+		faults:  []fault{down(paymentsHost)},
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 3, 5),
+		status:  http.StatusServiceUnavailable,
+		message: "Payment Service unavailable",
+		backlog: []string{"POST payments/api/v1/payments/authorize"},
+	}, {
+		name:    "rental service is down: payment is voided, car is unlocked",
+		faults:  []fault{down(rentalsHost)},
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 3, 5),
+		status:  http.StatusServiceUnavailable,
+		message: "Rental Service unavailable",
+		want:    state{payments: []models.PaymentStatus{models.PaymentCanceled}},
+		backlog: []string{"POST rentals/api/v1/rentals"},
+	}, {
+		name:   "rental service fails: payment is voided, car is unlocked",
+		faults: []fault{{host: rentalsHost, method: http.MethodPost, path: "/rentals", status: http.StatusInternalServerError}},
+		method: http.MethodPost,
+		path:   "/rental",
+		body:   rentalRequest(carUID, 3, 5),
+		status: http.StatusInternalServerError,
+		want:   state{payments: []models.PaymentStatus{models.PaymentCanceled}},
+	}, {
+		name:    "car lock is lost: rental is canceled, payment is voided",
+		faults:  []fault{{host: carsHost, method: http.MethodPut, path: "/lock/rental", status: http.StatusNotFound}},
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 3, 5),
+		status:  http.StatusInternalServerError,
+		message: "car lock released before the rental was confirmed",
+		want:    state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentCanceled}},
+	}, {
+		name:   "payment service fails to link the rental: rental is canceled, payment is voided, car is unlocked",
+		faults: []fault{{host: paymentsHost, method: http.MethodPut, path: "/rental", status: http.StatusInternalServerError}},
+		method: http.MethodPost,
+		path:   "/rental",
+		body:   rentalRequest(carUID, 3, 5),
+		status: http.StatusInternalServerError,
+		want:   state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentCanceled}},
+	}, {
+		name:    "payment is declined: rental is canceled, payment is voided, car is unlocked",
+		setUp:   decline,
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 3, 5),
+		status:  http.StatusInternalServerError,
+		message: "payment not in authorized state",
+		want:    state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentCanceled}},
+	}, {
+		name:    "car unlock fails on rollback",
+		setUp:   decline,
+		faults:  []fault{{host: carsHost, method: http.MethodDelete, path: "/lock", status: http.StatusForbidden}},
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 3, 5),
+		status:  http.StatusInternalServerError,
+		message: "rollback",
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentCanceled}},
+	}, {
+		name:    "car service is down on attaching the rental: attachment is retried",
+		faults:  []fault{{host: carsHost, method: http.MethodPut, path: "/lock/rental"}},
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 3, 5),
+		status:  http.StatusOK,
+		message: `"status":"RESERVED"`,
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalReserved}, payments: []models.PaymentStatus{models.PaymentPaid}},
+		backlog: []string{"PUT cars/api/v1/cars/:uid/lock/rental"},
+	}, {
+		name: "charge is pending at the provider: payment is reported authorized",
+		setUp: func(env *environment, _ string) error {
+			env.provider.SetMode(paymentProvider.ModePending)
+			return nil
+		},
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 3, 5),
+		status:  http.StatusOK,
+		message: `"status":"AUTHORIZED"`,
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalReserved}, payments: []models.PaymentStatus{models.PaymentAuthorized}},
+	}, {
+		name:    "payment service is down on capture: capture is retried, payment is reported authorized",
+		faults:  []fault{{host: paymentsHost, method: http.MethodPost, path: "/capture"}},
+		method:  http.MethodPost,
+		path:    "/rental",
+		body:    rentalRequest(carUID, 3, 5),
+		status:  http.StatusOK,
+		message: `"status":"AUTHORIZED"`,
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalReserved}, payments: []models.PaymentStatus{models.PaymentAuthorized}},
+		backlog: []string{"POST payments/api/v1/payments/:uid/capture"},
+	}})
+}
+
+func (s *E2ESuite) TestCancelRental(t provider.T) {
+	t.Epic("Rental flows")
+	t.Severity(allure.BLOCKER)
+
+	reserved := state{locks: 1, rentals: []models.RentalStatus{models.RentalReserved}, payments: []models.PaymentStatus{models.PaymentPaid}}
+	canceled := state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentCanceled}}
+
+	s.run(t, []e2eCase{{
+		name:   "cancel a reservation: payment is refunded in full",
+		rental: &period{3, 5},
+		method: http.MethodDelete,
+		path:   "/rental/:rentalUID",
+		status: http.StatusNoContent,
+		want:   canceled,
+	}, {
+		name:   "cancel a started rental: payment is refunded in part",
+		rental: &period{0, 2},
+		method: http.MethodDelete,
+		path:   "/rental/:rentalUID",
+		status: http.StatusNoContent,
+		want:   state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentPartiallyRefunded}},
+	}, {
+		name:    "started rental can't be canceled: car stays locked, payment is not refunded",
+		rental:  &period{0, 2},
+		faults:  []fault{{host: rentalsHost, method: http.MethodPut, path: "/status", status: http.StatusConflict}},
+		method:  http.MethodDelete,
+		path:    "/rental/:rentalUID",
+		status:  http.StatusConflict,
+		message: "rental status transition not allowed",
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalInProgress}, payments: []models.PaymentStatus{models.PaymentPaid}},
+	}, {
+		name:     "cancel a rental of another user",
+		rental:   &period{3, 5},
+		username: "Another User",
+		method:   http.MethodDelete,
+		path:     "/rental/:rentalUID",
+		status:   http.StatusForbidden,
+		message:  "rental not permitted",
+		want:     reserved,
+	}, {
+		name:    "cancel an unknown rental",
+		method:  http.MethodDelete,
+		path:    "/rental/" + unknownRentalUID,
+		status:  http.StatusNotFound,
+		message: "rental not found",
+	}, {
+		name:   "cancel a canceled rental: payment is refunded once",
+		rental: &period{3, 5},
+		setUp: func(env *environment, rentalUID string) error {
+			_, _, err := env.do(http.MethodDelete, "/rental/"+rentalUID, username, nil)
+			return err
+		},
+		method: http.MethodDelete,
+		path:   "/rental/:rentalUID",
+		status: http.StatusNoContent,
+		want:   canceled,
+	}, {
+		name:   "cancel a finished rental",
+		rental: &period{-1, 1},
+		setUp: func(env *environment, rentalUID string) error {
+			_, _, err := env.do(http.MethodPost, "/rental/"+rentalUID+"/finish", username, nil)
+			return err
+		},
+		method:  http.MethodDelete,
+		path:    "/rental/:rentalUID",
+		status:  http.StatusConflict,
+		message: "rental status transition not allowed",
+		want:    state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid}},
+	}, {
+		name:   "refund fails on a late cancellation: a repeated request refunds the payment",
+		rental: &period{0, 2},
+		setUp: func(env *environment, rentalUID string) error {
+			env.services.inject(fault{host: paymentsHost, method: http.MethodPost, path: "/refunds", status: http.StatusInternalServerError})
+			_, _, err := env.do(http.MethodDelete, "/rental/"+rentalUID, username, nil)
+			return err
+		},
+		method: http.MethodDelete,
+		path:   "/rental/:rentalUID",
+		status: http.StatusNoContent,
+		want:   state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentPartiallyRefunded}},
+	}, {
+		name:   "payment service is down on a late cancellation: a repeated and a replayed refund refund once",
+		rental: &period{0, 2},
+		setUp: func(env *environment, rentalUID string) error {
+			env.services.inject(fault{host: paymentsHost, method: http.MethodPost, path: "/refunds"})
+			_, _, err := env.do(http.MethodDelete, "/rental/"+rentalUID, username, nil)
+			return err
+		},
+		method:   http.MethodDelete,
+		path:     "/rental/:rentalUID",
+		status:   http.StatusNoContent,
+		want:     state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentPartiallyRefunded}},
+		backlog:  []string{"POST payments/api/v1/payments/:uid/refunds"},
+		replayed: &state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentPartiallyRefunded}},
+	}, {
+		name:   "car is locked by another holder: rental is canceled, the lock is left to its holder",
+		rental: &period{3, 5},
+		faults: []fault{{host: carsHost, method: http.MethodDelete, path: "/lock", status: http.StatusForbidden}},
+		method: http.MethodDelete,
+		path:   "/rental/:rentalUID",
+		status: http.StatusNoContent,
+		want:   state{locks: 1, rentals: canceled.rentals, payments: canceled.payments},
+	}, {
+		name:     "car service is down: rental is canceled, unlock is retried",
+		rental:   &period{3, 5},
+		faults:   []fault{down(carsHost)},
+		method:   http.MethodDelete,
+		path:     "/rental/:rentalUID",
+		status:   http.StatusServiceUnavailable,
+		message:  "Car Service unavailable",
+		want:     state{locks: 1, rentals: canceled.rentals, payments: canceled.payments},
+		backlog:  []string{"DELETE cars/api/v1/cars/:uid/lock"},
+		replayed: &canceled,
+	}, {
+		name:    "payment is not found",
+		rental:  &period{3, 5},
+		faults:  []fault{{host: paymentsHost, method: http.MethodPut, path: "/status", status: http.StatusNotFound}},
+		method:  http.MethodDelete,
+		path:    "/rental/:rentalUID",
+		status:  http.StatusNotFound,
+		message: "payment not found",
+		want:    reserved,
+	}, {
+		name:    "payment can't be canceled",
+		rental:  &period{3, 5},
+		faults:  []fault{{host: paymentsHost, method: http.MethodPut, path: "/status", status: http.StatusConflict}},
+		method:  http.MethodDelete,
+		path:    "/rental/:rentalUID",
+		status:  http.StatusConflict,
+		message: "payment status change not allowed",
+		want:    reserved,
+	}, {
+		name:     "payment service is down: payment cancellation is retried",
+		rental:   &period{3, 5},
+		faults:   []fault{down(paymentsHost)},
+		method:   http.MethodDelete,
+		path:     "/rental/:rentalUID",
+		status:   http.StatusNoContent,
+		want:     state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentPaid}},
+		backlog:  []string{"PUT payments/api/v1/payments/:uid/status"},
+		replayed: &canceled,
+	}, {
+		name:    "rental can't be canceled: payment is reinstated, car stays locked",
+		rental:  &period{3, 5},
+		faults:  []fault{{host: rentalsHost, method: http.MethodPut, path: "/status", status: http.StatusConflict}},
+		method:  http.MethodDelete,
+		path:    "/rental/:rentalUID",
+		status:  http.StatusConflict,
+		message: "rental status transition not allowed",
+		want:    reserved,
+	}, {
+		name:   "rental service fails: payment is reinstated",
+		rental: &period{3, 5},
+		faults: []fault{{host: rentalsHost, method: http.MethodPut, path: "/status", status: http.StatusInternalServerError}},
+		method: http.MethodDelete,
+		path:   "/rental/:rentalUID",
+		status: http.StatusInternalServerError,
+		want:   reserved,
+	}, {
+		name:     "rental service is down on cancellation: payment is reinstated, the rental stays reserved",
+		rental:   &period{3, 5},
+		faults:   []fault{{host: rentalsHost, method: http.MethodPut, path: "/status"}},
+		method:   http.MethodDelete,
+		path:     "/rental/:rentalUID",
+		status:   http.StatusServiceUnavailable,
+		message:  "Rental Service unavailable",
+		want:     reserved,
+		replayed: &reserved,
+	}, {
+		name:   "payment reinstatement fails on rollback",
+		rental: &period{3, 5},
+		faults: []fault{
+			{host: rentalsHost, method: http.MethodPut, path: "/status", status: http.StatusInternalServerError},
+			{host: paymentsHost, method: http.MethodPost, path: "/reinstate", status: http.StatusInternalServerError},
+		},
+		method:  http.MethodDelete,
+		path:    "/rental/:rentalUID",
+		status:  http.StatusInternalServerError,
+		message: "rollback",
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalReserved}, payments: []models.PaymentStatus{models.PaymentCanceled}},
+	}})
+
+	t.WithNewStep("capture is queued on a late cancellation: authorization is voided", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
+		env.services.inject(fault{host: paymentsHost, method: http.MethodPost, path: "/capture"})
+		rentalUID, err := env.startRental(username, carUID, day(0), day(2))
+		sCtx.Require().NoError(err)
+		env.services.inject()
+		// act
+		status, body, err := env.do(http.MethodDelete, "/rental/"+rentalUID, username, nil)
+		sCtx.Require().NoError(err)
+		canceledState, err := env.state()
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(env.backlog.replay(env.services))
+		replayed, err := env.state()
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().Equal(http.StatusNoContent, status, body)
+		sCtx.Require().Equal(canceled, canceledState)
+		sCtx.Require().Equal(canceled, replayed)
+	})
+}
+
+func (s *E2ESuite) TestFinishRental(t provider.T) {
+	t.Epic("Rental flows")
+	t.Severity(allure.BLOCKER)
+
+	inProgress := state{locks: 1, rentals: []models.RentalStatus{models.RentalInProgress}, payments: []models.PaymentStatus{models.PaymentPaid}}
+
+	s.run(t, []e2eCase{{
+		name:   "return a car on time",
+		rental: &period{-1, 1},
+		method: http.MethodPost,
+		path:   "/rental/:rentalUID/finish",
+		status: http.StatusNoContent,
+		want:   state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid}},
+	}, {
+		name:   "return a car early: unused days are refunded",
+		rental: &period{-1, 3},
+		method: http.MethodPost,
+		path:   "/rental/:rentalUID/finish",
+		status: http.StatusNoContent,
+		want:   state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPartiallyRefunded}},
+	}, {
+		name:   "return a car late: overdue days are charged",
+		rental: &period{-3, -1},
+		method: http.MethodPost,
+		path:   "/rental/:rentalUID/finish",
+		status: http.StatusNoContent,
+		want:   state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid, models.PaymentPaid}},
+	}, {
+		name:    "rental can't be finished: car stays locked",
+		rental:  &period{-1, 1},
+		faults:  []fault{{host: rentalsHost, method: http.MethodPut, path: "/status", status: http.StatusConflict}},
+		method:  http.MethodPost,
+		path:    "/rental/:rentalUID/finish",
+		status:  http.StatusConflict,
+		message: "rental status transition not allowed",
+		want:    inProgress,
+	}, {
+		name:    "car service is down on return: rental is finished, unlock is retried",
+		rental:  &period{-1, 1},
+		faults:  []fault{{host: carsHost, method: http.MethodDelete, path: "/lock"}},
+		method:  http.MethodPost,
+		path:    "/rental/:rentalUID/finish",
+		status:  http.StatusServiceUnavailable,
+		message: "Car Service unavailable",
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid}},
+		backlog: []string{"DELETE cars/api/v1/cars/:uid/lock"},
+	}, {
+		name:    "finish a reservation",
+		rental:  &period{3, 5},
+		method:  http.MethodPost,
+		path:    "/rental/:rentalUID/finish",
+		status:  http.StatusConflict,
+		message: "rental status transition not allowed",
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalReserved}, payments: []models.PaymentStatus{models.PaymentPaid}},
+	}, {
+		name:    "car service is down on a late return: car price fallback",
+		rental:  &period{-3, -1},
+		faults:  []fault{down(carsHost)},
+		method:  http.MethodPost,
+		path:    "/rental/:rentalUID/finish",
+		status:  http.StatusServiceUnavailable,
+		message: "car price unavailable",
+		want:    inProgress,
+	}, {
+		name:    "payment service is down on a late return: rental is finished, surcharge is retried",
+		rental:  &period{-3, -1},
+		faults:  []fault{down(paymentsHost)},
+		method:  http.MethodPost,
+		path:    "/rental/:rentalUID/finish",
+		status:  http.StatusServiceUnavailable,
+		message: "Payment Service unavailable",
+		want:    state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid}},
+		backlog: []string{"POST payments/api/v1/payments"},
+	}, {
+		name:    "surcharge can't be set: surcharge is kept for a repeated request",
+		rental:  &period{-3, -1},
+		faults:  []fault{{host: rentalsHost, method: http.MethodPut, path: "/surcharge", status: http.StatusNotFound}},
+		method:  http.MethodPost,
+		path:    "/rental/:rentalUID/finish",
+		status:  http.StatusInternalServerError,
+		message: "rental not found",
+		want:    state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid, models.PaymentPaid}},
+	}, {
+		name:     "rental service is down on a late return after the rental is finished: surcharge is kept for a repeated request",
+		rental:   &period{-3, -1},
+		faults:   []fault{{host: rentalsHost, method: http.MethodPut, path: "/surcharge"}},
+		method:   http.MethodPost,
+		path:     "/rental/:rentalUID/finish",
+		status:   http.StatusServiceUnavailable,
+		message:  "Rental Service unavailable",
+		want:     state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid, models.PaymentPaid}},
+		replayed: &state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid, models.PaymentPaid}},
+	}, {
+		name:   "surcharge is declined: rental is finished without a charge",
+		rental: &period{-3, -1},
+		faults: []fault{{host: paymentsHost, method: http.MethodPost, path: "/payments", status: http.StatusPaymentRequired}},
+		method: http.MethodPost,
+		path:   "/rental/:rentalUID/finish",
+		status: http.StatusInternalServerError,
+		want:   state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid}},
+	}, {
+		name:    "car service is down on a late return after the price: surcharge is not charged",
+		rental:  &period{-3, -1},
+		faults:  []fault{{host: carsHost, method: http.MethodDelete, path: "/lock"}},
+		method:  http.MethodPost,
+		path:    "/rental/:rentalUID/finish",
+		status:  http.StatusServiceUnavailable,
+		message: "Car Service unavailable",
+		want:    state{locks: 1, rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid}},
+		backlog: []string{"DELETE cars/api/v1/cars/:uid/lock"},
+	}, {
+		name:   "repeated return: surcharge is charged once",
+		rental: &period{-3, -1},
+		setUp: func(env *environment, rentalUID string) error {
+			_, _, err := env.do(http.MethodPost, "/rental/"+rentalUID+"/finish", username, nil)
+			return err
+		},
+		method: http.MethodPost,
+		path:   "/rental/:rentalUID/finish",
+		status: http.StatusNoContent,
+		want:   state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid, models.PaymentPaid}},
+	}, {
+		name:   "surcharge can't be set: a repeated return attaches the surcharge",
+		rental: &period{-3, -1},
+		setUp: func(env *environment, rentalUID string) error {
+			env.services.inject(fault{host: rentalsHost, method: http.MethodPut, path: "/surcharge", status: http.StatusNotFound})
+			_, _, err := env.do(http.MethodPost, "/rental/"+rentalUID+"/finish", username, nil)
+			return err
+		},
+		method: http.MethodPost,
+		path:   "/rental/:rentalUID/finish",
+		status: http.StatusNoContent,
+		want:   state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid, models.PaymentPaid}},
+	}, {
+		name:   "payment service is down on a late return: a repeated and a replayed surcharge charge once",
+		rental: &period{-3, -1},
+		setUp: func(env *environment, rentalUID string) error {
+			env.services.inject(fault{host: paymentsHost, method: http.MethodPost, path: "/payments"})
+			_, _, err := env.do(http.MethodPost, "/rental/"+rentalUID+"/finish", username, nil)
+			return err
+		},
+		method:   http.MethodPost,
+		path:     "/rental/:rentalUID/finish",
+		status:   http.StatusNoContent,
+		want:     state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid, models.PaymentPaid}},
+		backlog:  []string{"POST payments/api/v1/payments"},
+		replayed: &state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid, models.PaymentPaid}},
+	}, {
+		name:   "refund fails on an early return: a repeated return refunds unused days",
+		rental: &period{-1, 3},
+		setUp: func(env *environment, rentalUID string) error {
+			env.services.inject(fault{host: paymentsHost, method: http.MethodPost, path: "/refunds", status: http.StatusInternalServerError})
+			_, _, err := env.do(http.MethodPost, "/rental/"+rentalUID+"/finish", username, nil)
+			return err
+		},
+		method: http.MethodPost,
+		path:   "/rental/:rentalUID/finish",
+		status: http.StatusNoContent,
+		want:   state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPartiallyRefunded}},
+	}, {
+		name:   "car service is down on return: a repeated return unlocks the car",
+		rental: &period{-1, 1},
+		setUp: func(env *environment, rentalUID string) error {
+			env.services.inject(fault{host: carsHost, method: http.MethodDelete, path: "/lock", status: http.StatusInternalServerError})
+			_, _, err := env.do(http.MethodPost, "/rental/"+rentalUID+"/finish", username, nil)
+			return err
+		},
+		method: http.MethodPost,
+		path:   "/rental/:rentalUID/finish",
+		status: http.StatusNoContent,
+		want:   state{rentals: []models.RentalStatus{models.RentalFinished}, payments: []models.PaymentStatus{models.PaymentPaid}},
+	}, {
+		name:   "finish a canceled rental",
+		rental: &period{3, 5},
+		setUp: func(env *environment, rentalUID string) error {
+			_, _, err := env.do(http.MethodDelete, "/rental/"+rentalUID, username, nil)
+			return err
+		},
+		method:  http.MethodPost,
+		path:    "/rental/:rentalUID/finish",
+		status:  http.StatusConflict,
+		message: "rental status transition not allowed",
+		want:    state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentCanceled}},
+	}})
+}
+
+func (s *E2ESuite) TestExpireReservations(t provider.T) {
+	t.Epic("Rental flows")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	expired := state{rentals: []models.RentalStatus{models.RentalCanceled}, payments: []models.PaymentStatus{models.PaymentCanceled}}
+	reserved := state{locks: 1, rentals: []models.RentalStatus{models.RentalReserved}, payments: []models.PaymentStatus{models.PaymentPaid}}
+
+	t.WithNewStep("no-show is canceled and refunded through the provider", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(logger)
+		rentalUID, err := env.startRental(username, carUID, day(3), day(5))
+		sCtx.Require().NoError(err)
+		// act
+		err = env.expirer.ExpireReservations(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+
+		actual, err := env.state()
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(expired, actual)
+
+		rental, _, err := env.rentals.GetRental(ctx, rentalUID)
+		sCtx.Require().NoError(err)
+		refunds, err := env.payments.GetRefunds(ctx, rental.PaymentUID)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(refunds, 1)
+
+		response, err := env.provider.Status(ctx, refunds[0].RefundUID)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(models.ProviderApproved, response.Status)
+	})
+
+	t.WithNewStep("reservation starting later is kept", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(logger)
+		_, err := env.startRental(username, carUID, day(10), day(12))
+		sCtx.Require().NoError(err)
+		// act
+		err = env.expirer.ExpireReservations(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+
+		actual, err := env.state()
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(reserved, actual)
+	})
+
+	t.WithNewStep("no-show with a capture never landed: authorization is voided", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(logger)
+		env.services.inject(fault{host: paymentsHost, method: http.MethodPost, path: "/capture"})
+		_, err := env.startRental(username, carUID, day(3), day(5))
+		sCtx.Require().NoError(err)
+		env.services.inject()
+		// act
+		err = env.expirer.ExpireReservations(ctx)
+		sCtx.Require().NoError(err)
+		voided, err := env.state()
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(env.backlog.replay(env.services))
+		replayed, err := env.state()
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().Equal(expired, voided)
+		sCtx.Require().Equal(expired, replayed)
+	})
+
+	t.WithNewStep("declined refund keeps the reservation for the next run", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(logger)
+		_, err := env.startRental(username, carUID, day(3), day(5))
+		sCtx.Require().NoError(err)
+		env.provider.SetMode(paymentProvider.ModeDecline)
+		// act
+		declinedErr := env.expirer.ExpireReservations(ctx)
+		declined, err := env.state()
+		sCtx.Require().NoError(err)
+		env.provider.SetMode(paymentProvider.ModeApprove)
+		retriedErr := env.expirer.ExpireReservations(ctx)
+		retried, err := env.state()
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().Error(declinedErr)
+		sCtx.Require().Contains(declinedErr.Error(), "refund not allowed")
+		sCtx.Require().Equal(reserved, declined)
+		sCtx.Require().NoError(retriedErr)
+		sCtx.Require().Equal(expired, retried)
+	})
+
+	t.WithNewStep("rental service is down: the next run cancels the refunded reservation", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(logger)
+		_, err := env.startRental(username, carUID, day(3), day(5))
+		sCtx.Require().NoError(err)
+		env.services.inject(fault{host: rentalsHost, method: http.MethodPut, path: "/status"})
+		// act
+		failedErr := env.expirer.ExpireReservations(ctx)
+		env.services.inject()
+		retriedErr := env.expirer.ExpireReservations(ctx)
+		retried, err := env.state()
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().Error(failedErr)
+		sCtx.Require().NoError(retriedErr)
+		sCtx.Require().Equal(expired, retried)
+	})
+
+	t.WithNewStep("reservation picked up meanwhile: payment is reinstated", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(logger)
+		_, err := env.startRental(username, carUID, day(3), day(5))
+		sCtx.Require().NoError(err)
+		env.services.inject(fault{host: rentalsHost, method: http.MethodPut, path: "/status", status: http.StatusConflict})
+		// act
+		err = env.expirer.ExpireReservations(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+
+		actual, err := env.state()
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(reserved, actual)
+	})
+}
+
+func (s *E2ESuite) TestListCars(t provider.T) {
+	t.Epic("Rental flows")
+	t.Severity(allure.NORMAL)
+
+	reserved := state{locks: 1, rentals: []models.RentalStatus{models.RentalReserved}, payments: []models.PaymentStatus{models.PaymentPaid}}
+
+	s.run(t, []e2eCase{{
+		name:    "list cars available for a period",
+		rental:  &period{3, 5},
+		method:  http.MethodGet,
+		path:    "/cars?from=" + day(7).Format(time.DateOnly) + "&to=" + day(9).Format(time.DateOnly),
+		status:  http.StatusOK,
+		message: `"totalElements":1`,
+		want:    reserved,
+	}, {
+		name:    "list cars for a period overlapping a rental",
+		rental:  &period{3, 5},
+		method:  http.MethodGet,
+		path:    "/cars?from=" + day(4).Format(time.DateOnly) + "&to=" + day(6).Format(time.DateOnly),
+		status:  http.StatusOK,
+		message: `"totalElements":0`,
+		want:    reserved,
+	}, {
+		name:    "list cars for an empty period",
+		method:  http.MethodGet,
+		path:    "/cars?from=" + day(3).Format(time.DateOnly) + "&to=" + day(3).Format(time.DateOnly),
+		status:  http.StatusBadRequest,
+		message: "invalid period",
+	}, {
+		name:    "list cars until a past date",
+		method:  http.MethodGet,
+		path:    "/cars?to=" + day(-1).Format(time.DateOnly),
+		status:  http.StatusBadRequest,
+		message: "invalid period",
+	}})
+}
+
+func (s *E2ESuite) TestFallbacks(t provider.T) {
+	t.Epic("Rental flows")
+	t.Severity(allure.CRITICAL)
+
+	reserved := state{locks: 1, rentals: []models.RentalStatus{models.RentalReserved}, payments: []models.PaymentStatus{models.PaymentPaid}}
+
+	s.run(t, []e2eCase{{
+		name:    "list cars with the car service down",
+		faults:  []fault{down(carsHost)},
+		method:  http.MethodGet,
+		path:    "/cars",
+		status:  http.StatusOK,
+		message: `"items":[]`,
+	}, {
+		name:    "get a rental with the car service down",
+		rental:  &period{3, 5},
+		faults:  []fault{down(carsHost)},
+		method:  http.MethodGet,
+		path:    "/rental/:rentalUID",
+		status:  http.StatusOK,
+		message: `"car":{"carUid":"` + carUID + `"}`,
+		want:    reserved,
+	}, {
+		name:    "get a rental with the payment service down",
+		rental:  &period{3, 5},
+		faults:  []fault{down(paymentsHost)},
+		method:  http.MethodGet,
+		path:    "/rental/:rentalUID",
+		status:  http.StatusOK,
+		message: `"payment":{}`,
+		want:    reserved,
+	}, {
+		name:    "get a rental with the rental service down",
+		rental:  &period{3, 5},
+		faults:  []fault{down(rentalsHost)},
+		method:  http.MethodGet,
+		path:    "/rental/:rentalUID",
+		status:  http.StatusForbidden,
+		message: "rental not permitted",
+		want:    reserved,
+	}, {
+		name:    "quote a rental with the car service down",
+		faults:  []fault{down(carsHost)},
+		method:  http.MethodGet,
+		path:    "/rental/quote?carUid=" + carUID + "&dateFrom=" + day(3).Format(time.DateOnly) + "&dateTo=" + day(5).Format(time.DateOnly),
+		status:  http.StatusServiceUnavailable,
+		message: "car price unavailable",
+	}})
+}
+
+// TestPaymentServiceFailover follows the failover scenario of the API tests: the rental can't be started
+// while the payment service is down, but can be canceled, and the cancellation reaches the service once it is back.
+func (s *E2ESuite) TestPaymentServiceFailover(t provider.T) {
+	t.Epic("Rental flows")
+	t.Severity(allure.BLOCKER)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	env := newEnvironment(logger)
+	request := rentalRequest(carUID, 3, 5)
+
+	t.WithNewStep("start a rental with the payment service down", func(sCtx provider.StepCtx) {
+		// arrange
+		env.services.inject(down(paymentsHost))
+		// act
+		status, body, err := env.do(http.MethodPost, "/rental", username, request)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(http.StatusServiceUnavailable, status, body)
+		sCtx.Require().Contains(body, "Payment Service unavailable")
+	})
+
+	var rentalUID string
+
+	t.WithNewStep("start a rental with the payment service up", func(sCtx provider.StepCtx) {
+		// arrange
+		env.services.inject()
+		// act
+		var err error
+		rentalUID, err = env.startRental(username, request.CarUID, day(3), day(5))
+		// assert
+		sCtx.Require().NoError(err)
+	})
+
+	t.WithNewStep("cancel the rental with the payment service down", func(sCtx provider.StepCtx) {
+		// arrange
+		env.services.inject(down(paymentsHost))
+		// act
+		status, body, err := env.do(http.MethodDelete, "/rental/"+rentalUID, username, nil)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(http.StatusNoContent, status, body)
+		sCtx.Require().Equal([]string{
+			"POST payments/api/v1/payments/authorize",
+			"PUT payments/api/v1/payments/:uid/status",
+		}, env.backlog.entries())
+	})
+
+	t.WithNewStep("get the canceled rental with the payment service down", func(sCtx provider.StepCtx) {
+		// act
+		status, body, err := env.do(http.MethodGet, "/rental/"+rentalUID, username, nil)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(http.StatusOK, status, body)
+		sCtx.Require().Contains(body, `"status":"CANCELED"`)
+		sCtx.Require().Contains(body, `"payment":{}`)
+	})
+
+	t.WithNewStep("get the canceled rental once the backlog is replayed", func(sCtx provider.StepCtx) {
+		// arrange
+		env.services.inject()
+		sCtx.Require().NoError(env.backlog.replay(env.services))
+		// act (the payment is left out until the circuit breaker half-opens)
+		var body string
+		err := poll(3*time.Second, func() (bool, error) {
+			status, resBody, err := env.do(http.MethodGet, "/rental/"+rentalUID, username, nil)
+			if err != nil || status != http.StatusOK {
+				return false, err
+			}
+
+			body = resBody
+
+			return !strings.Contains(body, `"payment":{}`), nil
+		})
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Contains(body, `"payment":{"paymentUid":"`)
+		sCtx.Require().Contains(body, `"status":"CANCELED","price":`)
+	})
+}
+
+func TestE2E(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(E2ESuite))
+}
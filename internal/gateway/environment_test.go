@@ -0,0 +1,375 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	carAPI "github.com/Inspirate789/ds-lab2/internal/car/api"
+	carDelivery "github.com/Inspirate789/ds-lab2/internal/car/delivery"
+	carRepository "github.com/Inspirate789/ds-lab2/internal/car/repository"
+	carUseCase "github.com/Inspirate789/ds-lab2/internal/car/usecase"
+	"github.com/Inspirate789/ds-lab2/internal/gateway"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	paymentAPI "github.com/Inspirate789/ds-lab2/internal/payment/api"
+	paymentDelivery "github.com/Inspirate789/ds-lab2/internal/payment/delivery"
+	paymentProvider "github.com/Inspirate789/ds-lab2/internal/payment/provider"
+	paymentRepository "github.com/Inspirate789/ds-lab2/internal/payment/repository"
+	paymentUseCase "github.com/Inspirate789/ds-lab2/internal/payment/usecase"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	rentalAPI "github.com/Inspirate789/ds-lab2/internal/rental/api"
+	rentalDelivery "github.com/Inspirate789/ds-lab2/internal/rental/delivery"
+	rentalRepository "github.com/Inspirate789/ds-lab2/internal/rental/repository"
+	rentalUseCase "github.com/Inspirate789/ds-lab2/internal/rental/usecase"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	carsHost     = "cars"
+	rentalsHost  = "rentals"
+	paymentsHost = "payments"
+)
+
+var rentalsConfig = app.RentalsConfig{
+	OverduePenalty:     1000,
+	OverdueGracePeriod: time.Hour,
+	Cancellation: app.CancellationPolicy{
+		FreePeriod: 24 * time.Hour,
+		LateRefund: 50,
+	},
+}
+
+// fault answers the matching requests of the gateway clients instead of the service,
+// a zero status makes the service unreachable.
+type fault struct {
+	host   string
+	method string // any method if empty
+	path   string // suffix of the request path, any path if empty
+	status int
+}
+
+func down(host string) fault {
+	return fault{host: host}
+}
+
+func (f fault) matches(req *http.Request) bool {
+	return req.URL.Hostname() == f.host &&
+		(f.method == "" || req.Method == f.method) &&
+		strings.HasSuffix(req.URL.Path, f.path)
+}
+
+func (f fault) response(req *http.Request) (*http.Response, error) {
+	if f.status == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: req.URL.Hostname(), IsNotFound: true}
+	}
+
+	return &http.Response{
+		StatusCode: f.status,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(http.StatusText(f.status))),
+		Request:    req,
+	}, nil
+}
+
+// services passes the requests of the gateway clients to the in-process service apps.
+type services struct {
+	apps   map[string]*app.FiberApp
+	mu     sync.Mutex
+	faults []fault
+}
+
+func (s *services) inject(faults ...fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = faults
+}
+
+func (s *services) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	faults := s.faults
+	s.mu.Unlock()
+
+	for _, f := range faults {
+		if f.matches(req) {
+			return f.response(req)
+		}
+	}
+
+	webApp, found := s.apps[req.URL.Hostname()]
+	if !found {
+		return down(req.URL.Hostname()).response(req)
+	}
+
+	return webApp.Test(req, -1)
+}
+
+var uidPattern = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// backlog keeps the requests pushed by the gateway clients for the retryer.
+type backlog struct {
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (b *backlog) HealthCheck(context.Context) error {
+	return nil
+}
+
+func (b *backlog) Push(_ context.Context, req *http.Request) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.requests = append(b.requests, req)
+
+	return nil
+}
+
+// poll checks the condition until it holds or the timeout expires.
+func poll(timeout time.Duration, condition func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		done, err := condition()
+		if err != nil || done {
+			return err
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("condition not met in " + timeout.String())
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// entries lists the pushed requests as "METHOD host/path" with the uids replaced by ":uid".
+func (b *backlog) entries() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := make([]string, 0, len(b.requests))
+	for _, req := range b.requests {
+		res = append(res, req.Method+" "+req.URL.Host+uidPattern.ReplaceAllString(req.URL.Path, ":uid"))
+	}
+
+	return res
+}
+
+// replay sends the pushed requests again, as the retryer does.
+func (b *backlog) replay(s *services) error {
+	b.mu.Lock()
+	requests := b.requests
+	b.requests = nil
+	b.mu.Unlock()
+
+	for _, req := range requests {
+		retry := req.Clone(context.Background())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+
+			retry.Body = body
+		}
+
+		resp, err := s.RoundTrip(retry)
+		if err != nil {
+			return err
+		}
+
+		_ = resp.Body.Close()
+	}
+
+	return nil
+}
+
+// environment runs the gateway with the cars, rentals and payments services in-process,
+// the services keep their data in memory.
+type environment struct {
+	cars     *carRepository.MemoryRepository
+	rentals  *rentalRepository.MemoryRepository
+	payments *paymentRepository.MemoryRepository
+	provider *paymentProvider.Fake
+	services *services
+	backlog  *backlog
+	expirer  *gateway.ReservationExpirer
+	gateway  *app.FiberApp
+}
+
+// newApp serves the delivery in-process, the apps have no fault rules to reject.
+func newApp(config app.WebConfig, delivery app.Delivery, logger *slog.Logger) *app.FiberApp {
+	webApp, err := app.NewFiberApp(config, delivery, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	return webApp
+}
+
+func newEnvironment(logger *slog.Logger) *environment {
+	env := &environment{
+		cars:     carRepository.NewMemoryRepository(carRepository.SeedCars, logger),
+		rentals:  rentalRepository.NewMemoryRepository(logger),
+		payments: paymentRepository.NewMemoryRepository(logger),
+		provider: paymentProvider.NewFake(paymentProvider.ModeApprove, 0, "", "", nil, logger),
+		backlog:  new(backlog),
+	}
+
+	env.services = &services{
+		apps: map[string]*app.FiberApp{
+			carsHost: newApp(
+				app.WebConfig{PathPrefix: "/api/v1/cars"},
+				carDelivery.New(carUseCase.New(env.cars, time.Minute, logger), logger),
+				logger,
+			),
+			rentalsHost: newApp(
+				app.WebConfig{PathPrefix: "/api/v1/rentals"},
+				rentalDelivery.New(rentalUseCase.New(env.rentals, logger), logger),
+				logger,
+			),
+			paymentsHost: newApp(
+				app.WebConfig{PathPrefix: "/api/v1/payments"},
+				paymentDelivery.New(paymentUseCase.New(env.payments, env.provider, logger), "", logger),
+				logger,
+			),
+		},
+	}
+
+	client := &http.Client{Transport: env.services}
+	cars := carAPI.New("http://"+carsHost, client, env.backlog, 1, logger)
+	rentals := rentalAPI.New("http://"+rentalsHost, client, env.backlog, 1, logger)
+	payments := paymentAPI.New("http://"+paymentsHost, client, env.backlog, 1, logger)
+
+	// a negative grace period expires the reservations starting within it
+	env.expirer = gateway.NewReservationExpirer(cars, rentals, payments, -7*24*time.Hour, logger)
+	env.gateway = newApp(
+		app.WebConfig{PathPrefix: "/api/v1"},
+		gateway.New(cars, rentals, payments, rentalsConfig, logger),
+		logger,
+	)
+
+	return env
+}
+
+// do sends the request to the gateway on behalf of the user.
+func (env *environment) do(method, path, username string, body any) (status int, resBody string, err error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, "", err
+		}
+
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, "http://gateway/api/v1"+path, reqBody)
+	if err != nil {
+		return 0, "", err
+	}
+
+	req.Header.Set("X-User-Name", username)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := env.gateway.Test(req, -1)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return resp.StatusCode, string(data), nil
+}
+
+// startRental rents the car for the period through the gateway.
+func (env *environment) startRental(username, carUID string, from, to time.Time) (rentalUID string, err error) {
+	status, body, err := env.do(http.MethodPost, "/rental", username, gateway.CarRentalRequest{
+		CarUID:   carUID,
+		DateFrom: from.Format(time.DateOnly),
+		DateTo:   to.Format(time.DateOnly),
+	})
+	if err != nil {
+		return "", err
+	} else if status != http.StatusOK {
+		return "", &unexpectedStatusError{status: status, body: body}
+	}
+
+	var res gateway.CarRentalResponse
+
+	err = json.Unmarshal([]byte(body), &res)
+
+	return res.RentalUID, err
+}
+
+type unexpectedStatusError struct {
+	status int
+	body   string
+}
+
+func (e *unexpectedStatusError) Error() string {
+	return http.StatusText(e.status) + ": " + e.body
+}
+
+var allPages = pagination.Request{Limit: pagination.MaxLimit}
+
+// state is what the services keep after a request.
+type state struct {
+	locks    int
+	rentals  []models.RentalStatus
+	payments []models.PaymentStatus
+}
+
+func (env *environment) state() (res state, err error) {
+	ctx := context.Background()
+
+	reservations, _, err := env.cars.GetReservations(ctx, allPages)
+	if err != nil {
+		return state{}, err
+	}
+
+	res.locks = len(reservations)
+
+	rentals, _, err := env.rentals.GetRentals(ctx, allPages)
+	if err != nil {
+		return state{}, err
+	}
+
+	for _, rental := range rentals {
+		res.rentals = append(res.rentals, rental.Status)
+	}
+
+	for _, status := range []models.PaymentStatus{
+		models.PaymentAuthorized,
+		models.PaymentPaid,
+		models.PaymentCanceled,
+		models.PaymentRefunded,
+		models.PaymentPartiallyRefunded,
+	} {
+		payments, _, err := env.payments.GetPayments(ctx, status, allPages)
+		if err != nil {
+			return state{}, err
+		}
+
+		for range payments {
+			res.payments = append(res.payments, status)
+		}
+	}
+
+	return res, nil
+}
@@ -7,7 +7,14 @@ func (e GatewayError) Error() string {
 }
 
 const (
-	ErrInvalidPage GatewayError = "page number must be >= 1"
+	ErrInvalidPage         GatewayError = "page number must be >= 1"
+	ErrInvalidPageSize     GatewayError = "page size must be in [1, 100]"
+	ErrInvalidCursor       GatewayError = "invalid page cursor"
+	ErrRentalNotStarted    GatewayError = "rental period has not started yet"
+	ErrCarPriceUnavailable GatewayError = "car price unavailable"
+	ErrUnknownPromoCode    GatewayError = "unknown promo code"
+	ErrPaymentUnavailable  GatewayError = "payment unavailable"
+	ErrCarLockLost         GatewayError = "car lock released before the rental was confirmed"
 )
 
 // TODO: use errors.Wrap() ?
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"context"
+	carErrors "github.com/Inspirate789/ds-lab2/internal/car/delivery/errors"
+	"github.com/Inspirate789/ds-lab2/internal/gateway/errors"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	paymentErrors "github.com/Inspirate789/ds-lab2/internal/payment/delivery/errors"
+	"go.uber.org/multierr"
+	"log/slog"
+	"time"
+)
+
+// ReservationExpirer cancels reservations which were not picked up within the grace period
+// after the rental start, releasing the car and refunding the payment through the provider.
+type ReservationExpirer struct {
+	carsAPI     CarsAPI
+	rentalsAPI  RentalsAPI
+	paymentsAPI PaymentsAPI
+	gracePeriod time.Duration
+	logger      *slog.Logger
+}
+
+func NewReservationExpirer(carsAPI CarsAPI, rentalsAPI RentalsAPI, paymentsAPI PaymentsAPI, gracePeriod time.Duration, logger *slog.Logger) *ReservationExpirer {
+	return &ReservationExpirer{
+		carsAPI:     carsAPI,
+		rentalsAPI:  rentalsAPI,
+		paymentsAPI: paymentsAPI,
+		gracePeriod: gracePeriod,
+		logger:      logger,
+	}
+}
+
+func (e *ReservationExpirer) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		e.logger.Warn("reservation expiry check interval not set, expiry disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := e.ExpireReservations(ctx)
+			if err != nil {
+				e.logger.Error(err.Error())
+			}
+		}
+	}
+}
+
+func (e *ReservationExpirer) ExpireReservations(ctx context.Context) error {
+	const batchSize = 100
+
+	rentals, err := e.rentalsAPI.GetExpiredReservations(ctx, time.Now().Add(-e.gracePeriod), batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, rental := range rentals {
+		err = multierr.Append(err, e.expireReservation(ctx, rental))
+	}
+
+	return err
+}
+
+// expireReservation returns the money of a no-show before the reservation is canceled, so a failed refund
+// leaves the reservation to the next run. A payment whose capture never landed is voided, nothing was charged.
+func (e *ReservationExpirer) expireReservation(ctx context.Context, rental models.Rental) error {
+	// 1. Refund or void payment (a payment canceled already, e.g. by a failed run, is not reinstated on rollback)
+	payment, found, err := e.paymentsAPI.GetPayment(ctx, rental.PaymentUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return paymentErrors.ErrPaymentNotFound
+	} else if payment.Price.Amount == 0 { // circuit breaker fallback
+		return errors.ErrPaymentUnavailable
+	}
+
+	canceled := false
+	if payment.Status != models.PaymentRefunded {
+		var allowed bool
+
+		found, allowed, canceled, err = e.paymentsAPI.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		if err != nil {
+			return err
+		} else if !found {
+			return paymentErrors.ErrPaymentNotFound
+		} else if !allowed {
+			e.logger.Error("no-show refund declined",
+				slog.String("rental_uid", rental.RentalUID),
+				slog.String("payment_uid", payment.PaymentUID),
+				slog.Int64("amount", payment.Price.Amount),
+				slog.String("currency", payment.Price.Currency),
+			)
+
+			return paymentErrors.ErrRefundNotAllowed
+		}
+	}
+
+	// 2. Cancel rental unless it has been picked up meanwhile, the payment is reinstated then
+	_, allowed, changed, err := e.rentalsAPI.SetRentalStatusFrom(ctx, rental.RentalUID, models.RentalReserved, models.RentalCanceled)
+	if err != nil {
+		return err
+	} else if !allowed {
+		if !canceled {
+			return nil
+		}
+
+		_, _, _, err = e.paymentsAPI.ReinstatePayment(ctx, payment.PaymentUID)
+
+		return errors.ErrRollbackWrap(err)
+	} else if changed {
+		e.logger.Info("reservation expired",
+			slog.String("rental_uid", rental.RentalUID),
+			slog.String("payment_uid", payment.PaymentUID),
+			slog.String("previous_payment_status", string(payment.Status)),
+			slog.String("username", rental.Username),
+		)
+	}
+
+	// 3. Unlock car (failed requests are retried through the backlog)
+	_, allowed, _, err = e.carsAPI.UnlockCar(ctx, rental.CarUID, rental.DateFrom, rental.DateTo, rental.RentalUID)
+	if err == nil && !allowed {
+		err = carErrors.ErrCarLockNotOwned
+	}
+
+	return err
+}
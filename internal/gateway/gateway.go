@@ -4,53 +4,69 @@ import (
 	"context"
 	carErrors "github.com/Inspirate789/ds-lab2/internal/car/delivery/errors"
 	"github.com/Inspirate789/ds-lab2/internal/gateway/errors"
+	"github.com/Inspirate789/ds-lab2/internal/gateway/pricing"
 	"github.com/Inspirate789/ds-lab2/internal/models"
 	paymentErrors "github.com/Inspirate789/ds-lab2/internal/payment/delivery/errors"
 	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
 	rentalErrors "github.com/Inspirate789/ds-lab2/internal/rental/delivery/errors"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"go.uber.org/multierr"
 	"log/slog"
-	"math"
 	"strconv"
 	"time"
 )
 
 type CarsAPI interface {
 	app.HealthChecker
-	GetCars(ctx context.Context, offset, limit uint64, showAll bool) (res []models.Car, totalCount uint64, err error)
+	GetCars(ctx context.Context, page pagination.Request, showAll bool, from, to time.Time) (res []models.Car, info pagination.Page, err error)
 	GetCar(ctx context.Context, carUID string) (res models.Car, found bool, err error)
-	LockCar(ctx context.Context, carUID string) (res models.Car, found, success bool, err error)
-	UnlockCar(ctx context.Context, carUID string) (err error)
+	LockCar(ctx context.Context, carUID string, from, to time.Time, lock models.CarLock) (res models.Car, found, success bool, err error)
+	AttachRental(ctx context.Context, carUID string, from, to time.Time, rentalUID string) (found bool, err error)
+	UnlockCar(ctx context.Context, carUID string, from, to time.Time, holder string) (found, allowed, changed bool, err error)
 }
 
 type RentalsAPI interface {
 	app.HealthChecker
-	GetUserRentals(ctx context.Context, username string, offset, limit uint64) (res []models.Rental, totalCount uint64, err error)
+	GetUserRentals(ctx context.Context, username string, page pagination.Request) (res []models.Rental, info pagination.Page, err error)
 	GetUserRental(ctx context.Context, rentalUID, username string) (res models.Rental, found, permitted bool, err error)
 	CreateRental(ctx context.Context, properties models.RentalProperties) (res models.Rental, err error)
-	SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found bool, err error)
+	GetExpiredReservations(ctx context.Context, before time.Time, limit uint64) (res []models.Rental, err error)
+	SetSurchargePayment(ctx context.Context, rentalUID, paymentUID string) (found bool, err error)
+	SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found, allowed, changed bool, err error)
+	SetRentalStatusFrom(ctx context.Context, rentalUID string, expected, status models.RentalStatus) (found, allowed, changed bool, err error)
 }
 
 type PaymentsAPI interface {
 	app.HealthChecker
-	CreatePayment(ctx context.Context, price uint64) (res models.Payment, err error)
-	SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found bool, err error)
+	CreatePayment(ctx context.Context, price models.Money, idempotencyKey string) (res models.Payment, err error)
+	AuthorizePayment(ctx context.Context, price models.Money) (res models.Payment, err error)
+	CapturePayment(ctx context.Context, paymentUID string) (status models.PaymentStatus, found, allowed bool, err error)
+	LinkRental(ctx context.Context, paymentUID, rentalUID string) (found, allowed bool, err error)
+	VoidPayment(ctx context.Context, paymentUID string) (found, allowed bool, err error)
+	SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found, allowed, changed bool, err error)
+	ReinstatePayment(ctx context.Context, paymentUID string) (found, allowed, changed bool, err error)
 	GetPayment(ctx context.Context, paymentUID string) (res models.Payment, found bool, err error)
+	RefundPayment(ctx context.Context, paymentUID string, amount models.Money, reason, idempotencyKey string) (res models.Refund, found, allowed bool, err error)
 }
 
 type Gateway struct {
 	carsAPI     CarsAPI
 	rentalsAPI  RentalsAPI
 	paymentsAPI PaymentsAPI
+	config      app.RentalsConfig
+	pricing     *pricing.Engine
 	logger      *slog.Logger
 }
 
-func New(carsAPI CarsAPI, rentalsAPI RentalsAPI, paymentsAPI PaymentsAPI, logger *slog.Logger) app.Delivery {
+func New(carsAPI CarsAPI, rentalsAPI RentalsAPI, paymentsAPI PaymentsAPI, config app.RentalsConfig, logger *slog.Logger) app.Delivery {
 	return &Gateway{
 		carsAPI:     carsAPI,
 		rentalsAPI:  rentalsAPI,
 		paymentsAPI: paymentsAPI,
+		config:      config,
+		pricing:     pricing.New(config.Pricing),
 		logger:      logger,
 	}
 }
@@ -67,24 +83,58 @@ func (gateway *Gateway) AddHandlers(router fiber.Router) {
 	router.Get("/cars", gateway.getCars)
 	router.Get("/rental", gateway.getRentals)
 	router.Post("/rental", gateway.startCarRental)
+	router.Get("/rental/quote", gateway.getRentalQuote)
 	router.Get("/rental/:rentalUID", gateway.getRental)
+	router.Post("/rental/:rentalUID/pickup", gateway.pickUpCar)
 	router.Post("/rental/:rentalUID/finish", gateway.finishCarRental)
 	router.Delete("/rental/:rentalUID", gateway.cancelCarRental)
 }
 
-func (gateway *Gateway) getCars(ctx *fiber.Ctx) error {
-	page, err := strconv.ParseUint(ctx.Query("page"), 10, 64)
+func (gateway *Gateway) parsePage(ctx *fiber.Ctx) (req pagination.Request, page uint64, err error) {
+	size, err := strconv.ParseUint(ctx.Query("size"), 10, 64)
+	if err != nil {
+		gateway.logger.Debug("list size not set, use max page size")
+		size = pagination.MaxLimit
+	} else if size == 0 || size > pagination.MaxLimit {
+		return pagination.Request{}, 0, errors.ErrInvalidPageSize
+	}
+
+	if token := ctx.Query("cursor"); token != "" {
+		cursor, err := pagination.ParseCursor(token)
+		if err != nil {
+			gateway.logger.Error(err.Error())
+			return pagination.Request{}, 0, errors.ErrInvalidCursor
+		}
+
+		return pagination.Request{Limit: size, Cursor: &cursor}, 0, nil
+	}
+
+	page, err = strconv.ParseUint(ctx.Query("page"), 10, 64)
 	if err != nil {
-		gateway.logger.Debug("car list page not set, use default 1")
+		gateway.logger.Debug("list page not set, use default 1")
 		page = 1
 	} else if page == 0 {
-		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPage.Map())
+		return pagination.Request{}, 0, errors.ErrInvalidPage
 	}
 
-	size, err := strconv.ParseUint(ctx.Query("size"), 10, 64)
+	return pagination.Request{Offset: (page - 1) * size, Limit: size}, page, nil
+}
+
+// setCursors returns the cursors of the neighbouring pages in the X-Next-Cursor and X-Prev-Cursor headers.
+func setCursors(ctx *fiber.Ctx, info pagination.Page) {
+	if info.Next != nil {
+		ctx.Set("X-Next-Cursor", info.Next.String())
+	}
+
+	if info.Prev != nil {
+		ctx.Set("X-Prev-Cursor", info.Prev.String())
+	}
+}
+
+func (gateway *Gateway) getCars(ctx *fiber.Ctx) error {
+	pageRequest, page, err := gateway.parsePage(ctx)
 	if err != nil {
-		gateway.logger.Debug("car list size not set, return all cars")
-		size = math.MaxInt64
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
 	}
 
 	showAll, err := strconv.ParseBool(ctx.Query("showAll"))
@@ -93,32 +143,55 @@ func (gateway *Gateway) getCars(ctx *fiber.Ctx) error {
 		showAll = false
 	}
 
-	cars, totalCount, err := gateway.carsAPI.GetCars(ctx.Context(), (page-1)*size, size, showAll)
+	var from, to time.Time
+	if ctx.Query("from") != "" {
+		from, err = time.Parse(time.DateOnly, ctx.Query("from"))
+		if err != nil {
+			gateway.logger.Error(err.Error())
+			parseErr := errors.ErrInvalidDateFrom(err.Error())
+
+			return ctx.Status(fiber.StatusBadRequest).JSON(parseErr.Map())
+		}
+	}
+	if ctx.Query("to") != "" {
+		to, err = time.Parse(time.DateOnly, ctx.Query("to"))
+		if err != nil {
+			gateway.logger.Error(err.Error())
+			parseErr := errors.ErrInvalidDateTo(err.Error())
+
+			return ctx.Status(fiber.StatusBadRequest).JSON(parseErr.Map())
+		}
+	}
+
+	start := from
+	if start.IsZero() {
+		start = time.Now() // the cars service checks the availability from now on
+	}
+
+	if !to.IsZero() && !to.After(start) {
+		dateErr := errors.ErrInvalidRentalPeriod(ctx.Query("from"), ctx.Query("to"))
+		return ctx.Status(fiber.StatusBadRequest).JSON(dateErr.Map())
+	}
+
+	cars, info, err := gateway.carsAPI.GetCars(ctx.Context(), pageRequest, showAll, from, to)
 	if err != nil {
 		return err
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(NewCarsDTO(cars, page, size, totalCount))
+	setCursors(ctx, info)
+
+	return ctx.Status(fiber.StatusOK).JSON(NewCarsDTO(cars, page, pageRequest.Limit, info))
 }
 
 func (gateway *Gateway) getRentals(ctx *fiber.Ctx) error {
-	page, err := strconv.ParseUint(ctx.Query("page"), 10, 64)
-	if err != nil {
-		gateway.logger.Debug("car list page not set, use default 1")
-		page = 1
-	} else if page == 0 {
-		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPage.Map())
-	}
-
-	size, err := strconv.ParseUint(ctx.Query("size"), 10, 64)
+	pageRequest, _, err := gateway.parsePage(ctx)
 	if err != nil {
-		gateway.logger.Debug("car list size not set, return all cars")
-		size = math.MaxInt64
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
 	}
 
 	username := ctx.Get("X-User-Name")
 
-	rentals, totalCount, err := gateway.rentalsAPI.GetUserRentals(ctx.Context(), username, (page-1)*size, size)
+	rentals, info, err := gateway.rentalsAPI.GetUserRentals(ctx.Context(), username, pageRequest)
 	if err != nil {
 		return err
 	}
@@ -147,7 +220,23 @@ func (gateway *Gateway) getRentals(ctx *fiber.Ctx) error {
 		payments = append(payments, payment)
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(NewRentalsDTO(rentals, cars, payments, page, size, totalCount))
+	surcharges := make(map[string]models.Payment)
+	for _, rental := range rentals {
+		if rental.SurchargePaymentUID == "" {
+			continue
+		}
+
+		surcharge, found, err := gateway.paymentsAPI.GetPayment(ctx.Context(), rental.SurchargePaymentUID)
+		if err != nil {
+			return err
+		} else if found {
+			surcharges[rental.RentalUID] = surcharge
+		}
+	}
+
+	setCursors(ctx, info)
+
+	return ctx.Status(fiber.StatusOK).JSON(NewRentalsDTO(rentals, cars, payments, surcharges))
 }
 
 func (gateway *Gateway) getRental(ctx *fiber.Ctx) error {
@@ -177,45 +266,89 @@ func (gateway *Gateway) getRental(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusNotFound).JSON(paymentErrors.ErrPaymentNotFound.Map())
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(NewRentalDTO(rental, car, payment))
+	var surcharge models.Payment
+	if rental.SurchargePaymentUID != "" {
+		surcharge, _, err = gateway.paymentsAPI.GetPayment(ctx.Context(), rental.SurchargePaymentUID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewRentalDTO(rental, car, payment, surcharge))
 }
 
-func (gateway *Gateway) startCarRental(ctx *fiber.Ctx) error {
-	// 0. Read request data
-	username := ctx.Get("X-User-Name")
-	var dto CarRentalRequest
+func parseRentalPeriod(from, to string) (dateFrom, dateTo time.Time, err error) {
+	dateFrom, err = time.Parse(time.DateOnly, from)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.ErrInvalidDateFrom(err.Error())
+	}
 
-	err := ctx.BodyParser(&dto)
+	dateTo, err = time.Parse(time.DateOnly, to)
 	if err != nil {
-		gateway.logger.Error(err.Error())
-		parseErr := errors.ErrInvalidRentalRequest(err.Error())
+		return time.Time{}, time.Time{}, errors.ErrInvalidDateTo(err.Error())
+	}
 
-		return ctx.Status(fiber.StatusUnprocessableEntity).JSON(parseErr.Map())
+	if !dateTo.After(dateFrom) {
+		return time.Time{}, time.Time{}, errors.ErrInvalidRentalPeriod(from, to)
 	}
 
-	dateFrom, err := time.Parse(time.DateOnly, dto.DateFrom)
+	return dateFrom, dateTo, nil
+}
+
+func (gateway *Gateway) getRentalQuote(ctx *fiber.Ctx) error {
+	carUID := ctx.Query("carUid")
+	promoCode := ctx.Query("promoCode")
+
+	dateFrom, dateTo, err := parseRentalPeriod(ctx.Query("dateFrom"), ctx.Query("dateTo"))
 	if err != nil {
 		gateway.logger.Error(err.Error())
-		parseErr := errors.ErrInvalidDateFrom(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
 
-		return ctx.Status(fiber.StatusUnprocessableEntity).JSON(parseErr.Map())
+	car, found, err := gateway.carsAPI.GetCar(ctx.Context(), carUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(carErrors.ErrCarNotFound.Map())
+	} else if car.Price == 0 { // circuit breaker fallback
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(errors.ErrCarPriceUnavailable.Map())
 	}
 
-	dateTo, err := time.Parse(time.DateOnly, dto.DateTo)
+	quote, err := gateway.pricing.Quote(car, dateFrom, dateTo, promoCode)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewRentalQuoteDTO(carUID, dateFrom, dateTo, quote))
+}
+
+func (gateway *Gateway) startCarRental(ctx *fiber.Ctx) (err error) {
+	// 0. Read request data
+	username := ctx.Get("X-User-Name")
+	var dto CarRentalRequest
+
+	err = ctx.BodyParser(&dto)
 	if err != nil {
 		gateway.logger.Error(err.Error())
-		parseErr := errors.ErrInvalidDateTo(err.Error())
+		parseErr := errors.ErrInvalidRentalRequest(err.Error())
 
 		return ctx.Status(fiber.StatusUnprocessableEntity).JSON(parseErr.Map())
 	}
 
-	if !dateTo.After(dateFrom) {
-		dateErr := errors.ErrInvalidRentalPeriod(dto.DateFrom, dto.DateTo)
-		return ctx.Status(fiber.StatusUnprocessableEntity).JSON(dateErr.Map())
+	dateFrom, dateTo, err := parseRentalPeriod(dto.DateFrom, dto.DateTo)
+	if err != nil {
+		gateway.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if dto.PromoCode != "" && !gateway.pricing.PromoCodeExists(dto.PromoCode) {
+		return ctx.Status(fiber.StatusUnprocessableEntity).JSON(errors.ErrUnknownPromoCode.Map())
 	}
 
-	// 1. Lock car
-	car, found, success, err := gateway.carsAPI.LockCar(ctx.Context(), dto.CarUID)
+	// 1. Lock car (the owner tells this rental flow from the others)
+	lock := models.CarLock{Owner: uuid.NewString()}
+
+	car, found, success, err := gateway.carsAPI.LockCar(ctx.Context(), dto.CarUID, dateFrom, dateTo, lock)
 	if err != nil {
 		return err
 	} else if !found {
@@ -226,48 +359,95 @@ func (gateway *Gateway) startCarRental(ctx *fiber.Ctx) error {
 
 	defer func() {
 		if err != nil {
-			rollbackErr := gateway.carsAPI.UnlockCar(ctx.Context(), dto.CarUID)
+			_, allowed, _, rollbackErr := gateway.carsAPI.UnlockCar(ctx.Context(), dto.CarUID, dateFrom, dateTo, lock.Owner)
+			if rollbackErr == nil && !allowed {
+				rollbackErr = carErrors.ErrCarLockNotOwned
+			}
+
 			err = multierr.Append(err, errors.ErrRollbackWrap(rollbackErr))
 		}
 	}()
 
-	// 2. Create payment
-	price := uint64(dateTo.Sub(dateFrom)/(24*time.Hour)) * car.Price
+	// 2. Hold funds
+	quote, err := gateway.pricing.Quote(car, dateFrom, dateTo, dto.PromoCode)
+	if err != nil {
+		return err
+	}
 
-	payment, err := gateway.paymentsAPI.CreatePayment(ctx.Context(), price)
+	payment, err := gateway.paymentsAPI.AuthorizePayment(ctx.Context(), models.NewMoney(quote.Total, models.DefaultCurrency))
 	if err != nil {
 		return err
 	}
 
 	defer func() {
 		if err != nil {
-			_, rollbackErr := gateway.paymentsAPI.SetPaymentStatus(ctx.Context(), payment.PaymentUID, models.PaymentCanceled)
+			_, _, rollbackErr := gateway.paymentsAPI.VoidPayment(ctx.Context(), payment.PaymentUID)
 			err = multierr.Append(err, errors.ErrRollbackWrap(rollbackErr))
 		}
 	}()
 
-	// 3. Create rental
+	// 3. Create rental (future rentals are reserved until the car is picked up)
+	status := models.RentalInProgress
+	if dateFrom.After(time.Now()) {
+		status = models.RentalReserved
+	}
+
 	rental, err := gateway.rentalsAPI.CreateRental(ctx.Context(), models.RentalProperties{
-		Username:   username,
-		PaymentUID: payment.PaymentUID,
-		CarUID:     dto.CarUID,
-		DateFrom:   dateFrom,
-		DateTo:     dateTo,
-		Status:     models.RentalInProgress,
-	}) // dto.CarUID, username, dateFrom, dateTo)
+		Username:       username,
+		PaymentUID:     payment.PaymentUID,
+		CarUID:         dto.CarUID,
+		DateFrom:       dateFrom,
+		DateTo:         dateTo,
+		Status:         status,
+		PricingVersion: quote.Version,
+	})
 	if err != nil {
 		return err
 	}
 
+	defer func() {
+		if err != nil {
+			_, _, _, rollbackErr := gateway.rentalsAPI.SetRentalStatus(ctx.Context(), rental.RentalUID, models.RentalCanceled)
+			err = multierr.Append(err, errors.ErrRollbackWrap(rollbackErr))
+		}
+	}()
+
+	// 4. Attach rental to the car lock, link payment to rental and capture it
+	found, err = gateway.carsAPI.AttachRental(ctx.Context(), dto.CarUID, dateFrom, dateTo, rental.RentalUID)
+	if err != nil {
+		return err
+	} else if !found {
+		err = errors.ErrCarLockLost
+		return err
+	}
+
+	_, _, err = gateway.paymentsAPI.LinkRental(ctx.Context(), payment.PaymentUID, rental.RentalUID)
+	if err != nil {
+		return err
+	}
+
+	payment.RentalUID = rental.RentalUID
+
+	// a capture pending at the provider or queued in the backlog leaves the payment AUTHORIZED
+	paymentStatus, _, allowed, err := gateway.paymentsAPI.CapturePayment(ctx.Context(), payment.PaymentUID)
+	if err != nil {
+		return err
+	} else if !allowed {
+		err = paymentErrors.ErrPaymentNotAuthorized
+		return err
+	}
+
+	payment.Status = paymentStatus
+
 	return ctx.Status(fiber.StatusOK).JSON(NewRentalResponse(rental, payment))
 }
 
-func (gateway *Gateway) cancelCarRental(ctx *fiber.Ctx) (err error) {
+func (gateway *Gateway) pickUpCar(ctx *fiber.Ctx) error {
 	// 0. Read request data
 	username := ctx.Get("X-User-Name")
 	rentalUID := ctx.Params("rentalUID")
 
-	// 1. Check rental access
+	// 1. Check rental access and state
 	rental, found, permitted, err := gateway.rentalsAPI.GetUserRental(ctx.Context(), rentalUID, username)
 	if err != nil {
 		return err
@@ -275,51 +455,253 @@ func (gateway *Gateway) cancelCarRental(ctx *fiber.Ctx) (err error) {
 		return ctx.Status(fiber.StatusNotFound).JSON(rentalErrors.ErrRentalNotFound.Map())
 	} else if !permitted {
 		return ctx.Status(fiber.StatusForbidden).JSON(rentalErrors.ErrRentalNotPermitted.Map())
+	} else if rental.Status != models.RentalReserved {
+		return ctx.Status(fiber.StatusConflict).JSON(rentalErrors.ErrRentalStatusConflict.Map())
+	} else if time.Now().Before(rental.DateFrom) {
+		return ctx.Status(fiber.StatusConflict).JSON(errors.ErrRentalNotStarted.Map())
 	}
 
-	// 2. Unlock car
-	err = gateway.carsAPI.UnlockCar(ctx.Context(), rental.CarUID)
+	// 2. Start rental
+	_, allowed, changed, err := gateway.rentalsAPI.SetRentalStatusFrom(ctx.Context(), rentalUID, models.RentalReserved, models.RentalInProgress)
 	if err != nil {
 		return err
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(rentalErrors.ErrRentalStatusConflict.Map())
+	} else if !changed {
+		gateway.logger.Debug("rental already picked up", slog.String("rental_uid", rentalUID))
 	}
 
-	// 3. Cancel rental
-	_, err = gateway.rentalsAPI.SetRentalStatus(ctx.Context(), rentalUID, models.RentalCanceled)
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (gateway *Gateway) cancelCarRental(ctx *fiber.Ctx) (err error) {
+	// 0. Read request data
+	username := ctx.Get("X-User-Name")
+	rentalUID := ctx.Params("rentalUID")
+
+	// 1. Check rental access and state
+	rental, found, permitted, err := gateway.rentalsAPI.GetUserRental(ctx.Context(), rentalUID, username)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(rentalErrors.ErrRentalNotFound.Map())
+	} else if !permitted {
+		return ctx.Status(fiber.StatusForbidden).JSON(rentalErrors.ErrRentalNotPermitted.Map())
+	} else if rental.Status != models.RentalReserved && rental.Status != models.RentalInProgress && rental.Status != models.RentalCanceled {
+		// a canceled rental is passed on, so a repeated request finishes the unlock and the refund of a failed one
+		return ctx.Status(fiber.StatusConflict).JSON(rentalErrors.ErrRentalStatusConflict.Map())
+	}
+
+	refundPercent := pricing.CancellationRefundPercent(gateway.config.Cancellation, rental.DateFrom, time.Now())
+	if refundPercent < 100 {
+		return gateway.cancelWithPartialRefund(ctx, rental, refundPercent)
+	}
+
+	// 2. Cancel payment (a payment canceled already, e.g. by a repeated request, is not reinstated on rollback)
+	found, allowed, canceled, err := gateway.paymentsAPI.SetPaymentStatus(ctx.Context(), rental.PaymentUID, models.PaymentCanceled)
 	if err != nil {
 		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(paymentErrors.ErrPaymentNotFound.Map())
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(paymentErrors.ErrPaymentStatusConflict.Map())
+	} else if !canceled {
+		gateway.logger.Debug("payment already canceled", slog.String("payment_uid", rental.PaymentUID))
 	}
 
+	reinstatePayment := func() error {
+		if !canceled {
+			return nil
+		}
+
+		_, _, _, rollbackErr := gateway.paymentsAPI.ReinstatePayment(ctx.Context(), rental.PaymentUID)
+
+		return rollbackErr
+	}
+
+	rentalCanceled := false
+
 	defer func() {
-		if err != nil {
-			_, rollbackErr := gateway.rentalsAPI.SetRentalStatus(ctx.Context(), rentalUID, models.RentalInProgress)
-			err = multierr.Append(err, errors.ErrRollbackWrap(rollbackErr))
+		if err != nil && !rentalCanceled {
+			err = multierr.Append(err, errors.ErrRollbackWrap(reinstatePayment()))
 		}
 	}()
 
-	// 4. Cancel payment
-	found, err = gateway.paymentsAPI.SetPaymentStatus(ctx.Context(), rental.PaymentUID, models.PaymentCanceled)
+	// 3. Cancel rental (the rental status can't be rolled back, so it goes after the payment)
+	_, allowed, _, err = gateway.rentalsAPI.SetRentalStatus(ctx.Context(), rentalUID, models.RentalCanceled)
+	if err != nil {
+		return err
+	} else if !allowed {
+		rollbackErr := reinstatePayment()
+		if rollbackErr != nil {
+			return errors.ErrRollbackWrap(rollbackErr)
+		}
+
+		return ctx.Status(fiber.StatusConflict).JSON(rentalErrors.ErrRentalStatusConflict.Map())
+	}
+
+	rentalCanceled = true
+
+	// 4. Unlock car once the rental is canceled, so a conflicting request never frees the car of an active rental
+	err = gateway.unlockCar(ctx.Context(), rental)
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// unlockCar releases the car of a rental which is over. A car unlocked already, e.g. by a repeated request
+// or by the reconciler, is a harmless repeat; a missing car or a lock of another holder is an inconsistency
+// which is reported but does not fail the rental flow, since the rental status is changed already.
+func (gateway *Gateway) unlockCar(ctx context.Context, rental models.Rental) error {
+	found, allowed, changed, err := gateway.carsAPI.UnlockCar(ctx, rental.CarUID, rental.DateFrom, rental.DateTo, rental.RentalUID)
+	if err != nil {
+		return err
+	} else if !found {
+		gateway.logger.Warn("inconsistency: car of the rental not found",
+			slog.String("rental_uid", rental.RentalUID),
+			slog.String("car_uid", rental.CarUID),
+		)
+	} else if !allowed {
+		gateway.logger.Warn("inconsistency: car of the rental locked by another holder",
+			slog.String("rental_uid", rental.RentalUID),
+			slog.String("car_uid", rental.CarUID),
+		)
+	} else if !changed {
+		gateway.logger.Debug("car already unlocked",
+			slog.String("rental_uid", rental.RentalUID),
+			slog.String("car_uid", rental.CarUID),
+		)
+	}
+
+	return nil
+}
+
+// cancelWithPartialRefund cancels a rental past the free cancellation period. Refunds can't be rolled back,
+// so the refund goes after the rental status change and the payment is checked before it. A rental canceled
+// already, e.g. by a request which failed to refund, is unlocked and refunded again; the refund is made once.
+func (gateway *Gateway) cancelWithPartialRefund(ctx *fiber.Ctx, rental models.Rental, refundPercent uint64) error {
+	// 2. Check payment before the rental is canceled
+	payment, found, err := gateway.paymentsAPI.GetPayment(ctx.Context(), rental.PaymentUID)
 	if err != nil {
 		return err
 	} else if !found {
 		return ctx.Status(fiber.StatusNotFound).JSON(paymentErrors.ErrPaymentNotFound.Map())
+	} else if payment.Price.Amount == 0 { // circuit breaker fallback
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(errors.ErrPaymentUnavailable.Map())
 	}
 
-	defer func() {
+	// 3. Cancel rental
+	_, allowed, changed, err := gateway.rentalsAPI.SetRentalStatus(ctx.Context(), rental.RentalUID, models.RentalCanceled)
+	if err != nil {
+		return err
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(rentalErrors.ErrRentalStatusConflict.Map())
+	} else if !changed {
+		gateway.logger.Debug("rental already canceled", slog.String("rental_uid", rental.RentalUID))
+	}
+
+	// 4. Unlock car and refund payment
+	err = multierr.Combine(
+		gateway.unlockCar(ctx.Context(), rental),
+		gateway.refundCanceled(ctx.Context(), rental, payment, refundPercent),
+	)
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// refundCanceled refunds the percent of the payment of a canceled rental. Nothing was charged for an authorization
+// whose capture has not landed yet (it may be queued in the backlog), so the authorization is voided instead.
+func (gateway *Gateway) refundCanceled(ctx context.Context, rental models.Rental, payment models.Payment, refundPercent uint64) error {
+	if payment.Status == models.PaymentAuthorized {
+		found, allowed, err := gateway.paymentsAPI.VoidPayment(ctx, payment.PaymentUID)
 		if err != nil {
-			_, rollbackErr := gateway.paymentsAPI.SetPaymentStatus(ctx.Context(), rental.PaymentUID, models.PaymentPaid)
-			err = multierr.Append(err, errors.ErrRollbackWrap(rollbackErr))
+			return err
+		} else if !found {
+			return paymentErrors.ErrPaymentNotFound
+		} else if allowed {
+			gateway.logger.Info("authorization of a canceled rental voided",
+				slog.String("rental_uid", rental.RentalUID),
+				slog.String("payment_uid", payment.PaymentUID),
+			)
+
+			return nil
 		}
-	}()
 
-	return ctx.SendStatus(fiber.StatusNoContent)
+		// the capture has landed meanwhile
+	}
+
+	return gateway.refundPayment(ctx, rental, refundPercent, 100, "late cancellation")
 }
 
-func (gateway *Gateway) finishCarRental(ctx *fiber.Ctx) error {
+// refundIdempotencyKey allows one refund per rental and reason, so neither replayed nor repeated requests
+// refund it twice.
+func refundIdempotencyKey(rentalUID, reason string) string {
+	return "refund:" + rentalUID + ":" + reason
+}
+
+// refundPayment refunds numerator/denominator of the rental payment price, rounded down to a minor unit.
+// A payment canceled or refunded in full has nothing left to refund.
+func (gateway *Gateway) refundPayment(ctx context.Context, rental models.Rental, numerator, denominator uint64, reason string) error {
+	payment, found, err := gateway.paymentsAPI.GetPayment(ctx, rental.PaymentUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return paymentErrors.ErrPaymentNotFound
+	} else if payment.Price.Amount == 0 { // circuit breaker fallback
+		return errors.ErrPaymentUnavailable
+	} else if payment.Status == models.PaymentCanceled || payment.Status == models.PaymentRefunded {
+		gateway.logger.Debug("payment already returned",
+			slog.String("payment_uid", payment.PaymentUID),
+			slog.String("status", string(payment.Status)),
+		)
+
+		return nil
+	}
+
+	amount := models.Money{
+		Amount:   payment.Price.Amount * int64(numerator) / int64(denominator),
+		Currency: payment.Price.Currency,
+	}
+	if amount.Amount == 0 {
+		return nil
+	}
+
+	refund, found, allowed, err := gateway.paymentsAPI.RefundPayment(ctx, payment.PaymentUID, amount, reason, refundIdempotencyKey(rental.RentalUID, reason))
+	if err != nil {
+		return err
+	} else if !found {
+		return paymentErrors.ErrPaymentNotFound
+	} else if !allowed {
+		return paymentErrors.ErrRefundNotAllowed
+	}
+
+	gateway.logger.Info("refund payment",
+		slog.String("payment_uid", payment.PaymentUID),
+		slog.String("refund_uid", refund.RefundUID),
+		slog.Int64("amount", amount.Amount),
+		slog.String("currency", amount.Currency),
+		slog.String("reason", reason),
+	)
+
+	return nil
+}
+
+func rentalDays(rental models.Rental) uint64 {
+	return uint64(rental.DateTo.Sub(rental.DateFrom) / (24 * time.Hour))
+}
+
+func (gateway *Gateway) finishCarRental(ctx *fiber.Ctx) (err error) {
 	// 0. Read request data
 	username := ctx.Get("X-User-Name")
 	rentalUID := ctx.Params("rentalUID")
+	returnedAt := time.Now()
 
-	// 1. Check rental access
+	// 1. Check rental access and state
 	rental, found, permitted, err := gateway.rentalsAPI.GetUserRental(ctx.Context(), rentalUID, username)
 	if err != nil {
 		return err
@@ -327,19 +709,99 @@ func (gateway *Gateway) finishCarRental(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusNotFound).JSON(rentalErrors.ErrRentalNotFound.Map())
 	} else if !permitted {
 		return ctx.Status(fiber.StatusForbidden).JSON(rentalErrors.ErrRentalNotPermitted.Map())
+	} else if rental.Status != models.RentalInProgress && rental.Status != models.RentalFinished {
+		// a finished rental is passed on, so a repeated request finishes the steps a failed one left
+		return ctx.Status(fiber.StatusConflict).JSON(rentalErrors.ErrRentalStatusConflict.Map())
+	}
+
+	if !rental.ReturnedAt.IsZero() {
+		returnedAt = rental.ReturnedAt // a repeated request prices the return as the first one
+	}
+
+	// 2. Price a late return before the rental is finished (unless its surcharge is charged already)
+	var surchargePrice uint64
+	overdue := pricing.OverdueDays(rental.DateTo, returnedAt, gateway.config.OverdueGracePeriod)
+	if overdue != 0 && rental.SurchargePaymentUID == "" {
+		car, found, err := gateway.carsAPI.GetCar(ctx.Context(), rental.CarUID)
+		if err != nil {
+			return err
+		} else if !found {
+			return ctx.Status(fiber.StatusNotFound).JSON(carErrors.ErrCarNotFound.Map())
+		} else if car.Price == 0 { // circuit breaker fallback
+			return ctx.Status(fiber.StatusServiceUnavailable).JSON(errors.ErrCarPriceUnavailable.Map())
+		}
+
+		surchargePrice = overdue*car.Price + gateway.config.OverduePenalty
 	}
 
-	// 2. Unlock car
-	err = gateway.carsAPI.UnlockCar(ctx.Context(), rental.CarUID)
+	// 3. Finish rental (the refund and the surcharge are made once per rental, so a rental finished already
+	// by a failed or concurrent request goes through the next steps again)
+	_, allowed, changed, err := gateway.rentalsAPI.SetRentalStatus(ctx.Context(), rentalUID, models.RentalFinished)
 	if err != nil {
 		return err
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(rentalErrors.ErrRentalStatusConflict.Map())
+	} else if !changed {
+		gateway.logger.Debug("rental already finished", slog.String("rental_uid", rentalUID))
+	}
+
+	// 4. Unlock car once the rental is finished and refund unused days of an early return
+	// (both go after the status change, refunds can't be rolled back)
+	err = gateway.unlockCar(ctx.Context(), rental)
+	if days, unused := rentalDays(rental), pricing.UnusedDays(rental.DateTo, returnedAt); unused != 0 {
+		err = multierr.Append(err, gateway.refundPayment(ctx.Context(), rental, unused, days, "early return"))
 	}
 
-	// 3. Finish rental
-	_, err = gateway.rentalsAPI.SetRentalStatus(ctx.Context(), rentalUID, models.RentalFinished)
 	if err != nil {
 		return err
 	}
 
+	// 5. Charge for a late return last, so no later step fails the request after the charge
+	if surchargePrice != 0 {
+		err = gateway.chargeSurcharge(ctx.Context(), rentalUID, surchargePrice)
+		if err != nil {
+			return err
+		}
+
+		gateway.logger.Info("charge for late return",
+			slog.String("rental_uid", rentalUID),
+			slog.Uint64("overdue_days", overdue),
+			slog.Uint64("price", surchargePrice),
+		)
+	}
+
 	return ctx.SendStatus(fiber.StatusNoContent)
 }
+
+// surchargeIdempotencyKey allows one surcharge per rental, so replayed requests don't charge it twice.
+func surchargeIdempotencyKey(rentalUID string) string {
+	return "surcharge:" + rentalUID
+}
+
+// chargeSurcharge charges the surcharge of a finished rental and attaches it to the rental. The surcharge
+// is linked to the rental first and is not canceled on failure: a repeated request gets the same surcharge
+// by its idempotency key and attaches it, and the reconciler cancels one left with no rental.
+func (gateway *Gateway) chargeSurcharge(ctx context.Context, rentalUID string, price uint64) error {
+	surcharge, err := gateway.paymentsAPI.CreatePayment(ctx, models.NewMoney(price, models.DefaultCurrency), surchargeIdempotencyKey(rentalUID))
+	if err != nil {
+		return err
+	}
+
+	found, allowed, err := gateway.paymentsAPI.LinkRental(ctx, surcharge.PaymentUID, rentalUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return paymentErrors.ErrPaymentNotFound
+	} else if !allowed {
+		return paymentErrors.ErrPaymentLinkedToOtherRental
+	}
+
+	found, err = gateway.rentalsAPI.SetSurchargePayment(ctx, rentalUID, surcharge.PaymentUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return rentalErrors.ErrRentalNotFound
+	}
+
+	return nil
+}
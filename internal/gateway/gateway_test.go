@@ -3,6 +3,7 @@ package gateway_test
 import (
 	"context"
 	"github.com/Inspirate789/ds-lab2/internal/gateway"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
 	"github.com/ozontech/allure-go/pkg/allure"
 	"github.com/ozontech/allure-go/pkg/framework/provider"
 	"github.com/ozontech/allure-go/pkg/framework/suite"
@@ -30,7 +31,7 @@ func (s *GatewaySuite) TestHealthCheck(t provider.T) {
 	rentalAPI.On("HealthCheck", ctx).Return(nil)
 	paymentAPI.On("HealthCheck", ctx).Return(nil)
 
-	g := gateway.New(carsAPI, rentalAPI, paymentAPI, logger)
+	g := gateway.New(carsAPI, rentalAPI, paymentAPI, app.RentalsConfig{}, logger)
 	// act
 	err := g.HealthCheck(ctx)
 	// assert
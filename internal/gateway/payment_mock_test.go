@@ -14,17 +14,47 @@ func (api *paymentApiMock) HealthCheck(ctx context.Context) error {
 	return api.Called(ctx).Error(0)
 }
 
-func (api *paymentApiMock) CreatePayment(ctx context.Context, price uint64) (res models.Payment, err error) {
+func (api *paymentApiMock) CreatePayment(ctx context.Context, price models.Money, idempotencyKey string) (res models.Payment, err error) {
+	args := api.Called(ctx, price, idempotencyKey)
+	return args.Get(0).(models.Payment), args.Error(1)
+}
+
+func (api *paymentApiMock) AuthorizePayment(ctx context.Context, price models.Money) (res models.Payment, err error) {
 	args := api.Called(ctx, price)
 	return args.Get(0).(models.Payment), args.Error(1)
 }
 
-func (api *paymentApiMock) SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found bool, err error) {
+func (api *paymentApiMock) CapturePayment(ctx context.Context, paymentUID string) (status models.PaymentStatus, found, allowed bool, err error) {
+	args := api.Called(ctx, paymentUID)
+	return args.Get(0).(models.PaymentStatus), args.Bool(1), args.Bool(2), args.Error(3)
+}
+
+func (api *paymentApiMock) LinkRental(ctx context.Context, paymentUID, rentalUID string) (found, allowed bool, err error) {
+	args := api.Called(ctx, paymentUID, rentalUID)
+	return args.Bool(0), args.Bool(1), args.Error(2)
+}
+
+func (api *paymentApiMock) VoidPayment(ctx context.Context, paymentUID string) (found, allowed bool, err error) {
+	args := api.Called(ctx, paymentUID)
+	return args.Bool(0), args.Bool(1), args.Error(2)
+}
+
+func (api *paymentApiMock) SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found, allowed, changed bool, err error) {
 	args := api.Called(ctx, paymentUID, status)
-	return args.Bool(0), args.Error(1)
+	return args.Bool(0), args.Bool(1), args.Bool(2), args.Error(3)
+}
+
+func (api *paymentApiMock) ReinstatePayment(ctx context.Context, paymentUID string) (found, allowed, changed bool, err error) {
+	args := api.Called(ctx, paymentUID)
+	return args.Bool(0), args.Bool(1), args.Bool(2), args.Error(3)
 }
 
 func (api *paymentApiMock) GetPayment(ctx context.Context, paymentUID string) (res models.Payment, found bool, err error) {
 	args := api.Called(ctx, paymentUID)
 	return args.Get(0).(models.Payment), args.Bool(1), nil
 }
+
+func (api *paymentApiMock) RefundPayment(ctx context.Context, paymentUID string, amount models.Money, reason, idempotencyKey string) (res models.Refund, found, allowed bool, err error) {
+	args := api.Called(ctx, paymentUID, amount, reason, idempotencyKey)
+	return args.Get(0).(models.Refund), args.Bool(1), args.Bool(2), args.Error(3)
+}
@@ -0,0 +1,149 @@
+package pricing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"time"
+)
+
+type PricingError string
+
+func (e PricingError) Error() string {
+	return string(e)
+}
+
+const ErrUnknownPromoCode PricingError = "unknown promo code"
+
+const defaultVersion = "default"
+
+type Item struct {
+	Rule        string
+	Description string
+	Amount      int64
+}
+
+type Quote struct {
+	Version string
+	Days    uint64
+	Items   []Item
+	Total   uint64
+}
+
+// Rental is what the rules price: the car rented for the days in [DateFrom, DateTo).
+type Rental struct {
+	Car       models.Car
+	DateFrom  time.Time
+	DateTo    time.Time
+	Days      uint64
+	PromoCode string
+}
+
+// Rule prices one aspect of a rental. Rules are applied in order, subtotal is the amount
+// of the items added by the rules before.
+type Rule interface {
+	Apply(rental Rental, subtotal int64) (item Item, ok bool)
+}
+
+// PromoRule is a rule applied to the rentals with its promo codes.
+type PromoRule interface {
+	Rule
+	Accepts(code string) bool
+}
+
+// Engine prices rentals by its rules. All rates are percents of the amount they apply to.
+type Engine struct {
+	version string
+	rules   []Rule
+}
+
+// New creates the engine of the configured rules: the base price, weekend and season surcharges per day,
+// then the car type surcharge, the long rental discount and the promo code discount of the subtotal.
+func New(config app.PricingConfig) *Engine {
+	rules := []Rule{Base{}, Weekend{Surcharge: config.WeekendSurcharge}}
+	for _, season := range config.Seasons {
+		rules = append(rules, Season(season))
+	}
+
+	rules = append(rules,
+		CarType{Rates: config.CarTypes},
+		LongRental{Discounts: config.LongRentalDiscounts},
+		Promo{Codes: config.PromoCodes},
+	)
+
+	return NewWithRules(rulesVersion(config), rules...)
+}
+
+// rulesVersion is the configured label followed by a digest of the rules, so the version stored
+// with the rentals changes along with the rules even if the label is left as it was.
+func rulesVersion(config app.PricingConfig) string {
+	label := config.Version
+	if label == "" {
+		label = defaultVersion
+	}
+
+	config.Version = ""
+
+	digest := sha256.Sum256([]byte(fmt.Sprintf("%+v", config)))
+
+	return label + "-" + hex.EncodeToString(digest[:4])
+}
+
+// NewWithRules creates the engine of the rules applied in the given order.
+func NewWithRules(version string, rules ...Rule) *Engine {
+	if version == "" {
+		version = defaultVersion
+	}
+
+	return &Engine{version: version, rules: rules}
+}
+
+func (e *Engine) Version() string {
+	return e.version
+}
+
+func (e *Engine) PromoCodeExists(code string) bool {
+	for _, rule := range e.rules {
+		if promo, ok := rule.(PromoRule); ok && promo.Accepts(code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Quote itemizes the price of renting the car for the days in [dateFrom, dateTo).
+func (e *Engine) Quote(car models.Car, dateFrom, dateTo time.Time, promoCode string) (Quote, error) {
+	if promoCode != "" && !e.PromoCodeExists(promoCode) {
+		return Quote{}, ErrUnknownPromoCode
+	}
+
+	rental := Rental{
+		Car:       car,
+		DateFrom:  dateFrom,
+		DateTo:    dateTo,
+		Days:      uint64(dateTo.Sub(dateFrom) / day),
+		PromoCode: promoCode,
+	}
+
+	var (
+		items    []Item
+		subtotal int64
+	)
+
+	for _, rule := range e.rules {
+		if item, ok := rule.Apply(rental, subtotal); ok {
+			items = append(items, item)
+			subtotal += item.Amount
+		}
+	}
+
+	return Quote{
+		Version: e.version,
+		Days:    rental.Days,
+		Items:   items,
+		Total:   uint64(max(subtotal, 0)),
+	}, nil
+}
@@ -0,0 +1,251 @@
+package pricing_test
+
+import (
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/gateway/pricing"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	sedan    = models.Car{Price: 1000, Type: models.CarType("SEDAN")}
+	roadster = models.Car{Price: 1000, Type: models.CarType("ROADSTER")}
+)
+
+func date(value string) time.Time {
+	res, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		panic(err)
+	}
+
+	return res
+}
+
+// itemAmounts lists the items as "rule=amount".
+func itemAmounts(items []pricing.Item) []string {
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		res = append(res, fmt.Sprintf("%s=%d", item.Rule, item.Amount))
+	}
+
+	return res
+}
+
+// cleaningFee is a rule the engine doesn't configure itself.
+type cleaningFee struct{}
+
+func (cleaningFee) Apply(pricing.Rental, int64) (pricing.Item, bool) {
+	return pricing.Item{Rule: "cleaning", Description: "cleaning fee", Amount: 500}, true
+}
+
+type PricingSuite struct {
+	suite.Suite
+}
+
+func (s *PricingSuite) TestQuote(t provider.T) {
+	t.Epic("Pricing")
+	t.Severity(allure.CRITICAL)
+
+	summer := app.SeasonRate{Name: "summer", From: "06-01", To: "08-31", Surcharge: 10}
+	winter := app.SeasonRate{Name: "winter", From: "12-01", To: "02-28", Surcharge: 30}
+	roadsters := []app.CarTypeRate{{Type: "ROADSTER", Surcharge: 25}}
+	longRentals := []app.LongRentalDiscount{{MinDays: 7, Discount: 10}, {MinDays: 14, Discount: 20}}
+	promoCodes := []app.PromoCode{{Code: "WELCOME", Discount: 5}, {Code: "FREE", Discount: 150}}
+
+	tests := []struct {
+		name     string
+		config   app.PricingConfig
+		car      models.Car
+		from, to string
+		promo    string
+		items    []string
+		total    uint64
+	}{{
+		name:  "base price only",
+		car:   sedan,
+		from:  "2026-10-19",
+		to:    "2026-10-22",
+		items: []string{"base=3000"},
+		total: 3000,
+	}, {
+		name:   "weekend days",
+		config: app.PricingConfig{WeekendSurcharge: 20},
+		car:    sedan,
+		from:   "2026-10-23",
+		to:     "2026-10-26",
+		items:  []string{"base=3000", "weekend=400"},
+		total:  3400,
+	}, {
+		name:   "no weekend days",
+		config: app.PricingConfig{WeekendSurcharge: 20},
+		car:    sedan,
+		from:   "2026-10-19",
+		to:     "2026-10-22",
+		items:  []string{"base=3000"},
+		total:  3000,
+	}, {
+		name:   "season starts during the rental",
+		config: app.PricingConfig{Seasons: []app.SeasonRate{summer}},
+		car:    sedan,
+		from:   "2026-05-29",
+		to:     "2026-06-02",
+		items:  []string{"base=4000", "season:summer=100"},
+		total:  4100,
+	}, {
+		name:   "season around the new year",
+		config: app.PricingConfig{Seasons: []app.SeasonRate{summer, winter}},
+		car:    sedan,
+		from:   "2026-12-30",
+		to:     "2027-01-02",
+		items:  []string{"base=3000", "season:winter=900"},
+		total:  3900,
+	}, {
+		name:   "car type surcharge",
+		config: app.PricingConfig{CarTypes: roadsters},
+		car:    roadster,
+		from:   "2026-10-19",
+		to:     "2026-10-22",
+		items:  []string{"base=3000", "carType:ROADSTER=750"},
+		total:  3750,
+	}, {
+		name:   "car of another type",
+		config: app.PricingConfig{CarTypes: roadsters},
+		car:    sedan,
+		from:   "2026-10-19",
+		to:     "2026-10-22",
+		items:  []string{"base=3000"},
+		total:  3000,
+	}, {
+		name:   "longest reached long rental discount",
+		config: app.PricingConfig{LongRentalDiscounts: longRentals},
+		car:    sedan,
+		from:   "2026-10-19",
+		to:     "2026-11-02",
+		items:  []string{"base=14000", "longRental=-2800"},
+		total:  11200,
+	}, {
+		name:   "rental too short for a discount",
+		config: app.PricingConfig{LongRentalDiscounts: longRentals},
+		car:    sedan,
+		from:   "2026-10-19",
+		to:     "2026-10-25",
+		items:  []string{"base=6000"},
+		total:  6000,
+	}, {
+		name:   "promo code",
+		config: app.PricingConfig{PromoCodes: promoCodes},
+		car:    sedan,
+		from:   "2026-10-19",
+		to:     "2026-10-22",
+		promo:  "WELCOME",
+		items:  []string{"base=3000", "promo:WELCOME=-150"},
+		total:  2850,
+	}, {
+		name:   "promo code discount over the price",
+		config: app.PricingConfig{PromoCodes: promoCodes},
+		car:    sedan,
+		from:   "2026-10-19",
+		to:     "2026-10-22",
+		promo:  "FREE",
+		items:  []string{"base=3000", "promo:FREE=-4500"},
+		total:  0,
+	}, {
+		name: "all rules, percents of the subtotal apply in order",
+		config: app.PricingConfig{
+			WeekendSurcharge:    20,
+			Seasons:             []app.SeasonRate{summer, winter},
+			CarTypes:            roadsters,
+			LongRentalDiscounts: longRentals,
+			PromoCodes:          promoCodes,
+		},
+		car:   roadster,
+		from:  "2026-05-29",
+		to:    "2026-06-05",
+		promo: "WELCOME",
+		items: []string{"base=7000", "weekend=400", "season:summer=400", "carType:ROADSTER=1950", "longRental=-975", "promo:WELCOME=-438"},
+		total: 8337,
+	}}
+
+	for _, test := range tests {
+		t.WithNewStep(test.name, func(sCtx provider.StepCtx) {
+			// arrange
+			engine := pricing.New(test.config)
+			// act
+			quote, err := engine.Quote(test.car, date(test.from), date(test.to), test.promo)
+			// assert
+			sCtx.Require().NoError(err)
+			sCtx.Require().Equal(test.items, itemAmounts(quote.Items))
+			sCtx.Require().Equal(test.total, quote.Total)
+			sCtx.Require().True(strings.HasPrefix(quote.Version, "default-"))
+		})
+	}
+
+	t.WithNewStep("version follows the rules", func(sCtx provider.StepCtx) {
+		// arrange
+		config := app.PricingConfig{Version: "v1", PromoCodes: promoCodes}
+		changed := config
+		changed.PromoCodes = []app.PromoCode{{Code: "WELCOME", Discount: 15}}
+		// act
+		version := pricing.New(config).Version()
+		same := pricing.New(config).Version()
+		other := pricing.New(changed).Version()
+		// assert
+		sCtx.Require().True(strings.HasPrefix(version, "v1-"))
+		sCtx.Require().Equal(version, same)
+		sCtx.Require().NotEqual(version, other)
+	})
+
+	t.WithNewStep("unknown promo code", func(sCtx provider.StepCtx) {
+		// arrange
+		engine := pricing.New(app.PricingConfig{PromoCodes: promoCodes})
+		// act
+		_, err := engine.Quote(sedan, date("2026-10-19"), date("2026-10-22"), "UNKNOWN")
+		// assert
+		sCtx.Require().ErrorIs(err, pricing.ErrUnknownPromoCode)
+		sCtx.Require().True(engine.PromoCodeExists("WELCOME"))
+		sCtx.Require().False(engine.PromoCodeExists("UNKNOWN"))
+	})
+}
+
+func (s *PricingSuite) TestNewWithRules(t provider.T) {
+	t.Epic("Pricing")
+	t.Severity(allure.NORMAL)
+
+	t.WithNewStep("custom rule sees the subtotal of the rules before", func(sCtx provider.StepCtx) {
+		// arrange
+		engine := pricing.NewWithRules("v2",
+			pricing.Base{},
+			cleaningFee{},
+			pricing.Promo{Codes: []app.PromoCode{{Code: "WELCOME", Discount: 10}}},
+		)
+		// act
+		quote, err := engine.Quote(sedan, date("2026-10-19"), date("2026-10-22"), "WELCOME")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal([]string{"base=3000", "cleaning=500", "promo:WELCOME=-350"}, itemAmounts(quote.Items))
+		sCtx.Require().Equal(uint64(3150), quote.Total)
+		sCtx.Require().Equal("v2", quote.Version)
+	})
+
+	t.WithNewStep("engine without a promo rule accepts no promo codes", func(sCtx provider.StepCtx) {
+		// arrange
+		engine := pricing.NewWithRules("", pricing.Base{})
+		// act
+		_, err := engine.Quote(sedan, date("2026-10-19"), date("2026-10-22"), "WELCOME")
+		// assert
+		sCtx.Require().ErrorIs(err, pricing.ErrUnknownPromoCode)
+		sCtx.Require().Equal("default", engine.Version())
+	})
+}
+
+func TestPricing(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(PricingSuite))
+}
@@ -0,0 +1,38 @@
+package pricing
+
+import (
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// UnusedDays counts the whole days left until the rental end.
+func UnusedDays(dateTo, returnedAt time.Time) uint64 {
+	if !returnedAt.Before(dateTo) {
+		return 0
+	}
+
+	return uint64(dateTo.Sub(returnedAt) / day)
+}
+
+// OverdueDays counts the started days of a late return. Returns within the grace period are not charged,
+// afterwards the days are counted from the end of the grace period.
+func OverdueDays(dateTo, returnedAt time.Time, grace time.Duration) uint64 {
+	overdue := returnedAt.Sub(dateTo) - max(grace, 0)
+	if overdue <= 0 {
+		return 0
+	}
+
+	return uint64((overdue + day - 1) / day)
+}
+
+// CancellationRefundPercent is the percent of the payment refunded for a rental canceled at the moment:
+// all of it at least the free period before the start, the late refund afterwards.
+func CancellationRefundPercent(policy app.CancellationPolicy, dateFrom, canceledAt time.Time) uint64 {
+	if !canceledAt.Add(policy.FreePeriod).After(dateFrom) {
+		return 100
+	}
+
+	return min(policy.LateRefund, 100)
+}
@@ -0,0 +1,114 @@
+package pricing_test
+
+import (
+	"github.com/Inspirate789/ds-lab2/internal/gateway/pricing"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"testing"
+	"time"
+)
+
+type ReturnsSuite struct {
+	suite.Suite
+}
+
+func (s *ReturnsSuite) TestOverdueDays(t provider.T) {
+	t.Epic("Pricing")
+	t.Severity(allure.CRITICAL)
+
+	dateTo := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		late  time.Duration
+		grace time.Duration
+		days  uint64
+	}{
+		{name: "early return", late: -time.Hour, grace: time.Hour},
+		{name: "return on time", grace: time.Hour},
+		{name: "late within the grace period", late: 59 * time.Minute, grace: time.Hour},
+		{name: "late at the end of the grace period", late: time.Hour, grace: time.Hour},
+		{name: "late just after the grace period", late: time.Hour + time.Minute, grace: time.Hour, days: 1},
+		{name: "late by a day after the grace period", late: 25 * time.Hour, grace: time.Hour, days: 1},
+		{name: "late by a day and a minute after the grace period", late: 25*time.Hour + time.Minute, grace: time.Hour, days: 2},
+		{name: "late without a grace period", late: time.Minute, days: 1},
+		{name: "negative grace period", late: time.Minute, grace: -time.Hour, days: 1},
+	}
+
+	for _, test := range tests {
+		t.WithNewStep(test.name, func(sCtx provider.StepCtx) {
+			// act
+			days := pricing.OverdueDays(dateTo, dateTo.Add(test.late), test.grace)
+			// assert
+			sCtx.Require().Equal(test.days, days)
+		})
+	}
+}
+
+func (s *ReturnsSuite) TestUnusedDays(t provider.T) {
+	t.Epic("Pricing")
+	t.Severity(allure.NORMAL)
+
+	dateTo := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		early time.Duration
+		days  uint64
+	}{
+		{name: "late return", early: -time.Hour},
+		{name: "return on time"},
+		{name: "early by less than a day", early: 23 * time.Hour},
+		{name: "early by a day", early: 24 * time.Hour, days: 1},
+		{name: "early by two days and a bit", early: 49 * time.Hour, days: 2},
+	}
+
+	for _, test := range tests {
+		t.WithNewStep(test.name, func(sCtx provider.StepCtx) {
+			// act
+			days := pricing.UnusedDays(dateTo, dateTo.Add(-test.early))
+			// assert
+			sCtx.Require().Equal(test.days, days)
+		})
+	}
+}
+
+func (s *ReturnsSuite) TestCancellationRefundPercent(t provider.T) {
+	t.Epic("Pricing")
+	t.Severity(allure.CRITICAL)
+
+	dateFrom := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	policy := app.CancellationPolicy{FreePeriod: 24 * time.Hour, LateRefund: 50}
+
+	tests := []struct {
+		name    string
+		policy  app.CancellationPolicy
+		before  time.Duration // how long before the rental start it is canceled
+		percent uint64
+	}{
+		{name: "long before the start", policy: policy, before: 72 * time.Hour, percent: 100},
+		{name: "at the end of the free period", policy: policy, before: 24 * time.Hour, percent: 100},
+		{name: "just after the free period", policy: policy, before: 24*time.Hour - time.Minute, percent: 50},
+		{name: "after the start", policy: policy, before: -time.Hour, percent: 50},
+		{name: "no late refund", policy: app.CancellationPolicy{FreePeriod: 24 * time.Hour}, before: time.Hour},
+		{name: "no free period", policy: app.CancellationPolicy{LateRefund: 50}, before: time.Hour, percent: 100},
+		{name: "late refund over the price", policy: app.CancellationPolicy{LateRefund: 150}, before: -time.Hour, percent: 100},
+	}
+
+	for _, test := range tests {
+		t.WithNewStep(test.name, func(sCtx provider.StepCtx) {
+			// act
+			percent := pricing.CancellationRefundPercent(test.policy, dateFrom, dateFrom.Add(-test.before))
+			// assert
+			sCtx.Require().Equal(test.percent, percent)
+		})
+	}
+}
+
+func TestReturns(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(ReturnsSuite))
+}
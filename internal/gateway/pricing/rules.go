@@ -0,0 +1,162 @@
+package pricing
+
+import (
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"time"
+)
+
+func percent(amount, rate int64) int64 {
+	return amount * rate / 100
+}
+
+// countDays counts the rental days matching the condition.
+func countDays(rental Rental, matches func(day time.Time) bool) int64 {
+	var n int64
+
+	for day := rental.DateFrom; day.Before(rental.DateTo); day = day.AddDate(0, 0, 1) {
+		if matches(day) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Base charges the car price for every rental day.
+type Base struct{}
+
+func (Base) Apply(rental Rental, _ int64) (Item, bool) {
+	return Item{
+		Rule:        "base",
+		Description: fmt.Sprintf("%d days x %d", rental.Days, rental.Car.Price),
+		Amount:      int64(rental.Days) * int64(rental.Car.Price),
+	}, true
+}
+
+// Weekend adds the surcharge of the car price for every Saturday and Sunday.
+type Weekend struct {
+	Surcharge int64
+}
+
+func (w Weekend) Apply(rental Rental, _ int64) (Item, bool) {
+	n := countDays(rental, func(day time.Time) bool {
+		weekday := day.Weekday()
+		return weekday == time.Saturday || weekday == time.Sunday
+	})
+	if n == 0 || w.Surcharge == 0 {
+		return Item{}, false
+	}
+
+	return Item{
+		Rule:        "weekend",
+		Description: fmt.Sprintf("%d weekend days, %+d%%", n, w.Surcharge),
+		Amount:      n * percent(int64(rental.Car.Price), w.Surcharge),
+	}, true
+}
+
+// Season adds the surcharge of the car price for every day in the season.
+type Season app.SeasonRate
+
+// contains reports whether the day is in the season, a season with From after To wraps around the new year.
+func (s Season) contains(day time.Time) bool {
+	date := day.Format("01-02")
+
+	if s.From <= s.To {
+		return s.From <= date && date <= s.To
+	}
+
+	return date >= s.From || date <= s.To
+}
+
+func (s Season) Apply(rental Rental, _ int64) (Item, bool) {
+	n := countDays(rental, s.contains)
+	if n == 0 || s.Surcharge == 0 {
+		return Item{}, false
+	}
+
+	return Item{
+		Rule:        "season:" + s.Name,
+		Description: fmt.Sprintf("%d days in season, %+d%%", n, s.Surcharge),
+		Amount:      n * percent(int64(rental.Car.Price), s.Surcharge),
+	}, true
+}
+
+// CarType adds the surcharge of the subtotal for the car type.
+type CarType struct {
+	Rates []app.CarTypeRate
+}
+
+func (c CarType) Apply(rental Rental, subtotal int64) (Item, bool) {
+	for _, rate := range c.Rates {
+		if models.CarType(rate.Type) == rental.Car.Type && rate.Surcharge != 0 {
+			return Item{
+				Rule:        "carType:" + rate.Type,
+				Description: fmt.Sprintf("%s, %+d%%", rate.Type, rate.Surcharge),
+				Amount:      percent(subtotal, rate.Surcharge),
+			}, true
+		}
+	}
+
+	return Item{}, false
+}
+
+// LongRental discounts the subtotal by the rate of the longest period the rental reaches.
+type LongRental struct {
+	Discounts []app.LongRentalDiscount
+}
+
+func (l LongRental) Apply(rental Rental, subtotal int64) (Item, bool) {
+	var discount int64
+	var minDays uint64
+
+	for _, rate := range l.Discounts {
+		if rental.Days >= rate.MinDays && rate.MinDays >= minDays {
+			discount, minDays = rate.Discount, rate.MinDays
+		}
+	}
+
+	if discount == 0 {
+		return Item{}, false
+	}
+
+	return Item{
+		Rule:        "longRental",
+		Description: fmt.Sprintf("%d+ days, -%d%%", minDays, discount),
+		Amount:      -percent(subtotal, discount),
+	}, true
+}
+
+// Promo discounts the subtotal of the rentals with a promo code.
+type Promo struct {
+	Codes []app.PromoCode
+}
+
+func (p Promo) discount(code string) (int64, bool) {
+	for _, promo := range p.Codes {
+		if promo.Code == code {
+			return promo.Discount, true
+		}
+	}
+
+	return 0, false
+}
+
+func (p Promo) Accepts(code string) bool {
+	_, found := p.discount(code)
+	return found
+}
+
+func (p Promo) Apply(rental Rental, subtotal int64) (Item, bool) {
+	discount, found := p.discount(rental.PromoCode)
+	if rental.PromoCode == "" || !found || discount == 0 {
+		return Item{}, false
+	}
+
+	return Item{
+		Rule:        "promo:" + rental.PromoCode,
+		Description: fmt.Sprintf("promo code, -%d%%", discount),
+		Amount:      -percent(subtotal, discount),
+	}, true
+}
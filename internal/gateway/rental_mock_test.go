@@ -3,7 +3,9 @@ package gateway_test
 import (
 	"context"
 	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/stretchr/testify/mock"
+	"time"
 )
 
 type rentalApiMock struct {
@@ -14,9 +16,9 @@ func (api *rentalApiMock) HealthCheck(ctx context.Context) error {
 	return api.Called(ctx).Error(0)
 }
 
-func (api *rentalApiMock) GetUserRentals(ctx context.Context, username string, offset, limit uint64) (res []models.Rental, totalCount uint64, err error) {
-	args := api.Called(ctx, username, offset, limit)
-	return args.Get(0).([]models.Rental), args.Get(1).(uint64), nil
+func (api *rentalApiMock) GetUserRentals(ctx context.Context, username string, page pagination.Request) (res []models.Rental, info pagination.Page, err error) {
+	args := api.Called(ctx, username, page)
+	return args.Get(0).([]models.Rental), args.Get(1).(pagination.Page), nil
 }
 
 func (api *rentalApiMock) GetUserRental(ctx context.Context, rentalUID, username string) (res models.Rental, found, permitted bool, err error) {
@@ -24,12 +26,27 @@ func (api *rentalApiMock) GetUserRental(ctx context.Context, rentalUID, username
 	return args.Get(0).(models.Rental), args.Get(1).(bool), args.Get(2).(bool), args.Error(3)
 }
 
+func (api *rentalApiMock) GetExpiredReservations(ctx context.Context, before time.Time, limit uint64) (res []models.Rental, err error) {
+	args := api.Called(ctx, before, limit)
+	return args.Get(0).([]models.Rental), args.Error(1)
+}
+
 func (api *rentalApiMock) CreateRental(ctx context.Context, properties models.RentalProperties) (res models.Rental, err error) {
 	args := api.Called(ctx, properties)
 	return args.Get(0).(models.Rental), args.Error(1)
 }
 
-func (api *rentalApiMock) SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found bool, err error) {
-	args := api.Called(ctx, rentalUID, status)
+func (api *rentalApiMock) SetSurchargePayment(ctx context.Context, rentalUID, paymentUID string) (found bool, err error) {
+	args := api.Called(ctx, rentalUID, paymentUID)
 	return args.Bool(0), args.Error(1)
 }
+
+func (api *rentalApiMock) SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found, allowed, changed bool, err error) {
+	args := api.Called(ctx, rentalUID, status)
+	return args.Bool(0), args.Bool(1), args.Bool(2), args.Error(3)
+}
+
+func (api *rentalApiMock) SetRentalStatusFrom(ctx context.Context, rentalUID string, expected, status models.RentalStatus) (found, allowed, changed bool, err error) {
+	args := api.Called(ctx, rentalUID, expected, status)
+	return args.Bool(0), args.Bool(1), args.Bool(2), args.Error(3)
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type CarType string
 
 const (
@@ -20,3 +22,25 @@ type Car struct {
 	Type               CarType
 	Availability       bool
 }
+
+// CarLock tells who holds a car reservation: the rental flow that locked the car and, once created,
+// its rental. A zero ExpiresAt means the lock does not expire.
+type CarLock struct {
+	RentalUID string
+	Owner     string
+	ExpiresAt time.Time
+}
+
+// HeldBy tells whether the holder, the lock owner or the rental, holds the lock.
+// Locks with no holder recorded are held by no one, they are released only by force.
+func (lock CarLock) HeldBy(holder string) bool {
+	return holder != "" && (holder == lock.Owner || holder == lock.RentalUID)
+}
+
+type CarReservation struct {
+	ID       int64
+	CarUID   string
+	DateFrom time.Time
+	DateTo   time.Time
+	CarLock
+}
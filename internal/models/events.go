@@ -0,0 +1,118 @@
+package models
+
+import "time"
+
+// Aggregates the domain events are published for; see docs/events.md for the schema.
+const (
+	AggregateCar     = "car"
+	AggregateRental  = "rental"
+	AggregatePayment = "payment"
+)
+
+const (
+	EventCarLocked   = "CarLocked"
+	EventCarUnlocked = "CarUnlocked"
+
+	EventRentalCreated      = "RentalCreated"
+	EventRentalPickedUp     = "RentalPickedUp"
+	EventRentalFinished     = "RentalFinished"
+	EventRentalCanceled     = "RentalCanceled"
+	EventRentalSurchargeSet = "RentalSurchargeSet"
+
+	EventPaymentAuthorized        = "PaymentAuthorized"
+	EventPaymentPaid              = "PaymentPaid"
+	EventPaymentCanceled          = "PaymentCanceled"
+	EventPaymentRefunded          = "PaymentRefunded"
+	EventPaymentPartiallyRefunded = "PaymentPartiallyRefunded"
+	EventRefundIssued             = "RefundIssued"
+)
+
+type CarLockEvent struct {
+	CarUID   string    `json:"carUid"`
+	DateFrom time.Time `json:"dateFrom"`
+	DateTo   time.Time `json:"dateTo"`
+}
+
+type RentalEvent struct {
+	RentalUID           string       `json:"rentalUid"`
+	Username            string       `json:"username"`
+	CarUID              string       `json:"carUid"`
+	PaymentUID          string       `json:"paymentUid"`
+	SurchargePaymentUID string       `json:"surchargePaymentUid,omitempty"`
+	DateFrom            time.Time    `json:"dateFrom"`
+	DateTo              time.Time    `json:"dateTo"`
+	Status              RentalStatus `json:"status"`
+	PreviousStatus      RentalStatus `json:"previousStatus,omitempty"`
+}
+
+func NewRentalEvent(rental Rental, previous RentalStatus) RentalEvent {
+	return RentalEvent{
+		RentalUID:           rental.RentalUID,
+		Username:            rental.Username,
+		CarUID:              rental.CarUID,
+		PaymentUID:          rental.PaymentUID,
+		SurchargePaymentUID: rental.SurchargePaymentUID,
+		DateFrom:            rental.DateFrom,
+		DateTo:              rental.DateTo,
+		Status:              rental.Status,
+		PreviousStatus:      previous,
+	}
+}
+
+// RentalEventType returns the event published when the rental moves to the status.
+func RentalEventType(status RentalStatus) string {
+	switch status {
+	case RentalInProgress:
+		return EventRentalPickedUp
+	case RentalFinished:
+		return EventRentalFinished
+	case RentalCanceled:
+		return EventRentalCanceled
+	default:
+		return EventRentalCreated
+	}
+}
+
+type PaymentEvent struct {
+	PaymentUID     string        `json:"paymentUid"`
+	RentalUID      string        `json:"rentalUid,omitempty"`
+	Status         PaymentStatus `json:"status"`
+	PreviousStatus PaymentStatus `json:"previousStatus,omitempty"`
+	Price          int64         `json:"price"` // minor units of the currency
+	Currency       string        `json:"currency"`
+}
+
+func NewPaymentEvent(payment Payment, previous PaymentStatus) PaymentEvent {
+	return PaymentEvent{
+		PaymentUID:     payment.PaymentUID,
+		RentalUID:      payment.RentalUID,
+		Status:         payment.Status,
+		PreviousStatus: previous,
+		Price:          payment.Price.Amount,
+		Currency:       payment.Price.Currency,
+	}
+}
+
+type RefundEvent struct {
+	RefundUID  string `json:"refundUid"`
+	PaymentUID string `json:"paymentUid"`
+	Amount     int64  `json:"amount"` // minor units of the currency
+	Currency   string `json:"currency"`
+	Reason     string `json:"reason"`
+}
+
+// PaymentEventType returns the event published when the payment moves to the status.
+func PaymentEventType(status PaymentStatus) string {
+	switch status {
+	case PaymentAuthorized:
+		return EventPaymentAuthorized
+	case PaymentPaid:
+		return EventPaymentPaid
+	case PaymentCanceled:
+		return EventPaymentCanceled
+	case PaymentRefunded:
+		return EventPaymentRefunded
+	default:
+		return EventPaymentPartiallyRefunded
+	}
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const DefaultCurrency = "RUB"
+
+// Money is an amount in minor units (e.g. kopecks) of an ISO 4217 currency.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// zeroExponentCurrencies have no minor units.
+var zeroExponentCurrencies = map[string]bool{
+	"JPY": true,
+	"KRW": true,
+	"VND": true,
+	"ISK": true,
+	"CLP": true,
+}
+
+func minorUnitsPerMajor(currency string) int64 {
+	if zeroExponentCurrencies[currency] {
+		return 1
+	}
+
+	return 100
+}
+
+func ValidCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func NewMoney(major uint64, currency string) Money {
+	return Money{
+		Amount:   int64(major) * minorUnitsPerMajor(currency),
+		Currency: currency,
+	}
+}
+
+// Major returns the amount in major units, truncating the fraction.
+func (m Money) Major() int64 {
+	return m.Amount / minorUnitsPerMajor(m.Currency)
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Format returns the amount in major units with the minor units of the currency, e.g. 1500.50.
+func (m Money) Format() string {
+	perMajor := minorUnitsPerMajor(m.Currency)
+	if perMajor == 1 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, amount/perMajor, amount%perMajor)
+}
@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+type NotificationKind string
+
+const (
+	NotificationBookingConfirmation NotificationKind = "BOOKING_CONFIRMATION"
+	NotificationPickupReminder      NotificationKind = "PICKUP_REMINDER"
+	NotificationOverdueWarning      NotificationKind = "OVERDUE_WARNING"
+	NotificationRefundReceipt       NotificationKind = "REFUND_RECEIPT"
+)
+
+func (k NotificationKind) Valid() bool {
+	switch k {
+	case NotificationBookingConfirmation, NotificationPickupReminder, NotificationOverdueWarning, NotificationRefundReceipt:
+		return true
+	default:
+		return false
+	}
+}
+
+// NotificationKey identifies the notification of the kind about the subject (rental, refund, etc.),
+// so it is sent once even if the event it is triggered by is delivered again.
+func NotificationKey(kind NotificationKind, subjectUID string) string {
+	return string(kind) + ":" + subjectUID
+}
+
+type NotificationPreferences struct {
+	Username            string
+	Email               string // empty if notifications are not to be mailed
+	BookingConfirmation bool
+	PickupReminder      bool
+	OverdueWarning      bool
+	RefundReceipt       bool
+}
+
+func DefaultNotificationPreferences(username string) NotificationPreferences {
+	return NotificationPreferences{
+		Username:            username,
+		BookingConfirmation: true,
+		PickupReminder:      true,
+		OverdueWarning:      true,
+		RefundReceipt:       true,
+	}
+}
+
+func (p NotificationPreferences) Allows(kind NotificationKind) bool {
+	switch kind {
+	case NotificationBookingConfirmation:
+		return p.BookingConfirmation
+	case NotificationPickupReminder:
+		return p.PickupReminder
+	case NotificationOverdueWarning:
+		return p.OverdueWarning
+	case NotificationRefundReceipt:
+		return p.RefundReceipt
+	default:
+		return false
+	}
+}
+
+type Notification struct {
+	ID              int64
+	NotificationUID string
+	Key             string
+	Username        string
+	Kind            NotificationKind
+	Recipient       string // email, if the user set one
+	Subject         string
+	Body            string
+	SentAt          time.Time
+}
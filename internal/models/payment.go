@@ -1,15 +1,168 @@
 package models
 
+import "time"
+
 type PaymentStatus string
 
 const (
-	PaymentPaid     PaymentStatus = "PAID"
-	PaymentCanceled PaymentStatus = "CANCELED"
+	PaymentAuthorized        PaymentStatus = "AUTHORIZED"
+	PaymentPaid              PaymentStatus = "PAID"
+	PaymentCanceled          PaymentStatus = "CANCELED"
+	PaymentRefunded          PaymentStatus = "REFUNDED"
+	PaymentPartiallyRefunded PaymentStatus = "PARTIALLY_REFUNDED"
 )
 
+func (s PaymentStatus) Valid() bool {
+	switch s {
+	case PaymentAuthorized, PaymentPaid, PaymentCanceled, PaymentRefunded, PaymentPartiallyRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
 type Payment struct {
+	ID          int64
+	PaymentUID  string
+	Status      PaymentStatus
+	Price       Money
+	RentalUID   string // empty until the payment is linked to its rental
+	ExternalRef string // provider reference of the approved charge
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type Refund struct {
 	ID         int64
+	RefundUID  string
 	PaymentUID string
-	Status     PaymentStatus
-	Price      uint64
+	Amount     Money
+	Reason     string
+	CreatedAt  time.Time
+}
+
+type LedgerEntryKind string
+
+const (
+	LedgerAuthorization LedgerEntryKind = "AUTHORIZATION"
+	LedgerCapture       LedgerEntryKind = "CAPTURE"
+	LedgerCharge        LedgerEntryKind = "CHARGE"
+	LedgerRefund        LedgerEntryKind = "REFUND"
+	LedgerFee           LedgerEntryKind = "FEE"
+	LedgerVoid          LedgerEntryKind = "VOID"
+)
+
+type LedgerAccount string
+
+const (
+	AccountCustomer LedgerAccount = "CUSTOMER" // what the customer owes for the payment
+	AccountRevenue  LedgerAccount = "REVENUE"
+	AccountFees     LedgerAccount = "FEES"
+	// Customer funds held by an authorization until it is captured or voided
+	AccountHolds          LedgerAccount = "HOLDS"
+	AccountAuthorizations LedgerAccount = "AUTHORIZATIONS"
+)
+
+// LedgerEntry is an immutable ledger record. Entries of one transaction sum up to zero,
+// debits are positive and credits are negative.
+type LedgerEntry struct {
+	ID             int64
+	EntryUID       string
+	TransactionUID string
+	PaymentUID     string
+	Kind           LedgerEntryKind
+	Account        LedgerAccount
+	Amount         Money
+	Description    string
+	CreatedAt      time.Time
+}
+
+// PaymentStatusOf derives the payment status from its ledger entries in the order they were recorded.
+func PaymentStatusOf(entries []LedgerEntry) PaymentStatus {
+	var charged, refunded, held int64
+	voided := false
+
+	for _, entry := range entries {
+		switch entry.Account {
+		case AccountHolds:
+			held += entry.Amount.Amount
+			voided = voided || entry.Kind == LedgerVoid
+		case AccountCustomer:
+			switch entry.Kind {
+			case LedgerCharge, LedgerFee:
+				charged += entry.Amount.Amount
+				voided = false
+			case LedgerRefund:
+				refunded -= entry.Amount.Amount
+			case LedgerVoid:
+				charged, refunded, voided = 0, 0, true
+			}
+		}
+	}
+
+	switch {
+	case held > 0:
+		return PaymentAuthorized
+	case voided:
+		return PaymentCanceled
+	case refunded == 0:
+		return PaymentPaid
+	case refunded >= charged:
+		return PaymentRefunded
+	default:
+		return PaymentPartiallyRefunded
+	}
+}
+
+// AccountBalances sums the ledger entries per account.
+func AccountBalances(entries []LedgerEntry) map[LedgerAccount]int64 {
+	balances := make(map[LedgerAccount]int64)
+
+	for _, entry := range entries {
+		balances[entry.Account] += entry.Amount.Amount
+	}
+
+	return balances
+}
+
+type ProviderOperationKind string
+
+const (
+	ProviderCharge ProviderOperationKind = "CHARGE"
+	ProviderRefund ProviderOperationKind = "REFUND"
+)
+
+// Reasons of the provider operations the payments service makes on its own.
+const (
+	ReasonCancellation  = "cancellation"  // refunds the outstanding balance, the payment is CANCELED once approved
+	ReasonReinstatement = "reinstatement" // charges a canceled payment again
+	ReasonCompensation  = "compensation"  // returns a charge approved after its payment was voided
+)
+
+type ProviderOperationStatus string
+
+const (
+	ProviderPending  ProviderOperationStatus = "PENDING"
+	ProviderApproved ProviderOperationStatus = "APPROVED"
+	ProviderDeclined ProviderOperationStatus = "DECLINED"
+)
+
+// ProviderOperation is a request to the payment provider; OperationUID is its idempotency key.
+type ProviderOperation struct {
+	ID             int64
+	OperationUID   string
+	PaymentUID     string
+	Kind           ProviderOperationKind
+	Amount         Money
+	Reason         string
+	IdempotencyKey string // refunds only, e.g. refund:<rentalUID>:<reason>
+	Status         ProviderOperationStatus
+	ExternalRef    string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+type ProviderResponse struct {
+	Status      ProviderOperationStatus
+	ExternalRef string
 }
@@ -0,0 +1,157 @@
+package models_test
+
+import (
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"testing"
+)
+
+// transaction builds the entries of one ledger transaction from account and amount pairs.
+func transaction(kind models.LedgerEntryKind, postings ...any) []models.LedgerEntry {
+	entries := make([]models.LedgerEntry, 0, len(postings)/2)
+	for i := 0; i < len(postings); i += 2 {
+		entries = append(entries, models.LedgerEntry{
+			Kind:    kind,
+			Account: postings[i].(models.LedgerAccount),
+			Amount:  models.Money{Amount: int64(postings[i+1].(int)), Currency: models.DefaultCurrency},
+		})
+	}
+
+	return entries
+}
+
+func ledger(transactions ...[]models.LedgerEntry) []models.LedgerEntry {
+	var entries []models.LedgerEntry
+	for _, transaction := range transactions {
+		entries = append(entries, transaction...)
+	}
+
+	return entries
+}
+
+var (
+	authorization = transaction(models.LedgerAuthorization, models.AccountHolds, 3000, models.AccountAuthorizations, -3000)
+	capture       = transaction(models.LedgerCapture, models.AccountHolds, -3000, models.AccountAuthorizations, 3000)
+	void          = transaction(models.LedgerVoid, models.AccountHolds, -3000, models.AccountAuthorizations, 3000)
+	charge        = transaction(models.LedgerCharge, models.AccountCustomer, 3000, models.AccountRevenue, -3000)
+	fee           = transaction(models.LedgerFee, models.AccountCustomer, 500, models.AccountFees, -500)
+	voidCharge    = transaction(models.LedgerVoid, models.AccountCustomer, -3000, models.AccountRevenue, 3000)
+)
+
+func refund(amount int) []models.LedgerEntry {
+	return transaction(models.LedgerRefund, models.AccountCustomer, -amount, models.AccountRevenue, amount)
+}
+
+type LedgerSuite struct {
+	suite.Suite
+}
+
+func (s *LedgerSuite) TestPaymentStatusOf(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	tests := []struct {
+		name    string
+		entries []models.LedgerEntry
+		status  models.PaymentStatus
+	}{
+		{name: "charged", entries: ledger(charge), status: models.PaymentPaid},
+		{name: "authorized", entries: ledger(authorization), status: models.PaymentAuthorized},
+		{name: "captured", entries: ledger(authorization, capture, charge), status: models.PaymentPaid},
+		{name: "authorization voided", entries: ledger(authorization, void), status: models.PaymentCanceled},
+		{name: "refunded in part", entries: ledger(charge, refund(1000)), status: models.PaymentPartiallyRefunded},
+		{name: "refunded in parts", entries: ledger(charge, refund(1000), refund(2000)), status: models.PaymentRefunded},
+		{name: "fee refunded with the charge", entries: ledger(charge, fee, refund(3000)), status: models.PaymentPartiallyRefunded},
+		{name: "charge voided", entries: ledger(charge, refund(1000), voidCharge), status: models.PaymentCanceled},
+		{name: "charged again after the void", entries: ledger(charge, voidCharge, charge), status: models.PaymentPaid},
+	}
+
+	for _, test := range tests {
+		t.WithNewStep(test.name, func(sCtx provider.StepCtx) {
+			// act
+			status := models.PaymentStatusOf(test.entries)
+			// assert
+			sCtx.Require().Equal(test.status, status)
+		})
+	}
+}
+
+func (s *LedgerSuite) TestAccountBalances(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.NORMAL)
+
+	t.WithNewStep("balances of every account sum up to zero", func(sCtx provider.StepCtx) {
+		// arrange
+		entries := ledger(authorization, capture, charge, fee, refund(1000))
+		// act
+		balances := models.AccountBalances(entries)
+		// assert
+		sCtx.Require().Equal(map[models.LedgerAccount]int64{
+			models.AccountHolds:          0,
+			models.AccountAuthorizations: 0,
+			models.AccountCustomer:       2500,
+			models.AccountRevenue:        -2000,
+			models.AccountFees:           -500,
+		}, balances)
+
+		var total int64
+		for _, balance := range balances {
+			total += balance
+		}
+
+		sCtx.Require().Zero(total)
+	})
+}
+
+func (s *LedgerSuite) TestMoney(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.NORMAL)
+
+	tests := []struct {
+		currency string
+		minor    int64
+	}{
+		{currency: "RUB", minor: 350000},
+		{currency: "USD", minor: 350000},
+		{currency: "JPY", minor: 3500},
+	}
+
+	for _, test := range tests {
+		t.WithNewStep(test.currency+" minor units", func(sCtx provider.StepCtx) {
+			// act
+			money := models.NewMoney(3500, test.currency)
+			// assert
+			sCtx.Require().Equal(test.minor, money.Amount)
+			sCtx.Require().Equal(int64(3500), money.Major())
+			sCtx.Require().Equal(models.Money{Amount: -test.minor, Currency: test.currency}, money.Neg())
+		})
+	}
+
+	t.WithNewStep("fraction is truncated", func(sCtx provider.StepCtx) {
+		// assert
+		sCtx.Require().Equal(int64(12), models.Money{Amount: 1299, Currency: "RUB"}.Major())
+	})
+
+	t.WithNewStep("format", func(sCtx provider.StepCtx) {
+		// assert
+		sCtx.Require().Equal("1500.05", models.Money{Amount: 150005, Currency: "RUB"}.Format())
+		sCtx.Require().Equal("-0.50", models.Money{Amount: -50, Currency: "RUB"}.Format())
+		sCtx.Require().Equal("3500", models.Money{Amount: 3500, Currency: "JPY"}.Format())
+	})
+
+	t.WithNewStep("currency codes", func(sCtx provider.StepCtx) {
+		// assert
+		sCtx.Require().True(models.ValidCurrency("RUB"))
+		sCtx.Require().False(models.ValidCurrency("rub"))
+		sCtx.Require().False(models.ValidCurrency("RUBL"))
+		sCtx.Require().False(models.ValidCurrency("R1B"))
+	})
+}
+
+func TestLedger(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(LedgerSuite))
+}
@@ -5,11 +5,21 @@ import "time"
 type RentalStatus string
 
 const (
+	RentalReserved   RentalStatus = "RESERVED"
 	RentalInProgress RentalStatus = "IN_PROGRESS"
 	RentalFinished   RentalStatus = "FINISHED"
 	RentalCanceled   RentalStatus = "CANCELED"
 )
 
+func (s RentalStatus) Valid() bool {
+	switch s {
+	case RentalReserved, RentalInProgress, RentalFinished, RentalCanceled:
+		return true
+	default:
+		return false
+	}
+}
+
 type RentalProperties struct {
 	Username   string
 	PaymentUID string
@@ -17,10 +27,22 @@ type RentalProperties struct {
 	DateFrom   time.Time
 	DateTo     time.Time
 	Status     RentalStatus
+	// PricingVersion identifies the pricing rules the rental price was computed with.
+	PricingVersion string
 }
 
 type Rental struct {
-	ID        int64
-	RentalUID string
+	ID                  int64
+	RentalUID           string
+	Version             int64
+	PickedUpAt          time.Time // zero until the car is picked up
+	ReturnedAt          time.Time // zero until the car is returned
+	SurchargePaymentUID string    // extra charge for a late return, if any
 	RentalProperties
 }
+
+type RentalStatusChange struct {
+	From      RentalStatus // empty for the initial status
+	To        RentalStatus
+	ChangedAt time.Time
+}
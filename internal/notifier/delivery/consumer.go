@@ -0,0 +1,67 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Inspirate789/ds-lab2/pkg/outbox"
+	"github.com/segmentio/kafka-go"
+	"log/slog"
+	"time"
+)
+
+type EventReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Consume handles the events until the context is done. A message is committed once handled,
+// so events are processed at least once; an event still failing after a few attempts is skipped
+// so it does not block the events behind it.
+func (d *Delivery) Consume(ctx context.Context, reader EventReader) {
+	const maxAttempts = 3
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
+			d.logger.Error(err.Error())
+			time.Sleep(time.Second)
+
+			continue
+		}
+
+		var event outbox.Message
+
+		err = json.Unmarshal(msg.Value, &event)
+		if err != nil {
+			d.logger.Error("invalid event skipped", slog.String("error", err.Error()), slog.Int64("offset", msg.Offset))
+		}
+
+		for attempt := 1; err == nil; attempt++ {
+			err = d.useCase.HandleEvent(ctx, event)
+			if err == nil || attempt == maxAttempts || ctx.Err() != nil {
+				break
+			}
+
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
+		if err != nil {
+			d.logger.Error("event skipped",
+				slog.String("event_uid", event.EventUID),
+				slog.String("type", event.Type),
+				slog.String("error", err.Error()),
+			)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		err = reader.CommitMessages(ctx, msg)
+		if err != nil {
+			d.logger.Error(err.Error())
+		}
+	}
+}
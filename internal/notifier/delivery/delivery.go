@@ -0,0 +1,112 @@
+package delivery
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/notifier/delivery/errors"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/outbox"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"net/mail"
+	"strconv"
+)
+
+type UseCase interface {
+	app.HealthChecker
+	GetPreferences(ctx context.Context, username string) (res models.NotificationPreferences, err error)
+	SetPreferences(ctx context.Context, preferences models.NotificationPreferences) error
+	GetNotifications(ctx context.Context, username string, limit uint64) (res []models.Notification, err error)
+	HandleEvent(ctx context.Context, event outbox.Message) error
+}
+
+type Delivery struct {
+	useCase UseCase
+	logger  *slog.Logger
+}
+
+func New(useCase UseCase, logger *slog.Logger) *Delivery {
+	return &Delivery{
+		useCase: useCase,
+		logger:  logger,
+	}
+}
+
+func (d *Delivery) HealthCheck(ctx context.Context) error {
+	return d.useCase.HealthCheck(ctx)
+}
+
+func (d *Delivery) AddHandlers(router fiber.Router) {
+	router.Get("/", d.getNotifications)
+	router.Get("/preferences", d.getPreferences)
+	router.Put("/preferences", d.setPreferences)
+}
+
+func (d *Delivery) getNotifications(ctx *fiber.Ctx) error {
+	username := ctx.Get("X-User-Name")
+	if username == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrUsernameNotSet.Map())
+	}
+
+	limit := uint64(pagination.MaxLimit)
+	if ctx.Query("limit") != "" {
+		var err error
+		limit, err = strconv.ParseUint(ctx.Query("limit"), 10, 64)
+		if err != nil || limit == 0 || limit > pagination.MaxLimit {
+			return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidNotificationsLimit.Map())
+		}
+	}
+
+	notifications, err := d.useCase.GetNotifications(ctx.Context(), username, limit)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewNotificationsDTO(notifications))
+}
+
+func (d *Delivery) getPreferences(ctx *fiber.Ctx) error {
+	username := ctx.Get("X-User-Name")
+	if username == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrUsernameNotSet.Map())
+	}
+
+	preferences, err := d.useCase.GetPreferences(ctx.Context(), username)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewPreferencesDTO(preferences))
+}
+
+func (d *Delivery) setPreferences(ctx *fiber.Ctx) error {
+	username := ctx.Get("X-User-Name")
+	if username == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrUsernameNotSet.Map())
+	}
+
+	var dto PreferencesDTO
+
+	err := ctx.BodyParser(&dto)
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPreferences.Map())
+	}
+
+	if dto.Email != "" {
+		address, err := mail.ParseAddress(dto.Email)
+		if err != nil || address.Address != dto.Email {
+			return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidEmail.Map())
+		}
+	}
+
+	preferences := dto.ToModel(username)
+
+	err = d.useCase.SetPreferences(ctx.Context(), preferences)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewPreferencesDTO(preferences))
+}
@@ -0,0 +1,65 @@
+package delivery
+
+import (
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"time"
+)
+
+type PreferencesDTO struct {
+	Email               string `json:"email"`
+	BookingConfirmation bool   `json:"bookingConfirmation"`
+	PickupReminder      bool   `json:"pickupReminder"`
+	OverdueWarning      bool   `json:"overdueWarning"`
+	RefundReceipt       bool   `json:"refundReceipt"`
+}
+
+func NewPreferencesDTO(preferences models.NotificationPreferences) PreferencesDTO {
+	return PreferencesDTO{
+		Email:               preferences.Email,
+		BookingConfirmation: preferences.BookingConfirmation,
+		PickupReminder:      preferences.PickupReminder,
+		OverdueWarning:      preferences.OverdueWarning,
+		RefundReceipt:       preferences.RefundReceipt,
+	}
+}
+
+func (preferences PreferencesDTO) ToModel(username string) models.NotificationPreferences {
+	return models.NotificationPreferences{
+		Username:            username,
+		Email:               preferences.Email,
+		BookingConfirmation: preferences.BookingConfirmation,
+		PickupReminder:      preferences.PickupReminder,
+		OverdueWarning:      preferences.OverdueWarning,
+		RefundReceipt:       preferences.RefundReceipt,
+	}
+}
+
+type NotificationDTO struct {
+	NotificationUID string                  `json:"notificationUid"`
+	Kind            models.NotificationKind `json:"kind"`
+	Recipient       string                  `json:"recipient,omitempty"`
+	Subject         string                  `json:"subject"`
+	Body            string                  `json:"body"`
+	SentAt          string                  `json:"sentAt"`
+}
+
+type NotificationsDTO struct {
+	Items []NotificationDTO `json:"items"`
+}
+
+func NewNotificationsDTO(notifications []models.Notification) NotificationsDTO {
+	items := make([]NotificationDTO, 0, len(notifications))
+
+	for _, notification := range notifications {
+		items = append(items, NotificationDTO{
+			NotificationUID: notification.NotificationUID,
+			Kind:            notification.Kind,
+			Recipient:       notification.Recipient,
+			Subject:         notification.Subject,
+			Body:            notification.Body,
+			SentAt:          notification.SentAt.Format(time.RFC3339),
+		})
+	}
+
+	return NotificationsDTO{Items: items}
+}
@@ -0,0 +1,18 @@
+package errors
+
+type NotifierError string
+
+func (e NotifierError) Error() string {
+	return string(e)
+}
+
+func (e NotifierError) Map() map[string]any {
+	return map[string]any{"message": e.Error()}
+}
+
+const (
+	ErrUsernameNotSet            NotifierError = "username not set"
+	ErrInvalidPreferences        NotifierError = "invalid notification preferences"
+	ErrInvalidEmail              NotifierError = "invalid email"
+	ErrInvalidNotificationsLimit NotifierError = "invalid notifications limit"
+)
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"database/sql"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"time"
+)
+
+type RentalDTO struct {
+	RentalUID           string              `db:"rental_uid"`
+	Username            string              `db:"username"`
+	CarUID              string              `db:"car_uid"`
+	PaymentUID          string              `db:"payment_uid"`
+	SurchargePaymentUID sql.NullString      `db:"surcharge_payment_uid"`
+	DateFrom            time.Time           `db:"date_from"`
+	DateTo              time.Time           `db:"date_to"`
+	Status              models.RentalStatus `db:"status"`
+}
+
+func NewRentalDTO(rental models.Rental) RentalDTO {
+	return RentalDTO{
+		RentalUID:           rental.RentalUID,
+		Username:            rental.Username,
+		CarUID:              rental.CarUID,
+		PaymentUID:          rental.PaymentUID,
+		SurchargePaymentUID: sql.NullString{String: rental.SurchargePaymentUID, Valid: rental.SurchargePaymentUID != ""},
+		DateFrom:            rental.DateFrom,
+		DateTo:              rental.DateTo,
+		Status:              rental.Status,
+	}
+}
+
+func (rental RentalDTO) ToModel() models.Rental {
+	return models.Rental{
+		RentalUID:           rental.RentalUID,
+		SurchargePaymentUID: rental.SurchargePaymentUID.String,
+		RentalProperties: models.RentalProperties{
+			Username:   rental.Username,
+			PaymentUID: rental.PaymentUID,
+			CarUID:     rental.CarUID,
+			DateFrom:   rental.DateFrom,
+			DateTo:     rental.DateTo,
+			Status:     rental.Status,
+		},
+	}
+}
+
+type RentalsDTO []RentalDTO
+
+func (rentals RentalsDTO) ToModel() []models.Rental {
+	result := make([]models.Rental, 0, len(rentals))
+
+	for _, rental := range rentals {
+		result = append(result, rental.ToModel())
+	}
+
+	return result
+}
+
+type PreferencesDTO struct {
+	Username            string `db:"username"`
+	Email               string `db:"email"`
+	BookingConfirmation bool   `db:"booking_confirmation"`
+	PickupReminder      bool   `db:"pickup_reminder"`
+	OverdueWarning      bool   `db:"overdue_warning"`
+	RefundReceipt       bool   `db:"refund_receipt"`
+}
+
+func NewPreferencesDTO(preferences models.NotificationPreferences) PreferencesDTO {
+	return PreferencesDTO{
+		Username:            preferences.Username,
+		Email:               preferences.Email,
+		BookingConfirmation: preferences.BookingConfirmation,
+		PickupReminder:      preferences.PickupReminder,
+		OverdueWarning:      preferences.OverdueWarning,
+		RefundReceipt:       preferences.RefundReceipt,
+	}
+}
+
+func (preferences PreferencesDTO) ToModel() models.NotificationPreferences {
+	return models.NotificationPreferences{
+		Username:            preferences.Username,
+		Email:               preferences.Email,
+		BookingConfirmation: preferences.BookingConfirmation,
+		PickupReminder:      preferences.PickupReminder,
+		OverdueWarning:      preferences.OverdueWarning,
+		RefundReceipt:       preferences.RefundReceipt,
+	}
+}
+
+type NotificationDTO struct {
+	ID              int64                   `db:"id"`
+	NotificationUID string                  `db:"notification_uid"`
+	Key             string                  `db:"key"`
+	Username        string                  `db:"username"`
+	Kind            models.NotificationKind `db:"kind"`
+	Recipient       string                  `db:"recipient"`
+	Subject         string                  `db:"subject"`
+	Body            string                  `db:"body"`
+	SentAt          time.Time               `db:"sent_at"`
+}
+
+func NewNotificationDTO(notification models.Notification) NotificationDTO {
+	return NotificationDTO{
+		ID:              notification.ID,
+		NotificationUID: notification.NotificationUID,
+		Key:             notification.Key,
+		Username:        notification.Username,
+		Kind:            notification.Kind,
+		Recipient:       notification.Recipient,
+		Subject:         notification.Subject,
+		Body:            notification.Body,
+		SentAt:          notification.SentAt,
+	}
+}
+
+func (notification NotificationDTO) ToModel() models.Notification {
+	return models.Notification{
+		ID:              notification.ID,
+		NotificationUID: notification.NotificationUID,
+		Key:             notification.Key,
+		Username:        notification.Username,
+		Kind:            notification.Kind,
+		Recipient:       notification.Recipient,
+		Subject:         notification.Subject,
+		Body:            notification.Body,
+		SentAt:          notification.SentAt,
+	}
+}
+
+type NotificationsDTO []NotificationDTO
+
+func (notifications NotificationsDTO) ToModel() []models.Notification {
+	result := make([]models.Notification, 0, len(notifications))
+
+	for _, notification := range notifications {
+		result = append(result, notification.ToModel())
+	}
+
+	return result
+}
@@ -0,0 +1,49 @@
+package repository
+
+const (
+	upsertRentalQuery = `
+		insert into rentals(rental_uid, username, car_uid, payment_uid, surcharge_payment_uid, date_from, date_to, status)
+		values (:rental_uid, :username, :car_uid, :payment_uid, :surcharge_payment_uid, :date_from, :date_to, :status)
+		on conflict (rental_uid) do update set
+			surcharge_payment_uid = excluded.surcharge_payment_uid,
+			date_from = excluded.date_from,
+			date_to = excluded.date_to,
+			status = excluded.status;
+	`
+	selectRentalByPaymentQuery = `select * from rentals where payment_uid = $1 or surcharge_payment_uid = $1 limit 1;`
+	// Due reminders exclude rentals notified already; keys are built as models.NotificationKey does
+	selectDuePickupsQuery = `
+		select * from rentals r
+		where r.status = 'RESERVED' and r.date_from > $1 and r.date_from <= $2 and not exists (
+			select 1 from notifications n where n.key = 'PICKUP_REMINDER:' || r.rental_uid
+		)
+		order by r.date_from
+		limit $3;
+	`
+	selectOverdueRentalsQuery = `
+		select * from rentals r
+		where r.status = 'IN_PROGRESS' and r.date_to <= $1 and not exists (
+			select 1 from notifications n where n.key = 'OVERDUE_WARNING:' || r.rental_uid
+		)
+		order by r.date_to
+		limit $2;
+	`
+	selectPreferencesQuery = `select * from notification_preferences where username = $1 limit 1;`
+	upsertPreferencesQuery = `
+		insert into notification_preferences(username, email, booking_confirmation, pickup_reminder, overdue_warning, refund_receipt)
+		values (:username, :email, :booking_confirmation, :pickup_reminder, :overdue_warning, :refund_receipt)
+		on conflict (username) do update set
+			email = excluded.email,
+			booking_confirmation = excluded.booking_confirmation,
+			pickup_reminder = excluded.pickup_reminder,
+			overdue_warning = excluded.overdue_warning,
+			refund_receipt = excluded.refund_receipt;
+	`
+	countNotificationsQuery = `select count(*) from notifications where key = $1;`
+	insertNotificationQuery = `
+		insert into notifications(notification_uid, key, username, kind, recipient, subject, body)
+		values (:notification_uid, :key, :username, :kind, :recipient, :subject, :body)
+		on conflict (key) do nothing;
+	`
+	selectNotificationsQuery = `select * from notifications where username = $1 order by id desc limit $2;`
+)
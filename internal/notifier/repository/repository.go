@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/sqlxutils"
+	"github.com/google/uuid"
+	"log/slog"
+	"time"
+)
+
+type SqlxRepository struct {
+	db     *sqlxutils.DB
+	logger *slog.Logger
+}
+
+func NewSqlxRepository(db *sqlxutils.DB, logger *slog.Logger) *SqlxRepository {
+	return &SqlxRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *SqlxRepository) HealthCheck(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *SqlxRepository) SaveRental(ctx context.Context, rental models.Rental) error {
+	dto := NewRentalDTO(rental)
+
+	_, err := sqlxutils.NamedExec(ctx, r.db, upsertRentalQuery, &dto)
+
+	return err
+}
+
+func (r *SqlxRepository) GetRentalByPayment(ctx context.Context, paymentUID string) (models.Rental, bool, error) {
+	var dto RentalDTO
+
+	err := sqlxutils.Get(ctx, r.db, &dto, selectRentalByPaymentQuery, paymentUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Rental{}, false, nil
+	} else if err != nil {
+		return models.Rental{}, false, err
+	}
+
+	return dto.ToModel(), true, nil
+}
+
+// GetDuePickups returns the reserved rentals starting within (after, before] which were not reminded of yet.
+func (r *SqlxRepository) GetDuePickups(ctx context.Context, after, before time.Time, limit uint64) ([]models.Rental, error) {
+	rentals := make(RentalsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db, &rentals, selectDuePickupsQuery, after, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return rentals.ToModel(), nil
+}
+
+// GetOverdueRentals returns the rentals in progress ended before the time which were not warned of yet.
+func (r *SqlxRepository) GetOverdueRentals(ctx context.Context, before time.Time, limit uint64) ([]models.Rental, error) {
+	rentals := make(RentalsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db, &rentals, selectOverdueRentalsQuery, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return rentals.ToModel(), nil
+}
+
+func (r *SqlxRepository) GetPreferences(ctx context.Context, username string) (models.NotificationPreferences, bool, error) {
+	var dto PreferencesDTO
+
+	err := sqlxutils.Get(ctx, r.db, &dto, selectPreferencesQuery, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.NotificationPreferences{}, false, nil
+	} else if err != nil {
+		return models.NotificationPreferences{}, false, err
+	}
+
+	return dto.ToModel(), true, nil
+}
+
+func (r *SqlxRepository) SetPreferences(ctx context.Context, preferences models.NotificationPreferences) error {
+	dto := NewPreferencesDTO(preferences)
+
+	_, err := sqlxutils.NamedExec(ctx, r.db, upsertPreferencesQuery, &dto)
+
+	return err
+}
+
+func (r *SqlxRepository) NotificationSent(ctx context.Context, key string) (bool, error) {
+	var count int64
+
+	err := sqlxutils.Get(ctx, r.db, &count, countNotificationsQuery, key)
+	if err != nil {
+		return false, err
+	}
+
+	return count != 0, nil
+}
+
+func (r *SqlxRepository) SaveNotification(ctx context.Context, notification models.Notification) error {
+	dto := NewNotificationDTO(notification)
+	dto.NotificationUID = uuid.New().String()
+
+	_, err := sqlxutils.NamedExec(ctx, r.db, insertNotificationQuery, &dto)
+
+	return err
+}
+
+func (r *SqlxRepository) GetNotifications(ctx context.Context, username string, limit uint64) ([]models.Notification, error) {
+	notifications := make(NotificationsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db.Reader(), &notifications, selectNotificationsQuery, username, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return notifications.ToModel(), nil
+}
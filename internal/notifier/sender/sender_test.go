@@ -0,0 +1,76 @@
+package sender_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/notifier/sender"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+var notification = models.Notification{
+	Key:      "BOOKING_CONFIRMATION:rental-uid",
+	Username: "Test Max",
+	Kind:     models.NotificationBookingConfirmation,
+	Subject:  "Your rental is booked",
+	Body:     "Hello, Test Max!",
+}
+
+type SenderSuite struct {
+	suite.Suite
+}
+
+func (s *SenderSuite) TestWriter(t provider.T) {
+	t.Epic("Notifications")
+	t.Severity(allure.NORMAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("notification to the email", func(sCtx provider.StepCtx) {
+		// arrange
+		var out bytes.Buffer
+		mailed := notification
+		mailed.Recipient = "max@example.com"
+		// act
+		err := sender.NewWriter(&out).Send(ctx, mailed)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Contains(out.String(), "BOOKING_CONFIRMATION to max@example.com\nSubject: Your rental is booked\n\nHello, Test Max!\n")
+	})
+
+	t.WithNewStep("notification of a user without an email", func(sCtx provider.StepCtx) {
+		// arrange
+		var out bytes.Buffer
+		// act
+		err := sender.NewWriter(&out).Send(ctx, notification)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Contains(out.String(), "BOOKING_CONFIRMATION to Test Max\n")
+	})
+}
+
+func (s *SenderSuite) TestSMTP(t provider.T) {
+	t.Epic("Notifications")
+	t.Severity(allure.NORMAL)
+
+	t.WithNewStep("user without an email is not mailed", func(sCtx provider.StepCtx) {
+		// arrange
+		logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+		smtpSender := sender.NewSMTP("smtp.invalid", "25", "", "", "rentals@example.com", logger)
+		// act
+		err := smtpSender.Send(context.Background(), notification)
+		// assert
+		sCtx.Require().NoError(err)
+	})
+}
+
+func TestSender(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(SenderSuite))
+}
@@ -0,0 +1,60 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+type SMTPSender struct {
+	addr   string
+	auth   smtp.Auth
+	from   string
+	logger *slog.Logger
+}
+
+func NewSMTP(host, port, username, password, from string, logger *slog.Logger) *SMTPSender {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPSender{
+		addr:   net.JoinHostPort(host, port),
+		auth:   auth,
+		from:   from,
+		logger: logger,
+	}
+}
+
+// Send mails the notification. Users without an email are skipped, as they chose not to be mailed.
+func (s *SMTPSender) Send(_ context.Context, notification models.Notification) error {
+	if notification.Recipient == "" {
+		s.logger.Debug("no email set, notification not mailed",
+			slog.String("username", notification.Username),
+			slog.String("kind", string(notification.Kind)),
+		)
+
+		return nil
+	}
+
+	var msg strings.Builder
+
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", headerValue(notification.Recipient))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerValue(notification.Subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(notification.Body, "\n", "\r\n"))
+
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{notification.Recipient}, []byte(msg.String()))
+}
+
+// headerValue keeps rendered values from breaking out of their header line.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
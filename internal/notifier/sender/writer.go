@@ -0,0 +1,47 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// WriterSender prints notifications to a writer, e.g. stdout or a file, for local use.
+type WriterSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriter(w io.Writer) *WriterSender {
+	return &WriterSender{w: w}
+}
+
+// NewFile appends notifications to the file; the returned closer closes it.
+func NewFile(path string) (*WriterSender, io.Closer, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewWriter(file), file, nil
+}
+
+func (s *WriterSender) Send(_ context.Context, notification models.Notification) error {
+	recipient := notification.Recipient
+	if recipient == "" {
+		recipient = notification.Username
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "--- %s %s to %s\nSubject: %s\n\n%s\n",
+		time.Now().Format(time.RFC3339), notification.Kind, recipient, notification.Subject, notification.Body,
+	)
+
+	return err
+}
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"go.uber.org/multierr"
+	"time"
+)
+
+func (u *UseCase) RunReminders(ctx context.Context) {
+	if u.config.ReminderInterval <= 0 {
+		u.logger.Warn("reminder interval not set, reminders disabled")
+		return
+	}
+
+	ticker := time.NewTicker(u.config.ReminderInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := u.SendDueReminders(ctx, time.Now())
+			if err != nil {
+				u.logger.Error(err.Error())
+			}
+		}
+	}
+}
+
+// SendDueReminders reminds of the pickups starting within the pickup reminder period
+// and warns of the rentals overdue for longer than the grace period.
+func (u *UseCase) SendDueReminders(ctx context.Context, now time.Time) error {
+	const batchSize = 100
+
+	pickups, err := u.repo.GetDuePickups(ctx, now, now.Add(u.config.PickupReminder), batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, rental := range pickups {
+		err = multierr.Append(err, u.notify(ctx, models.NotificationPickupReminder, rental.RentalUID, rental.Username, rentalData(rental)))
+	}
+
+	overdue, overdueErr := u.repo.GetOverdueRentals(ctx, now.Add(-u.config.OverdueGrace), batchSize)
+	if overdueErr != nil {
+		return multierr.Append(err, overdueErr)
+	}
+
+	for _, rental := range overdue {
+		err = multierr.Append(err, u.notify(ctx, models.NotificationOverdueWarning, rental.RentalUID, rental.Username, rentalData(rental)))
+	}
+
+	return err
+}
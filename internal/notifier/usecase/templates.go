@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/pkg/errors"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateData is what notification templates are rendered with.
+type TemplateData struct {
+	Username  string
+	RentalUID string
+	CarUID    string
+	DateFrom  time.Time
+	DateTo    time.Time
+	Amount    string // major units with the fraction, e.g. 1500.50
+	Currency  string
+	Reason    string
+}
+
+var defaultTemplates = []app.NotificationTemplate{
+	{
+		Kind:    string(models.NotificationBookingConfirmation),
+		Subject: "Your rental is booked",
+		Body: "Hello, {{.Username}}!\n\n" +
+			"Your rental {{.RentalUID}} of car {{.CarUID}} is booked " +
+			"from {{.DateFrom.Format \"2006-01-02\"}} to {{.DateTo.Format \"2006-01-02\"}}.\n",
+	},
+	{
+		Kind:    string(models.NotificationPickupReminder),
+		Subject: "Your rental starts soon",
+		Body: "Hello, {{.Username}}!\n\n" +
+			"Don't forget to pick up car {{.CarUID}} on {{.DateFrom.Format \"2006-01-02\"}} (rental {{.RentalUID}}).\n",
+	},
+	{
+		Kind:    string(models.NotificationOverdueWarning),
+		Subject: "Your rental is overdue",
+		Body: "Hello, {{.Username}}!\n\n" +
+			"Rental {{.RentalUID}} ended on {{.DateTo.Format \"2006-01-02\"}}, but car {{.CarUID}} has not been returned yet. " +
+			"Every overdue day is charged along with a penalty.\n",
+	},
+	{
+		Kind:    string(models.NotificationRefundReceipt),
+		Subject: "Refund receipt",
+		Body: "Hello, {{.Username}}!\n\n" +
+			"{{.Amount}} {{.Currency}} were refunded for rental {{.RentalUID}}" +
+			"{{if .Reason}} ({{.Reason}}){{end}}.\n",
+	},
+}
+
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+type Templates struct {
+	templates map[models.NotificationKind]messageTemplate
+}
+
+// NewTemplates parses the default templates, replaced by the given ones of the same kind.
+func NewTemplates(overrides []app.NotificationTemplate) (*Templates, error) {
+	t := &Templates{templates: make(map[models.NotificationKind]messageTemplate)}
+
+	for _, source := range append(defaultTemplates, overrides...) {
+		kind := models.NotificationKind(source.Kind)
+		if !kind.Valid() {
+			return nil, errors.Errorf("unknown notification template kind %q", source.Kind)
+		}
+
+		subject, err := template.New(source.Kind + "_subject").Parse(source.Subject)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s subject template", source.Kind)
+		}
+
+		body, err := template.New(source.Kind + "_body").Parse(source.Body)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s body template", source.Kind)
+		}
+
+		t.templates[kind] = messageTemplate{subject: subject, body: body}
+	}
+
+	return t, nil
+}
+
+func (t *Templates) Render(kind models.NotificationKind, data TemplateData) (subject, body string, err error) {
+	tmpl := t.templates[kind]
+
+	var buf strings.Builder
+
+	err = tmpl.subject.Execute(&buf, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	subject = buf.String()
+	buf.Reset()
+
+	err = tmpl.body.Execute(&buf, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return subject, buf.String(), nil
+}
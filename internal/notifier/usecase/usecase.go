@@ -0,0 +1,207 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/outbox"
+	"log/slog"
+	"time"
+)
+
+type Repository interface {
+	HealthCheck(ctx context.Context) error
+	SaveRental(ctx context.Context, rental models.Rental) error
+	GetRentalByPayment(ctx context.Context, paymentUID string) (res models.Rental, found bool, err error)
+	GetDuePickups(ctx context.Context, after, before time.Time, limit uint64) (res []models.Rental, err error)
+	GetOverdueRentals(ctx context.Context, before time.Time, limit uint64) (res []models.Rental, err error)
+	GetPreferences(ctx context.Context, username string) (res models.NotificationPreferences, found bool, err error)
+	SetPreferences(ctx context.Context, preferences models.NotificationPreferences) error
+	NotificationSent(ctx context.Context, key string) (sent bool, err error)
+	SaveNotification(ctx context.Context, notification models.Notification) error
+	GetNotifications(ctx context.Context, username string, limit uint64) (res []models.Notification, err error)
+}
+
+type Sender interface {
+	Send(ctx context.Context, notification models.Notification) error
+}
+
+type UseCase struct {
+	repo      Repository
+	sender    Sender
+	templates *Templates
+	config    app.NotifierConfig
+	logger    *slog.Logger
+}
+
+func New(repo Repository, sender Sender, templates *Templates, config app.NotifierConfig, logger *slog.Logger) *UseCase {
+	return &UseCase{
+		repo:      repo,
+		sender:    sender,
+		templates: templates,
+		config:    config,
+		logger:    logger,
+	}
+}
+
+func (u *UseCase) HealthCheck(ctx context.Context) error {
+	return u.repo.HealthCheck(ctx)
+}
+
+func (u *UseCase) GetPreferences(ctx context.Context, username string) (models.NotificationPreferences, error) {
+	preferences, found, err := u.repo.GetPreferences(ctx, username)
+	if err != nil {
+		return models.NotificationPreferences{}, err
+	} else if !found {
+		return models.DefaultNotificationPreferences(username), nil
+	}
+
+	return preferences, nil
+}
+
+func (u *UseCase) SetPreferences(ctx context.Context, preferences models.NotificationPreferences) error {
+	return u.repo.SetPreferences(ctx, preferences)
+}
+
+func (u *UseCase) GetNotifications(ctx context.Context, username string, limit uint64) ([]models.Notification, error) {
+	return u.repo.GetNotifications(ctx, username, limit)
+}
+
+// HandleEvent updates the rentals known to the notifier and sends the notifications the event triggers.
+// Other events are ignored.
+func (u *UseCase) HandleEvent(ctx context.Context, event outbox.Message) error {
+	switch event.AggregateType {
+	case models.AggregateRental:
+		var payload models.RentalEvent
+
+		err := json.Unmarshal(event.Payload, &payload)
+		if err != nil {
+			return err
+		}
+
+		return u.handleRentalEvent(ctx, event.Type, payload)
+	case models.AggregatePayment:
+		return u.handlePaymentEvent(ctx, event)
+	default:
+		return nil
+	}
+}
+
+func (u *UseCase) handleRentalEvent(ctx context.Context, eventType string, event models.RentalEvent) error {
+	rental := models.Rental{
+		RentalUID:           event.RentalUID,
+		SurchargePaymentUID: event.SurchargePaymentUID,
+		RentalProperties: models.RentalProperties{
+			Username:   event.Username,
+			PaymentUID: event.PaymentUID,
+			CarUID:     event.CarUID,
+			DateFrom:   event.DateFrom,
+			DateTo:     event.DateTo,
+			Status:     event.Status,
+		},
+	}
+
+	err := u.repo.SaveRental(ctx, rental)
+	if err != nil || eventType != models.EventRentalCreated {
+		return err
+	}
+
+	return u.notify(ctx, models.NotificationBookingConfirmation, rental.RentalUID, rental.Username, rentalData(rental))
+}
+
+func (u *UseCase) handlePaymentEvent(ctx context.Context, event outbox.Message) error {
+	var refund models.RefundEvent
+
+	switch event.Type {
+	case models.EventRefundIssued:
+		err := json.Unmarshal(event.Payload, &refund)
+		if err != nil {
+			return err
+		}
+	case models.EventPaymentCanceled:
+		var payment models.PaymentEvent
+
+		err := json.Unmarshal(event.Payload, &payment)
+		if err != nil {
+			return err
+		}
+
+		// Only a canceled charge returns money; canceled authorizations were never charged
+		if payment.PreviousStatus != models.PaymentPaid {
+			return nil
+		}
+
+		refund = models.RefundEvent{PaymentUID: payment.PaymentUID, Amount: payment.Price, Currency: payment.Currency}
+	default:
+		return nil
+	}
+
+	rental, found, err := u.repo.GetRentalByPayment(ctx, refund.PaymentUID)
+	if err != nil {
+		return err
+	} else if !found {
+		u.logger.Warn("refund of unknown rental payment, receipt not sent", slog.String("payment_uid", refund.PaymentUID))
+		return nil
+	}
+
+	data := rentalData(rental)
+	amount := models.Money{Amount: refund.Amount, Currency: refund.Currency}
+	data.Amount, data.Currency, data.Reason = amount.Format(), refund.Currency, refund.Reason
+
+	return u.notify(ctx, models.NotificationRefundReceipt, event.EventUID, rental.Username, data)
+}
+
+func rentalData(rental models.Rental) TemplateData {
+	return TemplateData{
+		Username:  rental.Username,
+		RentalUID: rental.RentalUID,
+		CarUID:    rental.CarUID,
+		DateFrom:  rental.DateFrom,
+		DateTo:    rental.DateTo,
+	}
+}
+
+// notify sends the notification of the kind about the subject, unless the user opted out of it or it was sent already.
+func (u *UseCase) notify(ctx context.Context, kind models.NotificationKind, subjectUID, username string, data TemplateData) error {
+	preferences, err := u.GetPreferences(ctx, username)
+	if err != nil {
+		return err
+	} else if !preferences.Allows(kind) {
+		return nil
+	}
+
+	key := models.NotificationKey(kind, subjectUID)
+
+	sent, err := u.repo.NotificationSent(ctx, key)
+	if err != nil || sent {
+		return err
+	}
+
+	subject, body, err := u.templates.Render(kind, data)
+	if err != nil {
+		return err
+	}
+
+	notification := models.Notification{
+		Key:       key,
+		Username:  username,
+		Kind:      kind,
+		Recipient: preferences.Email,
+		Subject:   subject,
+		Body:      body,
+	}
+
+	err = u.sender.Send(ctx, notification)
+	if err != nil {
+		return err
+	}
+
+	u.logger.Info("notification sent",
+		slog.String("kind", string(kind)),
+		slog.String("username", username),
+		slog.String("key", key),
+	)
+
+	return u.repo.SaveNotification(ctx, notification)
+}
@@ -0,0 +1,550 @@
+package usecase_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/notifier/usecase"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/outbox"
+	"github.com/google/uuid"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+const username = "Test Max"
+
+// repository keeps the notifier state in memory, as the Postgres repository does.
+type repository struct {
+	mu            sync.Mutex
+	rentals       map[string]models.Rental
+	preferences   map[string]models.NotificationPreferences
+	notifications []models.Notification
+}
+
+func newRepository() *repository {
+	return &repository{
+		rentals:     make(map[string]models.Rental),
+		preferences: make(map[string]models.NotificationPreferences),
+	}
+}
+
+func (r *repository) HealthCheck(context.Context) error {
+	return nil
+}
+
+func (r *repository) SaveRental(_ context.Context, rental models.Rental) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rentals[rental.RentalUID] = rental
+
+	return nil
+}
+
+func (r *repository) GetRentalByPayment(_ context.Context, paymentUID string) (models.Rental, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rental := range r.rentals {
+		if rental.PaymentUID == paymentUID || rental.SurchargePaymentUID == paymentUID {
+			return rental, true, nil
+		}
+	}
+
+	return models.Rental{}, false, nil
+}
+
+func (r *repository) sent(key string) bool {
+	for _, notification := range r.notifications {
+		if notification.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *repository) GetDuePickups(_ context.Context, after, before time.Time, _ uint64) (res []models.Rental, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rental := range r.rentals {
+		if rental.Status == models.RentalReserved && rental.DateFrom.After(after) && !rental.DateFrom.After(before) &&
+			!r.sent(models.NotificationKey(models.NotificationPickupReminder, rental.RentalUID)) {
+			res = append(res, rental)
+		}
+	}
+
+	return res, nil
+}
+
+func (r *repository) GetOverdueRentals(_ context.Context, before time.Time, _ uint64) (res []models.Rental, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rental := range r.rentals {
+		if rental.Status == models.RentalInProgress && !rental.DateTo.After(before) &&
+			!r.sent(models.NotificationKey(models.NotificationOverdueWarning, rental.RentalUID)) {
+			res = append(res, rental)
+		}
+	}
+
+	return res, nil
+}
+
+func (r *repository) GetPreferences(_ context.Context, username string) (models.NotificationPreferences, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	preferences, found := r.preferences[username]
+
+	return preferences, found, nil
+}
+
+func (r *repository) SetPreferences(_ context.Context, preferences models.NotificationPreferences) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.preferences[preferences.Username] = preferences
+
+	return nil
+}
+
+func (r *repository) NotificationSent(_ context.Context, key string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sent(key), nil
+}
+
+func (r *repository) SaveNotification(_ context.Context, notification models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.sent(notification.Key) {
+		r.notifications = append(r.notifications, notification)
+	}
+
+	return nil
+}
+
+func (r *repository) GetNotifications(_ context.Context, username string, limit uint64) (res []models.Notification, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.notifications) - 1; i >= 0 && uint64(len(res)) < limit; i-- {
+		if r.notifications[i].Username == username {
+			res = append(res, r.notifications[i])
+		}
+	}
+
+	return res, nil
+}
+
+// sender records the sent notifications.
+type sender struct {
+	mu   sync.Mutex
+	sent []models.Notification
+}
+
+func (s *sender) Send(_ context.Context, notification models.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, notification)
+
+	return nil
+}
+
+func (s *sender) kinds() []models.NotificationKind {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]models.NotificationKind, 0, len(s.sent))
+	for _, notification := range s.sent {
+		res = append(res, notification.Kind)
+	}
+
+	return res
+}
+
+type environment struct {
+	repo    *repository
+	sender  *sender
+	useCase *usecase.UseCase
+}
+
+var config = app.NotifierConfig{
+	PickupReminder: 24 * time.Hour,
+	OverdueGrace:   2 * time.Hour,
+}
+
+func newEnvironment(t provider.StepCtx) *environment {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	templates, err := usecase.NewTemplates(nil)
+	t.Require().NoError(err)
+
+	env := &environment{repo: newRepository(), sender: new(sender)}
+	env.useCase = usecase.New(env.repo, env.sender, templates, config, logger)
+
+	return env
+}
+
+func event(t provider.StepCtx, aggregateType, eventType string, payload any) outbox.Message {
+	data, err := json.Marshal(payload)
+	t.Require().NoError(err)
+
+	return outbox.Message{
+		EventUID:      uuid.NewString(),
+		Type:          eventType,
+		AggregateType: aggregateType,
+		OccurredAt:    time.Now(),
+		Payload:       data,
+	}
+}
+
+func rentalEvent(status models.RentalStatus, dateFrom, dateTo time.Time) models.RentalEvent {
+	return models.RentalEvent{
+		RentalUID:  uuid.NewString(),
+		Username:   username,
+		CarUID:     uuid.NewString(),
+		PaymentUID: uuid.NewString(),
+		DateFrom:   dateFrom,
+		DateTo:     dateTo,
+		Status:     status,
+	}
+}
+
+// rentalCreated handles the creation of a rental reserved for the days from now.
+func (env *environment) rentalCreated(t provider.StepCtx, from, to int) models.RentalEvent {
+	rental := rentalEvent(models.RentalReserved, time.Now().AddDate(0, 0, from), time.Now().AddDate(0, 0, to))
+	t.Require().NoError(env.useCase.HandleEvent(context.Background(), event(t, models.AggregateRental, models.EventRentalCreated, rental)))
+
+	return rental
+}
+
+// saveRental stores the rental as its events do, without the notifications they trigger.
+func (env *environment) saveRental(t provider.StepCtx, event models.RentalEvent) {
+	t.Require().NoError(env.repo.SaveRental(context.Background(), models.Rental{
+		RentalUID: event.RentalUID,
+		RentalProperties: models.RentalProperties{
+			Username:   event.Username,
+			PaymentUID: event.PaymentUID,
+			CarUID:     event.CarUID,
+			DateFrom:   event.DateFrom,
+			DateTo:     event.DateTo,
+			Status:     event.Status,
+		},
+	}))
+}
+
+type UseCaseSuite struct {
+	suite.Suite
+}
+
+func (s *UseCaseSuite) TestRentalEvents(t provider.T) {
+	t.Epic("Notifications")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("booking is confirmed", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		rental := rentalEvent(models.RentalReserved, time.Now().AddDate(0, 0, 3), time.Now().AddDate(0, 0, 5))
+		// act
+		err := env.useCase.HandleEvent(ctx, event(sCtx, models.AggregateRental, models.EventRentalCreated, rental))
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(env.sender.sent, 1)
+		sCtx.Require().Equal(models.NotificationBookingConfirmation, env.sender.sent[0].Kind)
+		sCtx.Require().Equal("Your rental is booked", env.sender.sent[0].Subject)
+		sCtx.Require().Contains(env.sender.sent[0].Body, rental.RentalUID)
+		sCtx.Require().Contains(env.sender.sent[0].Body, rental.DateFrom.Format(time.DateOnly))
+
+		notifications, err := env.useCase.GetNotifications(ctx, username, 10)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(notifications, 1)
+	})
+
+	t.WithNewStep("redelivered event is not notified twice", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		rental := rentalEvent(models.RentalReserved, time.Now().AddDate(0, 0, 3), time.Now().AddDate(0, 0, 5))
+		created := event(sCtx, models.AggregateRental, models.EventRentalCreated, rental)
+		sCtx.Require().NoError(env.useCase.HandleEvent(ctx, created))
+		// act
+		err := env.useCase.HandleEvent(ctx, created)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(env.sender.sent, 1)
+	})
+
+	t.WithNewStep("other rental events update the rental silently", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		rental := env.rentalCreated(sCtx, 3, 5)
+		rental.Status = models.RentalCanceled
+		// act
+		err := env.useCase.HandleEvent(ctx, event(sCtx, models.AggregateRental, models.EventRentalCanceled, rental))
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal([]models.NotificationKind{models.NotificationBookingConfirmation}, env.sender.kinds())
+		sCtx.Require().Equal(models.RentalCanceled, env.repo.rentals[rental.RentalUID].Status)
+	})
+
+	t.WithNewStep("user opted out of booking confirmations", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		preferences := models.DefaultNotificationPreferences(username)
+		preferences.BookingConfirmation = false
+		sCtx.Require().NoError(env.useCase.SetPreferences(ctx, preferences))
+		// act
+		env.rentalCreated(sCtx, 3, 5)
+		// assert
+		sCtx.Require().Empty(env.sender.sent)
+	})
+
+	t.WithNewStep("notification is sent to the user's email", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		preferences := models.DefaultNotificationPreferences(username)
+		preferences.Email = "max@example.com"
+		sCtx.Require().NoError(env.useCase.SetPreferences(ctx, preferences))
+		// act
+		env.rentalCreated(sCtx, 3, 5)
+		// assert
+		sCtx.Require().Len(env.sender.sent, 1)
+		sCtx.Require().Equal("max@example.com", env.sender.sent[0].Recipient)
+	})
+
+	t.WithNewStep("events of other aggregates are ignored", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		// act
+		err := env.useCase.HandleEvent(ctx, event(sCtx, models.AggregateCar, "CarLocked", models.CarLockEvent{CarUID: uuid.NewString()}))
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Empty(env.sender.sent)
+	})
+}
+
+func (s *UseCaseSuite) TestPaymentEvents(t provider.T) {
+	t.Epic("Notifications")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("refund receipt", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		rental := env.rentalCreated(sCtx, 3, 5)
+		refund := models.RefundEvent{RefundUID: uuid.NewString(), PaymentUID: rental.PaymentUID, Amount: 150050, Currency: "RUB", Reason: "early return"}
+		// act
+		err := env.useCase.HandleEvent(ctx, event(sCtx, models.AggregatePayment, models.EventRefundIssued, refund))
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal([]models.NotificationKind{models.NotificationBookingConfirmation, models.NotificationRefundReceipt}, env.sender.kinds())
+		sCtx.Require().Contains(env.sender.sent[1].Body, "1500.50 RUB were refunded for rental "+rental.RentalUID+" (early return)")
+	})
+
+	t.WithNewStep("refund of a surcharge", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		rental := rentalEvent(models.RentalFinished, time.Now().AddDate(0, 0, -3), time.Now().AddDate(0, 0, -1))
+		rental.SurchargePaymentUID = uuid.NewString()
+		sCtx.Require().NoError(env.useCase.HandleEvent(ctx, event(sCtx, models.AggregateRental, models.EventRentalFinished, rental)))
+		refund := models.RefundEvent{RefundUID: uuid.NewString(), PaymentUID: rental.SurchargePaymentUID, Amount: 100000, Currency: "RUB"}
+		// act
+		err := env.useCase.HandleEvent(ctx, event(sCtx, models.AggregatePayment, models.EventRefundIssued, refund))
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal([]models.NotificationKind{models.NotificationRefundReceipt}, env.sender.kinds())
+	})
+
+	t.WithNewStep("canceled charge is a refund", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		rental := env.rentalCreated(sCtx, 3, 5)
+		payment := models.PaymentEvent{PaymentUID: rental.PaymentUID, Status: models.PaymentCanceled, PreviousStatus: models.PaymentPaid, Price: 300000, Currency: "RUB"}
+		// act
+		err := env.useCase.HandleEvent(ctx, event(sCtx, models.AggregatePayment, models.EventPaymentCanceled, payment))
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal([]models.NotificationKind{models.NotificationBookingConfirmation, models.NotificationRefundReceipt}, env.sender.kinds())
+		sCtx.Require().Contains(env.sender.sent[1].Body, "3000.00 RUB were refunded")
+	})
+
+	t.WithNewStep("voided authorization is not a refund", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		rental := env.rentalCreated(sCtx, 3, 5)
+		payment := models.PaymentEvent{PaymentUID: rental.PaymentUID, Status: models.PaymentCanceled, PreviousStatus: models.PaymentAuthorized, Price: 300000, Currency: "RUB"}
+		// act
+		err := env.useCase.HandleEvent(ctx, event(sCtx, models.AggregatePayment, models.EventPaymentCanceled, payment))
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal([]models.NotificationKind{models.NotificationBookingConfirmation}, env.sender.kinds())
+	})
+
+	t.WithNewStep("refund of an unknown payment", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		refund := models.RefundEvent{RefundUID: uuid.NewString(), PaymentUID: uuid.NewString(), Amount: 100000, Currency: "RUB"}
+		// act
+		err := env.useCase.HandleEvent(ctx, event(sCtx, models.AggregatePayment, models.EventRefundIssued, refund))
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Empty(env.sender.sent)
+	})
+
+	t.WithNewStep("malformed payload", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		malformed := event(sCtx, models.AggregatePayment, models.EventRefundIssued, nil)
+		malformed.Payload = json.RawMessage(`{"amount":"many"}`)
+		// act
+		err := env.useCase.HandleEvent(ctx, malformed)
+		// assert
+		sCtx.Require().Error(err)
+		sCtx.Require().Empty(env.sender.sent)
+	})
+}
+
+func (s *UseCaseSuite) TestSendDueReminders(t provider.T) {
+	t.Epic("Notifications")
+	t.Severity(allure.NORMAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("pickup reminders and overdue warnings are sent once", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		now := time.Now()
+		due := rentalEvent(models.RentalReserved, now.Add(12*time.Hour), now.AddDate(0, 0, 2))
+		later := rentalEvent(models.RentalReserved, now.AddDate(0, 0, 3), now.AddDate(0, 0, 5))
+		overdue := rentalEvent(models.RentalInProgress, now.AddDate(0, 0, -3), now.Add(-3*time.Hour))
+		inGrace := rentalEvent(models.RentalInProgress, now.AddDate(0, 0, -3), now.Add(-time.Hour))
+		finished := rentalEvent(models.RentalFinished, now.AddDate(0, 0, -3), now.AddDate(0, 0, -1))
+
+		for _, rental := range []models.RentalEvent{due, later, overdue, inGrace, finished} {
+			env.saveRental(sCtx, rental)
+		}
+		// act
+		err := env.useCase.SendDueReminders(ctx, now)
+		sCtx.Require().NoError(err)
+		repeatErr := env.useCase.SendDueReminders(ctx, now)
+		// assert
+		sCtx.Require().NoError(repeatErr)
+		sCtx.Require().ElementsMatch([]models.NotificationKind{models.NotificationPickupReminder, models.NotificationOverdueWarning}, env.sender.kinds())
+
+		for _, notification := range env.sender.sent {
+			switch notification.Kind {
+			case models.NotificationPickupReminder:
+				sCtx.Require().Contains(notification.Body, due.RentalUID)
+			case models.NotificationOverdueWarning:
+				sCtx.Require().Contains(notification.Body, overdue.RentalUID)
+			}
+		}
+	})
+
+	t.WithNewStep("user opted out of reminders", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment(sCtx)
+		preferences := models.DefaultNotificationPreferences(username)
+		preferences.PickupReminder = false
+		sCtx.Require().NoError(env.useCase.SetPreferences(ctx, preferences))
+
+		due := rentalEvent(models.RentalReserved, time.Now().Add(12*time.Hour), time.Now().AddDate(0, 0, 2))
+		env.saveRental(sCtx, due)
+		// act
+		err := env.useCase.SendDueReminders(ctx, time.Now())
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Empty(env.sender.sent)
+	})
+}
+
+func (s *UseCaseSuite) TestTemplates(t provider.T) {
+	t.Epic("Notifications")
+	t.Severity(allure.NORMAL)
+
+	data := usecase.TemplateData{
+		Username:  username,
+		RentalUID: "rental-uid",
+		CarUID:    "car-uid",
+		DateFrom:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		DateTo:    time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC),
+		Amount:    "1500.00",
+		Currency:  "RUB",
+	}
+
+	t.WithNewStep("default templates", func(sCtx provider.StepCtx) {
+		// arrange
+		templates, err := usecase.NewTemplates(nil)
+		sCtx.Require().NoError(err)
+		// act
+		subject, body, err := templates.Render(models.NotificationOverdueWarning, data)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal("Your rental is overdue", subject)
+		sCtx.Require().Contains(body, "Rental rental-uid ended on 2026-10-21, but car car-uid has not been returned yet.")
+	})
+
+	t.WithNewStep("refund receipt without a reason", func(sCtx provider.StepCtx) {
+		// arrange
+		templates, err := usecase.NewTemplates(nil)
+		sCtx.Require().NoError(err)
+		// act
+		_, body, err := templates.Render(models.NotificationRefundReceipt, data)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Contains(body, "1500.00 RUB were refunded for rental rental-uid.\n")
+	})
+
+	t.WithNewStep("overridden template", func(sCtx provider.StepCtx) {
+		// arrange
+		templates, err := usecase.NewTemplates([]app.NotificationTemplate{{
+			Kind:    string(models.NotificationBookingConfirmation),
+			Subject: "Booked {{.CarUID}}",
+			Body:    "See you on {{.DateFrom.Format \"02.01.2006\"}}",
+		}})
+		sCtx.Require().NoError(err)
+		// act
+		subject, body, err := templates.Render(models.NotificationBookingConfirmation, data)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal("Booked car-uid", subject)
+		sCtx.Require().Equal("See you on 19.10.2026", body)
+	})
+
+	t.WithNewStep("template of an unknown kind", func(sCtx provider.StepCtx) {
+		// act
+		_, err := usecase.NewTemplates([]app.NotificationTemplate{{Kind: "NEWSLETTER", Subject: "News", Body: "News"}})
+		// assert
+		sCtx.Require().Error(err)
+		sCtx.Require().Contains(err.Error(), `unknown notification template kind "NEWSLETTER"`)
+	})
+
+	t.WithNewStep("malformed template", func(sCtx provider.StepCtx) {
+		// act
+		_, err := usecase.NewTemplates([]app.NotificationTemplate{{Kind: string(models.NotificationPickupReminder), Subject: "{{.CarUID", Body: "Body"}})
+		// assert
+		sCtx.Require().Error(err)
+		sCtx.Require().Contains(err.Error(), "parse PICKUP_REMINDER subject template")
+	})
+}
+
+func TestUseCase(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(UseCaseSuite))
+}
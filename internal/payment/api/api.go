@@ -4,10 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/Inspirate789/ds-lab2/internal/models"
 	"github.com/Inspirate789/ds-lab2/internal/payment/delivery"
 	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/pkg/errors"
 	"github.com/sony/gobreaker/v2"
 	"go.uber.org/multierr"
@@ -15,6 +15,7 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -102,14 +103,28 @@ func (api *PaymentsAPI) HealthCheck(ctx context.Context) (err error) {
 
 }
 
-func (api *PaymentsAPI) CreatePayment(ctx context.Context, price uint64) (res models.Payment, err error) {
-	endpoint := api.baseURL + "/api/v1/payments?price=" + strconv.FormatUint(price, 10)
+// priceQuery passes the price in minor units of its currency.
+func priceQuery(price models.Money) url.Values {
+	return url.Values{
+		"amount":   {strconv.FormatInt(price.Amount, 10)},
+		"currency": {price.Currency},
+	}
+}
+
+// CreatePayment creates a paid payment once per idempotency key, a repeated request (e.g. from the backlog)
+// returns the payment created before. An empty key creates a payment on every request.
+func (api *PaymentsAPI) CreatePayment(ctx context.Context, price models.Money, idempotencyKey string) (res models.Payment, err error) {
+	endpoint := api.baseURL + "/api/v1/payments?" + priceQuery(price).Encode()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
 	if err != nil {
 		return models.Payment{}, err
 	}
 
+	if idempotencyKey != "" {
+		req.Header.Set(delivery.IdempotencyKeyHeader, idempotencyKey)
+	}
+
 	resp, err := api.client.Do(req)
 	if err != nil {
 		var DNSError *net.DNSError
@@ -137,15 +152,55 @@ func (api *PaymentsAPI) CreatePayment(ctx context.Context, price uint64) (res mo
 		return models.Payment{}, err
 	}
 
-	return payment.ToModel(), nil
+	return payment.ToModel()
 }
 
-func (api *PaymentsAPI) SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found bool, err error) {
-	endpoint := api.baseURL + "/api/v1/payments/" + paymentUID + "/status"
+func (api *PaymentsAPI) AuthorizePayment(ctx context.Context, price models.Money) (res models.Payment, err error) {
+	endpoint := api.baseURL + "/api/v1/payments/authorize?" + priceQuery(price).Encode()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewBufferString(fmt.Sprint(status)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
 	if err != nil {
-		return false, err
+		return models.Payment{}, err
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = errors.Wrap(err, ErrServiceUnavailable)
+		}
+
+		return models.Payment{}, multierr.Combine(err, api.backlog.Push(ctx, req))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return models.Payment{}, errors.New(string(body))
+	}
+
+	var payment delivery.PaymentDTO
+
+	err = json.Unmarshal(body, &payment)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	return payment.ToModel()
+}
+
+// CapturePayment returns the payment status after the capture. A capture queued in the backlog
+// leaves the payment AUTHORIZED until the retryer delivers it.
+func (api *PaymentsAPI) CapturePayment(ctx context.Context, paymentUID string) (status models.PaymentStatus, found, allowed bool, err error) {
+	endpoint := api.baseURL + "/api/v1/payments/" + paymentUID + "/capture"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return "", false, false, err
 	}
 
 	resp, err := api.client.Do(req)
@@ -155,22 +210,340 @@ func (api *PaymentsAPI) SetPaymentStatus(ctx context.Context, paymentUID string,
 			err = nil
 		}
 
-		return true, multierr.Combine(err, api.backlog.Push(ctx, req))
+		return models.PaymentAuthorized, true, true, multierr.Combine(err, api.backlog.Push(ctx, req))
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return false, err
+		return "", false, false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", false, false, nil
+	} else if resp.StatusCode == http.StatusConflict {
+		return "", true, false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return "", false, false, errors.New(string(body))
+	}
+
+	var payment delivery.PaymentDTO
+
+	err = json.Unmarshal(body, &payment)
+	if err != nil {
+		return "", false, false, err
+	}
+
+	return payment.Status, true, true, nil
+}
+
+func (api *PaymentsAPI) VoidPayment(ctx context.Context, paymentUID string) (found, allowed bool, err error) {
+	endpoint := api.baseURL + "/api/v1/payments/" + paymentUID + "/void"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return false, false, err
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = nil
+		}
+
+		return true, true, multierr.Combine(err, api.backlog.Push(ctx, req))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, false, nil
+	} else if resp.StatusCode == http.StatusConflict {
+		return true, false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, false, errors.New(string(body))
+	}
+
+	return true, true, nil
+}
+
+func (api *PaymentsAPI) ReinstatePayment(ctx context.Context, paymentUID string) (found, allowed, changed bool, err error) {
+	endpoint := api.baseURL + "/api/v1/payments/" + paymentUID + "/reinstate"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return false, false, false, err
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = nil
+		}
+
+		return true, true, true, multierr.Combine(err, api.backlog.Push(ctx, req))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, false, false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, false, false, nil
+	} else if resp.StatusCode == http.StatusConflict {
+		return true, false, false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, false, false, errors.New(string(body))
+	}
+
+	var dto delivery.PaymentStatusUpdateDTO
+
+	err = json.Unmarshal(body, &dto)
+	if err != nil {
+		return false, false, false, err
+	}
+
+	return true, true, dto.Changed, nil
+}
+
+func (api *PaymentsAPI) LinkRental(ctx context.Context, paymentUID, rentalUID string) (found, allowed bool, err error) {
+	endpoint := api.baseURL + "/api/v1/payments/" + paymentUID + "/rental"
+
+	body, err := json.Marshal(delivery.PaymentRentalDTO{RentalUID: rentalUID})
+	if err != nil {
+		return false, false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return false, false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = nil
+		}
+
+		return true, true, multierr.Combine(err, api.backlog.Push(ctx, req))
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return false, false, err
 	}
 
 	if resp.StatusCode == http.StatusNotFound {
-		return false, nil
+		return false, false, nil
+	} else if resp.StatusCode == http.StatusConflict {
+		return true, false, nil
 	} else if resp.StatusCode != http.StatusOK {
-		return false, errors.New(string(body))
+		return false, false, errors.New(string(body))
 	}
 
-	return true, nil
+	return true, true, nil
+}
+
+func (api *PaymentsAPI) SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found, allowed, changed bool, err error) {
+	endpoint := api.baseURL + "/api/v1/payments/" + paymentUID + "/status"
+
+	body, err := json.Marshal(delivery.PaymentStatusRequestDTO{Status: status})
+	if err != nil {
+		return false, false, false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return false, false, false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = nil
+		}
+
+		return true, true, true, multierr.Combine(err, api.backlog.Push(ctx, req))
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return false, false, false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, false, false, nil
+	} else if resp.StatusCode == http.StatusConflict {
+		return true, false, false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, false, false, errors.New(string(body))
+	}
+
+	var dto delivery.PaymentStatusUpdateDTO
+
+	err = json.Unmarshal(body, &dto)
+	if err != nil {
+		return false, false, false, err
+	}
+
+	return true, true, dto.Changed, nil
+}
+
+// RefundPayment refunds the amount once per idempotency key, a repeated request (e.g. from the backlog)
+// returns the refund made before. An empty key makes a refund on every request.
+func (api *PaymentsAPI) RefundPayment(ctx context.Context, paymentUID string, amount models.Money, reason, idempotencyKey string) (res models.Refund, found, allowed bool, err error) {
+	endpoint := api.baseURL + "/api/v1/payments/" + paymentUID + "/refunds"
+
+	body, err := json.Marshal(delivery.NewRefundRequestDTO(amount, reason))
+	if err != nil {
+		return models.Refund{}, false, false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return models.Refund{}, false, false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set(delivery.IdempotencyKeyHeader, idempotencyKey)
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = errors.Wrap(err, ErrServiceUnavailable)
+		}
+
+		return models.Refund{}, false, false, multierr.Combine(err, api.backlog.Push(ctx, req))
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return models.Refund{}, false, false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return models.Refund{}, false, false, nil
+	} else if resp.StatusCode == http.StatusConflict {
+		return models.Refund{}, true, false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return models.Refund{}, false, false, errors.New(string(body))
+	}
+
+	var refund delivery.RefundDTO
+
+	err = json.Unmarshal(body, &refund)
+	if err != nil {
+		return models.Refund{}, false, false, err
+	}
+
+	res, err = refund.ToModel()
+	if err != nil {
+		return models.Refund{}, false, false, err
+	}
+
+	return res, true, true, nil
+}
+
+func (api *PaymentsAPI) GetRentalPayments(ctx context.Context, rentalUID string) ([]models.Payment, error) {
+	endpoint := api.baseURL + "/api/v1/payments?rentalUid=" + url.QueryEscape(rentalUID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = errors.Wrap(err, ErrServiceUnavailable)
+		}
+
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(string(body))
+	}
+
+	var payments delivery.PaymentsDTO
+
+	err = json.Unmarshal(body, &payments)
+	if err != nil {
+		return nil, err
+	}
+
+	res, _, err := payments.ToModel()
+
+	return res, err
+}
+
+// GetPayments lists the payments in the status; it bypasses the circuit breaker, as callers need the actual data.
+func (api *PaymentsAPI) GetPayments(ctx context.Context, status models.PaymentStatus, page pagination.Request) ([]models.Payment, pagination.Page, error) {
+	query := page.Values()
+	query.Set("status", string(status))
+
+	endpoint := api.baseURL + "/api/v1/payments?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = errors.Wrap(err, ErrServiceUnavailable)
+		}
+
+		return nil, pagination.Page{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, pagination.Page{}, errors.New(string(body))
+	}
+
+	var payments delivery.PaymentsDTO
+
+	err = json.Unmarshal(body, &payments)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	return payments.ToModel()
 }
 
 func (api *PaymentsAPI) getPayment(ctx context.Context, paymentUID string) (res models.Payment, found bool, err error) {
@@ -210,7 +583,12 @@ func (api *PaymentsAPI) getPayment(ctx context.Context, paymentUID string) (res
 		return models.Payment{}, false, err
 	}
 
-	return payment.ToModel(), true, nil
+	res, err = payment.ToModel()
+	if err != nil {
+		return models.Payment{}, false, err
+	}
+
+	return res, true, nil
 }
 
 func (api *PaymentsAPI) GetPayment(ctx context.Context, paymentUID string) (models.Payment, bool, error) {
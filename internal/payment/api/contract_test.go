@@ -0,0 +1,425 @@
+package api_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/payment/api"
+	"github.com/Inspirate789/ds-lab2/internal/payment/delivery"
+	"github.com/Inspirate789/ds-lab2/pkg/contract"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const contractPath = "../../../contracts/gateway-payments.json"
+
+const (
+	paymentUID        = "238c1b7e-3f5d-4a1c-8e9b-6d2f0a4c5b71"
+	unknownPaymentUID = "9b7c5e13-2a8d-4f60-b4e1-7d3c0a2f6e85"
+	rentalUID         = "8d5d3c36-2c4e-4b57-9a8d-7b0f5e4c1a20"
+	otherRentalUID    = "c3f1a2b4-5d6e-4f70-8a9b-0c1d2e3f4a5b"
+	refundUID         = "71e0d4c2-8b3a-4e5f-9c6d-2a1b0f9e8d7c"
+	idempotencyKey    = "surcharge:8d5d3c36-2c4e-4b57-9a8d-7b0f5e4c1a20"
+	refundKey         = "refund:8d5d3c36-2c4e-4b57-9a8d-7b0f5e4c1a20:rental canceled"
+	price             = 1400050 // minor units
+	currency          = "RUB"
+)
+
+var (
+	priceMoney  = models.Money{Amount: price, Currency: currency}
+	refundMoney = models.Money{Amount: 350025, Currency: currency}
+)
+
+func paymentState(name string) contract.State {
+	return contract.State{
+		Name: name,
+		Params: map[string]string{
+			"paymentUid": paymentUID,
+			"price":      strconv.Itoa(price),
+		},
+	}
+}
+
+var (
+	noPayments        = contract.State{Name: "no payments"}
+	paymentAuthorized = paymentState("payment is authorized")
+	paymentPaid       = paymentState("payment is paid")
+	paymentCanceled   = paymentState("payment is canceled")
+	paymentLinked     = contract.State{
+		Name: "payment is linked to a rental",
+		Params: map[string]string{
+			"paymentUid": paymentUID,
+			"price":      strconv.Itoa(price),
+			"rentalUid":  rentalUID,
+		},
+	}
+	paymentPaidForKey = contract.State{
+		Name: "payment is paid for the idempotency key",
+		Params: map[string]string{
+			"paymentUid":     paymentUID,
+			"price":          strconv.Itoa(price),
+			"idempotencyKey": idempotencyKey,
+		},
+	}
+	paymentRefundedForKey = contract.State{
+		Name: "payment is refunded for the idempotency key",
+		Params: map[string]string{
+			"paymentUid":     paymentUID,
+			"price":          strconv.Itoa(price),
+			"amount":         strconv.FormatInt(refundMoney.Amount, 10),
+			"reason":         "rental canceled",
+			"idempotencyKey": refundKey,
+		},
+	}
+	paymentNotExists = contract.State{
+		Name:   "payment does not exist",
+		Params: map[string]string{"paymentUid": unknownPaymentUID},
+	}
+)
+
+func paymentBody(status models.PaymentStatus) map[string]any {
+	return map[string]any{
+		"paymentUid": paymentUID,
+		"status":     status,
+		"price":      price,
+		"currency":   currency,
+	}
+}
+
+type ContractSuite struct {
+	suite.Suite
+}
+
+func (s *ContractSuite) TestGatewayContract(t provider.T) {
+	t.Epic("Contracts")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	consumer := contract.NewConsumer("gateway", "payments")
+	paymentAPI := api.New("http://payments", consumer.Client(), nil, 1, logger)
+
+	t.WithNewStep("authorize a payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("authorize a payment", noPayments, http.StatusOK, paymentBody(models.PaymentAuthorized), "paymentUid")
+		// act
+		payment, err := paymentAPI.AuthorizePayment(ctx, priceMoney)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Equal(paymentUID, payment.PaymentUID)
+		sCtx.Require().Equal(models.PaymentAuthorized, payment.Status)
+		sCtx.Require().Equal(priceMoney, payment.Price)
+	})
+
+	t.WithNewStep("create a paid payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("create a paid payment", noPayments, http.StatusOK, paymentBody(models.PaymentPaid), "paymentUid")
+		// act
+		payment, err := paymentAPI.CreatePayment(ctx, priceMoney, "")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Equal(paymentUID, payment.PaymentUID)
+		sCtx.Require().Equal(models.PaymentPaid, payment.Status)
+	})
+
+	t.WithNewStep("create a payment again with the idempotency key", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("create a payment again with the idempotency key", paymentPaidForKey, http.StatusOK, paymentBody(models.PaymentPaid))
+		// act
+		payment, err := paymentAPI.CreatePayment(ctx, priceMoney, idempotencyKey)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Equal(paymentUID, payment.PaymentUID)
+		sCtx.Require().Equal(models.PaymentPaid, payment.Status)
+	})
+
+	t.WithNewStep("get a payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("get a payment", paymentAuthorized, http.StatusOK, paymentBody(models.PaymentAuthorized))
+		// act
+		payment, found, err := paymentAPI.GetPayment(ctx, paymentUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().Equal(models.PaymentAuthorized, payment.Status)
+		sCtx.Require().Equal(priceMoney, payment.Price)
+	})
+
+	t.WithNewStep("get an unknown payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("get an unknown payment", paymentNotExists, http.StatusNotFound, nil)
+		// act
+		_, found, err := paymentAPI.GetPayment(ctx, unknownPaymentUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+	})
+
+	t.WithNewStep("list authorized payments", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("list authorized payments", paymentAuthorized, http.StatusOK, map[string]any{
+			"items": []map[string]any{paymentBody(models.PaymentAuthorized)},
+			"count": 1,
+		})
+		// act
+		payments, info, err := paymentAPI.GetPayments(ctx, models.PaymentAuthorized, pagination.Request{Limit: 10})
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Len(payments, 1)
+		sCtx.Require().Equal(paymentUID, payments[0].PaymentUID)
+		sCtx.Require().EqualValues(1, info.TotalCount)
+	})
+
+	t.WithNewStep("list payments of a rental", func(sCtx provider.StepCtx) {
+		// arrange
+		body := paymentBody(models.PaymentAuthorized)
+		body["rentalUid"] = rentalUID
+		consumer.Expect("list payments of a rental", paymentLinked, http.StatusOK, map[string]any{
+			"items": []map[string]any{body},
+		})
+		// act
+		payments, err := paymentAPI.GetRentalPayments(ctx, rentalUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Len(payments, 1)
+		sCtx.Require().Equal(rentalUID, payments[0].RentalUID)
+	})
+
+	t.WithNewStep("capture an authorized payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("capture an authorized payment", paymentAuthorized, http.StatusOK, paymentBody(models.PaymentPaid))
+		// act
+		status, found, allowed, err := paymentAPI.CapturePayment(ctx, paymentUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Equal(models.PaymentPaid, status)
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+	})
+
+	t.WithNewStep("capture a paid payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("capture a paid payment", paymentPaid, http.StatusConflict, nil)
+		// act
+		_, found, allowed, err := paymentAPI.CapturePayment(ctx, paymentUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+	})
+
+	t.WithNewStep("capture an unknown payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("capture an unknown payment", paymentNotExists, http.StatusNotFound, nil)
+		// act
+		_, found, allowed, err := paymentAPI.CapturePayment(ctx, unknownPaymentUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+		sCtx.Require().False(allowed)
+	})
+
+	t.WithNewStep("void an authorized payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("void an authorized payment", paymentAuthorized, http.StatusOK, nil)
+		// act
+		found, allowed, err := paymentAPI.VoidPayment(ctx, paymentUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+	})
+
+	t.WithNewStep("void a paid payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("void a paid payment", paymentPaid, http.StatusConflict, nil)
+		// act
+		found, allowed, err := paymentAPI.VoidPayment(ctx, paymentUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+	})
+
+	t.WithNewStep("link a payment to a rental", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("link a payment to a rental", paymentAuthorized, http.StatusOK, nil)
+		// act
+		found, allowed, err := paymentAPI.LinkRental(ctx, paymentUID, rentalUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+	})
+
+	t.WithNewStep("link a payment to another rental", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("link a payment to another rental", paymentLinked, http.StatusConflict, nil)
+		// act
+		found, allowed, err := paymentAPI.LinkRental(ctx, paymentUID, otherRentalUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+	})
+
+	t.WithNewStep("cancel a paid payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("cancel a paid payment", paymentPaid, http.StatusOK, delivery.PaymentStatusUpdateDTO{Changed: true})
+		// act
+		found, allowed, changed, err := paymentAPI.SetPaymentStatus(ctx, paymentUID, models.PaymentCanceled)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().True(changed)
+	})
+
+	t.WithNewStep("cancel a canceled payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("cancel a canceled payment", paymentCanceled, http.StatusOK, delivery.PaymentStatusUpdateDTO{Changed: false})
+		// act
+		found, allowed, changed, err := paymentAPI.SetPaymentStatus(ctx, paymentUID, models.PaymentCanceled)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().False(changed)
+	})
+
+	t.WithNewStep("cancel an unknown payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("cancel an unknown payment", paymentNotExists, http.StatusNotFound, nil)
+		// act
+		found, _, _, err := paymentAPI.SetPaymentStatus(ctx, unknownPaymentUID, models.PaymentCanceled)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+	})
+
+	t.WithNewStep("reinstate a canceled payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("reinstate a canceled payment", paymentCanceled, http.StatusOK, delivery.PaymentStatusUpdateDTO{Changed: true})
+		// act
+		found, allowed, changed, err := paymentAPI.ReinstatePayment(ctx, paymentUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().True(changed)
+	})
+
+	t.WithNewStep("reinstate an authorized payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("reinstate an authorized payment", paymentAuthorized, http.StatusConflict, nil)
+		// act
+		found, allowed, changed, err := paymentAPI.ReinstatePayment(ctx, paymentUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().False(changed)
+	})
+
+	t.WithNewStep("refund a paid payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("refund a paid payment", paymentPaid, http.StatusOK, delivery.RefundDTO{
+			RefundUID:  refundUID,
+			PaymentUID: paymentUID,
+			Amount:     refundMoney.Amount,
+			Currency:   currency,
+			Reason:     "rental canceled",
+			CreatedAt:  time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		}, "refundUid", "createdAt")
+		// act
+		refund, found, allowed, err := paymentAPI.RefundPayment(ctx, paymentUID, refundMoney, "rental canceled", refundKey)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().Equal(refundUID, refund.RefundUID)
+		sCtx.Require().Equal(refundMoney, refund.Amount)
+	})
+
+	t.WithNewStep("refund a payment again with the idempotency key", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("refund a payment again with the idempotency key", paymentRefundedForKey, http.StatusOK, delivery.RefundDTO{
+			RefundUID:  refundUID,
+			PaymentUID: paymentUID,
+			Amount:     refundMoney.Amount,
+			Currency:   currency,
+			Reason:     "rental canceled",
+			CreatedAt:  time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		}, "refundUid", "createdAt")
+		// act
+		refund, found, allowed, err := paymentAPI.RefundPayment(ctx, paymentUID, refundMoney, "rental canceled", refundKey)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().Equal(refundMoney, refund.Amount)
+	})
+
+	t.WithNewStep("refund an authorized payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("refund an authorized payment", paymentAuthorized, http.StatusConflict, nil)
+		// act
+		_, found, allowed, err := paymentAPI.RefundPayment(ctx, paymentUID, refundMoney, "rental canceled", refundKey)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+	})
+
+	t.WithNewStep("refund an unknown payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("refund an unknown payment", paymentNotExists, http.StatusNotFound, nil)
+		// act
+		_, found, allowed, err := paymentAPI.RefundPayment(ctx, unknownPaymentUID, refundMoney, "rental canceled", "")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+		sCtx.Require().False(allowed)
+	})
+
+	// act
+	err := consumer.Contract().Save(contractPath)
+	// assert
+	t.Require().NoError(err)
+}
+
+func TestContract(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(ContractSuite))
+}
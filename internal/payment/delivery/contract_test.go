@@ -0,0 +1,119 @@
+package delivery_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/payment/delivery"
+	paymentprovider "github.com/Inspirate789/ds-lab2/internal/payment/provider"
+	"github.com/Inspirate789/ds-lab2/internal/payment/repository"
+	"github.com/Inspirate789/ds-lab2/internal/payment/usecase"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/contract"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"strconv"
+	"testing"
+)
+
+const contractPath = "../../../contracts/gateway-payments.json"
+
+type ContractSuite struct {
+	suite.Suite
+}
+
+// setUp brings the repository to the provider state and maps the uids of the consumer to the generated ones.
+func setUp(repo *repository.MemoryRepository, useCase *usecase.UseCase, state contract.State) (replacements map[string]string, err error) {
+	ctx := context.Background()
+
+	if state.Name == "no payments" || state.Name == "payment does not exist" {
+		return nil, nil
+	}
+
+	amount, err := strconv.ParseInt(state.Params["price"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	price := models.Money{Amount: amount, Currency: models.DefaultCurrency}
+
+	var payment models.Payment
+
+	switch state.Name {
+	case "payment is authorized":
+		payment, err = repo.AuthorizePayment(ctx, price)
+	case "payment is linked to a rental":
+		payment, err = repo.AuthorizePayment(ctx, price)
+		if err == nil {
+			_, err = repo.LinkRental(ctx, payment.PaymentUID, state.Params["rentalUid"])
+		}
+	case "payment is paid":
+		payment, err = useCase.CreatePayment(ctx, price, "")
+	case "payment is paid for the idempotency key":
+		payment, err = useCase.CreatePayment(ctx, price, state.Params["idempotencyKey"])
+	case "payment is refunded for the idempotency key":
+		payment, err = useCase.CreatePayment(ctx, price, "")
+		if err == nil {
+			var refund int64
+
+			refund, err = strconv.ParseInt(state.Params["amount"], 10, 64)
+			if err == nil {
+				_, _, _, err = useCase.RefundPayment(ctx, payment.PaymentUID, models.Money{Amount: refund, Currency: models.DefaultCurrency},
+					state.Params["reason"], state.Params["idempotencyKey"])
+			}
+		}
+	case "payment is canceled":
+		payment, err = useCase.CreatePayment(ctx, price, "")
+		if err == nil {
+			_, _, _, err = useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		}
+	default:
+		return nil, fmt.Errorf("unknown provider state %q", state.Name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{state.Params["paymentUid"]: payment.PaymentUID}, nil
+}
+
+func (s *ContractSuite) TestGatewayContract(t provider.T) {
+	t.Epic("Contracts")
+	t.Severity(allure.CRITICAL)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	c, err := contract.Load(contractPath)
+	t.Require().NoError(err)
+
+	for _, interaction := range c.Interactions {
+		t.WithNewStep(interaction.Description, func(sCtx provider.StepCtx) {
+			// arrange
+			repo := repository.NewMemoryRepository(logger)
+			fakeProvider := paymentprovider.NewFake(paymentprovider.ModeApprove, 0, "", "", nil, logger)
+			useCase := usecase.New(repo, fakeProvider, logger)
+			replacements, err := setUp(repo, useCase, interaction.State)
+			sCtx.Require().NoError(err)
+			webApp, err := app.NewFiberApp(
+				app.WebConfig{PathPrefix: "/api/v1/payments"},
+				delivery.New(useCase, "", logger),
+				logger,
+			)
+			sCtx.Require().NoError(err)
+			// act
+			err = contract.Verify(webApp, interaction, replacements)
+			// assert
+			sCtx.Require().NoError(err)
+		})
+	}
+}
+
+func TestContract(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(ContractSuite))
+}
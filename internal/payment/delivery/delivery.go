@@ -5,27 +5,46 @@ import (
 	"github.com/Inspirate789/ds-lab2/internal/models"
 	"github.com/Inspirate789/ds-lab2/internal/payment/delivery/errors"
 	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"log/slog"
 	"strconv"
 )
 
+// IdempotencyKeyHeader makes a repeated payment creation or refund return the one made by the first request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 type UseCase interface {
 	app.HealthChecker
-	CreatePayment(ctx context.Context, price uint64) (res models.Payment, err error)
+	CreatePayment(ctx context.Context, price models.Money, idempotencyKey string) (res models.Payment, err error)
+	AuthorizePayment(ctx context.Context, price models.Money) (res models.Payment, err error)
+	CapturePayment(ctx context.Context, paymentUID string) (res models.Payment, found, allowed bool, err error)
+	VoidPayment(ctx context.Context, paymentUID string) (found, allowed bool, err error)
 	GetPayment(ctx context.Context, paymentUID string) (res models.Payment, found bool, err error)
-	SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found bool, err error)
+	GetPayments(ctx context.Context, status models.PaymentStatus, page pagination.Request) (res []models.Payment, info pagination.Page, err error)
+	GetRentalPayments(ctx context.Context, rentalUID string) (res []models.Payment, err error)
+	LinkRental(ctx context.Context, paymentUID, rentalUID string) (found, allowed bool, err error)
+	SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found, allowed, changed bool, err error)
+	ReinstatePayment(ctx context.Context, paymentUID string) (found, allowed, changed bool, err error)
+	RefundPayment(ctx context.Context, paymentUID string, amount models.Money, reason, idempotencyKey string) (res models.Refund, found, allowed bool, err error)
+	GetRefunds(ctx context.Context, paymentUID string) (res []models.Refund, found bool, err error)
+	AddFee(ctx context.Context, paymentUID string, amount models.Money, reason string) (found, allowed bool, err error)
+	GetLedgerEntries(ctx context.Context, paymentUID string) (res []models.LedgerEntry, found bool, err error)
+	HandleProviderResult(ctx context.Context, operationUID string, response models.ProviderResponse) (found bool, err error)
 }
 
 type Delivery struct {
-	useCase UseCase
-	logger  *slog.Logger
+	useCase       UseCase
+	webhookSecret string
+	logger        *slog.Logger
 }
 
-func New(useCase UseCase, logger *slog.Logger) *Delivery {
+func New(useCase UseCase, webhookSecret string, logger *slog.Logger) *Delivery {
 	return &Delivery{
-		useCase: useCase,
-		logger:  logger,
+		useCase:       useCase,
+		webhookSecret: webhookSecret,
+		logger:        logger,
 	}
 }
 
@@ -34,26 +53,112 @@ func (d *Delivery) HealthCheck(ctx context.Context) error {
 }
 
 func (d *Delivery) AddHandlers(router fiber.Router) {
+	router.Get("/", d.getPayments)
 	router.Post("/", d.createPayment)
+	router.Post("/webhooks/provider", d.handleProviderWebhook)
+	router.Post("/authorize", d.authorizePayment)
+	router.Post("/:paymentUID/capture", d.capturePayment)
+	router.Post("/:paymentUID/void", d.voidPayment)
 	router.Get("/:paymentUID", d.getPayment)
 	router.Put("/:paymentUID/status", d.updatePaymentStatus)
+	router.Put("/:paymentUID/rental", d.linkRental)
+	router.Post("/:paymentUID/reinstate", d.reinstatePayment)
+	router.Post("/:paymentUID/refunds", d.refundPayment)
+	router.Get("/:paymentUID/refunds", d.getRefunds)
+	router.Post("/:paymentUID/fees", d.addFee)
+	router.Get("/:paymentUID/entries", d.getLedgerEntries)
+}
+
+// parsePrice reads the amount of the payment in minor units of the currency. The price in major units
+// is read from the requests made before the amounts moved to minor units, e.g. the ones left in the backlog.
+func (d *Delivery) parsePrice(ctx *fiber.Ctx) (models.Money, error) {
+	currency := ctx.Query("currency", models.DefaultCurrency)
+	if !models.ValidCurrency(currency) {
+		return models.Money{}, errors.ErrInvalidCurrency
+	}
+
+	if ctx.Query("amount") == "" {
+		price, err := strconv.ParseUint(ctx.Query("price"), 10, 64)
+		if err != nil {
+			d.logger.Error(err.Error())
+			return models.Money{}, errors.ErrPaymentPriceNotSet
+		}
+
+		return models.NewMoney(price, currency), nil
+	}
+
+	amount, err := strconv.ParseInt(ctx.Query("amount"), 10, 64)
+	if err != nil || amount < 0 {
+		if err != nil {
+			d.logger.Error(err.Error())
+		}
+
+		return models.Money{}, errors.ErrPaymentPriceNotSet
+	}
+
+	return models.Money{Amount: amount, Currency: currency}, nil
 }
 
 func (d *Delivery) createPayment(ctx *fiber.Ctx) error {
-	price, err := strconv.ParseUint(ctx.Query("price"), 10, 64)
+	price, err := d.parsePrice(ctx)
 	if err != nil {
-		d.logger.Error(err.Error())
-		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrPaymentPriceNotSet.Map())
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
 	}
 
-	payment, err := d.useCase.CreatePayment(ctx.Context(), price)
+	payment, err := d.useCase.CreatePayment(ctx.Context(), price, ctx.Get(IdempotencyKeyHeader))
 	if err != nil {
 		return err
+	} else if payment.Status == models.PaymentCanceled {
+		return ctx.Status(fiber.StatusPaymentRequired).JSON(errors.ErrPaymentDeclined.Map())
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(NewPaymentDTO(payment))
 }
 
+func (d *Delivery) authorizePayment(ctx *fiber.Ctx) error {
+	price, err := d.parsePrice(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	payment, err := d.useCase.AuthorizePayment(ctx.Context(), price)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewPaymentDTO(payment))
+}
+
+func (d *Delivery) capturePayment(ctx *fiber.Ctx) error {
+	paymentUID := ctx.Params("paymentUID")
+
+	payment, found, allowed, err := d.useCase.CapturePayment(ctx.Context(), paymentUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrPaymentNotFound.Map())
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(errors.ErrPaymentNotAuthorized.Map())
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewPaymentDTO(payment))
+}
+
+func (d *Delivery) voidPayment(ctx *fiber.Ctx) error {
+	paymentUID := ctx.Params("paymentUID")
+
+	found, allowed, err := d.useCase.VoidPayment(ctx.Context(), paymentUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrPaymentNotFound.Map())
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(errors.ErrPaymentNotAuthorized.Map())
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
 func (d *Delivery) getPayment(ctx *fiber.Ctx) error {
 	paymentUID := ctx.Params("paymentUID")
 
@@ -67,16 +172,214 @@ func (d *Delivery) getPayment(ctx *fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(NewPaymentDTO(payment))
 }
 
+// getPayments looks payments up either by rental or, page by page, by status.
+func (d *Delivery) getPayments(ctx *fiber.Ctx) error {
+	if ctx.Query("status") != "" {
+		return d.getPaymentsByStatus(ctx)
+	}
+
+	rentalUID := ctx.Query("rentalUid")
+	if uuid.Validate(rentalUID) != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidRentalUID.Map())
+	}
+
+	payments, err := d.useCase.GetRentalPayments(ctx.Context(), rentalUID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewPaymentsDTO(payments, pagination.Page{TotalCount: uint64(len(payments))}))
+}
+
+func (d *Delivery) getPaymentsByStatus(ctx *fiber.Ctx) error {
+	status := models.PaymentStatus(ctx.Query("status"))
+	if !status.Valid() {
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPaymentStatus.Map())
+	}
+
+	page, err := pagination.ParseRequest(ctx.Query("offset"), ctx.Query("limit"), ctx.Query("cursor"))
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPage.Map())
+	}
+
+	payments, info, err := d.useCase.GetPayments(ctx.Context(), status, page)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewPaymentsDTO(payments, info))
+}
+
+func (d *Delivery) linkRental(ctx *fiber.Ctx) error {
+	paymentUID := ctx.Params("paymentUID")
+	var dto PaymentRentalDTO
+
+	err := ctx.BodyParser(&dto)
+	if err != nil || uuid.Validate(dto.RentalUID) != nil {
+		if err != nil {
+			d.logger.Error(err.Error())
+		}
+
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidRentalUID.Map())
+	}
+
+	found, allowed, err := d.useCase.LinkRental(ctx.Context(), paymentUID, dto.RentalUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrPaymentNotFound.Map())
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(errors.ErrPaymentLinkedToOtherRental.Map())
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
 func (d *Delivery) updatePaymentStatus(ctx *fiber.Ctx) error {
 	paymentUID := ctx.Params("paymentUID")
-	status := models.PaymentStatus(ctx.Body())
+	var dto PaymentStatusRequestDTO
+
+	err := ctx.BodyParser(&dto)
+	if err != nil || !dto.Status.Valid() {
+		if err != nil {
+			d.logger.Error(err.Error())
+		}
+
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPaymentStatus.Map())
+	}
+
+	found, allowed, changed, err := d.useCase.SetPaymentStatus(ctx.Context(), paymentUID, dto.Status)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrPaymentNotFound.Map())
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(errors.ErrPaymentStatusConflict.Map())
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(PaymentStatusUpdateDTO{Changed: changed})
+}
+
+func (d *Delivery) reinstatePayment(ctx *fiber.Ctx) error {
+	paymentUID := ctx.Params("paymentUID")
+
+	found, allowed, changed, err := d.useCase.ReinstatePayment(ctx.Context(), paymentUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrPaymentNotFound.Map())
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(errors.ErrPaymentStatusConflict.Map())
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(PaymentStatusUpdateDTO{Changed: changed})
+}
+
+func (d *Delivery) refundPayment(ctx *fiber.Ctx) error {
+	paymentUID := ctx.Params("paymentUID")
+	var dto RefundRequestDTO
+
+	err := ctx.BodyParser(&dto)
+	amount, valid := dto.ToModel()
+	if err != nil || !valid || dto.Reason == "" {
+		if err != nil {
+			d.logger.Error(err.Error())
+		}
+
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidRefundRequest.Map())
+	}
+
+	refund, found, allowed, err := d.useCase.RefundPayment(ctx.Context(), paymentUID, amount, dto.Reason, ctx.Get(IdempotencyKeyHeader))
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrPaymentNotFound.Map())
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(errors.ErrRefundNotAllowed.Map())
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewRefundDTO(refund))
+}
+
+func (d *Delivery) getRefunds(ctx *fiber.Ctx) error {
+	paymentUID := ctx.Params("paymentUID")
+
+	refunds, found, err := d.useCase.GetRefunds(ctx.Context(), paymentUID)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrPaymentNotFound.Map())
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewRefundsDTO(refunds))
+}
+
+func (d *Delivery) addFee(ctx *fiber.Ctx) error {
+	paymentUID := ctx.Params("paymentUID")
+	var dto FeeRequestDTO
+
+	err := ctx.BodyParser(&dto)
+	amount, valid := dto.ToModel()
+	if err != nil || !valid || dto.Reason == "" {
+		if err != nil {
+			d.logger.Error(err.Error())
+		}
+
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidFeeRequest.Map())
+	}
+
+	found, allowed, err := d.useCase.AddFee(ctx.Context(), paymentUID, amount, dto.Reason)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrPaymentNotFound.Map())
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(errors.ErrFeeNotAllowed.Map())
+	}
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func (d *Delivery) getLedgerEntries(ctx *fiber.Ctx) error {
+	paymentUID := ctx.Params("paymentUID")
 
-	found, err := d.useCase.SetPaymentStatus(ctx.Context(), paymentUID, status)
+	entries, found, err := d.useCase.GetLedgerEntries(ctx.Context(), paymentUID)
 	if err != nil {
 		return err
 	} else if !found {
 		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrPaymentNotFound.Map())
 	}
 
+	return ctx.Status(fiber.StatusOK).JSON(NewLedgerEntriesDTO(entries))
+}
+
+func (d *Delivery) handleProviderWebhook(ctx *fiber.Ctx) error {
+	if !validWebhookSignature(d.webhookSecret, ctx.Body(), ctx.Get(WebhookSignatureHeader)) {
+		return ctx.Status(fiber.StatusUnauthorized).JSON(errors.ErrInvalidWebhookSignature.Map())
+	}
+
+	var dto ProviderWebhookDTO
+
+	err := ctx.BodyParser(&dto)
+	completed := dto.Status == models.ProviderApproved || dto.Status == models.ProviderDeclined
+	if err != nil || dto.OperationUID == "" || !completed {
+		if err != nil {
+			d.logger.Error(err.Error())
+		}
+
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidWebhook.Map())
+	}
+
+	found, err := d.useCase.HandleProviderResult(ctx.Context(), dto.OperationUID, models.ProviderResponse{
+		Status:      dto.Status,
+		ExternalRef: dto.ExternalRef,
+	})
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrProviderOperationNotFound.Map())
+	}
+
 	return ctx.SendStatus(fiber.StatusOK)
 }
@@ -1,28 +1,272 @@
 package delivery
 
-import "github.com/Inspirate789/ds-lab2/internal/models"
+import (
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"time"
+)
 
 type PaymentDTO struct {
-	ID         int64                `json:"id"`
-	PaymentUID string               `json:"paymentUid"`
-	Status     models.PaymentStatus `json:"status"`
-	Price      uint64               `json:"price"`
+	ID          int64                `json:"id"`
+	PaymentUID  string               `json:"paymentUid"`
+	Status      models.PaymentStatus `json:"status"`
+	Price       int64                `json:"price"` // minor units of the currency
+	Currency    string               `json:"currency,omitempty"`
+	RentalUID   string               `json:"rentalUid,omitempty"`
+	ExternalRef string               `json:"externalRef,omitempty"`
+	CreatedAt   string               `json:"createdAt,omitempty"`
+	UpdatedAt   string               `json:"updatedAt,omitempty"`
+}
+
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
 }
 
 func NewPaymentDTO(car models.Payment) PaymentDTO {
 	return PaymentDTO{
-		ID:         car.ID,
-		PaymentUID: car.PaymentUID,
-		Status:     car.Status,
-		Price:      car.Price,
+		ID:          car.ID,
+		PaymentUID:  car.PaymentUID,
+		Status:      car.Status,
+		Price:       car.Price.Amount,
+		Currency:    car.Price.Currency,
+		RentalUID:   car.RentalUID,
+		ExternalRef: car.ExternalRef,
+		CreatedAt:   formatTimestamp(car.CreatedAt),
+		UpdatedAt:   formatTimestamp(car.UpdatedAt),
 	}
 }
 
-func (car PaymentDTO) ToModel() models.Payment {
+func (car PaymentDTO) ToModel() (models.Payment, error) {
+	createdAt, err := parseTimestamp(car.CreatedAt)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	updatedAt, err := parseTimestamp(car.UpdatedAt)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
 	return models.Payment{
-		ID:         car.ID,
-		PaymentUID: car.PaymentUID,
-		Status:     car.Status,
-		Price:      car.Price,
+		ID:          car.ID,
+		PaymentUID:  car.PaymentUID,
+		Status:      car.Status,
+		Price:       models.Money{Amount: car.Price, Currency: car.Currency},
+		RentalUID:   car.RentalUID,
+		ExternalRef: car.ExternalRef,
+		CreatedAt:   createdAt,
+		UpdatedAt:   updatedAt,
+	}, nil
+}
+
+type PaymentsDTO struct {
+	Items []PaymentDTO `json:"items"`
+	Count uint64       `json:"count"`
+	Next  string       `json:"next,omitempty"`
+	Prev  string       `json:"prev,omitempty"`
+}
+
+func NewPaymentsDTO(payments []models.Payment, info pagination.Page) PaymentsDTO {
+	items := make([]PaymentDTO, 0, len(payments))
+
+	for _, payment := range payments {
+		items = append(items, NewPaymentDTO(payment))
+	}
+
+	dto := PaymentsDTO{
+		Items: items,
+		Count: info.TotalCount,
+	}
+
+	if info.Next != nil {
+		dto.Next = info.Next.String()
+	}
+
+	if info.Prev != nil {
+		dto.Prev = info.Prev.String()
+	}
+
+	return dto
+}
+
+func (payments PaymentsDTO) ToModel() ([]models.Payment, pagination.Page, error) {
+	result := make([]models.Payment, 0, len(payments.Items))
+
+	for _, dto := range payments.Items {
+		payment, err := dto.ToModel()
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+
+		result = append(result, payment)
+	}
+
+	info := pagination.Page{TotalCount: payments.Count}
+
+	if payments.Next != "" {
+		next, err := pagination.ParseCursor(payments.Next)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+
+		info.Next = &next
+	}
+
+	if payments.Prev != "" {
+		prev, err := pagination.ParseCursor(payments.Prev)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+
+		info.Prev = &prev
+	}
+
+	return result, info, nil
+}
+
+type PaymentRentalDTO struct {
+	RentalUID string `json:"rentalUid"`
+}
+
+type PaymentStatusRequestDTO struct {
+	Status models.PaymentStatus `json:"status"`
+}
+
+// PaymentStatusUpdateDTO tells whether the payment status changed, so a repeated update can be told apart.
+type PaymentStatusUpdateDTO struct {
+	Changed bool `json:"changed"`
+}
+
+// amountOf reads a requested amount: minor units of the currency, or major units of the default currency
+// when the currency is not set, as in the requests made before the amounts moved to minor units.
+func amountOf(amount int64, currency string) (models.Money, bool) {
+	if amount <= 0 {
+		return models.Money{}, false
+	} else if currency == "" {
+		return models.NewMoney(uint64(amount), models.DefaultCurrency), true
+	}
+
+	return models.Money{Amount: amount, Currency: currency}, models.ValidCurrency(currency)
+}
+
+type RefundRequestDTO struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func NewRefundRequestDTO(amount models.Money, reason string) RefundRequestDTO {
+	return RefundRequestDTO{Amount: amount.Amount, Currency: amount.Currency, Reason: reason}
+}
+
+func (refund RefundRequestDTO) ToModel() (amount models.Money, ok bool) {
+	return amountOf(refund.Amount, refund.Currency)
+}
+
+type FeeRequestDTO struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func (fee FeeRequestDTO) ToModel() (amount models.Money, ok bool) {
+	return amountOf(fee.Amount, fee.Currency)
+}
+
+type RefundDTO struct {
+	ID         int64  `json:"id"`
+	RefundUID  string `json:"refundUid"`
+	PaymentUID string `json:"paymentUid"`
+	Amount     int64  `json:"amount"` // minor units of the currency
+	Currency   string `json:"currency"`
+	Reason     string `json:"reason"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+func NewRefundDTO(refund models.Refund) RefundDTO {
+	return RefundDTO{
+		ID:         refund.ID,
+		RefundUID:  refund.RefundUID,
+		PaymentUID: refund.PaymentUID,
+		Amount:     refund.Amount.Amount,
+		Currency:   refund.Amount.Currency,
+		Reason:     refund.Reason,
+		CreatedAt:  refund.CreatedAt.Format(time.RFC3339),
 	}
 }
+
+func (refund RefundDTO) ToModel() (models.Refund, error) {
+	createdAt, err := time.Parse(time.RFC3339, refund.CreatedAt)
+	if err != nil {
+		return models.Refund{}, err
+	}
+
+	return models.Refund{
+		ID:         refund.ID,
+		RefundUID:  refund.RefundUID,
+		PaymentUID: refund.PaymentUID,
+		Amount:     models.Money{Amount: refund.Amount, Currency: refund.Currency},
+		Reason:     refund.Reason,
+		CreatedAt:  createdAt,
+	}, nil
+}
+
+type RefundsDTO struct {
+	Items []RefundDTO `json:"items"`
+}
+
+func NewRefundsDTO(refunds []models.Refund) RefundsDTO {
+	items := make([]RefundDTO, 0, len(refunds))
+
+	for _, refund := range refunds {
+		items = append(items, NewRefundDTO(refund))
+	}
+
+	return RefundsDTO{Items: items}
+}
+
+type LedgerEntryDTO struct {
+	EntryUID       string                 `json:"entryUid"`
+	TransactionUID string                 `json:"transactionUid"`
+	Kind           models.LedgerEntryKind `json:"kind"`
+	Account        models.LedgerAccount   `json:"account"`
+	Amount         int64                  `json:"amount"` // minor units
+	Currency       string                 `json:"currency"`
+	Description    string                 `json:"description,omitempty"`
+	CreatedAt      string                 `json:"createdAt"`
+}
+
+type LedgerEntriesDTO struct {
+	Items []LedgerEntryDTO `json:"items"`
+}
+
+func NewLedgerEntriesDTO(entries []models.LedgerEntry) LedgerEntriesDTO {
+	items := make([]LedgerEntryDTO, 0, len(entries))
+
+	for _, entry := range entries {
+		items = append(items, LedgerEntryDTO{
+			EntryUID:       entry.EntryUID,
+			TransactionUID: entry.TransactionUID,
+			Kind:           entry.Kind,
+			Account:        entry.Account,
+			Amount:         entry.Amount.Amount,
+			Currency:       entry.Amount.Currency,
+			Description:    entry.Description,
+			CreatedAt:      formatTimestamp(entry.CreatedAt),
+		})
+	}
+
+	return LedgerEntriesDTO{Items: items}
+}
@@ -11,6 +11,22 @@ func (e PaymentError) Map() map[string]any {
 }
 
 const (
-	ErrPaymentNotFound    PaymentError = "payment not found"
-	ErrPaymentPriceNotSet PaymentError = "payment price not set"
+	ErrPaymentNotFound            PaymentError = "payment not found"
+	ErrPaymentPriceNotSet         PaymentError = "payment price not set"
+	ErrInvalidRefundRequest       PaymentError = "invalid refund request: amount and reason required"
+	ErrRefundNotAllowed           PaymentError = "refund not allowed: payment not refundable, amount exceeds the refundable rest or currency differs"
+	ErrInvalidCurrency            PaymentError = "invalid currency: ISO 4217 code expected"
+	ErrInvalidFeeRequest          PaymentError = "invalid fee request: amount and reason required"
+	ErrFeeNotAllowed              PaymentError = "fee not allowed: payment canceled or refunded or currency differs"
+	ErrPaymentNotAuthorized       PaymentError = "payment not in authorized state"
+	ErrPaymentDeclined            PaymentError = "payment declined by provider"
+	ErrInvalidPaymentStatus       PaymentError = "invalid payment status"
+	ErrPaymentStatusConflict      PaymentError = "payment status change not allowed"
+	ErrInvalidRentalUID           PaymentError = "invalid rental uid"
+	ErrPaymentLinkedToOtherRental PaymentError = "payment linked to another rental"
+	ErrInvalidPage                PaymentError = "invalid page request"
+
+	ErrInvalidWebhookSignature   PaymentError = "invalid webhook signature"
+	ErrInvalidWebhook            PaymentError = "invalid webhook: operation uid and status required"
+	ErrProviderOperationNotFound PaymentError = "provider operation not found"
 )
@@ -0,0 +1,29 @@
+package delivery
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+)
+
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+// ProviderWebhookDTO is an asynchronous provider result.
+type ProviderWebhookDTO struct {
+	OperationUID string                         `json:"operationUid"`
+	Status       models.ProviderOperationStatus `json:"status"`
+	ExternalRef  string                         `json:"externalRef"`
+}
+
+// SignWebhook returns the hex-encoded HMAC-SHA256 of the webhook body.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validWebhookSignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, body)), []byte(signature))
+}
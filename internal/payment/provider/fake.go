@@ -0,0 +1,181 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/payment/delivery"
+	"github.com/google/uuid"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type ProviderError string
+
+func (e ProviderError) Error() string {
+	return string(e)
+}
+
+const (
+	ErrProviderUnavailable ProviderError = "payment provider unavailable"
+	ErrProviderTimeout     ProviderError = "payment provider timeout"
+)
+
+type Mode string
+
+const (
+	ModeApprove Mode = "approve"
+	ModeDecline Mode = "decline"
+	ModeFail    Mode = "fail"    // requests fail before reaching the provider
+	ModeTimeout Mode = "timeout" // requests are approved, but the response is lost after the delay
+	ModePending Mode = "pending" // requests are approved asynchronously, the result is sent to the webhook after the delay
+)
+
+// Fake is an in-process payment provider for offline runs and tests.
+type Fake struct {
+	mu            sync.Mutex
+	mode          Mode
+	delay         time.Duration
+	operations    map[string]models.ProviderResponse
+	webhookURL    string
+	webhookSecret string
+	client        *http.Client
+	logger        *slog.Logger
+}
+
+func NewFake(mode Mode, delay time.Duration, webhookURL, webhookSecret string, client *http.Client, logger *slog.Logger) *Fake {
+	if mode == "" {
+		mode = ModeApprove
+	}
+
+	return &Fake{
+		mode:          mode,
+		delay:         delay,
+		operations:    make(map[string]models.ProviderResponse),
+		webhookURL:    webhookURL,
+		webhookSecret: webhookSecret,
+		client:        client,
+		logger:        logger,
+	}
+}
+
+func (f *Fake) SetMode(mode Mode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.mode = mode
+}
+
+func (f *Fake) Charge(ctx context.Context, operationUID string, _ models.Money) (models.ProviderResponse, error) {
+	return f.process(ctx, operationUID)
+}
+
+func (f *Fake) Refund(ctx context.Context, operationUID string, _ models.Money) (models.ProviderResponse, error) {
+	return f.process(ctx, operationUID)
+}
+
+// Status reports operations the provider never received as declined.
+func (f *Fake) Status(_ context.Context, operationUID string) (models.ProviderResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	response, found := f.operations[operationUID]
+	if !found {
+		return models.ProviderResponse{Status: models.ProviderDeclined}, nil
+	}
+
+	return response, nil
+}
+
+func (f *Fake) process(ctx context.Context, operationUID string) (models.ProviderResponse, error) {
+	f.mu.Lock()
+
+	if response, found := f.operations[operationUID]; found {
+		f.mu.Unlock()
+		return response, nil
+	}
+
+	mode := f.mode
+	response := models.ProviderResponse{
+		Status:      models.ProviderApproved,
+		ExternalRef: "fake-" + uuid.New().String(),
+	}
+
+	switch mode {
+	case ModeFail:
+		f.mu.Unlock()
+		return models.ProviderResponse{}, ErrProviderUnavailable
+	case ModeDecline:
+		response.Status = models.ProviderDeclined
+	case ModePending:
+		response.Status = models.ProviderPending
+	}
+
+	f.operations[operationUID] = response
+	f.mu.Unlock()
+
+	switch mode {
+	case ModeTimeout:
+		select {
+		case <-ctx.Done():
+		case <-time.After(f.delay):
+		}
+
+		return models.ProviderResponse{}, ErrProviderTimeout
+	case ModePending:
+		go f.complete(operationUID, models.ProviderResponse{
+			Status:      models.ProviderApproved,
+			ExternalRef: response.ExternalRef,
+		})
+	}
+
+	return response, nil
+}
+
+func (f *Fake) complete(operationUID string, response models.ProviderResponse) {
+	time.Sleep(f.delay)
+
+	f.mu.Lock()
+	f.operations[operationUID] = response
+	f.mu.Unlock()
+
+	if f.webhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(delivery.ProviderWebhookDTO{
+		OperationUID: operationUID,
+		Status:       response.Status,
+		ExternalRef:  response.ExternalRef,
+	})
+	if err != nil {
+		f.logger.Error(err.Error())
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, f.webhookURL, bytes.NewBuffer(body))
+	if err != nil {
+		f.logger.Error(err.Error())
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(delivery.WebhookSignatureHeader, delivery.SignWebhook(f.webhookSecret, body))
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		f.logger.Error(err.Error()) // the operation is synced later by a status request
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		f.logger.Warn("provider webhook rejected",
+			slog.String("operation_uid", operationUID),
+			slog.Int("status", resp.StatusCode),
+		)
+	}
+}
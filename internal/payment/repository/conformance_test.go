@@ -0,0 +1,519 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/payment/usecase"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/google/uuid"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"time"
+)
+
+const currency = "RUB"
+
+// ConformanceSuite holds the behaviour every repository implementation must have.
+type ConformanceSuite struct {
+	suite.Suite
+	repo usecase.Repository
+}
+
+func (s *ConformanceSuite) authorize(t provider.T, price uint64) models.Payment {
+	payment, err := s.repo.AuthorizePayment(context.Background(), models.NewMoney(price, currency))
+	t.Require().NoError(err)
+
+	return payment
+}
+
+// complete runs a provider operation of the payment to the status.
+func (s *ConformanceSuite) complete(t provider.T, paymentUID string, kind models.ProviderOperationKind, amount uint64, status models.ProviderOperationStatus) models.ProviderOperation {
+	operation, compensation := s.completeFor(t, paymentUID, kind, "test", amount, status)
+	t.Require().Nil(compensation)
+
+	return operation
+}
+
+// completeFor runs a provider operation of the payment made for the reason to the status.
+func (s *ConformanceSuite) completeFor(t provider.T, paymentUID string, kind models.ProviderOperationKind, reason string, amount uint64, status models.ProviderOperationStatus) (res models.ProviderOperation, compensation *models.ProviderOperation) {
+	ctx := context.Background()
+
+	operation, err := s.repo.CreateProviderOperation(ctx, models.ProviderOperation{
+		PaymentUID: paymentUID,
+		Kind:       kind,
+		Amount:     models.NewMoney(amount, currency),
+		Reason:     reason,
+	})
+	t.Require().NoError(err)
+	t.Require().Equal(models.ProviderPending, operation.Status)
+
+	operation, compensation, found, err := s.repo.ApplyProviderResult(ctx, operation.OperationUID, models.ProviderResponse{Status: status, ExternalRef: "ref-" + operation.OperationUID})
+	t.Require().NoError(err)
+	t.Require().True(found)
+
+	return operation, compensation
+}
+
+func (s *ConformanceSuite) status(t provider.T, paymentUID string) models.PaymentStatus {
+	payment, found, err := s.repo.GetPayment(context.Background(), paymentUID)
+	t.Require().NoError(err)
+	t.Require().True(found)
+
+	return payment.Status
+}
+
+func (s *ConformanceSuite) TestCapturePayment(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	payment := s.authorize(t, 1000)
+	// act
+	operation := s.complete(t, payment.PaymentUID, models.ProviderCharge, 1000, models.ProviderApproved)
+	repeated, _, found, err := s.repo.ApplyProviderResult(ctx, operation.OperationUID, models.ProviderResponse{Status: models.ProviderDeclined})
+	t.Require().NoError(err)
+	stored, _, err := s.repo.GetPayment(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	entries, err := s.repo.GetLedgerEntries(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().Equal(models.PaymentAuthorized, payment.Status)
+	t.Require().True(found)
+	t.Require().Equal(models.ProviderApproved, repeated.Status)
+	t.Require().Equal(models.PaymentPaid, stored.Status)
+	t.Require().Equal(operation.ExternalRef, stored.ExternalRef)
+
+	balances := models.AccountBalances(entries)
+	t.Require().Equal(int64(100000), balances[models.AccountCustomer])
+	t.Require().Equal(int64(-100000), balances[models.AccountRevenue])
+	t.Require().Zero(balances[models.AccountHolds])
+}
+
+func (s *ConformanceSuite) TestAuthorizePaymentOnce(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+	key := "test:" + uuid.NewString()
+
+	// arrange
+	first, created, err := s.repo.AuthorizePaymentOnce(ctx, models.NewMoney(1000, currency), key)
+	t.Require().NoError(err)
+	t.Require().True(created)
+	// act
+	repeated, created, err := s.repo.AuthorizePaymentOnce(ctx, models.NewMoney(2000, currency), key)
+	t.Require().NoError(err)
+	unkeyed, unkeyedCreated, err := s.repo.AuthorizePaymentOnce(ctx, models.NewMoney(1000, currency), "")
+	t.Require().NoError(err)
+	// assert
+	t.Require().False(created)
+	t.Require().Equal(first.PaymentUID, repeated.PaymentUID)
+	t.Require().Equal(models.NewMoney(1000, currency), repeated.Price)
+	t.Require().True(unkeyedCreated)
+	t.Require().NotEqual(first.PaymentUID, unkeyed.PaymentUID)
+}
+
+func (s *ConformanceSuite) TestDeclinedChargeVoidsAuthorization(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	payment := s.authorize(t, 500)
+	// act
+	s.complete(t, payment.PaymentUID, models.ProviderCharge, 500, models.ProviderDeclined)
+	// assert
+	t.Require().Equal(models.PaymentCanceled, s.status(t, payment.PaymentUID))
+}
+
+func (s *ConformanceSuite) TestVoidAuthorization(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	payment := s.authorize(t, 700)
+	// act
+	found, allowed, err := s.repo.VoidAuthorization(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	repeatFound, repeatAllowed, err := s.repo.VoidAuthorization(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	unknownFound, _, err := s.repo.VoidAuthorization(ctx, uuid.NewString())
+	t.Require().NoError(err)
+	// assert
+	t.Require().True(found)
+	t.Require().True(allowed)
+	t.Require().True(repeatFound)
+	t.Require().False(repeatAllowed)
+	t.Require().False(unknownFound)
+	t.Require().Equal(models.PaymentCanceled, s.status(t, payment.PaymentUID))
+}
+
+func (s *ConformanceSuite) TestGetStaleAuthorizations(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	stale := s.authorize(t, 100)
+	pending := s.authorize(t, 100)
+	captured := s.authorize(t, 100)
+	linked := s.authorize(t, 100)
+
+	_, err := s.repo.LinkRental(ctx, linked.PaymentUID, uuid.NewString())
+	t.Require().NoError(err)
+	_, err = s.repo.CreateProviderOperation(ctx, models.ProviderOperation{
+		PaymentUID: pending.PaymentUID,
+		Kind:       models.ProviderCharge,
+		Amount:     models.NewMoney(100, currency),
+	})
+	t.Require().NoError(err)
+	s.complete(t, captured.PaymentUID, models.ProviderCharge, 100, models.ProviderApproved)
+	// act
+	payments, err := s.repo.GetStaleAuthorizations(ctx, time.Now().Add(time.Hour), pagination.MaxLimit)
+	t.Require().NoError(err)
+	operations, err := s.repo.GetPendingProviderOperations(ctx, time.Now().Add(time.Hour), pagination.MaxLimit)
+	t.Require().NoError(err)
+	// assert
+	uids := paymentUIDs(payments)
+	t.Require().Contains(uids, stale.PaymentUID)
+	t.Require().NotContains(uids, pending.PaymentUID)
+	t.Require().NotContains(uids, captured.PaymentUID)
+	t.Require().NotContains(uids, linked.PaymentUID)
+
+	pendingUIDs := make([]string, 0, len(operations))
+	for _, operation := range operations {
+		pendingUIDs = append(pendingUIDs, operation.PaymentUID)
+	}
+
+	t.Require().Contains(pendingUIDs, pending.PaymentUID)
+	t.Require().NotContains(pendingUIDs, captured.PaymentUID)
+}
+
+func (s *ConformanceSuite) TestUpdatePaymentStatus(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	payment := s.authorize(t, 300)
+	// act
+	canceled, err := s.repo.UpdatePaymentStatus(ctx, payment.PaymentUID, models.PaymentAuthorized, models.PaymentCanceled)
+	t.Require().NoError(err)
+	stale, err := s.repo.UpdatePaymentStatus(ctx, payment.PaymentUID, models.PaymentAuthorized, models.PaymentCanceled)
+	t.Require().NoError(err)
+	_, reinstateErr := s.repo.UpdatePaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled, models.PaymentPaid)
+	unknown, err := s.repo.UpdatePaymentStatus(ctx, uuid.NewString(), models.PaymentAuthorized, models.PaymentCanceled)
+	t.Require().NoError(err)
+	// assert
+	t.Require().True(canceled)
+	t.Require().False(stale)
+	t.Require().Error(reinstateErr)
+	t.Require().False(unknown)
+	t.Require().Equal(models.PaymentCanceled, s.status(t, payment.PaymentUID))
+}
+
+func (s *ConformanceSuite) TestCancellationRefund(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	payment := s.authorize(t, 300)
+	s.complete(t, payment.PaymentUID, models.ProviderCharge, 300, models.ProviderApproved)
+	s.complete(t, payment.PaymentUID, models.ProviderRefund, 100, models.ProviderApproved)
+	// act
+	s.completeFor(t, payment.PaymentUID, models.ProviderRefund, models.ReasonCancellation, 200, models.ProviderDeclined)
+	declined := s.status(t, payment.PaymentUID)
+	s.completeFor(t, payment.PaymentUID, models.ProviderRefund, models.ReasonCancellation, 200, models.ProviderApproved)
+	refunds, err := s.repo.GetRefunds(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	entries, err := s.repo.GetLedgerEntries(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().Equal(models.PaymentPartiallyRefunded, declined)
+	t.Require().Equal(models.PaymentCanceled, s.status(t, payment.PaymentUID))
+	t.Require().Len(refunds, 2)
+	t.Require().Equal(models.ReasonCancellation, refunds[1].Reason)
+
+	for account, balance := range models.AccountBalances(entries) {
+		t.Require().Zero(balance, account)
+	}
+}
+
+func (s *ConformanceSuite) TestReinstatementCharge(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	payment := s.authorize(t, 300)
+	s.complete(t, payment.PaymentUID, models.ProviderCharge, 300, models.ProviderApproved)
+	s.completeFor(t, payment.PaymentUID, models.ProviderRefund, models.ReasonCancellation, 300, models.ProviderApproved)
+	// act
+	s.completeFor(t, payment.PaymentUID, models.ProviderCharge, models.ReasonReinstatement, 300, models.ProviderDeclined)
+	declined := s.status(t, payment.PaymentUID)
+	operation, compensation := s.completeFor(t, payment.PaymentUID, models.ProviderCharge, models.ReasonReinstatement, 300, models.ProviderApproved)
+	stored, _, err := s.repo.GetPayment(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	entries, err := s.repo.GetLedgerEntries(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().Equal(models.PaymentCanceled, declined)
+	t.Require().Nil(compensation)
+	t.Require().Equal(models.PaymentPaid, stored.Status)
+	t.Require().Equal(operation.ExternalRef, stored.ExternalRef)
+	t.Require().Equal(int64(30000), models.AccountBalances(entries)[models.AccountCustomer])
+}
+
+func (s *ConformanceSuite) TestChargeApprovedAfterVoid(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	payment := s.authorize(t, 300)
+	charge, err := s.repo.CreateProviderOperation(ctx, models.ProviderOperation{
+		PaymentUID: payment.PaymentUID,
+		Kind:       models.ProviderCharge,
+		Amount:     models.NewMoney(300, currency),
+	})
+	t.Require().NoError(err)
+	_, _, err = s.repo.VoidAuthorization(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	// act
+	_, compensation, _, err := s.repo.ApplyProviderResult(ctx, charge.OperationUID, models.ProviderResponse{Status: models.ProviderApproved})
+	t.Require().NoError(err)
+	_, repeated, _, err := s.repo.ApplyProviderResult(ctx, charge.OperationUID, models.ProviderResponse{Status: models.ProviderApproved})
+	t.Require().NoError(err)
+	t.Require().NotNil(compensation)
+	_, refundCompensation, _, err := s.repo.ApplyProviderResult(ctx, compensation.OperationUID, models.ProviderResponse{Status: models.ProviderApproved})
+	t.Require().NoError(err)
+	refunds, err := s.repo.GetRefunds(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	entries, err := s.repo.GetLedgerEntries(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().Equal(models.ProviderRefund, compensation.Kind)
+	t.Require().Equal(models.ReasonCompensation, compensation.Reason)
+	t.Require().Equal(charge.Amount, compensation.Amount)
+	t.Require().Equal(models.ProviderPending, compensation.Status)
+	t.Require().Nil(repeated)
+	t.Require().Nil(refundCompensation)
+	t.Require().Empty(refunds)
+	t.Require().Equal(models.PaymentCanceled, s.status(t, payment.PaymentUID))
+
+	for account, balance := range models.AccountBalances(entries) {
+		t.Require().Zero(balance, account)
+	}
+}
+
+func (s *ConformanceSuite) TestRefundsAndFees(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	payment := s.authorize(t, 1000)
+	s.complete(t, payment.PaymentUID, models.ProviderCharge, 1000, models.ProviderApproved)
+	// act
+	s.complete(t, payment.PaymentUID, models.ProviderRefund, 400, models.ProviderApproved)
+	s.complete(t, payment.PaymentUID, models.ProviderRefund, 100, models.ProviderDeclined)
+	partial := s.status(t, payment.PaymentUID)
+	feeFound, feeAllowed, err := s.repo.AddFee(ctx, payment.PaymentUID, models.NewMoney(50, currency), "damage")
+	t.Require().NoError(err)
+	s.complete(t, payment.PaymentUID, models.ProviderRefund, 650, models.ProviderApproved)
+	refunded := s.status(t, payment.PaymentUID)
+	_, refundedFeeAllowed, err := s.repo.AddFee(ctx, payment.PaymentUID, models.NewMoney(50, currency), "damage")
+	t.Require().NoError(err)
+	refunds, err := s.repo.GetRefunds(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().Equal(models.PaymentPartiallyRefunded, partial)
+	t.Require().True(feeFound)
+	t.Require().True(feeAllowed)
+	t.Require().Equal(models.PaymentRefunded, refunded)
+	t.Require().False(refundedFeeAllowed)
+	t.Require().Len(refunds, 2)
+	t.Require().Equal(models.NewMoney(400, currency), refunds[0].Amount)
+	t.Require().Equal("test", refunds[0].Reason)
+	t.Require().Equal(models.NewMoney(650, currency), refunds[1].Amount)
+}
+
+func (s *ConformanceSuite) TestCreateRefundOperation(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	payment := s.authorize(t, 1000)
+	authorized, authorizedAllowed, err := s.repo.CreateRefundOperation(ctx, models.ProviderOperation{
+		PaymentUID: payment.PaymentUID,
+		Amount:     models.NewMoney(100, currency),
+	})
+	t.Require().NoError(err)
+	s.complete(t, payment.PaymentUID, models.ProviderCharge, 1000, models.ProviderApproved)
+	refund := func(amount uint64, reason string) (models.ProviderOperation, bool) {
+		operation, allowed, err := s.repo.CreateRefundOperation(ctx, models.ProviderOperation{
+			PaymentUID: payment.PaymentUID,
+			Amount:     models.NewMoney(amount, currency),
+			Reason:     reason,
+		})
+		t.Require().NoError(err)
+
+		return operation, allowed
+	}
+	// act
+	first, firstAllowed := refund(600, "test")
+	_, excessAllowed := refund(500, "test")
+	_, cancelPendingAllowed := refund(0, models.ReasonCancellation)
+	second, secondAllowed := refund(400, "test")
+	_, _, _, err = s.repo.ApplyProviderResult(ctx, second.OperationUID, models.ProviderResponse{Status: models.ProviderDeclined})
+	t.Require().NoError(err)
+	_, _, _, err = s.repo.ApplyProviderResult(ctx, first.OperationUID, models.ProviderResponse{Status: models.ProviderApproved})
+	t.Require().NoError(err)
+	cancellation, cancelAllowed := refund(0, models.ReasonCancellation)
+	// assert
+	t.Require().False(authorizedAllowed)
+	t.Require().Empty(authorized.OperationUID)
+	t.Require().True(firstAllowed)
+	t.Require().Equal(models.ProviderRefund, first.Kind)
+	t.Require().Equal(models.ProviderPending, first.Status)
+	t.Require().False(excessAllowed)
+	t.Require().False(cancelPendingAllowed)
+	t.Require().True(secondAllowed)
+	t.Require().True(cancelAllowed)
+	t.Require().Equal(models.NewMoney(400, currency), cancellation.Amount)
+}
+
+func (s *ConformanceSuite) TestRefundOperationOnce(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	key := "refund:" + uuid.New().String() + ":early return"
+	payment := s.authorize(t, 1000)
+	s.complete(t, payment.PaymentUID, models.ProviderCharge, 1000, models.ProviderApproved)
+	other := s.authorize(t, 1000)
+	s.complete(t, other.PaymentUID, models.ProviderCharge, 1000, models.ProviderApproved)
+	refund := func(paymentUID string, amount uint64) (models.ProviderOperation, bool) {
+		operation, allowed, err := s.repo.CreateRefundOperation(ctx, models.ProviderOperation{
+			PaymentUID:     paymentUID,
+			Amount:         models.NewMoney(amount, currency),
+			Reason:         "early return",
+			IdempotencyKey: key,
+		})
+		t.Require().NoError(err)
+
+		return operation, allowed
+	}
+	// act
+	first, firstAllowed := refund(payment.PaymentUID, 600)
+	_, _, _, err := s.repo.ApplyProviderResult(ctx, first.OperationUID, models.ProviderResponse{Status: models.ProviderApproved})
+	t.Require().NoError(err)
+	repeated, repeatedAllowed := refund(payment.PaymentUID, 300)
+	_, otherAllowed := refund(other.PaymentUID, 300)
+	refunds, err := s.repo.GetRefunds(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().True(firstAllowed)
+	t.Require().True(repeatedAllowed)
+	t.Require().Equal(first.OperationUID, repeated.OperationUID)
+	t.Require().Equal(models.ProviderApproved, repeated.Status)
+	t.Require().Equal(models.NewMoney(600, currency), repeated.Amount)
+	t.Require().Equal(key, repeated.IdempotencyKey)
+	t.Require().False(otherAllowed)
+	t.Require().Len(refunds, 1)
+	t.Require().Equal(models.PaymentPaid, s.status(t, other.PaymentUID))
+}
+
+func (s *ConformanceSuite) TestRefundsKeepMinorUnits(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	payment := s.authorize(t, 1000)
+	s.complete(t, payment.PaymentUID, models.ProviderCharge, 1000, models.ProviderApproved)
+	third := models.Money{Amount: 33333, Currency: currency}
+	// act
+	operation, allowed, err := s.repo.CreateRefundOperation(ctx, models.ProviderOperation{PaymentUID: payment.PaymentUID, Amount: third, Reason: "test"})
+	t.Require().NoError(err)
+	_, _, _, err = s.repo.ApplyProviderResult(ctx, operation.OperationUID, models.ProviderResponse{Status: models.ProviderApproved})
+	t.Require().NoError(err)
+	_, otherAllowed, err := s.repo.CreateRefundOperation(ctx, models.ProviderOperation{PaymentUID: payment.PaymentUID, Amount: models.NewMoney(100, "USD"), Reason: "test"})
+	t.Require().NoError(err)
+	_, otherFeeAllowed, err := s.repo.AddFee(ctx, payment.PaymentUID, models.NewMoney(50, "USD"), "damage")
+	t.Require().NoError(err)
+	refunds, err := s.repo.GetRefunds(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	entries, err := s.repo.GetLedgerEntries(ctx, payment.PaymentUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().True(allowed)
+	t.Require().False(otherAllowed)
+	t.Require().False(otherFeeAllowed)
+	t.Require().Len(refunds, 1)
+	t.Require().Equal(third, refunds[0].Amount)
+	t.Require().Equal(models.NewMoney(1000, currency).Amount-third.Amount, models.AccountBalances(entries)[models.AccountCustomer])
+}
+
+func (s *ConformanceSuite) TestLinkRental(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	payment := s.authorize(t, 100)
+	rentalUID := uuid.NewString()
+	// act
+	linked, err := s.repo.LinkRental(ctx, payment.PaymentUID, rentalUID)
+	t.Require().NoError(err)
+	repeated, err := s.repo.LinkRental(ctx, payment.PaymentUID, rentalUID)
+	t.Require().NoError(err)
+	other, err := s.repo.LinkRental(ctx, payment.PaymentUID, uuid.NewString())
+	t.Require().NoError(err)
+	payments, err := s.repo.GetRentalPayments(ctx, rentalUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().True(linked)
+	t.Require().True(repeated)
+	t.Require().False(other)
+	t.Require().Equal([]string{payment.PaymentUID}, paymentUIDs(payments))
+}
+
+func (s *ConformanceSuite) TestGetPaymentsByStatus(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	_, before, err := s.repo.GetPayments(ctx, models.PaymentAuthorized, pagination.Request{Limit: 1})
+	t.Require().NoError(err)
+	authorized := []string{s.authorize(t, 100).PaymentUID, s.authorize(t, 100).PaymentUID}
+	captured := s.authorize(t, 100)
+	s.complete(t, captured.PaymentUID, models.ProviderCharge, 100, models.ProviderApproved)
+	// act
+	payments, after, err := s.repo.GetPayments(ctx, models.PaymentAuthorized, pagination.Request{Limit: 1, Cursor: &pagination.Cursor{
+		ID:       captured.ID + 1,
+		Backward: true,
+	}})
+	t.Require().NoError(err)
+	// assert
+	t.Require().Equal(before.TotalCount+2, after.TotalCount)
+	t.Require().Equal(authorized[1:], paymentUIDs(payments))
+	t.Require().NotNil(after.Next)
+	t.Require().NotNil(after.Prev)
+}
+
+func paymentUIDs(payments []models.Payment) []string {
+	uids := make([]string, 0, len(payments))
+
+	for _, payment := range payments {
+		uids = append(uids, payment.PaymentUID)
+	}
+
+	return uids
+}
@@ -1,19 +1,177 @@
 package repository
 
-import "github.com/Inspirate789/ds-lab2/internal/models"
+import (
+	"database/sql"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"time"
+)
 
 type PaymentDTO struct {
-	ID         int64                `db:"id"`
-	PaymentUID string               `db:"payment_uid"`
-	Status     models.PaymentStatus `db:"status"`
-	Price      uint64               `db:"price"`
+	ID             int64                `db:"id"`
+	PaymentUID     string               `db:"payment_uid"`
+	Status         models.PaymentStatus `db:"status"`
+	Price          int64                `db:"price"` // minor units
+	Currency       string               `db:"currency"`
+	RentalUID      sql.NullString       `db:"rental_uid"`
+	ExternalRef    sql.NullString       `db:"external_ref"`
+	IdempotencyKey sql.NullString       `db:"idempotency_key"`
+	CreatedAt      time.Time            `db:"created_at"`
+	UpdatedAt      time.Time            `db:"updated_at"`
 }
 
 func (car PaymentDTO) ToModel() models.Payment {
 	return models.Payment{
-		ID:         car.ID,
-		PaymentUID: car.PaymentUID,
-		Status:     car.Status,
-		Price:      car.Price,
+		ID:          car.ID,
+		PaymentUID:  car.PaymentUID,
+		Status:      car.Status,
+		Price:       models.Money{Amount: car.Price, Currency: car.Currency},
+		RentalUID:   car.RentalUID.String,
+		ExternalRef: car.ExternalRef.String,
+		CreatedAt:   car.CreatedAt,
+		UpdatedAt:   car.UpdatedAt,
 	}
 }
+
+type PaymentsDTO []PaymentDTO
+
+func (payments PaymentsDTO) ToModel() []models.Payment {
+	result := make([]models.Payment, 0, len(payments))
+
+	for _, payment := range payments {
+		result = append(result, payment.ToModel())
+	}
+
+	return result
+}
+
+type RefundDTO struct {
+	ID         int64     `db:"id"`
+	RefundUID  string    `db:"refund_uid"`
+	PaymentUID string    `db:"payment_uid"`
+	Amount     int64     `db:"amount"` // minor units
+	Currency   string    `db:"currency"`
+	Reason     string    `db:"reason"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+func (refund RefundDTO) ToModel() models.Refund {
+	return models.Refund{
+		ID:         refund.ID,
+		RefundUID:  refund.RefundUID,
+		PaymentUID: refund.PaymentUID,
+		Amount:     models.Money{Amount: refund.Amount, Currency: refund.Currency},
+		Reason:     refund.Reason,
+		CreatedAt:  refund.CreatedAt,
+	}
+}
+
+type RefundsDTO []RefundDTO
+
+func (refunds RefundsDTO) ToModel() []models.Refund {
+	result := make([]models.Refund, 0, len(refunds))
+
+	for _, refund := range refunds {
+		result = append(result, refund.ToModel())
+	}
+
+	return result
+}
+
+type LedgerEntryDTO struct {
+	ID             int64                  `db:"id"`
+	EntryUID       string                 `db:"entry_uid"`
+	TransactionUID string                 `db:"transaction_uid"`
+	PaymentUID     string                 `db:"payment_uid"`
+	Kind           models.LedgerEntryKind `db:"kind"`
+	Account        models.LedgerAccount   `db:"account"`
+	Amount         int64                  `db:"amount"`
+	Currency       string                 `db:"currency"`
+	Description    string                 `db:"description"`
+	CreatedAt      time.Time              `db:"created_at"`
+}
+
+func (entry LedgerEntryDTO) ToModel() models.LedgerEntry {
+	return models.LedgerEntry{
+		ID:             entry.ID,
+		EntryUID:       entry.EntryUID,
+		TransactionUID: entry.TransactionUID,
+		PaymentUID:     entry.PaymentUID,
+		Kind:           entry.Kind,
+		Account:        entry.Account,
+		Amount:         models.Money{Amount: entry.Amount, Currency: entry.Currency},
+		Description:    entry.Description,
+		CreatedAt:      entry.CreatedAt,
+	}
+}
+
+type LedgerEntriesDTO []LedgerEntryDTO
+
+func (entries LedgerEntriesDTO) ToModel() []models.LedgerEntry {
+	result := make([]models.LedgerEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		result = append(result, entry.ToModel())
+	}
+
+	return result
+}
+
+type ProviderOperationDTO struct {
+	ID             int64                          `db:"id"`
+	OperationUID   string                         `db:"operation_uid"`
+	PaymentUID     string                         `db:"payment_uid"`
+	Kind           models.ProviderOperationKind   `db:"kind"`
+	Amount         int64                          `db:"amount"`
+	Currency       string                         `db:"currency"`
+	Reason         string                         `db:"reason"`
+	IdempotencyKey sql.NullString                 `db:"idempotency_key"`
+	Status         models.ProviderOperationStatus `db:"status"`
+	ExternalRef    string                         `db:"external_ref"`
+	CreatedAt      time.Time                      `db:"created_at"`
+	UpdatedAt      time.Time                      `db:"updated_at"`
+}
+
+func NewProviderOperationDTO(operation models.ProviderOperation) ProviderOperationDTO {
+	return ProviderOperationDTO{
+		ID:             operation.ID,
+		OperationUID:   operation.OperationUID,
+		PaymentUID:     operation.PaymentUID,
+		Kind:           operation.Kind,
+		Amount:         operation.Amount.Amount,
+		Currency:       operation.Amount.Currency,
+		Reason:         operation.Reason,
+		IdempotencyKey: sql.NullString{String: operation.IdempotencyKey, Valid: operation.IdempotencyKey != ""},
+		Status:         operation.Status,
+		ExternalRef:    operation.ExternalRef,
+		CreatedAt:      operation.CreatedAt,
+		UpdatedAt:      operation.UpdatedAt,
+	}
+}
+
+func (operation ProviderOperationDTO) ToModel() models.ProviderOperation {
+	return models.ProviderOperation{
+		ID:             operation.ID,
+		OperationUID:   operation.OperationUID,
+		PaymentUID:     operation.PaymentUID,
+		Kind:           operation.Kind,
+		Amount:         models.Money{Amount: operation.Amount, Currency: operation.Currency},
+		Reason:         operation.Reason,
+		IdempotencyKey: operation.IdempotencyKey.String,
+		Status:         operation.Status,
+		ExternalRef:    operation.ExternalRef,
+		CreatedAt:      operation.CreatedAt,
+		UpdatedAt:      operation.UpdatedAt,
+	}
+}
+
+type ProviderOperationsDTO []ProviderOperationDTO
+
+func (operations ProviderOperationsDTO) ToModel() []models.ProviderOperation {
+	result := make([]models.ProviderOperation, 0, len(operations))
+
+	for _, operation := range operations {
+		result = append(result, operation.ToModel())
+	}
+
+	return result
+}
@@ -0,0 +1,473 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/google/uuid"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryRepository keeps the payments and their ledger in memory with the semantics of SqlxRepository,
+// for tests and demos without a database. Events are not published.
+type MemoryRepository struct {
+	mu         sync.RWMutex
+	payments   []models.Payment // in id order
+	entries    []models.LedgerEntry
+	refunds    []models.Refund
+	operations []models.ProviderOperation
+	keys       map[string]string // payment uids by idempotency key
+	lastIDs    struct{ payment, entry, refund, operation int64 }
+	logger     *slog.Logger
+}
+
+func NewMemoryRepository(logger *slog.Logger) *MemoryRepository {
+	return &MemoryRepository{keys: make(map[string]string), logger: logger}
+}
+
+func (r *MemoryRepository) HealthCheck(context.Context) error {
+	return nil
+}
+
+// record appends a ledger transaction for the payment and updates the payment status derived from the ledger.
+func (r *MemoryRepository) record(payment *models.Payment, kind models.LedgerEntryKind, description string, legs ...ledgerLeg) {
+	transactionUID := uuid.New().String()
+	now := time.Now()
+
+	for _, leg := range legs {
+		if leg.amount == 0 {
+			continue
+		}
+
+		r.lastIDs.entry++
+		r.entries = append(r.entries, models.LedgerEntry{
+			ID:             r.lastIDs.entry,
+			EntryUID:       uuid.New().String(),
+			TransactionUID: transactionUID,
+			PaymentUID:     payment.PaymentUID,
+			Kind:           kind,
+			Account:        leg.account,
+			Amount:         models.Money{Amount: leg.amount, Currency: payment.Price.Currency},
+			Description:    description,
+			CreatedAt:      now,
+		})
+	}
+
+	payment.Status = models.PaymentStatusOf(r.selectEntries(payment.PaymentUID))
+	payment.UpdatedAt = now
+}
+
+func (r *MemoryRepository) selectEntries(paymentUID string) []models.LedgerEntry {
+	entries := make([]models.LedgerEntry, 0)
+
+	for _, entry := range r.entries {
+		if entry.PaymentUID == paymentUID {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+func (r *MemoryRepository) payment(paymentUID string) *models.Payment {
+	i := slices.IndexFunc(r.payments, func(payment models.Payment) bool { return payment.PaymentUID == paymentUID })
+	if i < 0 {
+		return nil
+	}
+
+	return &r.payments[i]
+}
+
+func (r *MemoryRepository) AuthorizePayment(ctx context.Context, price models.Money) (models.Payment, error) {
+	res, _, err := r.AuthorizePaymentOnce(ctx, price, "")
+	return res, err
+}
+
+func (r *MemoryRepository) AuthorizePaymentOnce(_ context.Context, price models.Money, idempotencyKey string) (res models.Payment, created bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if paymentUID, found := r.keys[idempotencyKey]; found {
+		return *r.payment(paymentUID), false, nil
+	}
+
+	now := time.Now()
+	r.lastIDs.payment++
+	r.payments = append(r.payments, models.Payment{
+		ID:         r.lastIDs.payment,
+		PaymentUID: uuid.New().String(),
+		Status:     models.PaymentAuthorized,
+		Price:      price,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+
+	payment := &r.payments[len(r.payments)-1]
+
+	r.record(payment, models.LedgerAuthorization, "",
+		ledgerLeg{models.AccountHolds, price.Amount},
+		ledgerLeg{models.AccountAuthorizations, -price.Amount},
+	)
+
+	if idempotencyKey != "" {
+		r.keys[idempotencyKey] = payment.PaymentUID
+	}
+
+	return *payment, true, nil
+}
+
+// capture releases the authorization hold of the payment and charges the held amount.
+func (r *MemoryRepository) capture(payment *models.Payment) {
+	amount := payment.Price.Amount
+
+	r.record(payment, models.LedgerCapture, "",
+		ledgerLeg{models.AccountHolds, -amount},
+		ledgerLeg{models.AccountAuthorizations, amount},
+	)
+	r.record(payment, models.LedgerCharge, "",
+		ledgerLeg{models.AccountCustomer, amount},
+		ledgerLeg{models.AccountRevenue, -amount},
+	)
+}
+
+// void reverses all balances of the payment.
+func (r *MemoryRepository) void(payment *models.Payment) {
+	balances := models.AccountBalances(r.selectEntries(payment.PaymentUID))
+
+	r.record(payment, models.LedgerVoid, "",
+		ledgerLeg{models.AccountCustomer, -balances[models.AccountCustomer]},
+		ledgerLeg{models.AccountRevenue, -balances[models.AccountRevenue]},
+		ledgerLeg{models.AccountFees, -balances[models.AccountFees]},
+		ledgerLeg{models.AccountHolds, -balances[models.AccountHolds]},
+		ledgerLeg{models.AccountAuthorizations, -balances[models.AccountAuthorizations]},
+	)
+}
+
+func (r *MemoryRepository) VoidAuthorization(_ context.Context, paymentUID string) (found, allowed bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment := r.payment(paymentUID)
+	if payment == nil {
+		return false, false, nil
+	} else if payment.Status != models.PaymentAuthorized {
+		return true, false, nil
+	}
+
+	r.void(payment)
+
+	return true, true, nil
+}
+
+func (r *MemoryRepository) GetStaleAuthorizations(_ context.Context, before time.Time, limit uint64) ([]models.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]models.Payment, 0)
+
+	for _, payment := range r.payments {
+		pending := slices.ContainsFunc(r.operations, func(operation models.ProviderOperation) bool {
+			return operation.PaymentUID == payment.PaymentUID && operation.Status == models.ProviderPending
+		})
+
+		if payment.Status == models.PaymentAuthorized && payment.CreatedAt.Before(before) && payment.RentalUID == "" && !pending {
+			res = append(res, payment)
+		}
+	}
+
+	slices.SortStableFunc(res, func(a, b models.Payment) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	return res[:min(uint64(len(res)), limit)], nil
+}
+
+func (r *MemoryRepository) GetPayment(_ context.Context, paymentUID string) (models.Payment, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	payment := r.payment(paymentUID)
+	if payment == nil {
+		return models.Payment{}, false, nil
+	}
+
+	return *payment, true, nil
+}
+
+func (r *MemoryRepository) GetPayments(_ context.Context, status models.PaymentStatus, page pagination.Request) ([]models.Payment, pagination.Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	payments := make([]models.Payment, 0)
+
+	for _, payment := range r.payments {
+		if payment.Status == status {
+			payments = append(payments, payment)
+		}
+	}
+
+	id := func(payment models.Payment) int64 { return payment.ID }
+	res, info := pagination.Paginate(pagination.Window(payments, page, id), page, id)
+	info.TotalCount = uint64(len(payments))
+
+	return res, info, nil
+}
+
+func (r *MemoryRepository) GetRentalPayments(_ context.Context, rentalUID string) ([]models.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]models.Payment, 0)
+
+	for _, payment := range r.payments {
+		if payment.RentalUID == rentalUID {
+			res = append(res, payment)
+		}
+	}
+
+	return res, nil
+}
+
+func (r *MemoryRepository) LinkRental(_ context.Context, paymentUID, rentalUID string) (linked bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment := r.payment(paymentUID)
+	if payment == nil || (payment.RentalUID != "" && payment.RentalUID != rentalUID) {
+		return false, nil
+	}
+
+	payment.RentalUID = rentalUID
+	payment.UpdatedAt = time.Now()
+
+	return true, nil
+}
+
+func (r *MemoryRepository) UpdatePaymentStatus(_ context.Context, paymentUID string, expected, status models.PaymentStatus) (updated bool, err error) {
+	if status != models.PaymentCanceled {
+		return false, fmt.Errorf("unsupported payment status update %s -> %s", expected, status)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment := r.payment(paymentUID)
+	if payment == nil || payment.Status != expected {
+		return false, nil
+	}
+
+	r.void(payment)
+
+	return true, nil
+}
+
+// refund records a refund of the payment approved by the provider. A cancellation refund voids
+// the payment instead of reducing its balance.
+func (r *MemoryRepository) refund(payment *models.Payment, operation models.ProviderOperation) {
+	r.lastIDs.refund++
+	r.refunds = append(r.refunds, models.Refund{
+		ID:         r.lastIDs.refund,
+		RefundUID:  operation.OperationUID,
+		PaymentUID: payment.PaymentUID,
+		Amount:     operation.Amount,
+		Reason:     operation.Reason,
+		CreatedAt:  time.Now(),
+	})
+
+	if operation.Reason == models.ReasonCancellation {
+		r.void(payment)
+		return
+	}
+
+	r.record(payment, models.LedgerRefund, operation.Reason,
+		ledgerLeg{models.AccountCustomer, -operation.Amount.Amount},
+		ledgerLeg{models.AccountRevenue, operation.Amount.Amount},
+	)
+}
+
+func (r *MemoryRepository) GetRefunds(_ context.Context, paymentUID string) ([]models.Refund, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]models.Refund, 0)
+
+	for _, refund := range r.refunds {
+		if refund.PaymentUID == paymentUID {
+			res = append(res, refund)
+		}
+	}
+
+	return res, nil
+}
+
+func (r *MemoryRepository) AddFee(_ context.Context, paymentUID string, amount models.Money, reason string) (found, allowed bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment := r.payment(paymentUID)
+	if payment == nil {
+		return false, false, nil
+	} else if payment.Status != models.PaymentPaid && payment.Status != models.PaymentPartiallyRefunded {
+		return true, false, nil
+	} else if amount.Currency != payment.Price.Currency {
+		return true, false, nil
+	}
+
+	r.record(payment, models.LedgerFee, reason,
+		ledgerLeg{models.AccountCustomer, amount.Amount},
+		ledgerLeg{models.AccountFees, -amount.Amount},
+	)
+
+	return true, true, nil
+}
+
+func (r *MemoryRepository) GetLedgerEntries(_ context.Context, paymentUID string) ([]models.LedgerEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.selectEntries(paymentUID), nil
+}
+
+func (r *MemoryRepository) CreateProviderOperation(_ context.Context, operation models.ProviderOperation) (models.ProviderOperation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.payment(operation.PaymentUID) == nil {
+		return models.ProviderOperation{}, fmt.Errorf("payment %s of the provider operation not found", operation.PaymentUID)
+	}
+
+	return r.insertOperation(operation), nil
+}
+
+func (r *MemoryRepository) CreateRefundOperation(_ context.Context, operation models.ProviderOperation) (res models.ProviderOperation, allowed bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment := r.payment(operation.PaymentUID)
+	if payment == nil {
+		return models.ProviderOperation{}, false, fmt.Errorf("payment %s of the provider operation not found", operation.PaymentUID)
+	}
+
+	if operation.IdempotencyKey != "" {
+		i := slices.IndexFunc(r.operations, func(other models.ProviderOperation) bool { return other.IdempotencyKey == operation.IdempotencyKey })
+		if i >= 0 {
+			return r.operations[i], r.operations[i].PaymentUID == payment.PaymentUID, nil
+		}
+	}
+
+	if payment.Status != models.PaymentPaid && payment.Status != models.PaymentPartiallyRefunded {
+		return models.ProviderOperation{}, false, nil
+	}
+
+	var pending int64
+
+	for _, other := range r.operations {
+		if other.PaymentUID == payment.PaymentUID && other.Kind == models.ProviderRefund && other.Status == models.ProviderPending {
+			pending += other.Amount.Amount
+		}
+	}
+
+	available := models.AccountBalances(r.selectEntries(payment.PaymentUID))[models.AccountCustomer] - pending
+	if operation.Reason == models.ReasonCancellation {
+		if pending != 0 {
+			return models.ProviderOperation{}, false, nil
+		}
+
+		operation.Amount = models.Money{Amount: available, Currency: payment.Price.Currency}
+	}
+
+	if operation.Amount.Currency != payment.Price.Currency {
+		return models.ProviderOperation{}, false, nil
+	}
+
+	if operation.Amount.Amount <= 0 || operation.Amount.Amount > available {
+		return models.ProviderOperation{}, false, nil
+	}
+
+	operation.Kind = models.ProviderRefund
+
+	return r.insertOperation(operation), true, nil
+}
+
+func (r *MemoryRepository) insertOperation(operation models.ProviderOperation) models.ProviderOperation {
+	now := time.Now()
+	r.lastIDs.operation++
+	operation.ID = r.lastIDs.operation
+	operation.OperationUID = uuid.New().String()
+	operation.Status = models.ProviderPending
+	operation.CreatedAt = now
+	operation.UpdatedAt = now
+	r.operations = append(r.operations, operation)
+
+	return operation
+}
+
+func (r *MemoryRepository) ApplyProviderResult(_ context.Context, operationUID string, response models.ProviderResponse) (res models.ProviderOperation, compensation *models.ProviderOperation, found bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.operations, func(operation models.ProviderOperation) bool { return operation.OperationUID == operationUID })
+	if i < 0 {
+		return models.ProviderOperation{}, nil, false, nil
+	}
+
+	operation := &r.operations[i]
+	if operation.Status != models.ProviderPending || response.Status == models.ProviderPending {
+		return *operation, nil, true, nil
+	}
+
+	operation.Status = response.Status
+	operation.ExternalRef = response.ExternalRef
+	operation.UpdatedAt = time.Now()
+
+	payment := r.payment(operation.PaymentUID)
+	approved := operation.Status == models.ProviderApproved
+
+	switch {
+	case operation.Kind == models.ProviderCharge && payment.Status == models.PaymentAuthorized:
+		if approved {
+			payment.ExternalRef = operation.ExternalRef
+			r.capture(payment)
+		} else {
+			r.void(payment)
+		}
+	case operation.Kind == models.ProviderCharge && approved &&
+		operation.Reason == models.ReasonReinstatement && payment.Status == models.PaymentCanceled:
+		payment.ExternalRef = operation.ExternalRef
+		r.record(payment, models.LedgerCharge, operation.Reason,
+			ledgerLeg{models.AccountCustomer, operation.Amount.Amount},
+			ledgerLeg{models.AccountRevenue, -operation.Amount.Amount},
+		)
+	case operation.Kind == models.ProviderCharge && approved:
+		refund := r.insertOperation(models.ProviderOperation{
+			PaymentUID: operation.PaymentUID,
+			Kind:       models.ProviderRefund,
+			Amount:     operation.Amount,
+			Reason:     models.ReasonCompensation,
+		})
+		compensation = &refund
+	case operation.Kind == models.ProviderRefund && approved && operation.Reason != models.ReasonCompensation:
+		r.refund(payment, *operation)
+	}
+
+	return r.operations[i], compensation, true, nil
+}
+
+func (r *MemoryRepository) GetPendingProviderOperations(_ context.Context, before time.Time, limit uint64) ([]models.ProviderOperation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]models.ProviderOperation, 0)
+
+	for _, operation := range r.operations {
+		if operation.Status == models.ProviderPending && operation.CreatedAt.Before(before) {
+			res = append(res, operation)
+		}
+	}
+
+	slices.SortStableFunc(res, func(a, b models.ProviderOperation) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	return res[:min(uint64(len(res)), limit)], nil
+}
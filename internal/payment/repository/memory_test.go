@@ -0,0 +1,23 @@
+package repository_test
+
+import (
+	"github.com/Inspirate789/ds-lab2/internal/payment/repository"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+type MemoryRepositorySuite struct {
+	ConformanceSuite
+}
+
+func (s *MemoryRepositorySuite) BeforeAll(provider.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	s.repo = repository.NewMemoryRepository(logger)
+}
+
+func TestMemoryRepository(t *testing.T) {
+	suite.RunSuite(t, new(MemoryRepositorySuite))
+}
@@ -0,0 +1,109 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/pkg/migrations"
+	"github.com/Inspirate789/ds-lab2/pkg/postgrestest"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+const insertPaymentRowQuery = `insert into payments(payment_uid, status, price) values ($1, 'PAID', 3000);`
+
+type MigrationsSuite struct {
+	suite.Suite
+	dsn string
+}
+
+func (s *MigrationsSuite) TestDuplicatePaymentUIDs(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	migrator, err := migrations.New(s.dsn, "../../../migrations/payment", logger)
+	t.Require().NoError(err)
+	defer migrator.Close()
+
+	db, err := sqlx.Connect("postgres", s.dsn)
+	t.Require().NoError(err)
+	defer db.Close()
+
+	t.Require().NoError(migrator.Goto(ctx, 5))
+
+	duplicateUID := uuid.NewString()
+	for _, paymentUID := range []string{duplicateUID, duplicateUID, uuid.NewString()} {
+		_, err = db.Exec(insertPaymentRowQuery, paymentUID)
+		t.Require().NoError(err)
+	}
+	// act
+	duplicateErr := migrator.Goto(ctx, 6)
+	_, dirty, statusErr := migrator.Status()
+	t.Require().NoError(statusErr)
+	t.Require().True(dirty)
+
+	_, err = db.Exec(`delete from payments where id = (select max(id) from payments where payment_uid = $1);`, duplicateUID)
+	t.Require().NoError(err)
+	t.Require().NoError(migrator.Force(ctx, 5))
+	repairedErr := migrator.Goto(ctx, 6)
+	// assert
+	t.Require().Error(duplicateErr)
+	t.Require().Contains(duplicateErr.Error(), "payments with duplicate uids: "+duplicateUID)
+	t.Require().NoError(repairedErr)
+}
+
+func (s *MigrationsSuite) TestMinorUnits(t provider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	migrator, err := migrations.New(s.dsn, "../../../migrations/payment", logger)
+	t.Require().NoError(err)
+	defer migrator.Close()
+
+	db, err := sqlx.Connect("postgres", s.dsn)
+	t.Require().NoError(err)
+	defer db.Close()
+
+	t.Require().NoError(migrator.Goto(ctx, 8))
+
+	paymentUID := uuid.NewString()
+	_, err = db.Exec(insertPaymentRowQuery, paymentUID)
+	t.Require().NoError(err)
+	_, err = db.Exec(`insert into refunds(refund_uid, payment_uid, amount, reason) values ($1, $2, 1000, 'test');`, uuid.NewString(), paymentUID)
+	t.Require().NoError(err)
+	// act
+	t.Require().NoError(migrator.Goto(ctx, 9))
+
+	var price, amount int64
+	var currency string
+
+	t.Require().NoError(db.Get(&price, `select price from payments where payment_uid = $1;`, paymentUID))
+	t.Require().NoError(db.QueryRow(`select amount, currency from refunds where payment_uid = $1;`, paymentUID).Scan(&amount, &currency))
+	t.Require().NoError(migrator.Goto(ctx, 8))
+
+	var restored int64
+
+	t.Require().NoError(db.Get(&restored, `select price from payments where payment_uid = $1;`, paymentUID))
+	// assert
+	t.Require().Equal(int64(300000), price)
+	t.Require().Equal(int64(100000), amount)
+	t.Require().Equal("RUB", currency)
+	t.Require().Equal(int64(3000), restored)
+}
+
+func TestMigrations(t *testing.T) {
+	suite.RunSuite(t, &MigrationsSuite{dsn: postgrestest.Start(t, "payments")})
+}
@@ -1,9 +1,64 @@
 package repository
 
 const (
-	// WARNING: when OFFSET is at least as great as the number of rows returned from the base query, no rows are returned.
-	// So we get no full_count, either. If that's a rare case, just run a second query for the count in this case.
-	insertPaymentQuery       = `insert into payments(payment_uid, status, price) values (:payment_uid, :status, :price) returning *;`
-	selectPaymentQuery       = `select * from payments where payment_uid = $1 limit 1;`
-	updatePaymentStatusQuery = `update payments set status = $2 where payment_uid = $1;`
+	insertPaymentQuery = `
+		insert into payments(payment_uid, status, price, currency, idempotency_key) 
+		values (:payment_uid, :status, :price, :currency, :idempotency_key) 
+		on conflict (idempotency_key) do nothing
+		returning *;
+	`
+	selectPaymentQuery           = `select * from payments where payment_uid = $1 limit 1;`
+	selectIdempotentPaymentQuery = `select * from payments where idempotency_key = $1 limit 1;`
+	selectPaymentsQuery          = `select * from payments where status = $1 and id > $2 and id < $3 order by id offset $4 limit $5;`
+	selectPaymentsBackwardQuery  = `select * from payments where status = $1 and id > $2 and id < $3 order by id desc offset $4 limit $5;`
+	countPaymentsQuery           = `select count(*) from payments where status = $1;`
+	selectRentalPaymentsQuery    = `select * from payments where rental_uid = $1 order by id;`
+	updatePaymentRentalQuery     = `
+		update payments set rental_uid = $2, updated_at = now()
+		where payment_uid = $1 and (rental_uid is null or rental_uid = $2);
+	`
+	selectStaleAuthorizationsQuery = `
+		select * from payments
+		where status = 'AUTHORIZED' and created_at < $1 and rental_uid is null and not exists (
+			select 1 from provider_operations o
+			where o.payment_uid = payments.payment_uid and o.status = 'PENDING'
+		)
+		order by created_at
+		limit $2;
+	`
+	selectPaymentForUpdateQuery   = `select * from payments where payment_uid = $1 limit 1 for update;`
+	updatePaymentStatusQuery      = `update payments set status = $2, updated_at = now() where payment_uid = $1;`
+	updatePaymentExternalRefQuery = `update payments set external_ref = $2, updated_at = now() where payment_uid = $1;`
+	insertRefundQuery             = `
+		insert into refunds(refund_uid, payment_uid, amount, currency, reason) 
+		values (:refund_uid, :payment_uid, :amount, :currency, :reason) 
+		returning *;
+	`
+	selectRefundsQuery     = `select * from refunds where payment_uid = $1 order by id;`
+	insertLedgerEntryQuery = `
+		insert into ledger_entries(entry_uid, transaction_uid, payment_uid, kind, account, amount, currency, description) 
+		values (:entry_uid, :transaction_uid, :payment_uid, :kind, :account, :amount, :currency, :description);
+	`
+	selectLedgerEntriesQuery     = `select * from ledger_entries where payment_uid = $1 order by id;`
+	insertProviderOperationQuery = `
+		insert into provider_operations(operation_uid, payment_uid, kind, amount, currency, reason, idempotency_key, status) 
+		values (:operation_uid, :payment_uid, :kind, :amount, :currency, :reason, :idempotency_key, :status) 
+		returning *;
+	`
+	selectPendingRefundsAmountQuery = `
+		select coalesce(sum(amount), 0) from provider_operations
+		where payment_uid = $1 and kind = 'REFUND' and status = 'PENDING';
+	`
+	selectIdempotentProviderOperationQuery = `select * from provider_operations where idempotency_key = $1 limit 1;`
+	selectProviderOperationForUpdateQuery  = `select * from provider_operations where operation_uid = $1 limit 1 for update;`
+	updateProviderOperationQuery           = `
+		update provider_operations set status = $2, external_ref = $3, updated_at = now()
+		where operation_uid = $1;
+	`
+	selectPendingProviderOperationsQuery = `
+		select * from provider_operations
+		where status = 'PENDING' and created_at < $1
+		order by created_at
+		limit $2;
+	`
 )
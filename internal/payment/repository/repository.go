@@ -4,19 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/outbox"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/Inspirate789/ds-lab2/pkg/sqlxutils"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"log/slog"
+	"time"
 )
 
 type SqlxRepository struct {
-	db     *sqlx.DB
+	db     *sqlxutils.DB
 	logger *slog.Logger
 }
 
-func NewSqlxRepository(db *sqlx.DB, logger *slog.Logger) *SqlxRepository {
+func NewSqlxRepository(db *sqlxutils.DB, logger *slog.Logger) *SqlxRepository {
 	return &SqlxRepository{
 		db:     db,
 		logger: logger,
@@ -27,20 +31,183 @@ func (r *SqlxRepository) HealthCheck(ctx context.Context) error {
 	return r.db.PingContext(ctx)
 }
 
-func (r *SqlxRepository) CreatePayment(ctx context.Context, price uint64) (res models.Payment, err error) {
-	payment := PaymentDTO{
-		ID:         0,
-		PaymentUID: uuid.New().String(),
-		Status:     models.PaymentPaid,
-		Price:      price,
+type ledgerLeg struct {
+	account models.LedgerAccount
+	amount  int64
+}
+
+// record appends a ledger transaction for the locked payment and updates the payment status derived from the ledger.
+func (r *SqlxRepository) record(ctx context.Context, tx *sqlx.Tx, payment *PaymentDTO, kind models.LedgerEntryKind, description string, legs ...ledgerLeg) error {
+	transactionUID := uuid.New().String()
+
+	for _, leg := range legs {
+		if leg.amount == 0 {
+			continue
+		}
+
+		entry := LedgerEntryDTO{
+			EntryUID:       uuid.New().String(),
+			TransactionUID: transactionUID,
+			PaymentUID:     payment.PaymentUID,
+			Kind:           kind,
+			Account:        leg.account,
+			Amount:         leg.amount,
+			Currency:       payment.Currency,
+			Description:    description,
+		}
+
+		_, err := sqlxutils.NamedExec(ctx, tx, insertLedgerEntryQuery, &entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := r.selectEntries(ctx, tx, payment.PaymentUID)
+	if err != nil {
+		return err
+	}
+
+	payment.Status = models.PaymentStatusOf(entries)
+	_, err = sqlxutils.Exec(ctx, tx, updatePaymentStatusQuery, payment.PaymentUID, payment.Status)
+
+	return err
+}
+
+// writeStatusEvent writes the status change event of the payment to the outbox, if the status changed.
+func (r *SqlxRepository) writeStatusEvent(ctx context.Context, tx *sqlx.Tx, payment *PaymentDTO, previous models.PaymentStatus) error {
+	if payment.Status == previous {
+		return nil
+	}
+
+	return outbox.Write(ctx, tx, outbox.Event{
+		AggregateType: models.AggregatePayment,
+		AggregateUID:  payment.PaymentUID,
+		Type:          models.PaymentEventType(payment.Status),
+		Payload:       models.NewPaymentEvent(payment.ToModel(), previous),
+	})
+}
+
+func (r *SqlxRepository) selectEntries(ctx context.Context, db sqlx.QueryerContext, paymentUID string) ([]models.LedgerEntry, error) {
+	entries := make(LedgerEntriesDTO, 0)
+
+	err := sqlxutils.Select(ctx, db, &entries, selectLedgerEntriesQuery, paymentUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries.ToModel(), nil
+}
+
+func (r *SqlxRepository) lockPayment(ctx context.Context, tx *sqlx.Tx, paymentUID string) (payment PaymentDTO, found bool, err error) {
+	err = sqlxutils.Get(ctx, tx, &payment, selectPaymentForUpdateQuery, paymentUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PaymentDTO{}, false, nil
+	} else if err != nil {
+		return PaymentDTO{}, false, err
+	}
+
+	return payment, true, nil
+}
+
+func (r *SqlxRepository) AuthorizePayment(ctx context.Context, price models.Money) (res models.Payment, err error) {
+	res, _, err = r.AuthorizePaymentOnce(ctx, price, "")
+	return res, err
+}
+
+// AuthorizePaymentOnce authorizes a payment for the idempotency key. The payment authorized for the key
+// before is returned as is, with created false; an empty key never matches.
+func (r *SqlxRepository) AuthorizePaymentOnce(ctx context.Context, price models.Money, idempotencyKey string) (res models.Payment, created bool, err error) {
+	var payment PaymentDTO
+
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		// the transaction may be run again
+		created = false
+		payment = PaymentDTO{
+			ID:             0,
+			PaymentUID:     uuid.New().String(),
+			Status:         models.PaymentAuthorized,
+			Price:          price.Amount,
+			Currency:       price.Currency,
+			IdempotencyKey: sql.NullString{String: idempotencyKey, Valid: idempotencyKey != ""},
+		}
+
+		err := sqlxutils.NamedGet(ctx, tx, &payment, insertPaymentQuery, &payment)
+		if errors.Is(err, sql.ErrNoRows) {
+			return sqlxutils.Get(ctx, tx, &payment, selectIdempotentPaymentQuery, idempotencyKey)
+		} else if err != nil {
+			return err
+		}
+
+		created = true
+
+		err = r.record(ctx, tx, &payment, models.LedgerAuthorization, "",
+			ledgerLeg{models.AccountHolds, price.Amount},
+			ledgerLeg{models.AccountAuthorizations, -price.Amount},
+		)
+		if err != nil {
+			return err
+		}
+
+		return r.writeStatusEvent(ctx, tx, &payment, "")
+	})
+	if err != nil {
+		return models.Payment{}, false, err
+	}
+
+	return payment.ToModel(), created, nil
+}
+
+// capture releases the authorization hold of the locked payment and charges the held amount.
+func (r *SqlxRepository) capture(ctx context.Context, tx *sqlx.Tx, payment *PaymentDTO) error {
+	amount := payment.Price
+
+	err := r.record(ctx, tx, payment, models.LedgerCapture, "",
+		ledgerLeg{models.AccountHolds, -amount},
+		ledgerLeg{models.AccountAuthorizations, amount},
+	)
+	if err != nil {
+		return err
 	}
 
-	err = sqlxutils.NamedGet(ctx, r.db, &payment, insertPaymentQuery, &payment)
+	return r.record(ctx, tx, payment, models.LedgerCharge, "",
+		ledgerLeg{models.AccountCustomer, amount},
+		ledgerLeg{models.AccountRevenue, -amount},
+	)
+}
+
+func (r *SqlxRepository) VoidAuthorization(ctx context.Context, paymentUID string) (found, allowed bool, err error) {
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		found, allowed = false, false // the transaction may be run again
+
+		var payment PaymentDTO
+
+		payment, found, err = r.lockPayment(ctx, tx, paymentUID)
+		if err != nil || !found || payment.Status != models.PaymentAuthorized {
+			return err
+		}
+
+		allowed = true
+
+		err = r.void(ctx, tx, &payment)
+		if err != nil {
+			return err
+		}
+
+		return r.writeStatusEvent(ctx, tx, &payment, models.PaymentAuthorized)
+	})
+
+	return found, allowed, err
+}
+
+func (r *SqlxRepository) GetStaleAuthorizations(ctx context.Context, before time.Time, limit uint64) ([]models.Payment, error) {
+	payments := make(PaymentsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db, &payments, selectStaleAuthorizationsQuery, before, limit)
 	if err != nil {
-		return models.Payment{}, err
+		return nil, err
 	}
 
-	return payment.ToModel(), nil
+	return payments.ToModel(), nil
 }
 
 func (r *SqlxRepository) GetPayment(ctx context.Context, paymentUID string) (models.Payment, bool, error) {
@@ -56,8 +223,44 @@ func (r *SqlxRepository) GetPayment(ctx context.Context, paymentUID string) (mod
 	return dto.ToModel(), true, nil
 }
 
-func (r *SqlxRepository) SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found bool, err error) {
-	res, err := sqlxutils.Exec(ctx, r.db, updatePaymentStatusQuery, paymentUID, status)
+func (r *SqlxRepository) GetPayments(ctx context.Context, status models.PaymentStatus, page pagination.Request) ([]models.Payment, pagination.Page, error) {
+	query := selectPaymentsQuery
+	if page.Backward() {
+		query = selectPaymentsBackwardQuery
+	}
+
+	after, before := page.Bounds()
+	payments := make(PaymentsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db.Reader(), &payments, query, status, after, before, page.Offset, page.Limit+1)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	payments, info := pagination.Paginate(payments, page, func(payment PaymentDTO) int64 { return payment.ID })
+
+	err = sqlxutils.Get(ctx, r.db.Reader(), &info.TotalCount, countPaymentsQuery, status)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	return payments.ToModel(), info, nil
+}
+
+func (r *SqlxRepository) GetRentalPayments(ctx context.Context, rentalUID string) ([]models.Payment, error) {
+	payments := make(PaymentsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db, &payments, selectRentalPaymentsQuery, rentalUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return payments.ToModel(), nil
+}
+
+// LinkRental links the payment to the rental unless it is linked to another one.
+func (r *SqlxRepository) LinkRental(ctx context.Context, paymentUID, rentalUID string) (linked bool, err error) {
+	res, err := sqlxutils.Exec(ctx, r.db, updatePaymentRentalQuery, paymentUID, rentalUID)
 	if err != nil {
 		return false, err
 	}
@@ -67,5 +270,333 @@ func (r *SqlxRepository) SetPaymentStatus(ctx context.Context, paymentUID string
 		return false, err
 	}
 
-	return rowsCount != 0, err
+	return rowsCount != 0, nil
+}
+
+// void reverses all balances of the locked payment.
+func (r *SqlxRepository) void(ctx context.Context, tx *sqlx.Tx, payment *PaymentDTO) error {
+	entries, err := r.selectEntries(ctx, tx, payment.PaymentUID)
+	if err != nil {
+		return err
+	}
+
+	balances := models.AccountBalances(entries)
+
+	return r.record(ctx, tx, payment, models.LedgerVoid, "",
+		ledgerLeg{models.AccountCustomer, -balances[models.AccountCustomer]},
+		ledgerLeg{models.AccountRevenue, -balances[models.AccountRevenue]},
+		ledgerLeg{models.AccountFees, -balances[models.AccountFees]},
+		ledgerLeg{models.AccountHolds, -balances[models.AccountHolds]},
+		ledgerLeg{models.AccountAuthorizations, -balances[models.AccountAuthorizations]},
+	)
+}
+
+// UpdatePaymentStatus voids the outstanding balance of the payment (CANCELED), if the payment is still
+// in the expected status. Charged payments are canceled through a provider refund instead.
+func (r *SqlxRepository) UpdatePaymentStatus(ctx context.Context, paymentUID string, expected, status models.PaymentStatus) (updated bool, err error) {
+	if status != models.PaymentCanceled {
+		return false, fmt.Errorf("unsupported payment status update %s -> %s", expected, status)
+	}
+
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		updated = false // the transaction may be run again
+
+		payment, found, err := r.lockPayment(ctx, tx, paymentUID)
+		if err != nil || !found || payment.Status != expected {
+			return err
+		}
+
+		err = r.void(ctx, tx, &payment)
+		if err != nil {
+			return err
+		}
+
+		err = r.writeStatusEvent(ctx, tx, &payment, expected)
+		if err != nil {
+			return err
+		}
+
+		updated = true
+
+		return nil
+	})
+
+	return updated, err
+}
+
+// refund records a refund of the locked payment approved by the provider. A cancellation refund voids
+// the payment instead of reducing its balance.
+func (r *SqlxRepository) refund(ctx context.Context, tx *sqlx.Tx, payment *PaymentDTO, operation ProviderOperationDTO) error {
+	refund := RefundDTO{
+		RefundUID:  operation.OperationUID,
+		PaymentUID: payment.PaymentUID,
+		Amount:     operation.Amount,
+		Currency:   operation.Currency,
+		Reason:     operation.Reason,
+	}
+
+	err := sqlxutils.NamedGet(ctx, tx, &refund, insertRefundQuery, &refund)
+	if err != nil {
+		return err
+	}
+
+	err = outbox.Write(ctx, tx, outbox.Event{
+		AggregateType: models.AggregatePayment,
+		AggregateUID:  payment.PaymentUID,
+		Type:          models.EventRefundIssued,
+		Payload: models.RefundEvent{
+			RefundUID:  refund.RefundUID,
+			PaymentUID: refund.PaymentUID,
+			Amount:     refund.Amount,
+			Currency:   refund.Currency,
+			Reason:     refund.Reason,
+		},
+	})
+	if err != nil {
+		return err
+	} else if operation.Reason == models.ReasonCancellation {
+		return r.void(ctx, tx, payment)
+	}
+
+	return r.record(ctx, tx, payment, models.LedgerRefund, operation.Reason,
+		ledgerLeg{models.AccountCustomer, -operation.Amount},
+		ledgerLeg{models.AccountRevenue, operation.Amount},
+	)
+}
+
+func (r *SqlxRepository) GetRefunds(ctx context.Context, paymentUID string) ([]models.Refund, error) {
+	refunds := make(RefundsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db, &refunds, selectRefundsQuery, paymentUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return refunds.ToModel(), nil
+}
+
+// AddFee charges the fee on top of the paid payment; a fee in another currency is not allowed.
+func (r *SqlxRepository) AddFee(ctx context.Context, paymentUID string, amount models.Money, reason string) (found, allowed bool, err error) {
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		found, allowed = false, false // the transaction may be run again
+
+		var payment PaymentDTO
+
+		payment, found, err = r.lockPayment(ctx, tx, paymentUID)
+		if err != nil || !found {
+			return err
+		} else if payment.Status != models.PaymentPaid && payment.Status != models.PaymentPartiallyRefunded {
+			return nil
+		} else if amount.Currency != payment.Currency {
+			return nil
+		}
+
+		allowed = true
+
+		return r.record(ctx, tx, &payment, models.LedgerFee, reason,
+			ledgerLeg{models.AccountCustomer, amount.Amount},
+			ledgerLeg{models.AccountFees, -amount.Amount},
+		)
+	})
+
+	return found, allowed, err
+}
+
+func (r *SqlxRepository) GetLedgerEntries(ctx context.Context, paymentUID string) ([]models.LedgerEntry, error) {
+	return r.selectEntries(ctx, r.db, paymentUID)
+}
+
+func (r *SqlxRepository) CreateProviderOperation(ctx context.Context, operation models.ProviderOperation) (models.ProviderOperation, error) {
+	return insertProviderOperation(ctx, r.db, operation)
+}
+
+// CreateRefundOperation reserves the refund amount on the charged payment. Pending refunds are reserved
+// already, so the amount has to fit into the rest of the customer balance. A cancellation refund is made for
+// the whole balance and only when no other refund is pending, its amount is set here. A refund in another
+// currency than the payment is not allowed. The refund created before for the idempotency key is returned
+// as is, whatever its status; a key used by a refund of another payment is not allowed.
+func (r *SqlxRepository) CreateRefundOperation(ctx context.Context, operation models.ProviderOperation) (res models.ProviderOperation, allowed bool, err error) {
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		res, allowed = models.ProviderOperation{}, false // the transaction may be run again
+
+		payment, found, err := r.lockPayment(ctx, tx, operation.PaymentUID)
+		if err != nil {
+			return err
+		} else if !found {
+			return fmt.Errorf("payment %s of the provider operation not found", operation.PaymentUID)
+		}
+
+		if operation.IdempotencyKey != "" {
+			var existing ProviderOperationDTO
+
+			err = sqlxutils.Get(ctx, tx, &existing, selectIdempotentProviderOperationQuery, operation.IdempotencyKey)
+			if err == nil {
+				res, allowed = existing.ToModel(), existing.PaymentUID == payment.PaymentUID
+				return nil
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+
+		if payment.Status != models.PaymentPaid && payment.Status != models.PaymentPartiallyRefunded {
+			return nil
+		}
+
+		entries, err := r.selectEntries(ctx, tx, payment.PaymentUID)
+		if err != nil {
+			return err
+		}
+
+		var pending int64
+
+		err = sqlxutils.Get(ctx, tx, &pending, selectPendingRefundsAmountQuery, payment.PaymentUID)
+		if err != nil {
+			return err
+		}
+
+		available := models.AccountBalances(entries)[models.AccountCustomer] - pending
+		if operation.Reason == models.ReasonCancellation {
+			if pending != 0 {
+				return nil
+			}
+
+			operation.Amount = models.Money{Amount: available, Currency: payment.Currency}
+		}
+
+		if operation.Amount.Currency != payment.Currency {
+			return nil
+		}
+
+		if operation.Amount.Amount <= 0 || operation.Amount.Amount > available {
+			return nil
+		}
+
+		operation.Kind = models.ProviderRefund
+		allowed = true
+		res, err = insertProviderOperation(ctx, tx, operation)
+
+		return err
+	})
+
+	return res, allowed, err
+}
+
+func insertProviderOperation(ctx context.Context, db sqlx.ExtContext, operation models.ProviderOperation) (models.ProviderOperation, error) {
+	dto := NewProviderOperationDTO(operation)
+	dto.OperationUID = uuid.New().String()
+	dto.Status = models.ProviderPending
+
+	err := sqlxutils.NamedGet(ctx, db, &dto, insertProviderOperationQuery, &dto)
+	if err != nil {
+		return models.ProviderOperation{}, err
+	}
+
+	return dto.ToModel(), nil
+}
+
+// ApplyProviderResult completes a pending provider operation and updates the ledger of its payment.
+// Results of already completed operations are ignored, so provider callbacks may be delivered more than once.
+// A charge approved after its payment was voided is returned to the customer by the compensation refund,
+// which is created pending and has to be sent to the provider.
+func (r *SqlxRepository) ApplyProviderResult(ctx context.Context, operationUID string, response models.ProviderResponse) (res models.ProviderOperation, compensation *models.ProviderOperation, found bool, err error) {
+	var operation ProviderOperationDTO
+
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		operation, compensation, found = ProviderOperationDTO{}, nil, false // the transaction may be run again
+
+		err := sqlxutils.Get(ctx, tx, &operation, selectProviderOperationForUpdateQuery, operationUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		found = true
+		if operation.Status != models.ProviderPending || response.Status == models.ProviderPending {
+			return nil
+		}
+
+		operation.Status = response.Status
+		operation.ExternalRef = response.ExternalRef
+
+		_, err = sqlxutils.Exec(ctx, tx, updateProviderOperationQuery, operationUID, operation.Status, operation.ExternalRef)
+		if err != nil {
+			return err
+		}
+
+		payment, _, err := r.lockPayment(ctx, tx, operation.PaymentUID)
+		if err != nil {
+			return err
+		}
+
+		previous := payment.Status
+		approved := operation.Status == models.ProviderApproved
+
+		switch {
+		case operation.Kind == models.ProviderCharge && payment.Status == models.PaymentAuthorized:
+			if !approved {
+				err = r.void(ctx, tx, &payment)
+				break
+			}
+
+			err = r.setExternalRef(ctx, tx, &payment, operation.ExternalRef)
+			if err == nil {
+				err = r.capture(ctx, tx, &payment)
+			}
+		case operation.Kind == models.ProviderCharge && approved &&
+			operation.Reason == models.ReasonReinstatement && payment.Status == models.PaymentCanceled:
+			err = r.setExternalRef(ctx, tx, &payment, operation.ExternalRef)
+			if err == nil {
+				err = r.record(ctx, tx, &payment, models.LedgerCharge, operation.Reason,
+					ledgerLeg{models.AccountCustomer, operation.Amount},
+					ledgerLeg{models.AccountRevenue, -operation.Amount},
+				)
+			}
+		case operation.Kind == models.ProviderCharge && approved:
+			var refund models.ProviderOperation
+
+			refund, err = insertProviderOperation(ctx, tx, models.ProviderOperation{
+				PaymentUID: operation.PaymentUID,
+				Kind:       models.ProviderRefund,
+				Amount:     models.Money{Amount: operation.Amount, Currency: operation.Currency},
+				Reason:     models.ReasonCompensation,
+			})
+			compensation = &refund
+		case operation.Kind == models.ProviderRefund && approved && operation.Reason != models.ReasonCompensation:
+			err = r.refund(ctx, tx, &payment, operation)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return r.writeStatusEvent(ctx, tx, &payment, previous)
+	})
+	if err != nil {
+		return models.ProviderOperation{}, nil, found, err
+	}
+
+	return operation.ToModel(), compensation, found, nil
+}
+
+func (r *SqlxRepository) setExternalRef(ctx context.Context, tx *sqlx.Tx, payment *PaymentDTO, externalRef string) error {
+	_, err := sqlxutils.Exec(ctx, tx, updatePaymentExternalRefQuery, payment.PaymentUID, externalRef)
+	if err != nil {
+		return err
+	}
+
+	payment.ExternalRef = sql.NullString{String: externalRef, Valid: true}
+
+	return nil
+}
+
+func (r *SqlxRepository) GetPendingProviderOperations(ctx context.Context, before time.Time, limit uint64) ([]models.ProviderOperation, error) {
+	operations := make(ProviderOperationsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db, &operations, selectPendingProviderOperationsQuery, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return operations.ToModel(), nil
 }
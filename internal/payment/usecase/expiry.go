@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"context"
+	"go.uber.org/multierr"
+	"log/slog"
+	"time"
+)
+
+// RunAuthorizationExpiry voids authorizations which were not captured within ttl. An authorization
+// linked to its rental is left alone: the gateway links the payment right before the capture,
+// so its capture may still be queued in the backlog. A failed rental flow voids it explicitly.
+func (u *UseCase) RunAuthorizationExpiry(ctx context.Context, ttl, interval time.Duration) {
+	if ttl <= 0 || interval <= 0 {
+		u.logger.Warn("authorization ttl or check interval not set, authorization expiry disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := u.VoidStaleAuthorizations(ctx, time.Now().Add(-ttl))
+			if err != nil {
+				u.logger.Error(err.Error())
+			}
+		}
+	}
+}
+
+func (u *UseCase) VoidStaleAuthorizations(ctx context.Context, before time.Time) error {
+	const batchSize = 100
+
+	payments, err := u.repo.GetStaleAuthorizations(ctx, before, batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		// the authorization may be captured meanwhile, then it is not voided
+		_, voided, voidErr := u.repo.VoidAuthorization(ctx, payment.PaymentUID)
+		if voidErr != nil {
+			err = multierr.Append(err, voidErr)
+		} else if voided {
+			u.logger.Info("stale authorization voided", slog.String("payment_uid", payment.PaymentUID))
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"go.uber.org/multierr"
+	"log/slog"
+	"time"
+)
+
+// RunProviderSync requests the results of provider operations pending for longer than interval,
+// in case their callbacks or responses were lost.
+func (u *UseCase) RunProviderSync(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		u.logger.Warn("provider sync interval not set, provider sync disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := u.SyncProviderOperations(ctx, time.Now().Add(-interval))
+			if err != nil {
+				u.logger.Error(err.Error())
+			}
+		}
+	}
+}
+
+func (u *UseCase) SyncProviderOperations(ctx context.Context, before time.Time) error {
+	const batchSize = 100
+
+	operations, err := u.repo.GetPendingProviderOperations(ctx, before, batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, operation := range operations {
+		var (
+			response  models.ProviderResponse
+			statusErr error
+		)
+
+		if operation.Reason == models.ReasonCompensation {
+			// the provider may have never received the refund, nobody else would send it again
+			response, statusErr = u.provider.Refund(ctx, operation.OperationUID, operation.Amount)
+		} else {
+			response, statusErr = u.provider.Status(ctx, operation.OperationUID)
+		}
+
+		if statusErr != nil {
+			err = multierr.Append(err, statusErr)
+			continue
+		} else if response.Status == models.ProviderPending {
+			continue
+		}
+
+		_, _, applyErr := u.applyResult(ctx, operation.OperationUID, response)
+		if applyErr != nil {
+			err = multierr.Append(err, applyErr)
+			continue
+		}
+
+		u.logger.Info("provider operation synced",
+			slog.String("operation_uid", operation.OperationUID),
+			slog.String("status", string(response.Status)),
+		)
+	}
+
+	return err
+}
@@ -0,0 +1,21 @@
+package usecase
+
+import "github.com/Inspirate789/ds-lab2/internal/models"
+
+// transitions lists the statuses a payment may be moved to by a status update. Captures, refunds
+// and reinstatements have dedicated operations, so they are not listed here.
+var transitions = map[models.PaymentStatus][]models.PaymentStatus{
+	models.PaymentAuthorized:        {models.PaymentCanceled},
+	models.PaymentPaid:              {models.PaymentCanceled},
+	models.PaymentPartiallyRefunded: {models.PaymentCanceled},
+}
+
+func canTransition(from, to models.PaymentStatus) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
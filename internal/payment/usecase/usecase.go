@@ -3,25 +3,51 @@ package usecase
 import (
 	"context"
 	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"log/slog"
+	"slices"
+	"time"
 )
 
 type Repository interface {
 	HealthCheck(ctx context.Context) error
-	CreatePayment(ctx context.Context, price uint64) (res models.Payment, err error)
+	AuthorizePayment(ctx context.Context, price models.Money) (res models.Payment, err error)
+	AuthorizePaymentOnce(ctx context.Context, price models.Money, idempotencyKey string) (res models.Payment, created bool, err error)
+	VoidAuthorization(ctx context.Context, paymentUID string) (found, allowed bool, err error)
+	GetStaleAuthorizations(ctx context.Context, before time.Time, limit uint64) (res []models.Payment, err error)
 	GetPayment(ctx context.Context, paymentUID string) (res models.Payment, found bool, err error)
-	SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found bool, err error)
+	GetPayments(ctx context.Context, status models.PaymentStatus, page pagination.Request) (res []models.Payment, info pagination.Page, err error)
+	GetRentalPayments(ctx context.Context, rentalUID string) (res []models.Payment, err error)
+	LinkRental(ctx context.Context, paymentUID, rentalUID string) (linked bool, err error)
+	UpdatePaymentStatus(ctx context.Context, paymentUID string, expected, status models.PaymentStatus) (updated bool, err error)
+	GetRefunds(ctx context.Context, paymentUID string) (res []models.Refund, err error)
+	AddFee(ctx context.Context, paymentUID string, amount models.Money, reason string) (found, allowed bool, err error)
+	GetLedgerEntries(ctx context.Context, paymentUID string) (res []models.LedgerEntry, err error)
+	CreateProviderOperation(ctx context.Context, operation models.ProviderOperation) (res models.ProviderOperation, err error)
+	CreateRefundOperation(ctx context.Context, operation models.ProviderOperation) (res models.ProviderOperation, allowed bool, err error)
+	ApplyProviderResult(ctx context.Context, operationUID string, response models.ProviderResponse) (res models.ProviderOperation, compensation *models.ProviderOperation, found bool, err error)
+	GetPendingProviderOperations(ctx context.Context, before time.Time, limit uint64) (res []models.ProviderOperation, err error)
+}
+
+// Provider is an acquirer moving the money. Operations are identified by operationUID, so they can be retried
+// safely; a PENDING response is completed later by a provider callback or a status request.
+type Provider interface {
+	Charge(ctx context.Context, operationUID string, amount models.Money) (res models.ProviderResponse, err error)
+	Refund(ctx context.Context, operationUID string, amount models.Money) (res models.ProviderResponse, err error)
+	Status(ctx context.Context, operationUID string) (res models.ProviderResponse, err error)
 }
 
 type UseCase struct {
-	repo   Repository
-	logger *slog.Logger
+	repo     Repository
+	provider Provider
+	logger   *slog.Logger
 }
 
-func New(repo Repository, logger *slog.Logger) *UseCase {
+func New(repo Repository, provider Provider, logger *slog.Logger) *UseCase {
 	return &UseCase{
-		repo:   repo,
-		logger: logger,
+		repo:     repo,
+		provider: provider,
+		logger:   logger,
 	}
 }
 
@@ -29,14 +55,299 @@ func (u *UseCase) HealthCheck(ctx context.Context) error {
 	return u.repo.HealthCheck(ctx)
 }
 
-func (u *UseCase) CreatePayment(ctx context.Context, price uint64) (res models.Payment, err error) {
-	return u.repo.CreatePayment(ctx, price)
+// CreatePayment authorizes and immediately captures the payment; a declined payment is returned CANCELED.
+// A repeated request with the same idempotency key returns the payment created by the first one.
+func (u *UseCase) CreatePayment(ctx context.Context, price models.Money, idempotencyKey string) (res models.Payment, err error) {
+	payment, created, err := u.repo.AuthorizePaymentOnce(ctx, price, idempotencyKey)
+	if err != nil {
+		return models.Payment{}, err
+	} else if !created {
+		return payment, nil
+	}
+
+	_, err = u.charge(ctx, payment, "")
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	res, _, err = u.repo.GetPayment(ctx, payment.PaymentUID)
+
+	return res, err
+}
+
+func (u *UseCase) AuthorizePayment(ctx context.Context, price models.Money) (res models.Payment, err error) {
+	return u.repo.AuthorizePayment(ctx, price)
+}
+
+// CapturePayment charges an authorized payment through the provider. A pending charge is captured
+// when the provider reports the result, so the returned payment stays AUTHORIZED until then.
+func (u *UseCase) CapturePayment(ctx context.Context, paymentUID string) (res models.Payment, found, allowed bool, err error) {
+	payment, found, err := u.repo.GetPayment(ctx, paymentUID)
+	if err != nil || !found {
+		return models.Payment{}, found, false, err
+	} else if payment.Status != models.PaymentAuthorized {
+		return models.Payment{}, true, false, nil
+	}
+
+	status, err := u.charge(ctx, payment, "")
+	if err != nil {
+		return models.Payment{}, true, false, err
+	} else if status == models.ProviderDeclined {
+		return models.Payment{}, true, false, nil
+	}
+
+	res, _, err = u.repo.GetPayment(ctx, paymentUID)
+	if err != nil {
+		return models.Payment{}, true, false, err
+	}
+
+	return res, true, true, nil
+}
+
+func (u *UseCase) charge(ctx context.Context, payment models.Payment, reason string) (models.ProviderOperationStatus, error) {
+	operation, err := u.repo.CreateProviderOperation(ctx, models.ProviderOperation{
+		PaymentUID: payment.PaymentUID,
+		Kind:       models.ProviderCharge,
+		Amount:     payment.Price,
+		Reason:     reason,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// a failed request leaves the operation pending until the provider status is synced
+	response, err := u.provider.Charge(ctx, operation.OperationUID, operation.Amount)
+	if err != nil {
+		return "", err
+	}
+
+	_, _, err = u.applyResult(ctx, operation.OperationUID, response)
+
+	return response.Status, err
+}
+
+// refund sends the refund operation to the provider and applies the result.
+func (u *UseCase) refund(ctx context.Context, operation models.ProviderOperation) (res models.ProviderOperation, status models.ProviderOperationStatus, err error) {
+	response, err := u.provider.Refund(ctx, operation.OperationUID, operation.Amount)
+	if err != nil {
+		return models.ProviderOperation{}, "", err
+	}
+
+	res, _, err = u.applyResult(ctx, operation.OperationUID, response)
+
+	return res, response.Status, err
+}
+
+// applyResult applies the provider result and returns a charge approved after its payment was voided
+// to the customer. A compensation refund failed to be sent is sent again by the provider sync.
+func (u *UseCase) applyResult(ctx context.Context, operationUID string, response models.ProviderResponse) (res models.ProviderOperation, found bool, err error) {
+	res, compensation, found, err := u.repo.ApplyProviderResult(ctx, operationUID, response)
+	if err != nil || compensation == nil {
+		return res, found, err
+	}
+
+	u.logger.Warn("charge approved after the payment was voided, refund it",
+		slog.String("payment_uid", res.PaymentUID),
+		slog.String("operation_uid", operationUID),
+	)
+
+	_, _, err = u.refund(ctx, *compensation)
+
+	return res, found, err
+}
+
+func (u *UseCase) VoidPayment(ctx context.Context, paymentUID string) (found, allowed bool, err error) {
+	return u.repo.VoidAuthorization(ctx, paymentUID)
 }
 
 func (u *UseCase) GetPayment(ctx context.Context, paymentUID string) (res models.Payment, found bool, err error) {
 	return u.repo.GetPayment(ctx, paymentUID)
 }
 
-func (u *UseCase) SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found bool, err error) {
-	return u.repo.SetPaymentStatus(ctx, paymentUID, status)
+func (u *UseCase) GetPayments(ctx context.Context, status models.PaymentStatus, page pagination.Request) (res []models.Payment, info pagination.Page, err error) {
+	return u.repo.GetPayments(ctx, status, page)
+}
+
+func (u *UseCase) GetRentalPayments(ctx context.Context, rentalUID string) (res []models.Payment, err error) {
+	return u.repo.GetRentalPayments(ctx, rentalUID)
+}
+
+// LinkRental links the payment to its rental; a payment is never moved to another rental.
+func (u *UseCase) LinkRental(ctx context.Context, paymentUID, rentalUID string) (found, allowed bool, err error) {
+	_, found, err = u.repo.GetPayment(ctx, paymentUID)
+	if err != nil || !found {
+		return found, false, err
+	}
+
+	allowed, err = u.repo.LinkRental(ctx, paymentUID, rentalUID)
+
+	return true, allowed, err
+}
+
+func (u *UseCase) SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found, allowed, changed bool, err error) {
+	return u.setPaymentStatus(ctx, paymentUID, status, canTransition)
+}
+
+// ReinstatePayment charges a canceled payment again through the provider, e.g. to roll back a rental cancellation.
+// Only a payment captured before is reinstated, a voided authorization has never been paid.
+func (u *UseCase) ReinstatePayment(ctx context.Context, paymentUID string) (found, allowed, changed bool, err error) {
+	payment, found, err := u.repo.GetPayment(ctx, paymentUID)
+	if err != nil || !found {
+		return found, false, false, err
+	} else if payment.Status == models.PaymentPaid {
+		return true, true, false, nil
+	} else if payment.Status != models.PaymentCanceled {
+		return true, false, false, nil
+	}
+
+	entries, err := u.repo.GetLedgerEntries(ctx, paymentUID)
+	if err != nil {
+		return true, false, false, err
+	}
+
+	captured := slices.ContainsFunc(entries, func(entry models.LedgerEntry) bool { return entry.Kind == models.LedgerCapture })
+	if !captured {
+		return true, false, false, nil
+	}
+
+	status, err := u.charge(ctx, payment, models.ReasonReinstatement)
+	if err != nil {
+		return true, false, false, err
+	}
+
+	return true, status != models.ProviderDeclined, status != models.ProviderDeclined, nil
+}
+
+// setPaymentStatus reports a payment already in the status as unchanged.
+func (u *UseCase) setPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus, allowedFrom func(from, to models.PaymentStatus) bool) (found, allowed, changed bool, err error) {
+	const maxAttempts = 3
+
+	for range maxAttempts {
+		payment, found, err := u.repo.GetPayment(ctx, paymentUID)
+		if err != nil || !found {
+			return false, false, false, err
+		}
+
+		if payment.Status == status {
+			return true, true, false, nil
+		} else if !allowedFrom(payment.Status, status) {
+			return true, false, false, nil
+		} else if status == models.PaymentCanceled && payment.Status != models.PaymentAuthorized {
+			allowed, changed, err = u.cancelCharged(ctx, payment)
+			return true, allowed, changed, err
+		}
+
+		updated, err := u.repo.UpdatePaymentStatus(ctx, paymentUID, payment.Status, status)
+		if err != nil {
+			return true, false, false, err
+		} else if updated {
+			return true, true, true, nil
+		}
+
+		u.logger.Debug("payment status changed concurrently, retry",
+			slog.String("payment_uid", paymentUID),
+			slog.String("status", string(status)),
+		)
+	}
+
+	u.logger.Warn("give up changing payment status after concurrent updates", slog.String("payment_uid", paymentUID))
+
+	return true, false, false, nil
+}
+
+// cancelCharged refunds the outstanding balance of a charged payment through the provider. The payment
+// is CANCELED once the provider approves the refund, a pending refund is reported as a change.
+// A payment with other refunds pending is not canceled.
+func (u *UseCase) cancelCharged(ctx context.Context, payment models.Payment) (allowed, changed bool, err error) {
+	operation, allowed, err := u.repo.CreateRefundOperation(ctx, models.ProviderOperation{
+		PaymentUID: payment.PaymentUID,
+		Reason:     models.ReasonCancellation,
+	})
+	if err != nil || !allowed {
+		return false, false, err
+	}
+
+	_, status, err := u.refund(ctx, operation)
+	if err != nil {
+		return false, false, err
+	}
+
+	return status != models.ProviderDeclined, status != models.ProviderDeclined, nil
+}
+
+// RefundPayment refunds the amount through the provider. The amounts of pending refunds are reserved, so
+// the refunds never exceed the customer balance. A pending refund is recorded when the provider reports
+// the result, so an empty refund is returned for it. A repeated request with the same idempotency key returns
+// the refund made by the first one, a refund still pending is sent to the provider again.
+func (u *UseCase) RefundPayment(ctx context.Context, paymentUID string, amount models.Money, reason, idempotencyKey string) (res models.Refund, found, allowed bool, err error) {
+	_, found, err = u.repo.GetPayment(ctx, paymentUID)
+	if err != nil || !found {
+		return models.Refund{}, found, false, err
+	} else if reason == models.ReasonCancellation || reason == models.ReasonCompensation {
+		return models.Refund{}, true, false, nil // the refunds the service makes on its own
+	}
+
+	operation, allowed, err := u.repo.CreateRefundOperation(ctx, models.ProviderOperation{
+		PaymentUID:     paymentUID,
+		Amount:         amount,
+		Reason:         reason,
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil || !allowed {
+		return models.Refund{}, true, false, err
+	}
+
+	status := operation.Status
+	if status == models.ProviderPending {
+		operation, status, err = u.refund(ctx, operation)
+		if err != nil {
+			return models.Refund{}, true, false, err
+		}
+	}
+
+	if status == models.ProviderDeclined {
+		return models.Refund{}, true, false, nil
+	} else if status == models.ProviderPending {
+		return models.Refund{}, true, true, nil
+	}
+
+	return models.Refund{
+		RefundUID:  operation.OperationUID,
+		PaymentUID: paymentUID,
+		Amount:     operation.Amount,
+		Reason:     operation.Reason,
+		CreatedAt:  operation.UpdatedAt,
+	}, true, true, nil
+}
+
+// HandleProviderResult applies an asynchronous provider result (e.g. from a webhook).
+func (u *UseCase) HandleProviderResult(ctx context.Context, operationUID string, response models.ProviderResponse) (found bool, err error) {
+	_, found, err = u.applyResult(ctx, operationUID, response)
+	return found, err
+}
+
+func (u *UseCase) GetRefunds(ctx context.Context, paymentUID string) (res []models.Refund, found bool, err error) {
+	_, found, err = u.repo.GetPayment(ctx, paymentUID)
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	res, err = u.repo.GetRefunds(ctx, paymentUID)
+
+	return res, true, err
+}
+
+func (u *UseCase) AddFee(ctx context.Context, paymentUID string, amount models.Money, reason string) (found, allowed bool, err error) {
+	return u.repo.AddFee(ctx, paymentUID, amount, reason)
+}
+
+func (u *UseCase) GetLedgerEntries(ctx context.Context, paymentUID string) (res []models.LedgerEntry, found bool, err error) {
+	_, found, err = u.repo.GetPayment(ctx, paymentUID)
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	res, err = u.repo.GetLedgerEntries(ctx, paymentUID)
+
+	return res, true, err
 }
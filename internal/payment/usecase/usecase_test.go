@@ -0,0 +1,758 @@
+package usecase_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/payment/provider"
+	"github.com/Inspirate789/ds-lab2/internal/payment/repository"
+	"github.com/Inspirate789/ds-lab2/internal/payment/usecase"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/ozontech/allure-go/pkg/allure"
+	allureProvider "github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+// environment runs the use case on the in-memory repository and the fake provider.
+type environment struct {
+	repo     *repository.MemoryRepository
+	provider *provider.Fake
+	useCase  *usecase.UseCase
+}
+
+func newEnvironment(mode provider.Mode) *environment {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	env := &environment{
+		repo:     repository.NewMemoryRepository(logger),
+		provider: provider.NewFake(mode, 0, "", "", nil, logger),
+	}
+	env.useCase = usecase.New(env.repo, env.provider, logger)
+
+	return env
+}
+
+// rub is the amount of rubles in minor units.
+func rub(major uint64) models.Money {
+	return models.NewMoney(major, "RUB")
+}
+
+// paid creates a captured payment of the price.
+func (env *environment) paid(t allureProvider.StepCtx, price uint64) models.Payment {
+	payment, err := env.useCase.CreatePayment(context.Background(), rub(price), "")
+	t.Require().NoError(err)
+	t.Require().Equal(models.PaymentPaid, payment.Status)
+
+	return payment
+}
+
+func (env *environment) status(t allureProvider.StepCtx, paymentUID string) models.PaymentStatus {
+	payment, found, err := env.useCase.GetPayment(context.Background(), paymentUID)
+	t.Require().NoError(err)
+	t.Require().True(found)
+
+	return payment.Status
+}
+
+func (env *environment) balances(t allureProvider.StepCtx, paymentUID string) map[models.LedgerAccount]int64 {
+	entries, _, err := env.useCase.GetLedgerEntries(context.Background(), paymentUID)
+	t.Require().NoError(err)
+
+	return models.AccountBalances(entries)
+}
+
+type UseCaseSuite struct {
+	suite.Suite
+}
+
+func (s *UseCaseSuite) TestCreatePayment(t allureProvider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("repeated request with the idempotency key is charged once", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment, err := env.useCase.CreatePayment(ctx, rub(3000), "surcharge:test")
+		sCtx.Require().NoError(err)
+		// act
+		repeated, err := env.useCase.CreatePayment(ctx, rub(3000), "surcharge:test")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().Equal(payment.PaymentUID, repeated.PaymentUID)
+		sCtx.Require().Equal(models.PaymentPaid, repeated.Status)
+		sCtx.Require().Equal(int64(300000), env.balances(sCtx, payment.PaymentUID)[models.AccountCustomer])
+	})
+
+	t.WithNewStep("declined payment is not charged again for the idempotency key", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeDecline)
+		payment, err := env.useCase.CreatePayment(ctx, rub(3000), "surcharge:test")
+		sCtx.Require().NoError(err)
+		env.provider.SetMode(provider.ModeApprove)
+		// act
+		repeated, err := env.useCase.CreatePayment(ctx, rub(3000), "surcharge:test")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().Equal(models.PaymentCanceled, payment.Status)
+		sCtx.Require().Equal(payment.PaymentUID, repeated.PaymentUID)
+		sCtx.Require().Equal(models.PaymentCanceled, repeated.Status)
+	})
+}
+
+func (s *UseCaseSuite) TestCancelPayment(t allureProvider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("charged payment is refunded through the provider", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		// act
+		found, allowed, changed, err := env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		sCtx.Require().NoError(err)
+		_, repeatAllowed, repeatChanged, err := env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		sCtx.Require().NoError(err)
+		refunds, _, err := env.useCase.GetRefunds(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().True(changed)
+		sCtx.Require().True(repeatAllowed)
+		sCtx.Require().False(repeatChanged)
+		sCtx.Require().Equal(models.PaymentCanceled, env.status(sCtx, payment.PaymentUID))
+		sCtx.Require().Len(refunds, 1)
+		sCtx.Require().Equal(rub(3000), refunds[0].Amount)
+		sCtx.Require().Equal(models.ReasonCancellation, refunds[0].Reason)
+
+		response, err := env.provider.Status(ctx, refunds[0].RefundUID)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(models.ProviderApproved, response.Status)
+	})
+
+	t.WithNewStep("partially refunded payment is refunded the rest", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		_, _, _, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "early return", "")
+		sCtx.Require().NoError(err)
+		// act
+		_, allowed, changed, err := env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		sCtx.Require().NoError(err)
+		refunds, _, err := env.useCase.GetRefunds(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(allowed)
+		sCtx.Require().True(changed)
+		sCtx.Require().Equal(models.PaymentCanceled, env.status(sCtx, payment.PaymentUID))
+		sCtx.Require().Len(refunds, 2)
+		sCtx.Require().Equal(rub(2000), refunds[1].Amount)
+	})
+
+	t.WithNewStep("declined refund leaves the payment paid", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		env.provider.SetMode(provider.ModeDecline)
+		// act
+		_, allowed, changed, err := env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().False(allowed)
+		sCtx.Require().False(changed)
+		sCtx.Require().Equal(models.PaymentPaid, env.status(sCtx, payment.PaymentUID))
+	})
+
+	t.WithNewStep("authorization is voided without the provider", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeFail)
+		payment, err := env.useCase.AuthorizePayment(ctx, rub(3000))
+		sCtx.Require().NoError(err)
+		// act
+		_, allowed, changed, err := env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(allowed)
+		sCtx.Require().True(changed)
+		sCtx.Require().Equal(models.PaymentCanceled, env.status(sCtx, payment.PaymentUID))
+	})
+}
+
+func (s *UseCaseSuite) TestSetPaymentStatus(t allureProvider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	// payments in each status a status update may start from
+	setUps := map[models.PaymentStatus]func(env *environment, sCtx allureProvider.StepCtx) models.Payment{
+		models.PaymentAuthorized: func(env *environment, sCtx allureProvider.StepCtx) models.Payment {
+			payment, err := env.useCase.AuthorizePayment(ctx, rub(3000))
+			sCtx.Require().NoError(err)
+			return payment
+		},
+		models.PaymentPaid: func(env *environment, sCtx allureProvider.StepCtx) models.Payment {
+			return env.paid(sCtx, 3000)
+		},
+		models.PaymentPartiallyRefunded: func(env *environment, sCtx allureProvider.StepCtx) models.Payment {
+			payment := env.paid(sCtx, 3000)
+			_, _, _, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "early return", "")
+			sCtx.Require().NoError(err)
+			return payment
+		},
+		models.PaymentRefunded: func(env *environment, sCtx allureProvider.StepCtx) models.Payment {
+			payment := env.paid(sCtx, 3000)
+			_, _, _, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(3000), "early return", "")
+			sCtx.Require().NoError(err)
+			return payment
+		},
+		models.PaymentCanceled: func(env *environment, sCtx allureProvider.StepCtx) models.Payment {
+			payment, err := env.useCase.AuthorizePayment(ctx, rub(3000))
+			sCtx.Require().NoError(err)
+			_, _, err = env.useCase.VoidPayment(ctx, payment.PaymentUID)
+			sCtx.Require().NoError(err)
+			return payment
+		},
+	}
+
+	statuses := []models.PaymentStatus{
+		models.PaymentAuthorized,
+		models.PaymentPaid,
+		models.PaymentPartiallyRefunded,
+		models.PaymentRefunded,
+		models.PaymentCanceled,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			// only cancellation is a plain status update, the rest has dedicated operations
+			allowed := from == to || to == models.PaymentCanceled && from != models.PaymentRefunded
+			changed := allowed && from != to
+
+			want := from
+			if changed {
+				want = to
+			}
+
+			t.WithNewStep(string(from)+" to "+string(to), func(sCtx allureProvider.StepCtx) {
+				// arrange
+				env := newEnvironment(provider.ModeApprove)
+				payment := setUps[from](env, sCtx)
+				sCtx.Require().Equal(from, env.status(sCtx, payment.PaymentUID))
+				// act
+				found, actualAllowed, actualChanged, err := env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, to)
+				// assert
+				sCtx.Require().NoError(err)
+				sCtx.Require().True(found)
+				sCtx.Require().Equal(allowed, actualAllowed)
+				sCtx.Require().Equal(changed, actualChanged)
+				sCtx.Require().Equal(want, env.status(sCtx, payment.PaymentUID))
+			})
+		}
+	}
+
+	t.WithNewStep("unknown payment", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		// act
+		found, allowed, changed, err := env.useCase.SetPaymentStatus(ctx, "9b7c5e13-2a8d-4f60-b4e1-7d3c0a2f6e85", models.PaymentCanceled)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().False(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().False(changed)
+	})
+}
+
+func (s *UseCaseSuite) TestReinstatePayment(t allureProvider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("canceled payment is charged again through the provider", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		_, _, _, err := env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		sCtx.Require().NoError(err)
+		// act
+		found, allowed, changed, err := env.useCase.ReinstatePayment(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		_, repeatAllowed, repeatChanged, err := env.useCase.ReinstatePayment(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		stored, _, err := env.useCase.GetPayment(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().True(changed)
+		sCtx.Require().True(repeatAllowed)
+		sCtx.Require().False(repeatChanged)
+		sCtx.Require().Equal(models.PaymentPaid, stored.Status)
+		sCtx.Require().NotEqual(payment.ExternalRef, stored.ExternalRef)
+		sCtx.Require().Equal(int64(300000), env.balances(sCtx, payment.PaymentUID)[models.AccountCustomer])
+	})
+
+	t.WithNewStep("voided authorization is not reinstated", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment, err := env.useCase.AuthorizePayment(ctx, rub(3000))
+		sCtx.Require().NoError(err)
+		_, _, err = env.useCase.VoidPayment(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		// act
+		found, allowed, changed, err := env.useCase.ReinstatePayment(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().False(changed)
+		sCtx.Require().Equal(models.PaymentCanceled, env.status(sCtx, payment.PaymentUID))
+		sCtx.Require().Zero(env.balances(sCtx, payment.PaymentUID)[models.AccountCustomer])
+	})
+
+	t.WithNewStep("declined charge leaves the payment canceled", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		_, _, _, err := env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		sCtx.Require().NoError(err)
+		env.provider.SetMode(provider.ModeDecline)
+		// act
+		_, allowed, changed, err := env.useCase.ReinstatePayment(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().False(allowed)
+		sCtx.Require().False(changed)
+		sCtx.Require().Equal(models.PaymentCanceled, env.status(sCtx, payment.PaymentUID))
+	})
+}
+
+func (s *UseCaseSuite) TestRefundPayment(t allureProvider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("pending refunds are reserved", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		env.provider.SetMode(provider.ModePending)
+		// act
+		_, _, pendingAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(2000), "damage", "")
+		sCtx.Require().NoError(err)
+		_, _, excessAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(2000), "damage", "")
+		sCtx.Require().NoError(err)
+		_, cancelAllowed, _, err := env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		sCtx.Require().NoError(err)
+		env.provider.SetMode(provider.ModeApprove)
+		refund, _, restAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "damage", "")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(pendingAllowed)
+		sCtx.Require().False(excessAllowed)
+		sCtx.Require().False(cancelAllowed)
+		sCtx.Require().True(restAllowed)
+		sCtx.Require().Equal(rub(1000), refund.Amount)
+		sCtx.Require().Equal(models.PaymentPartiallyRefunded, env.status(sCtx, payment.PaymentUID))
+	})
+
+	t.WithNewStep("declined refund releases the reservation", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		env.provider.SetMode(provider.ModeDecline)
+		// act
+		_, _, declinedAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(3000), "damage", "")
+		sCtx.Require().NoError(err)
+		env.provider.SetMode(provider.ModeApprove)
+		_, _, allowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(3000), "damage", "")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().False(declinedAllowed)
+		sCtx.Require().True(allowed)
+		sCtx.Require().Equal(models.PaymentRefunded, env.status(sCtx, payment.PaymentUID))
+	})
+
+	t.WithNewStep("partial refunds up to the price", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		// act
+		_, _, firstAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "early return", "")
+		sCtx.Require().NoError(err)
+		partialStatus := env.status(sCtx, payment.PaymentUID)
+		_, _, restAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(2000), "late cancellation", "")
+		sCtx.Require().NoError(err)
+		_, _, excessAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1), "damage", "")
+		sCtx.Require().NoError(err)
+		refunds, _, err := env.useCase.GetRefunds(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(firstAllowed)
+		sCtx.Require().Equal(models.PaymentPartiallyRefunded, partialStatus)
+		sCtx.Require().True(restAllowed)
+		sCtx.Require().False(excessAllowed)
+		sCtx.Require().Equal(models.PaymentRefunded, env.status(sCtx, payment.PaymentUID))
+		sCtx.Require().Len(refunds, 2)
+		sCtx.Require().Equal(rub(1000), refunds[0].Amount)
+		sCtx.Require().Equal("early return", refunds[0].Reason)
+		sCtx.Require().Equal(rub(2000), refunds[1].Amount)
+		sCtx.Require().Equal(int64(0), env.balances(sCtx, payment.PaymentUID)[models.AccountCustomer])
+	})
+
+	t.WithNewStep("repeated refund with the idempotency key", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		first, _, _, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "early return", "refund:rental:early return")
+		sCtx.Require().NoError(err)
+		// act
+		repeated, found, allowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(500), "early return", "refund:rental:early return")
+		sCtx.Require().NoError(err)
+		refunds, _, err := env.useCase.GetRefunds(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().Equal(first, repeated)
+		sCtx.Require().Len(refunds, 1)
+		sCtx.Require().Equal(int64(200000), env.balances(sCtx, payment.PaymentUID)[models.AccountCustomer])
+	})
+
+	t.WithNewStep("pending refund is not reserved again for the idempotency key", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		env.provider.SetMode(provider.ModePending)
+		_, _, pendingAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "early return", "refund:rental:early return")
+		sCtx.Require().NoError(err)
+		// act
+		repeated, _, repeatedAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "early return", "refund:rental:early return")
+		sCtx.Require().NoError(err)
+		_, _, restAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(2000), "damage", "")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(pendingAllowed)
+		sCtx.Require().True(repeatedAllowed)
+		sCtx.Require().Empty(repeated.RefundUID)
+		sCtx.Require().True(restAllowed)
+		sCtx.Require().Equal(models.PaymentPaid, env.status(sCtx, payment.PaymentUID))
+	})
+
+	t.WithNewStep("idempotency key of another payment", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		other := env.paid(sCtx, 3000)
+		_, _, _, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "early return", "refund:rental:early return")
+		sCtx.Require().NoError(err)
+		// act
+		_, found, allowed, err := env.useCase.RefundPayment(ctx, other.PaymentUID, rub(1000), "early return", "refund:rental:early return")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().Equal(models.PaymentPaid, env.status(sCtx, other.PaymentUID))
+	})
+
+	t.WithNewStep("refund over the price", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		// act
+		_, found, allowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(3001), "damage", "")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().Equal(models.PaymentPaid, env.status(sCtx, payment.PaymentUID))
+	})
+
+	t.WithNewStep("authorization is not refundable", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment, err := env.useCase.AuthorizePayment(ctx, rub(3000))
+		sCtx.Require().NoError(err)
+		// act
+		_, found, allowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "damage", "")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().Equal(models.PaymentAuthorized, env.status(sCtx, payment.PaymentUID))
+	})
+
+	t.WithNewStep("canceled payment is not refundable", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		_, _, _, err := env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		sCtx.Require().NoError(err)
+		// act
+		_, found, allowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "damage", "")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+	})
+
+	t.WithNewStep("refund of an unknown payment", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		// act
+		_, found, allowed, err := env.useCase.RefundPayment(ctx, "unknown", rub(1000), "damage", "")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().False(found)
+		sCtx.Require().False(allowed)
+	})
+
+	t.WithNewStep("service reasons are refused", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		// act
+		_, found, allowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), models.ReasonCancellation, "")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().Equal(models.PaymentPaid, env.status(sCtx, payment.PaymentUID))
+	})
+}
+
+func (s *UseCaseSuite) TestChargeApprovedAfterVoid(t allureProvider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("compensation refund is sent at once", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeTimeout)
+		payment, err := env.useCase.AuthorizePayment(ctx, rub(3000))
+		sCtx.Require().NoError(err)
+		_, _, _, err = env.useCase.CapturePayment(ctx, payment.PaymentUID)
+		sCtx.Require().ErrorIs(err, provider.ErrProviderTimeout)
+		_, allowed, err := env.useCase.VoidPayment(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		sCtx.Require().True(allowed)
+		env.provider.SetMode(provider.ModeApprove)
+		// act
+		err = env.useCase.SyncProviderOperations(ctx, time.Now().Add(time.Minute))
+		sCtx.Require().NoError(err)
+		pending, err := env.repo.GetPendingProviderOperations(ctx, time.Now().Add(time.Minute), pagination.MaxLimit)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().Empty(pending)
+		sCtx.Require().Equal(models.PaymentCanceled, env.status(sCtx, payment.PaymentUID))
+
+		for account, balance := range env.balances(sCtx, payment.PaymentUID) {
+			sCtx.Require().Zero(balance, account)
+		}
+	})
+
+	t.WithNewStep("compensation refund failed to be sent is sent by the sync", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeTimeout)
+		payment, err := env.useCase.AuthorizePayment(ctx, rub(3000))
+		sCtx.Require().NoError(err)
+		_, _, _, err = env.useCase.CapturePayment(ctx, payment.PaymentUID)
+		sCtx.Require().ErrorIs(err, provider.ErrProviderTimeout)
+		_, _, err = env.useCase.VoidPayment(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		env.provider.SetMode(provider.ModeFail)
+		// act
+		found, err := env.useCase.HandleProviderResult(ctx, pendingUID(sCtx, env), models.ProviderResponse{Status: models.ProviderApproved})
+		sCtx.Require().True(found)
+		sCtx.Require().ErrorIs(err, provider.ErrProviderUnavailable)
+		compensation := pendingUID(sCtx, env)
+		env.provider.SetMode(provider.ModeApprove)
+		err = env.useCase.SyncProviderOperations(ctx, time.Now().Add(time.Minute))
+		sCtx.Require().NoError(err)
+		// assert
+		response, err := env.provider.Status(ctx, compensation)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(models.ProviderApproved, response.Status)
+		sCtx.Require().Equal(models.PaymentCanceled, env.status(sCtx, payment.PaymentUID))
+	})
+}
+
+func (s *UseCaseSuite) TestLinkRental(t allureProvider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("payments are linked to their rental", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		surcharge := env.paid(sCtx, 1000)
+		unlinked := env.paid(sCtx, 500)
+		// act
+		found, allowed, err := env.useCase.LinkRental(ctx, payment.PaymentUID, "rental")
+		sCtx.Require().NoError(err)
+		_, surchargeAllowed, err := env.useCase.LinkRental(ctx, surcharge.PaymentUID, "rental")
+		sCtx.Require().NoError(err)
+		payments, err := env.useCase.GetRentalPayments(ctx, "rental")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().True(surchargeAllowed)
+		sCtx.Require().Len(payments, 2)
+
+		for _, linked := range payments {
+			sCtx.Require().Contains([]string{payment.PaymentUID, surcharge.PaymentUID}, linked.PaymentUID)
+			sCtx.Require().NotEqual(unlinked.PaymentUID, linked.PaymentUID)
+			sCtx.Require().Equal("rental", linked.RentalUID)
+		}
+	})
+
+	t.WithNewStep("relinking to the same rental is allowed", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		_, _, err := env.useCase.LinkRental(ctx, payment.PaymentUID, "rental")
+		sCtx.Require().NoError(err)
+		// act
+		found, allowed, err := env.useCase.LinkRental(ctx, payment.PaymentUID, "rental")
+		sCtx.Require().NoError(err)
+		payments, err := env.useCase.GetRentalPayments(ctx, "rental")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().Len(payments, 1)
+	})
+
+	t.WithNewStep("payment is never moved to another rental", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		_, _, err := env.useCase.LinkRental(ctx, payment.PaymentUID, "rental")
+		sCtx.Require().NoError(err)
+		// act
+		found, allowed, err := env.useCase.LinkRental(ctx, payment.PaymentUID, "other rental")
+		sCtx.Require().NoError(err)
+		payments, err := env.useCase.GetRentalPayments(ctx, "rental")
+		sCtx.Require().NoError(err)
+		otherPayments, err := env.useCase.GetRentalPayments(ctx, "other rental")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().Len(payments, 1)
+		sCtx.Require().Empty(otherPayments)
+	})
+
+	t.WithNewStep("unknown payment is not linked", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		// act
+		found, allowed, err := env.useCase.LinkRental(ctx, "unknown", "rental")
+		sCtx.Require().NoError(err)
+		payments, err := env.useCase.GetRentalPayments(ctx, "rental")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().False(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().NotNil(payments)
+		sCtx.Require().Empty(payments)
+	})
+}
+
+func (s *UseCaseSuite) TestLedger(t allureProvider.T) {
+	t.Epic("Payments")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("cancellation settles every account", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		payment := env.paid(sCtx, 3000)
+		// act
+		found, allowed, err := env.useCase.AddFee(ctx, payment.PaymentUID, rub(500), "fuel")
+		sCtx.Require().NoError(err)
+		_, _, refundAllowed, err := env.useCase.RefundPayment(ctx, payment.PaymentUID, rub(1000), "early return", "")
+		sCtx.Require().NoError(err)
+		_, _, _, err = env.useCase.SetPaymentStatus(ctx, payment.PaymentUID, models.PaymentCanceled)
+		sCtx.Require().NoError(err)
+		entries, _, err := env.useCase.GetLedgerEntries(ctx, payment.PaymentUID)
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().True(refundAllowed)
+		sCtx.Require().Equal(models.PaymentCanceled, models.PaymentStatusOf(entries))
+
+		transactions := make(map[string]int64)
+		for _, entry := range entries {
+			sCtx.Require().Equal(payment.PaymentUID, entry.PaymentUID)
+			sCtx.Require().Equal("RUB", entry.Amount.Currency)
+			transactions[entry.TransactionUID] += entry.Amount.Amount
+		}
+
+		for transactionUID, sum := range transactions {
+			sCtx.Require().Zero(sum, "transaction %s", transactionUID)
+		}
+
+		for account, balance := range models.AccountBalances(entries) {
+			sCtx.Require().Zero(balance, "account %s", account)
+		}
+	})
+
+	t.WithNewStep("fee is charged only on a paid payment", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		authorization, err := env.useCase.AuthorizePayment(ctx, rub(3000))
+		sCtx.Require().NoError(err)
+		// act
+		found, allowed, err := env.useCase.AddFee(ctx, authorization.PaymentUID, rub(500), "fuel")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().Equal(int64(0), env.balances(sCtx, authorization.PaymentUID)[models.AccountFees])
+	})
+
+	t.WithNewStep("ledger of an unknown payment", func(sCtx allureProvider.StepCtx) {
+		// arrange
+		env := newEnvironment(provider.ModeApprove)
+		// act
+		feeFound, _, err := env.useCase.AddFee(ctx, "unknown", rub(500), "fuel")
+		sCtx.Require().NoError(err)
+		entries, found, err := env.useCase.GetLedgerEntries(ctx, "unknown")
+		sCtx.Require().NoError(err)
+		// assert
+		sCtx.Require().False(feeFound)
+		sCtx.Require().False(found)
+		sCtx.Require().Empty(entries)
+	})
+}
+
+// pendingUID returns the uid of the only pending provider operation.
+func pendingUID(t allureProvider.StepCtx, env *environment) string {
+	operations, err := env.repo.GetPendingProviderOperations(context.Background(), time.Now().Add(time.Minute), pagination.MaxLimit)
+	t.Require().NoError(err)
+	t.Require().Len(operations, 1)
+
+	return operations[0].OperationUID
+}
+
+func TestUseCase(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(UseCaseSuite))
+}
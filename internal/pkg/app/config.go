@@ -3,28 +3,195 @@ package app
 import (
 	"github.com/nil-go/konf"
 	"github.com/nil-go/konf/provider/file"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
+	"time"
 )
 
 type Config struct {
 	Logging struct {
 		Level int
 	}
-	Web WebConfig
-	DB  struct {
-		DriverName       string
-		ConnectionString string
-	}
+	Web   WebConfig
+	DB    DBConfig
 	Kafka struct {
 		Addresses []string
 		Topic     string
 	}
+	Outbox struct {
+		Topic     string
+		BatchSize uint64
+		Interval  time.Duration
+	}
+	Reservations struct {
+		GracePeriod   time.Duration
+		CheckInterval time.Duration
+	}
+	Leases struct {
+		TTL           time.Duration // how long a car lock not attached to a rental is held
+		SweepInterval time.Duration
+	}
+	Shutdown       ShutdownConfig
+	Rentals        RentalsConfig
+	Authorizations struct {
+		TTL           time.Duration
+		CheckInterval time.Duration
+	}
+	Provider struct {
+		WebhookSecret Secret
+		SyncInterval  time.Duration
+		Fake          struct {
+			Mode       string
+			Delay      time.Duration
+			WebhookURL string
+		}
+	}
+	Retryer struct {
+		RequestTimeout time.Duration // zero is set to the default
+	}
+	Reconciler      ReconcilerConfig
+	Notifier        NotifierConfig
 	CarsApiAddr     string
 	RentalApiAddr   string
 	PaymentApiAddr  string
 	MaxRequestFails uint
 }
 
+type DBConfig struct {
+	DriverName              string
+	ConnectionString        string
+	ReplicaConnectionString string // optional, serves the list queries
+	MaxOpenConns            int
+	MaxIdleConns            int
+	ConnMaxLifetime         time.Duration
+	ConnMaxIdleTime         time.Duration
+	StatementTimeout        time.Duration
+	ConnectAttempts         int
+	ConnectBackoff          time.Duration
+	SkipMigrations          bool // migrations are applied with the migrate subcommand instead of on start
+}
+
+type RentalsConfig struct {
+	OverduePenalty     uint64        // charged once for a late return, on top of the overdue days
+	OverdueGracePeriod time.Duration // late returns within it are not charged
+	Pricing            PricingConfig
+	Cancellation       CancellationPolicy
+}
+
+// CancellationPolicy refunds the whole payment for rentals canceled at least FreePeriod before
+// the start and LateRefund percents of it afterwards.
+type CancellationPolicy struct {
+	FreePeriod time.Duration
+	LateRefund uint64
+}
+
+// PricingConfig holds the rental pricing rules; rates are in percents.
+type PricingConfig struct {
+	Version             string // label of the rules, a digest of the rules is appended to it
+	WeekendSurcharge    int64
+	Seasons             []SeasonRate
+	CarTypes            []CarTypeRate
+	LongRentalDiscounts []LongRentalDiscount
+	PromoCodes          []PromoCode
+}
+
+type SeasonRate struct {
+	Name      string
+	From      string // MM-DD, inclusive
+	To        string // MM-DD, inclusive
+	Surcharge int64
+}
+
+// seasonDateLayout is MM-DD, seasons are compared as strings in this layout.
+const seasonDateLayout = "01-02"
+
+func (season SeasonRate) validate() error {
+	for _, date := range []string{season.From, season.To} {
+		if _, err := time.Parse(seasonDateLayout, date); err != nil {
+			return errors.Errorf("season %q: date %q is not a valid MM-DD", season.Name, date)
+		}
+	}
+
+	return nil
+}
+
+func (config PricingConfig) validate() error {
+	names := make(map[string]bool, len(config.Seasons))
+
+	for _, season := range config.Seasons {
+		if names[season.Name] {
+			return errors.Errorf("season %q is set twice", season.Name)
+		}
+
+		names[season.Name] = true
+
+		err := season.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type CarTypeRate struct {
+	Type      string
+	Surcharge int64
+}
+
+type LongRentalDiscount struct {
+	MinDays  uint64
+	Discount int64
+}
+
+type PromoCode struct {
+	Code     string
+	Discount int64
+}
+
+// ReconcilerConfig selects the repairs applied to inconsistencies between the services;
+// in dry-run mode inconsistencies are only reported.
+type ReconcilerConfig struct {
+	Mode         string        // dry-run or apply
+	Interval     time.Duration // zero runs a single pass
+	ConfirmDelay time.Duration // an inconsistency is acted upon only if it is still there after the delay
+	Repairs      struct {
+		UnlockOrphanedCars     bool
+		CancelOrphanedPayments bool
+		LockRentedCars         bool
+		AttachOwnerlessLocks   bool
+	}
+}
+
+type NotifierConfig struct {
+	Topics           []string
+	GroupID          string
+	ReminderInterval time.Duration // how often due reminders are looked up
+	PickupReminder   time.Duration // how long before the rental start the pickup reminder is sent
+	OverdueGrace     time.Duration // how long after the rental end the overdue warning is sent
+	Sender           NotificationSenderConfig
+	Templates        []NotificationTemplate // override the default templates
+}
+
+type NotificationSenderConfig struct {
+	Kind string // stdout, file or smtp
+	File string
+	SMTP struct {
+		Host     string
+		Port     string
+		Username string
+		Password Secret
+		From     string
+	}
+}
+
+// NotificationTemplate holds text/template sources rendered with the notification data.
+type NotificationTemplate struct {
+	Kind    string
+	Subject string
+	Body    string
+}
+
 func ReadLocalConfig(configPath string) (Config, error) {
 	var config konf.Config
 
@@ -40,5 +207,15 @@ func ReadLocalConfig(configPath string) (Config, error) {
 		return Config{}, err
 	}
 
+	err = res.Rentals.Pricing.validate()
+	if err != nil {
+		return Config{}, errors.Wrap(err, "invalid pricing config")
+	}
+
+	err = res.Web.Faults.validate()
+	if err != nil {
+		return Config{}, errors.Wrap(err, "invalid faults config")
+	}
+
 	return res, nil
 }
@@ -0,0 +1,181 @@
+package app_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+type ConfigSuite struct {
+	suite.Suite
+}
+
+// writeConfig writes the config to a temporary file the caller removes.
+func writeConfig(t provider.StepCtx, content string) string {
+	file, err := os.CreateTemp("", "config-*.yaml")
+	t.Require().NoError(err)
+	defer file.Close()
+
+	_, err = file.WriteString(content)
+	t.Require().NoError(err)
+
+	return file.Name()
+}
+
+func (s *ConfigSuite) TestPricingSeasons(t provider.T) {
+	t.Epic("Configuration")
+	t.Severity(allure.NORMAL)
+
+	tests := []struct {
+		name    string
+		seasons string
+		message string // part of the error, no error if empty
+	}{{
+		name:    "season within a year",
+		seasons: "[{name: summer, from: 06-01, to: 08-31}]",
+	}, {
+		name:    "season around the new year",
+		seasons: "[{name: winter, from: 12-01, to: 02-29}]",
+	}, {
+		name:    "date without leading zeros",
+		seasons: "[{name: summer, from: 6-1, to: 08-31}]",
+		message: `date "6-1" is not a valid MM-DD`,
+	}, {
+		name:    "nonexistent date",
+		seasons: "[{name: spring, from: 03-01, to: 04-31}]",
+		message: `date "04-31" is not a valid MM-DD`,
+	}, {
+		name:    "missing date",
+		seasons: "[{name: summer, from: 06-01}]",
+		message: `date "" is not a valid MM-DD`,
+	}, {
+		name:    "duplicate season",
+		seasons: "[{name: summer, from: 06-01, to: 06-30}, {name: summer, from: 07-01, to: 08-31}]",
+		message: `season "summer" is set twice`,
+	}}
+
+	for _, test := range tests {
+		t.WithNewStep(test.name, func(sCtx provider.StepCtx) {
+			// arrange
+			path := writeConfig(sCtx, "rentals:\n  pricing:\n    seasons: "+test.seasons+"\n")
+			defer os.Remove(path)
+			// act
+			_, err := app.ReadLocalConfig(path)
+			// assert
+			if test.message == "" {
+				sCtx.Require().NoError(err)
+				return
+			}
+
+			sCtx.Require().Error(err)
+			sCtx.Require().Contains(err.Error(), test.message)
+		})
+	}
+}
+
+func (s *ConfigSuite) TestFaults(t provider.T) {
+	t.Epic("Configuration")
+	t.Severity(allure.NORMAL)
+
+	tests := []struct {
+		name    string
+		rules   string
+		message string // part of the error, no error if empty
+	}{{
+		name:  "valid rules",
+		rules: "[{kind: latency, latency: 100ms}, {host: payments, kind: drop, percent: 50}]",
+	}, {
+		name:    "unknown kind",
+		rules:   "[{kind: unavailable}, {kind: timeout}]",
+		message: `fault rule 1: unknown fault kind "timeout"`,
+	}, {
+		name:    "percent out of range",
+		rules:   "[{kind: error, percent: 150}]",
+		message: "fault percent 150 is out of [0, 100]",
+	}}
+
+	for _, test := range tests {
+		t.WithNewStep(test.name, func(sCtx provider.StepCtx) {
+			// arrange
+			path := writeConfig(sCtx, "web:\n  faults:\n    enabled: true\n    rules: "+test.rules+"\n")
+			defer os.Remove(path)
+			// act
+			_, err := app.ReadLocalConfig(path)
+			// assert
+			if test.message == "" {
+				sCtx.Require().NoError(err)
+				return
+			}
+
+			sCtx.Require().Error(err)
+			sCtx.Require().Contains(err.Error(), test.message)
+		})
+	}
+}
+
+func (s *ConfigSuite) TestGatewayConfig(t provider.T) {
+	t.Epic("Configuration")
+	t.Severity(allure.NORMAL)
+
+	// act
+	config, err := app.ReadLocalConfig("../../../configs/gateway.yaml")
+	// assert
+	t.Require().NoError(err)
+	t.Require().Equal("v1", config.Rentals.Pricing.Version)
+}
+
+func (s *ConfigSuite) TestSecrets(t provider.T) {
+	t.Epic("Configuration")
+	t.Severity(allure.CRITICAL)
+
+	tests := []struct {
+		name   string
+		config string
+		secret func(config app.Config) app.Secret
+	}{{
+		name:   "webhook secret",
+		config: "provider:\n  webhookSecret: whsec_0123456789\n",
+		secret: func(config app.Config) app.Secret { return config.Provider.WebhookSecret },
+	}, {
+		name:   "SMTP password",
+		config: "notifier:\n  sender:\n    kind: smtp\n    smtp:\n      password: hunter2-smtp\n",
+		secret: func(config app.Config) app.Secret { return config.Notifier.Sender.SMTP.Password },
+	}}
+
+	for _, test := range tests {
+		t.WithNewStep(test.name+" is redacted in the config dumps", func(sCtx provider.StepCtx) {
+			// arrange
+			path := writeConfig(sCtx, test.config)
+			defer os.Remove(path)
+
+			config, err := app.ReadLocalConfig(path)
+			sCtx.Require().NoError(err)
+
+			secret := test.secret(config)
+			sCtx.Require().NotEmpty(secret.Reveal())
+
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&logs, nil))
+			// act
+			logger.Info("config", slog.Any("secret", secret))
+			dumps := []string{fmt.Sprintf("%v", config), fmt.Sprintf("%+v", config), fmt.Sprintf("%#v", config), logs.String()}
+			// assert
+			for _, dump := range dumps {
+				sCtx.Require().NotContains(dump, secret.Reveal())
+				sCtx.Require().Contains(dump, "[REDACTED]")
+			}
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(ConfigSuite))
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/pkg/sqlxutils"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"log/slog"
+)
+
+// MemoryDriver keeps the data of a service in memory instead of a database.
+const MemoryDriver = "memory"
+
+func ConnectDB(ctx context.Context, config DBConfig, logger *slog.Logger) (*sqlxutils.DB, error) {
+	options := sqlxutils.PoolOptions{
+		MaxOpenConns:     config.MaxOpenConns,
+		MaxIdleConns:     config.MaxIdleConns,
+		ConnMaxLifetime:  config.ConnMaxLifetime,
+		ConnMaxIdleTime:  config.ConnMaxIdleTime,
+		StatementTimeout: config.StatementTimeout,
+		ConnectAttempts:  config.ConnectAttempts,
+		ConnectBackoff:   config.ConnectBackoff,
+	}
+
+	primary, err := sqlxutils.Connect(ctx, config.DriverName, config.ConnectionString, options, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var replica *sqlx.DB
+
+	if config.ReplicaConnectionString != "" {
+		replica, err = sqlxutils.Connect(ctx, config.DriverName, config.ReplicaConnectionString, options, logger)
+		if err != nil {
+			_ = primary.Close()
+			return nil, errors.Wrap(err, "replica")
+		}
+	}
+
+	return sqlxutils.NewDB(primary, replica), nil
+}
@@ -0,0 +1,323 @@
+package app
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type FaultKind string
+
+const (
+	FaultLatency     FaultKind = "latency"     // the request is delayed
+	FaultError       FaultKind = "error"       // 500 Internal Server Error
+	FaultDrop        FaultKind = "drop"        // the connection is closed without a response
+	FaultUnavailable FaultKind = "unavailable" // 503 Service Unavailable
+)
+
+// FaultsConfig enables fault injection for chaos testing, faults are never injected unless it is enabled.
+type FaultsConfig struct {
+	Enabled bool
+	Rules   []FaultRule
+}
+
+// FaultRule injects the fault into the matching requests. Rules with a host apply to the requests sent
+// to the host by the API clients ("*" for any host), the others to the requests served by the app.
+type FaultRule struct {
+	Host    string
+	Method  string // any method if empty
+	Path    string // path prefix, any path if empty
+	Kind    FaultKind
+	Percent uint          // of the matching requests, all of them if zero
+	Latency time.Duration // for latency faults
+}
+
+func (config FaultsConfig) validate() error {
+	for i, rule := range config.Rules {
+		err := rule.validate()
+		if err != nil {
+			return errors.Wrapf(err, "fault rule %d", i)
+		}
+	}
+
+	return nil
+}
+
+func (rule FaultRule) validate() error {
+	switch rule.Kind {
+	case FaultLatency, FaultError, FaultDrop, FaultUnavailable:
+	default:
+		return errors.Errorf("unknown fault kind %q", rule.Kind)
+	}
+
+	if rule.Percent > 100 {
+		return errors.Errorf("fault percent %d is out of [0, 100]", rule.Percent)
+	}
+
+	return nil
+}
+
+func (rule FaultRule) matches(outgoing bool, host, method, path string) bool {
+	if outgoing != (rule.Host != "") {
+		return false
+	} else if outgoing && rule.Host != "*" && rule.Host != host {
+		return false
+	}
+
+	return (rule.Method == "" || strings.EqualFold(rule.Method, method)) && strings.HasPrefix(path, rule.Path)
+}
+
+// FaultInjector holds the fault rules of the app and its API clients.
+type FaultInjector struct {
+	mu     sync.RWMutex
+	rules  []FaultRule
+	logger *slog.Logger
+}
+
+func NewFaultInjector(rules []FaultRule, logger *slog.Logger) (*FaultInjector, error) {
+	injector := &FaultInjector{logger: logger}
+
+	err := injector.SetRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return injector, nil
+}
+
+func (f *FaultInjector) Rules() []FaultRule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return append([]FaultRule(nil), f.rules...)
+}
+
+func (f *FaultInjector) SetRules(rules []FaultRule) error {
+	for _, rule := range rules {
+		err := rule.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = append([]FaultRule(nil), rules...)
+
+	return nil
+}
+
+// pick returns the fault of the first matching rule, if the request falls into its percentage.
+func (f *FaultInjector) pick(outgoing bool, host, method, path string) (FaultRule, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, rule := range f.rules {
+		if !rule.matches(outgoing, host, method, path) {
+			continue
+		}
+
+		if rule.Percent == 0 || rand.UintN(100) < rule.Percent {
+			f.logger.Warn("inject fault",
+				slog.String("kind", string(rule.Kind)),
+				slog.String("method", method),
+				slog.String("path", path),
+			)
+
+			return rule, true
+		}
+
+		return FaultRule{}, false
+	}
+
+	return FaultRule{}, false
+}
+
+func (f *FaultInjector) middleware(ctx *fiber.Ctx) error {
+	if strings.HasPrefix(ctx.Path(), "/manage/") {
+		return ctx.Next()
+	}
+
+	rule, found := f.pick(false, "", ctx.Method(), ctx.Path())
+	if !found {
+		return ctx.Next()
+	}
+
+	switch rule.Kind {
+	case FaultLatency:
+		select {
+		case <-ctx.Context().Done():
+			return ctx.Context().Err()
+		case <-time.After(rule.Latency):
+		}
+
+		return ctx.Next()
+	case FaultError:
+		return ctx.Status(fiber.StatusInternalServerError).JSON(newFiberError("injected fault"))
+	case FaultUnavailable:
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(newFiberError("injected fault"))
+	default: // FaultDrop
+		ctx.Context().HijackSetNoResponse(true)
+		ctx.Context().Hijack(func(net.Conn) {})
+
+		return nil
+	}
+}
+
+func (f *FaultInjector) getRules(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusOK).JSON(NewFaultRulesDTO(f.Rules()))
+}
+
+func (f *FaultInjector) setRules(ctx *fiber.Ctx) error {
+	var dto FaultRulesDTO
+
+	err := ctx.BodyParser(&dto)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(newFiberError(err.Error()))
+	}
+
+	rules, err := dto.ToModel()
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(newFiberError(err.Error()))
+	}
+
+	err = f.SetRules(rules)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(newFiberError(err.Error()))
+	}
+
+	f.logger.Warn("set fault rules", slog.Int("count", len(rules)))
+
+	return ctx.Status(fiber.StatusOK).JSON(NewFaultRulesDTO(rules))
+}
+
+func (f *FaultInjector) clearRules(ctx *fiber.Ctx) error {
+	_ = f.SetRules(nil)
+	f.logger.Warn("clear fault rules")
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// Transport injects the faults into the requests sent through the base transport. A nil injector
+// leaves the base transport as is.
+func (f *FaultInjector) Transport(base http.RoundTripper) http.RoundTripper {
+	if f == nil {
+		return base
+	}
+
+	return &faultTransport{base: base, injector: f}
+}
+
+type faultTransport struct {
+	base     http.RoundTripper
+	injector *FaultInjector
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rule, found := t.injector.pick(true, req.URL.Host, req.Method, req.URL.Path)
+	if !found {
+		return t.base.RoundTrip(req)
+	}
+
+	switch rule.Kind {
+	case FaultLatency:
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(rule.Latency):
+		}
+
+		return t.base.RoundTrip(req)
+	case FaultError:
+		return faultResponse(req, http.StatusInternalServerError), nil
+	case FaultUnavailable:
+		return faultResponse(req, http.StatusServiceUnavailable), nil
+	default: // FaultDrop, the host can't be reached as if its container was stopped
+		return nil, &net.OpError{
+			Op:  "dial",
+			Net: "tcp",
+			Err: &net.DNSError{Err: "injected fault", Name: req.URL.Hostname(), IsNotFound: true},
+		}
+	}
+}
+
+func faultResponse(req *http.Request, status int) *http.Response {
+	return &http.Response{
+		Status:     http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"message":"injected fault"}`)),
+		Request:    req,
+	}
+}
+
+type FaultRuleDTO struct {
+	Host    string    `json:"host,omitempty"`
+	Method  string    `json:"method,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Kind    FaultKind `json:"kind"`
+	Percent uint      `json:"percent,omitempty"`
+	Latency string    `json:"latency,omitempty"` // time.ParseDuration format
+}
+
+type FaultRulesDTO []FaultRuleDTO
+
+func NewFaultRulesDTO(rules []FaultRule) FaultRulesDTO {
+	dto := make(FaultRulesDTO, 0, len(rules))
+
+	for _, rule := range rules {
+		item := FaultRuleDTO{
+			Host:    rule.Host,
+			Method:  rule.Method,
+			Path:    rule.Path,
+			Kind:    rule.Kind,
+			Percent: rule.Percent,
+		}
+
+		if rule.Latency != 0 {
+			item.Latency = rule.Latency.String()
+		}
+
+		dto = append(dto, item)
+	}
+
+	return dto
+}
+
+func (dto FaultRulesDTO) ToModel() ([]FaultRule, error) {
+	rules := make([]FaultRule, 0, len(dto))
+
+	for _, item := range dto {
+		var latency time.Duration
+		if item.Latency != "" {
+			var err error
+
+			latency, err = time.ParseDuration(item.Latency)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid fault latency")
+			}
+		}
+
+		rules = append(rules, FaultRule{
+			Host:    item.Host,
+			Method:  item.Method,
+			Path:    item.Path,
+			Kind:    item.Kind,
+			Percent: item.Percent,
+			Latency: latency,
+		})
+	}
+
+	return rules, nil
+}
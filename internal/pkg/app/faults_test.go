@@ -0,0 +1,337 @@
+package app_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/gofiber/fiber/v2"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type delivery struct{}
+
+func (delivery) HealthCheck(context.Context) error {
+	return nil
+}
+
+func (delivery) AddHandlers(router fiber.Router) {
+	router.Get("/things", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+}
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var okTransport = roundTripper(func(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+})
+
+type FaultsSuite struct {
+	suite.Suite
+}
+
+func newApp(t provider.StepCtx, rules ...app.FaultRule) *app.FiberApp {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	config := app.WebConfig{
+		PathPrefix: "/api/v1",
+		Faults:     app.FaultsConfig{Enabled: true, Rules: rules},
+	}
+
+	webApp, err := app.NewFiberApp(config, delivery{}, logger)
+	t.Require().NoError(err)
+
+	return webApp
+}
+
+// serve starts the app on a free local port and returns its address; the caller shuts the app down.
+// Unlike the apps under test, a served app reports its requests canceled on shutdown only.
+func serve(t provider.StepCtx, rules ...app.FaultRule) (*app.FiberApp, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	t.Require().NoError(err)
+
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	t.Require().NoError(listener.Close())
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	config := app.WebConfig{
+		Host:       "127.0.0.1",
+		Port:       port,
+		PathPrefix: "/api/v1",
+		Faults:     app.FaultsConfig{Enabled: true, Rules: rules},
+	}
+
+	webApp, err := app.NewFiberApp(config, delivery{}, logger)
+	t.Require().NoError(err)
+
+	go func() {
+		_ = webApp.Start()
+	}()
+
+	addr := "http://127.0.0.1:" + port
+	for i := 0; i < 100; i++ {
+		resp, err := http.Get(addr + "/manage/health")
+		if err == nil {
+			_ = resp.Body.Close()
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return webApp, addr
+}
+
+func status(webApp *app.FiberApp, method, target, body string) (int, error) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := webApp.Test(req, -1)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+func (s *FaultsSuite) TestDisabledByDefault(t provider.T) {
+	t.Epic("Fault injection")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	webApp, err := app.NewFiberApp(app.WebConfig{PathPrefix: "/api/v1"}, delivery{}, logger)
+	t.Require().NoError(err)
+	// act
+	code, err := status(webApp, http.MethodPut, "/manage/faults", `[{"kind":"unavailable"}]`)
+	// assert
+	t.Require().NoError(err)
+	t.Require().NotEqual(http.StatusOK, code)
+	t.Require().Nil(webApp.Faults())
+	t.Require().NotNil(webApp.Faults().Transport(okTransport))
+}
+
+func (s *FaultsSuite) TestMiddleware(t provider.T) {
+	t.Epic("Fault injection")
+	t.Severity(allure.CRITICAL)
+
+	t.WithNewStep("configured error fault", func(sCtx provider.StepCtx) {
+		// arrange
+		webApp := newApp(sCtx, app.FaultRule{Method: http.MethodGet, Path: "/api/v1/things", Kind: app.FaultError})
+		// act
+		code, err := status(webApp, http.MethodGet, "/api/v1/things", "")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(http.StatusInternalServerError, code)
+	})
+
+	t.WithNewStep("fault of another method", func(sCtx provider.StepCtx) {
+		// arrange
+		webApp := newApp(sCtx, app.FaultRule{Method: http.MethodPost, Kind: app.FaultError})
+		// act
+		code, err := status(webApp, http.MethodGet, "/api/v1/things", "")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(http.StatusOK, code)
+	})
+
+	t.WithNewStep("fault set through the endpoint", func(sCtx provider.StepCtx) {
+		// arrange
+		webApp := newApp(sCtx)
+		code, err := status(webApp, http.MethodPut, "/manage/faults", `[{"path":"/api/v1","kind":"unavailable","percent":100}]`)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(http.StatusOK, code)
+		// act
+		code, err = status(webApp, http.MethodGet, "/api/v1/things", "")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(http.StatusServiceUnavailable, code)
+		sCtx.Require().Len(webApp.Faults().Rules(), 1)
+	})
+
+	t.WithNewStep("management endpoints are not affected", func(sCtx provider.StepCtx) {
+		// arrange
+		webApp := newApp(sCtx, app.FaultRule{Kind: app.FaultUnavailable})
+		// act
+		healthCode, healthErr := status(webApp, http.MethodGet, "/manage/health", "")
+		clearCode, clearErr := status(webApp, http.MethodDelete, "/manage/faults", "")
+		code, err := status(webApp, http.MethodGet, "/api/v1/things", "")
+		// assert
+		sCtx.Require().NoError(healthErr)
+		sCtx.Require().NoError(clearErr)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(http.StatusOK, healthCode)
+		sCtx.Require().Equal(http.StatusNoContent, clearCode)
+		sCtx.Require().Equal(http.StatusOK, code)
+	})
+
+	t.WithNewStep("invalid fault", func(sCtx provider.StepCtx) {
+		// arrange
+		webApp := newApp(sCtx)
+		// act
+		percentCode, percentErr := status(webApp, http.MethodPut, "/manage/faults", `[{"kind":"error","percent":101}]`)
+		kindCode, kindErr := status(webApp, http.MethodPut, "/manage/faults", `[{"kind":"flood"}]`)
+		latencyCode, latencyErr := status(webApp, http.MethodPut, "/manage/faults", `[{"kind":"latency","latency":"soon"}]`)
+		// assert
+		sCtx.Require().NoError(percentErr)
+		sCtx.Require().NoError(kindErr)
+		sCtx.Require().NoError(latencyErr)
+		sCtx.Require().Equal(http.StatusBadRequest, percentCode)
+		sCtx.Require().Equal(http.StatusBadRequest, kindCode)
+		sCtx.Require().Equal(http.StatusBadRequest, latencyCode)
+		sCtx.Require().Empty(webApp.Faults().Rules())
+	})
+
+	t.WithNewStep("invalid configured fault", func(sCtx provider.StepCtx) {
+		// arrange
+		logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		config := app.WebConfig{
+			PathPrefix: "/api/v1",
+			Faults:     app.FaultsConfig{Enabled: true, Rules: []app.FaultRule{{Kind: "flood"}}},
+		}
+		// act
+		_, err := app.NewFiberApp(config, delivery{}, logger)
+		// assert
+		sCtx.Require().Error(err)
+		sCtx.Require().Contains(err.Error(), "unknown fault kind")
+	})
+
+	t.WithNewStep("latency fault", func(sCtx provider.StepCtx) {
+		// arrange
+		webApp, addr := serve(sCtx, app.FaultRule{Kind: app.FaultLatency, Latency: 50 * time.Millisecond})
+		defer webApp.Shutdown(context.Background()) //nolint:errcheck
+		start := time.Now()
+		// act
+		resp, err := http.Get(addr + "/api/v1/things")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(resp.Body.Close())
+		sCtx.Require().Equal(http.StatusOK, resp.StatusCode)
+		sCtx.Require().GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+	})
+
+	t.WithNewStep("latency fault is cut short on shutdown", func(sCtx provider.StepCtx) {
+		// arrange
+		webApp, addr := serve(sCtx, app.FaultRule{Kind: app.FaultLatency, Latency: time.Minute})
+		codes := make(chan int, 1)
+
+		go func() {
+			resp, err := http.Get(addr + "/api/v1/things")
+			if err != nil {
+				codes <- 0
+				return
+			}
+
+			_ = resp.Body.Close()
+			codes <- resp.StatusCode
+		}()
+
+		time.Sleep(50 * time.Millisecond) // the request is delayed meanwhile
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		// act
+		err := webApp.Shutdown(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+		var code int
+		select {
+		case code = <-codes:
+		case <-time.After(5 * time.Second):
+			code = http.StatusOK // still delayed
+		}
+
+		sCtx.Require().NotEqual(http.StatusOK, code)
+	})
+
+	t.WithNewStep("dropped connection", func(sCtx provider.StepCtx) {
+		// arrange
+		webApp := newApp(sCtx, app.FaultRule{Kind: app.FaultDrop})
+		// act
+		_, err := status(webApp, http.MethodGet, "/api/v1/things", "")
+		// assert
+		sCtx.Require().Error(err)
+	})
+}
+
+func (s *FaultsSuite) TestTransport(t provider.T) {
+	t.Epic("Fault injection")
+	t.Severity(allure.CRITICAL)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	t.WithNewStep("unavailable host", func(sCtx provider.StepCtx) {
+		// arrange
+		injector, err := app.NewFaultInjector([]app.FaultRule{{Host: "cars", Kind: app.FaultUnavailable}}, logger)
+		sCtx.Require().NoError(err)
+		client := &http.Client{Transport: injector.Transport(okTransport)}
+		// act
+		faultResp, faultErr := client.Get("http://cars/api/v1/cars")
+		resp, err := client.Get("http://rentals/api/v1/rentals")
+		// assert
+		sCtx.Require().NoError(faultErr)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(http.StatusServiceUnavailable, faultResp.StatusCode)
+		sCtx.Require().Equal(http.StatusOK, resp.StatusCode)
+	})
+
+	t.WithNewStep("dropped connection to any host", func(sCtx provider.StepCtx) {
+		// arrange
+		injector, err := app.NewFaultInjector([]app.FaultRule{{Host: "*", Path: "/api/v1/payments", Kind: app.FaultDrop}}, logger)
+		sCtx.Require().NoError(err)
+		client := &http.Client{Transport: injector.Transport(okTransport)}
+		// act
+		_, err = client.Get("http://payments/api/v1/payments/authorize")
+		// assert
+		var DNSError *net.DNSError
+		sCtx.Require().ErrorAs(err, &DNSError)
+	})
+
+	t.WithNewStep("faults of the served requests", func(sCtx provider.StepCtx) {
+		// arrange
+		injector, err := app.NewFaultInjector([]app.FaultRule{{Kind: app.FaultError}}, logger)
+		sCtx.Require().NoError(err)
+		client := &http.Client{Transport: injector.Transport(okTransport)}
+		// act
+		resp, err := client.Get("http://cars/api/v1/cars")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(http.StatusOK, resp.StatusCode)
+	})
+
+	t.WithNewStep("fault of a part of the requests", func(sCtx provider.StepCtx) {
+		// arrange
+		injector, err := app.NewFaultInjector([]app.FaultRule{{Host: "cars", Kind: app.FaultError, Percent: 50}}, logger)
+		sCtx.Require().NoError(err)
+		client := &http.Client{Transport: injector.Transport(okTransport)}
+		codes := make(map[int]int)
+		// act
+		for range 200 {
+			resp, err := client.Get("http://cars/api/v1/cars")
+			sCtx.Require().NoError(err)
+			codes[resp.StatusCode]++
+		}
+		// assert
+		sCtx.Require().NotZero(codes[http.StatusOK])
+		sCtx.Require().NotZero(codes[http.StatusInternalServerError])
+	})
+}
+
+func TestFaults(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(FaultsSuite))
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"io"
+	"log/slog"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ShutdownConfig holds the timeouts of the shutdown steps, zero ones are set to the defaults.
+type ShutdownConfig struct {
+	ReadinessDelay time.Duration // how long the web apps report not ready before they stop accepting requests
+	HTTPTimeout    time.Duration // draining in-flight requests
+	WorkersTimeout time.Duration // finishing the work in progress of the background workers
+	KafkaTimeout   time.Duration // flushing the writers and closing the readers
+	CloseTimeout   time.Duration // closing the DB and the other resources
+}
+
+func (config ShutdownConfig) withDefaults() ShutdownConfig {
+	if config.HTTPTimeout == 0 {
+		config.HTTPTimeout = time.Minute
+	}
+
+	if config.WorkersTimeout == 0 {
+		config.WorkersTimeout = 30 * time.Second
+	}
+
+	if config.KafkaTimeout == 0 {
+		config.KafkaTimeout = 10 * time.Second
+	}
+
+	if config.CloseTimeout == 0 {
+		config.CloseTimeout = 5 * time.Second
+	}
+
+	return config
+}
+
+type WebApp interface {
+	Start() error
+	SetReady(ready bool)
+	Shutdown(ctx context.Context) error
+}
+
+type namedCloser struct {
+	name   string
+	closer io.Closer
+}
+
+// Lifecycle runs the web apps and the background workers of a service until SIGINT or SIGTERM
+// and then stops them in order: the web apps report not ready and drain the in-flight requests,
+// the workers finish their work in progress, the Kafka writers are flushed and the readers closed,
+// and finally the DB and the other resources are closed. Every step has its own timeout, a step
+// which fails or times out doesn't block the following ones.
+type Lifecycle struct {
+	config  ShutdownConfig
+	ctx     context.Context
+	cancel  context.CancelFunc
+	webApps []WebApp
+	workers sync.WaitGroup
+	kafka   []namedCloser
+	closers []namedCloser
+	logger  *slog.Logger
+}
+
+func NewLifecycle(config ShutdownConfig, logger *slog.Logger) *Lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Lifecycle{
+		config: config.withDefaults(),
+		ctx:    ctx,
+		cancel: cancel,
+		logger: logger,
+	}
+}
+
+func (l *Lifecycle) AddWebApp(webApp WebApp) {
+	l.webApps = append(l.webApps, webApp)
+}
+
+// Go runs the worker in background. The worker context is canceled when the workers are stopped,
+// the worker should finish the work in progress and return.
+func (l *Lifecycle) Go(worker func(ctx context.Context)) {
+	l.workers.Add(1)
+
+	go func() {
+		defer l.workers.Done()
+		worker(l.ctx)
+	}()
+}
+
+// AddKafka adds a Kafka writer or reader; closing a writer flushes its pending messages.
+func (l *Lifecycle) AddKafka(name string, client io.Closer) {
+	l.kafka = append(l.kafka, namedCloser{name: name, closer: client})
+}
+
+// AddCloser adds a resource closed at the end of the shutdown, such as the DB.
+func (l *Lifecycle) AddCloser(name string, closer io.Closer) {
+	l.closers = append(l.closers, namedCloser{name: name, closer: closer})
+}
+
+// Run starts the web apps and shuts the service down on SIGINT, SIGTERM or a failed start.
+func (l *Lifecycle) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	startErrors := make(chan error, len(l.webApps))
+
+	for _, webApp := range l.webApps {
+		go func() {
+			err := webApp.Start()
+			if err != nil {
+				startErrors <- err
+			}
+		}()
+	}
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+		l.logger.Info("shutdown signal received")
+	case err = <-startErrors:
+	}
+
+	return multierr.Append(err, l.Shutdown())
+}
+
+func (l *Lifecycle) Shutdown() (err error) {
+	l.logger.Info("shutdown ...")
+
+	for _, webApp := range l.webApps {
+		webApp.SetReady(false)
+	}
+
+	if len(l.webApps) != 0 && l.config.ReadinessDelay > 0 {
+		time.Sleep(l.config.ReadinessDelay)
+	}
+
+	for _, webApp := range l.webApps {
+		err = multierr.Append(err, l.step("drain http requests", l.config.HTTPTimeout, webApp.Shutdown))
+	}
+
+	err = multierr.Append(err, l.step("stop workers", l.config.WorkersTimeout, func(ctx context.Context) error {
+		l.cancel()
+
+		done := make(chan struct{})
+		go func() {
+			l.workers.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}))
+
+	for _, client := range l.kafka {
+		err = multierr.Append(err, l.step("close "+client.name, l.config.KafkaTimeout, closeFunc(client.closer)))
+	}
+
+	for _, closer := range l.closers {
+		err = multierr.Append(err, l.step("close "+closer.name, l.config.CloseTimeout, closeFunc(closer.closer)))
+	}
+
+	l.logger.Info("shutdown completed")
+
+	return err
+}
+
+// step runs the shutdown step, giving up on it after the timeout.
+func (l *Lifecycle) step(name string, timeout time.Duration, stop func(ctx context.Context) error) error {
+	l.logger.Debug(name + " ...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- stop(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		l.logger.Error(name+" failed", slog.String("error", err.Error()))
+		return errors.Wrap(err, name)
+	}
+
+	return nil
+}
+
+func closeFunc(closer io.Closer) func(ctx context.Context) error {
+	return func(context.Context) error {
+		return closer.Close()
+	}
+}
@@ -0,0 +1,163 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder keeps the shutdown steps in the order they were made.
+type recorder struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *recorder) record(step string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.steps = append(r.steps, step)
+}
+
+func (r *recorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.steps...)
+}
+
+type webApp struct {
+	recorder *recorder
+}
+
+func (a webApp) Start() error {
+	return nil
+}
+
+func (a webApp) SetReady(ready bool) {
+	if !ready {
+		a.recorder.record("not ready")
+	}
+}
+
+func (a webApp) Shutdown(context.Context) error {
+	a.recorder.record("drain http requests")
+	return nil
+}
+
+type closer struct {
+	name     string
+	err      error
+	recorder *recorder
+}
+
+func (c closer) Close() error {
+	c.recorder.record("close " + c.name)
+	return c.err
+}
+
+type LifecycleSuite struct {
+	suite.Suite
+}
+
+func (s *LifecycleSuite) TestShutdown(t provider.T) {
+	t.Epic("Lifecycle")
+	t.Severity(allure.CRITICAL)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	t.WithNewStep("steps in order", func(sCtx provider.StepCtx) {
+		// arrange
+		steps := new(recorder)
+		lifecycle := app.NewLifecycle(app.ShutdownConfig{}, logger)
+		lifecycle.AddCloser("db", closer{name: "db", recorder: steps})
+		lifecycle.AddKafka("writer", closer{name: "writer", recorder: steps})
+		lifecycle.Go(func(ctx context.Context) {
+			<-ctx.Done()
+			steps.record("finish work")
+		})
+		lifecycle.AddWebApp(webApp{recorder: steps})
+		// act
+		err := lifecycle.Shutdown()
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal([]string{
+			"not ready",
+			"drain http requests",
+			"finish work",
+			"close writer",
+			"close db",
+		}, steps.recorded())
+	})
+
+	t.WithNewStep("worker times out", func(sCtx provider.StepCtx) {
+		// arrange
+		steps := new(recorder)
+		release := make(chan struct{})
+		defer close(release)
+		lifecycle := app.NewLifecycle(app.ShutdownConfig{WorkersTimeout: 10 * time.Millisecond}, logger)
+		lifecycle.Go(func(context.Context) {
+			<-release
+		})
+		lifecycle.AddKafka("reader", closer{name: "reader", recorder: steps})
+		lifecycle.AddCloser("db", closer{name: "db", recorder: steps})
+		// act
+		err := lifecycle.Shutdown()
+		// assert
+		sCtx.Require().ErrorIs(err, context.DeadlineExceeded)
+		sCtx.Require().Contains(err.Error(), "stop workers")
+		sCtx.Require().Equal([]string{"close reader", "close db"}, steps.recorded())
+	})
+
+	t.WithNewStep("failed step", func(sCtx provider.StepCtx) {
+		// arrange
+		steps := new(recorder)
+		flushErr := errors.New("broker unavailable")
+		lifecycle := app.NewLifecycle(app.ShutdownConfig{}, logger)
+		lifecycle.AddKafka("writer", closer{name: "writer", err: flushErr, recorder: steps})
+		lifecycle.AddCloser("db", closer{name: "db", recorder: steps})
+		// act
+		err := lifecycle.Shutdown()
+		// assert
+		sCtx.Require().ErrorIs(err, flushErr)
+		sCtx.Require().Contains(err.Error(), "close writer")
+		sCtx.Require().Equal([]string{"close writer", "close db"}, steps.recorded())
+	})
+}
+
+func (s *LifecycleSuite) TestReadiness(t provider.T) {
+	t.Epic("Lifecycle")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	webApp, err := app.NewFiberApp(app.WebConfig{PathPrefix: "/api/v1"}, delivery{}, logger)
+	t.Require().NoError(err)
+	readyCode, readyErr := status(webApp, http.MethodGet, "/manage/health", "")
+	// act
+	webApp.SetReady(false)
+	code, err := status(webApp, http.MethodGet, "/manage/health", "")
+	thingsCode, thingsErr := status(webApp, http.MethodGet, "/api/v1/things", "")
+	// assert
+	t.Require().NoError(readyErr)
+	t.Require().NoError(err)
+	t.Require().NoError(thingsErr)
+	t.Require().Equal(http.StatusOK, readyCode)
+	t.Require().Equal(http.StatusServiceUnavailable, code)
+	t.Require().Equal(http.StatusOK, thingsCode)
+}
+
+func TestLifecycle(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(LifecycleSuite))
+}
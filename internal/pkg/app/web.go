@@ -11,6 +11,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
 )
 
 type HealthChecker interface {
@@ -26,11 +27,14 @@ type WebConfig struct {
 	Host       string
 	Port       string
 	PathPrefix string
+	Faults     FaultsConfig
 }
 
 type FiberApp struct {
 	config WebConfig
 	fiber  *fiber.App
+	faults *FaultInjector // nil unless fault injection is enabled
+	ready  atomic.Bool
 	logger *slog.Logger
 }
 
@@ -38,8 +42,12 @@ func newFiberError(msg string) fiber.Map {
 	return fiber.Map{"message": msg}
 }
 
-func checkReadiness(delivery HealthChecker) func(ctx *fiber.Ctx) error {
+func (f *FiberApp) checkReadiness(delivery HealthChecker) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
+		if !f.ready.Load() {
+			return ctx.Status(fiber.StatusServiceUnavailable).JSON(newFiberError("shutting down"))
+		}
+
 		err := delivery.HealthCheck(ctx.UserContext())
 		if err != nil {
 			return ctx.Status(fiber.StatusServiceUnavailable).JSON(newFiberError(err.Error()))
@@ -49,7 +57,14 @@ func checkReadiness(delivery HealthChecker) func(ctx *fiber.Ctx) error {
 	}
 }
 
-func NewFiberApp(config WebConfig, delivery Delivery, logger *slog.Logger) *FiberApp {
+// NewFiberApp fails if fault injection is enabled with invalid rules, so a chaos run never passes without faults.
+func NewFiberApp(config WebConfig, delivery Delivery, logger *slog.Logger) (*FiberApp, error) {
+	res := &FiberApp{
+		config: config,
+		logger: logger,
+	}
+	res.ready.Store(true)
+
 	app := fiber.New(fiber.Config{
 		DisableStartupMessage: true,
 		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
@@ -69,21 +84,46 @@ func NewFiberApp(config WebConfig, delivery Delivery, logger *slog.Logger) *Fibe
 	app.Use(slogfiber.New(logger))
 	app.Use(pprof.New())
 
-	app.Get("/manage/health", checkReadiness(delivery))
+	app.Get("/manage/health", res.checkReadiness(delivery))
 
-	delivery.AddHandlers(app.Group(config.PathPrefix))
+	var faults *FaultInjector
+	if config.Faults.Enabled {
+		var err error
 
-	return &FiberApp{
-		config: config,
-		fiber:  app,
-		logger: logger,
+		faults, err = NewFaultInjector(config.Faults.Rules, logger)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid fault rules")
+		}
+
+		logger.Warn("fault injection enabled")
+		app.Use(faults.middleware)
+		app.Get("/manage/faults", faults.getRules)
+		app.Put("/manage/faults", faults.setRules)
+		app.Delete("/manage/faults", faults.clearRules)
 	}
+
+	delivery.AddHandlers(app.Group(config.PathPrefix))
+
+	res.fiber = app
+	res.faults = faults
+
+	return res, nil
+}
+
+// Faults returns the fault injector of the app, nil unless fault injection is enabled.
+func (f *FiberApp) Faults() *FaultInjector {
+	return f.faults
 }
 
 func (f *FiberApp) Start() error {
 	return errors.Wrap(f.fiber.Listen(f.config.Host+":"+f.config.Port), "start web app")
 }
 
+// SetReady sets the state reported by the readiness check, the app keeps serving the requests.
+func (f *FiberApp) SetReady(ready bool) {
+	f.ready.Store(ready)
+}
+
 func (f *FiberApp) Shutdown(ctx context.Context) error {
 	return errors.Wrap(f.fiber.ShutdownWithContext(ctx), "stop web app")
 }
@@ -0,0 +1,38 @@
+package reconciler_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+type carsApiMock struct {
+	mock.Mock
+}
+
+func (api *carsApiMock) GetReservations(ctx context.Context, page pagination.Request) (res []models.CarReservation, info pagination.Page, err error) {
+	args := api.Called(ctx, page)
+	return args.Get(0).([]models.CarReservation), args.Get(1).(pagination.Page), args.Error(2)
+}
+
+func (api *carsApiMock) LockCar(ctx context.Context, carUID string, from, to time.Time, lock models.CarLock) (res models.Car, found, success bool, err error) {
+	args := api.Called(ctx, carUID, from, to, lock)
+	return args.Get(0).(models.Car), args.Bool(1), args.Bool(2), args.Error(3)
+}
+
+func (api *carsApiMock) UnlockCar(ctx context.Context, carUID string, from, to time.Time, holder string) (found, allowed, changed bool, err error) {
+	args := api.Called(ctx, carUID, from, to, holder)
+	return args.Bool(0), args.Bool(1), args.Bool(2), args.Error(3)
+}
+
+func (api *carsApiMock) AttachRental(ctx context.Context, carUID string, from, to time.Time, rentalUID string) (found bool, err error) {
+	args := api.Called(ctx, carUID, from, to, rentalUID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (api *carsApiMock) ForceUnlockCar(ctx context.Context, carUID string, from, to time.Time) (found, changed bool, err error) {
+	args := api.Called(ctx, carUID, from, to)
+	return args.Bool(0), args.Bool(1), args.Error(2)
+}
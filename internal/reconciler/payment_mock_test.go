@@ -0,0 +1,22 @@
+package reconciler_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/stretchr/testify/mock"
+)
+
+type paymentApiMock struct {
+	mock.Mock
+}
+
+func (api *paymentApiMock) GetPayments(ctx context.Context, status models.PaymentStatus, page pagination.Request) (res []models.Payment, info pagination.Page, err error) {
+	args := api.Called(ctx, status, page)
+	return args.Get(0).([]models.Payment), args.Get(1).(pagination.Page), args.Error(2)
+}
+
+func (api *paymentApiMock) SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found, allowed, changed bool, err error) {
+	args := api.Called(ctx, paymentUID, status)
+	return args.Bool(0), args.Bool(1), args.Bool(2), args.Error(3)
+}
@@ -0,0 +1,452 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"log/slog"
+	"time"
+)
+
+type ReconcilerError string
+
+func (e ReconcilerError) Error() string {
+	return string(e)
+}
+
+const (
+	ErrInvalidMode     ReconcilerError = "invalid reconciler mode: dry-run or apply expected"
+	ErrCarNotFound     ReconcilerError = "car not found"
+	ErrCarAlreadyRent  ReconcilerError = "car already rent for an overlapping period"
+	ErrCarLockChanged  ReconcilerError = "car lock holder changed meanwhile"
+	ErrPaymentNotFound ReconcilerError = "payment not found"
+	ErrPaymentChanged  ReconcilerError = "payment status changed meanwhile"
+)
+
+const (
+	ModeDryRun = "dry-run"
+	ModeApply  = "apply"
+)
+
+// lockOwner holds the car locks the reconciler restores.
+const lockOwner = "reconciler"
+
+type CarsAPI interface {
+	GetReservations(ctx context.Context, page pagination.Request) (res []models.CarReservation, info pagination.Page, err error)
+	LockCar(ctx context.Context, carUID string, from, to time.Time, lock models.CarLock) (res models.Car, found, success bool, err error)
+	AttachRental(ctx context.Context, carUID string, from, to time.Time, rentalUID string) (found bool, err error)
+	UnlockCar(ctx context.Context, carUID string, from, to time.Time, holder string) (found, allowed, changed bool, err error)
+	ForceUnlockCar(ctx context.Context, carUID string, from, to time.Time) (found, changed bool, err error)
+}
+
+type RentalsAPI interface {
+	GetRentals(ctx context.Context, page pagination.Request) (res []models.Rental, info pagination.Page, err error)
+}
+
+type PaymentsAPI interface {
+	GetPayments(ctx context.Context, status models.PaymentStatus, page pagination.Request) (res []models.Payment, info pagination.Page, err error)
+	SetPaymentStatus(ctx context.Context, paymentUID string, status models.PaymentStatus) (found, allowed, changed bool, err error)
+}
+
+type Kind string
+
+const (
+	OrphanedCarLock   Kind = "ORPHANED_CAR_LOCK"   // car locked for a period with no active rental
+	OrphanedPayment   Kind = "ORPHANED_PAYMENT"    // payment holding money no rental refers to
+	UnlockedRentedCar Kind = "UNLOCKED_RENTED_CAR" // reserved or in progress rental of a car which is not locked
+	OwnerlessCarLock  Kind = "OWNERLESS_CAR_LOCK"  // car lock of an active rental with no holder recorded
+)
+
+// heldStatuses are the payment statuses still holding the customer money: canceling such a payment
+// voids the authorization or refunds the rest. Canceled and refunded payments hold nothing to repair.
+var heldStatuses = []models.PaymentStatus{models.PaymentAuthorized, models.PaymentPaid, models.PaymentPartiallyRefunded}
+
+var kinds = []Kind{OrphanedCarLock, OrphanedPayment, UnlockedRentedCar, OwnerlessCarLock}
+
+type Finding struct {
+	Kind       Kind
+	CarUID     string
+	RentalUID  string
+	PaymentUID string
+	LockOwner  string
+	DateFrom   time.Time
+	DateTo     time.Time
+}
+
+func (f Finding) key() string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s/%d/%d", f.Kind, f.CarUID, f.RentalUID, f.PaymentUID, f.LockOwner, f.DateFrom.Unix(), f.DateTo.Unix())
+}
+
+func (f Finding) attrs() []any {
+	attrs := []any{slog.String("kind", string(f.Kind))}
+
+	if f.CarUID != "" {
+		attrs = append(attrs,
+			slog.String("car_uid", f.CarUID),
+			slog.Time("date_from", f.DateFrom),
+			slog.Time("date_to", f.DateTo),
+		)
+	}
+
+	if f.RentalUID != "" {
+		attrs = append(attrs, slog.String("rental_uid", f.RentalUID))
+	}
+
+	if f.LockOwner != "" {
+		attrs = append(attrs, slog.String("lock_owner", f.LockOwner))
+	}
+
+	if f.PaymentUID != "" {
+		attrs = append(attrs, slog.String("payment_uid", f.PaymentUID))
+	}
+
+	return attrs
+}
+
+type Report struct {
+	Found    map[Kind]int
+	Repaired map[Kind]int
+	Failed   map[Kind]int
+}
+
+// Reconciler scans the cars, rentals and payments services for the inconsistencies
+// left by failed rollbacks and, in apply mode, repairs them.
+type Reconciler struct {
+	carsAPI     CarsAPI
+	rentalsAPI  RentalsAPI
+	paymentsAPI PaymentsAPI
+	config      app.ReconcilerConfig
+	logger      *slog.Logger
+}
+
+func New(carsAPI CarsAPI, rentalsAPI RentalsAPI, paymentsAPI PaymentsAPI, config app.ReconcilerConfig, logger *slog.Logger) (*Reconciler, error) {
+	if config.Mode == "" {
+		config.Mode = ModeDryRun
+	} else if config.Mode != ModeDryRun && config.Mode != ModeApply {
+		return nil, ErrInvalidMode
+	}
+
+	return &Reconciler{
+		carsAPI:     carsAPI,
+		rentalsAPI:  rentalsAPI,
+		paymentsAPI: paymentsAPI,
+		config:      config,
+		logger:      logger,
+	}, nil
+}
+
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := r.Reconcile(ctx)
+		if err != nil {
+			r.logger.Error(err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context) (Report, error) {
+	findings, err := r.Scan(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+
+	// Operations in flight look inconsistent for a moment, so only act on what persists
+	if r.config.ConfirmDelay > 0 && len(findings) != 0 {
+		select {
+		case <-ctx.Done():
+			return Report{}, ctx.Err()
+		case <-time.After(r.config.ConfirmDelay):
+		}
+
+		confirmed, err := r.Scan(ctx)
+		if err != nil {
+			return Report{}, err
+		}
+
+		findings = intersect(findings, confirmed)
+	}
+
+	report := Report{
+		Found:    make(map[Kind]int),
+		Repaired: make(map[Kind]int),
+		Failed:   make(map[Kind]int),
+	}
+
+	for _, finding := range findings {
+		report.Found[finding.Kind]++
+		r.logger.Warn("inconsistency found", finding.attrs()...)
+
+		if r.config.Mode != ModeApply || !r.repairEnabled(finding.Kind) {
+			continue
+		}
+
+		err = r.repair(ctx, finding)
+		if err != nil {
+			report.Failed[finding.Kind]++
+			r.logger.Error("repair failed", append(finding.attrs(), slog.String("error", err.Error()))...)
+
+			continue
+		}
+
+		report.Repaired[finding.Kind]++
+		r.logger.Info("inconsistency repaired", finding.attrs()...)
+	}
+
+	for _, kind := range kinds {
+		r.logger.Info("reconciliation finished",
+			slog.String("mode", r.config.Mode),
+			slog.String("kind", string(kind)),
+			slog.Int("found", report.Found[kind]),
+			slog.Int("repaired", report.Repaired[kind]),
+			slog.Int("failed", report.Failed[kind]),
+		)
+	}
+
+	return report, nil
+}
+
+// Scan collects the current inconsistencies. Services are scanned in the order the rental flow
+// writes to them, so a rental created during the scan is seen along with its car lock and payment.
+func (r *Reconciler) Scan(ctx context.Context) ([]Finding, error) {
+	reservations, err := collect(ctx, r.carsAPI.GetReservations)
+	if err != nil {
+		return nil, err
+	}
+
+	rentals, err := collect(ctx, r.rentalsAPI.GetRentals)
+	if err != nil {
+		return nil, err
+	}
+
+	var payments []models.Payment
+
+	for _, status := range heldStatuses {
+		held, err := collect(ctx, func(ctx context.Context, page pagination.Request) ([]models.Payment, pagination.Page, error) {
+			return r.paymentsAPI.GetPayments(ctx, status, page)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		payments = append(payments, held...)
+	}
+
+	return detect(reservations, rentals, payments), nil
+}
+
+func collect[T any](ctx context.Context, list func(context.Context, pagination.Request) ([]T, pagination.Page, error)) ([]T, error) {
+	var res []T
+
+	page := pagination.Request{Limit: pagination.MaxLimit}
+
+	for {
+		items, info, err := list(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, items...)
+
+		if info.Next == nil {
+			return res, nil
+		}
+
+		page.Cursor = info.Next
+	}
+}
+
+type lockKey struct {
+	carUID   string
+	dateFrom int64
+	dateTo   int64
+}
+
+func newLockKey(carUID string, from, to time.Time) lockKey {
+	return lockKey{carUID: carUID, dateFrom: from.Unix(), dateTo: to.Unix()}
+}
+
+func detect(reservations []models.CarReservation, rentals []models.Rental, payments []models.Payment) []Finding {
+	var findings []Finding
+
+	locked := make(map[lockKey]bool, len(reservations))
+	for _, reservation := range reservations {
+		locked[newLockKey(reservation.CarUID, reservation.DateFrom, reservation.DateTo)] = true
+	}
+
+	rented := make(map[lockKey]string)
+	rentalUIDs := make(map[string]bool, len(rentals))
+	paymentUIDs := make(map[string]bool, len(rentals))
+
+	for _, rental := range rentals {
+		rentalUIDs[rental.RentalUID] = true
+		paymentUIDs[rental.PaymentUID] = true
+		if rental.SurchargePaymentUID != "" {
+			paymentUIDs[rental.SurchargePaymentUID] = true
+		}
+
+		if rental.Status != models.RentalReserved && rental.Status != models.RentalInProgress {
+			continue
+		}
+
+		key := newLockKey(rental.CarUID, rental.DateFrom, rental.DateTo)
+		rented[key] = rental.RentalUID
+
+		if !locked[key] {
+			findings = append(findings, Finding{
+				Kind:       UnlockedRentedCar,
+				CarUID:     rental.CarUID,
+				RentalUID:  rental.RentalUID,
+				PaymentUID: rental.PaymentUID,
+				DateFrom:   rental.DateFrom,
+				DateTo:     rental.DateTo,
+			})
+		}
+	}
+
+	for _, reservation := range reservations {
+		rentalUID, ok := rented[newLockKey(reservation.CarUID, reservation.DateFrom, reservation.DateTo)]
+		if !ok {
+			findings = append(findings, Finding{
+				Kind:      OrphanedCarLock,
+				CarUID:    reservation.CarUID,
+				RentalUID: reservation.RentalUID,
+				LockOwner: reservation.Owner,
+				DateFrom:  reservation.DateFrom,
+				DateTo:    reservation.DateTo,
+			})
+		} else if reservation.Owner == "" && reservation.RentalUID == "" {
+			// no one could release such a lock but by force, so it is handed over to its rental
+			findings = append(findings, Finding{
+				Kind:      OwnerlessCarLock,
+				CarUID:    reservation.CarUID,
+				RentalUID: rentalUID,
+				DateFrom:  reservation.DateFrom,
+				DateTo:    reservation.DateTo,
+			})
+		}
+	}
+
+	for _, payment := range payments {
+		if !paymentUIDs[payment.PaymentUID] && !rentalUIDs[payment.RentalUID] {
+			findings = append(findings, Finding{
+				Kind:       OrphanedPayment,
+				RentalUID:  payment.RentalUID,
+				PaymentUID: payment.PaymentUID,
+			})
+		}
+	}
+
+	return findings
+}
+
+func intersect(findings, confirmed []Finding) []Finding {
+	keys := make(map[string]bool, len(confirmed))
+	for _, finding := range confirmed {
+		keys[finding.key()] = true
+	}
+
+	res := make([]Finding, 0, len(findings))
+
+	for _, finding := range findings {
+		if keys[finding.key()] {
+			res = append(res, finding)
+		}
+	}
+
+	return res
+}
+
+func (r *Reconciler) repairEnabled(kind Kind) bool {
+	switch kind {
+	case OrphanedCarLock:
+		return r.config.Repairs.UnlockOrphanedCars
+	case OrphanedPayment:
+		return r.config.Repairs.CancelOrphanedPayments
+	case UnlockedRentedCar:
+		return r.config.Repairs.LockRentedCars
+	case OwnerlessCarLock:
+		return r.config.Repairs.AttachOwnerlessLocks
+	default:
+		return false
+	}
+}
+
+func (r *Reconciler) repair(ctx context.Context, finding Finding) error {
+	switch finding.Kind {
+	case OrphanedCarLock:
+		holder := finding.LockOwner
+		if holder == "" {
+			holder = finding.RentalUID
+		}
+
+		// locks with no holder recorded are left over by the callers which did not track it
+		if holder == "" {
+			found, _, err := r.carsAPI.ForceUnlockCar(ctx, finding.CarUID, finding.DateFrom, finding.DateTo)
+			if err != nil {
+				return err
+			} else if !found {
+				return ErrCarNotFound
+			}
+
+			return nil
+		}
+
+		// an unchanged result means the lock is gone meanwhile, which repairs the finding as well
+		found, allowed, _, err := r.carsAPI.UnlockCar(ctx, finding.CarUID, finding.DateFrom, finding.DateTo, holder)
+		if err != nil {
+			return err
+		} else if !found {
+			return ErrCarNotFound
+		} else if !allowed {
+			return ErrCarLockChanged
+		}
+
+		return nil
+	case OrphanedPayment:
+		found, allowed, _, err := r.paymentsAPI.SetPaymentStatus(ctx, finding.PaymentUID, models.PaymentCanceled)
+		if err != nil {
+			return err
+		} else if !found {
+			return ErrPaymentNotFound
+		} else if !allowed {
+			return ErrPaymentChanged
+		}
+
+		return nil
+	case UnlockedRentedCar:
+		lock := models.CarLock{RentalUID: finding.RentalUID, Owner: lockOwner}
+
+		_, found, success, err := r.carsAPI.LockCar(ctx, finding.CarUID, finding.DateFrom, finding.DateTo, lock)
+		if err != nil {
+			return err
+		} else if !found {
+			return ErrCarNotFound
+		} else if !success {
+			return ErrCarAlreadyRent
+		}
+
+		return nil
+	case OwnerlessCarLock:
+		found, err := r.carsAPI.AttachRental(ctx, finding.CarUID, finding.DateFrom, finding.DateTo, finding.RentalUID)
+		if err != nil {
+			return err
+		} else if !found {
+			return ErrCarNotFound
+		}
+
+		return nil
+	default:
+		return nil
+	}
+}
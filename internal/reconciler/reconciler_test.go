@@ -0,0 +1,437 @@
+package reconciler_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/internal/reconciler"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"github.com/stretchr/testify/mock"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+var (
+	dateFrom = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	dateTo   = time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+)
+
+// environment serves a snapshot of the services through the API mocks.
+type environment struct {
+	carsAPI    *carsApiMock
+	rentalAPI  *rentalApiMock
+	paymentAPI *paymentApiMock
+}
+
+func newEnvironment() *environment {
+	return &environment{
+		carsAPI:    new(carsApiMock),
+		rentalAPI:  new(rentalApiMock),
+		paymentAPI: new(paymentApiMock),
+	}
+}
+
+// serve returns the snapshot as a single page of every list, the payments are listed by status.
+func (env *environment) serve(reservations []models.CarReservation, rentals []models.Rental, payments []models.Payment) {
+	env.carsAPI.On("GetReservations", mock.Anything, mock.Anything).Return(reservations, pagination.Page{}, nil)
+	env.rentalAPI.On("GetRentals", mock.Anything, mock.Anything).Return(rentals, pagination.Page{}, nil)
+	for _, status := range []models.PaymentStatus{models.PaymentAuthorized, models.PaymentPaid, models.PaymentPartiallyRefunded} {
+		held := make([]models.Payment, 0, len(payments))
+		for _, payment := range payments {
+			if payment.Status == status {
+				held = append(held, payment)
+			}
+		}
+
+		env.paymentAPI.On("GetPayments", mock.Anything, status, mock.Anything).Return(held, pagination.Page{}, nil)
+	}
+}
+
+func (env *environment) reconciler(t provider.StepCtx, config app.ReconcilerConfig) *reconciler.Reconciler {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	r, err := reconciler.New(env.carsAPI, env.rentalAPI, env.paymentAPI, config, logger)
+	t.Require().NoError(err)
+
+	return r
+}
+
+func reservation(carUID, rentalUID, owner string) models.CarReservation {
+	return models.CarReservation{
+		CarUID:   carUID,
+		DateFrom: dateFrom,
+		DateTo:   dateTo,
+		CarLock:  models.CarLock{RentalUID: rentalUID, Owner: owner},
+	}
+}
+
+func rental(rentalUID, carUID, paymentUID string, status models.RentalStatus) models.Rental {
+	return models.Rental{
+		RentalUID: rentalUID,
+		RentalProperties: models.RentalProperties{
+			PaymentUID: paymentUID,
+			CarUID:     carUID,
+			DateFrom:   dateFrom,
+			DateTo:     dateTo,
+			Status:     status,
+		},
+	}
+}
+
+func payment(paymentUID, rentalUID string) models.Payment {
+	return models.Payment{PaymentUID: paymentUID, Status: models.PaymentPaid, RentalUID: rentalUID}
+}
+
+// applyAll enables every repair.
+func applyAll() app.ReconcilerConfig {
+	config := app.ReconcilerConfig{Mode: reconciler.ModeApply}
+	config.Repairs.UnlockOrphanedCars = true
+	config.Repairs.CancelOrphanedPayments = true
+	config.Repairs.LockRentedCars = true
+	config.Repairs.AttachOwnerlessLocks = true
+
+	return config
+}
+
+type ReconcilerSuite struct {
+	suite.Suite
+}
+
+func (s *ReconcilerSuite) TestNew(t provider.T) {
+	t.Epic("Reconciliation")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	env := newEnvironment()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	// act
+	_, defaultErr := reconciler.New(env.carsAPI, env.rentalAPI, env.paymentAPI, app.ReconcilerConfig{}, logger)
+	_, invalidErr := reconciler.New(env.carsAPI, env.rentalAPI, env.paymentAPI, app.ReconcilerConfig{Mode: "repair"}, logger)
+	// assert
+	t.Require().NoError(defaultErr)
+	t.Require().ErrorIs(invalidErr, reconciler.ErrInvalidMode)
+}
+
+func (s *ReconcilerSuite) TestScan(t provider.T) {
+	t.Epic("Reconciliation")
+	t.Severity(allure.CRITICAL)
+
+	surcharged := rental("rental", "car", "payment", models.RentalFinished)
+	surcharged.SurchargePaymentUID = "surcharge"
+
+	tests := []struct {
+		name         string
+		reservations []models.CarReservation
+		rentals      []models.Rental
+		payments     []models.Payment
+		findings     []reconciler.Finding
+	}{
+		{
+			name:         "consistent services",
+			reservations: []models.CarReservation{reservation("car", "rental", "")},
+			rentals:      []models.Rental{rental("rental", "car", "payment", models.RentalInProgress)},
+			payments:     []models.Payment{payment("payment", "rental")},
+		},
+		{
+			name:         "lock of no rental",
+			reservations: []models.CarReservation{reservation("car", "rental", "")},
+			findings: []reconciler.Finding{
+				{Kind: reconciler.OrphanedCarLock, CarUID: "car", RentalUID: "rental", DateFrom: dateFrom, DateTo: dateTo},
+			},
+		},
+		{
+			name:         "lock of a finished rental",
+			reservations: []models.CarReservation{reservation("car", "rental", "gateway")},
+			rentals:      []models.Rental{rental("rental", "car", "payment", models.RentalFinished)},
+			payments:     []models.Payment{payment("payment", "rental")},
+			findings: []reconciler.Finding{
+				{Kind: reconciler.OrphanedCarLock, CarUID: "car", RentalUID: "rental", LockOwner: "gateway", DateFrom: dateFrom, DateTo: dateTo},
+			},
+		},
+		{
+			name:         "ownerless lock of an active rental",
+			reservations: []models.CarReservation{reservation("car", "", "")},
+			rentals:      []models.Rental{rental("rental", "car", "payment", models.RentalReserved)},
+			payments:     []models.Payment{payment("payment", "rental")},
+			findings: []reconciler.Finding{
+				{Kind: reconciler.OwnerlessCarLock, CarUID: "car", RentalUID: "rental", DateFrom: dateFrom, DateTo: dateTo},
+			},
+		},
+		{
+			name:         "ownerless lock of no rental",
+			reservations: []models.CarReservation{reservation("car", "", "")},
+			findings: []reconciler.Finding{
+				{Kind: reconciler.OrphanedCarLock, CarUID: "car", DateFrom: dateFrom, DateTo: dateTo},
+			},
+		},
+		{
+			name:     "reserved rental of an unlocked car",
+			rentals:  []models.Rental{rental("rental", "car", "payment", models.RentalReserved)},
+			payments: []models.Payment{payment("payment", "rental")},
+			findings: []reconciler.Finding{
+				{Kind: reconciler.UnlockedRentedCar, CarUID: "car", RentalUID: "rental", PaymentUID: "payment", DateFrom: dateFrom, DateTo: dateTo},
+			},
+		},
+		{
+			name: "lock for other dates",
+			reservations: []models.CarReservation{{
+				CarUID:   "car",
+				DateFrom: dateFrom,
+				DateTo:   dateTo.Add(24 * time.Hour),
+				CarLock:  models.CarLock{RentalUID: "rental"},
+			}},
+			rentals: []models.Rental{rental("rental", "car", "payment", models.RentalInProgress)},
+			findings: []reconciler.Finding{
+				{Kind: reconciler.UnlockedRentedCar, CarUID: "car", RentalUID: "rental", PaymentUID: "payment", DateFrom: dateFrom, DateTo: dateTo},
+				{Kind: reconciler.OrphanedCarLock, CarUID: "car", RentalUID: "rental", DateFrom: dateFrom, DateTo: dateTo.Add(24 * time.Hour)},
+			},
+		},
+		{
+			name:     "payment of no rental",
+			payments: []models.Payment{payment("payment", "")},
+			findings: []reconciler.Finding{
+				{Kind: reconciler.OrphanedPayment, PaymentUID: "payment"},
+			},
+		},
+		{
+			name:     "payment linked to a missing rental",
+			payments: []models.Payment{payment("payment", "rental")},
+			findings: []reconciler.Finding{
+				{Kind: reconciler.OrphanedPayment, RentalUID: "rental", PaymentUID: "payment"},
+			},
+		},
+		{
+			name: "authorized and partially refunded payments of no rental",
+			payments: []models.Payment{
+				{PaymentUID: "authorized", Status: models.PaymentAuthorized},
+				{PaymentUID: "partially refunded", Status: models.PaymentPartiallyRefunded},
+			},
+			findings: []reconciler.Finding{
+				{Kind: reconciler.OrphanedPayment, PaymentUID: "authorized"},
+				{Kind: reconciler.OrphanedPayment, PaymentUID: "partially refunded"},
+			},
+		},
+		{
+			name:     "refunded payment of no rental",
+			payments: []models.Payment{{PaymentUID: "refunded", Status: models.PaymentRefunded}},
+		},
+		{
+			name:     "surcharge of a rental",
+			rentals:  []models.Rental{surcharged},
+			payments: []models.Payment{payment("payment", "rental"), payment("surcharge", "")},
+		},
+		{
+			name:     "linked payment the rental does not refer to",
+			rentals:  []models.Rental{rental("rental", "car", "payment", models.RentalCanceled)},
+			payments: []models.Payment{payment("other", "rental")},
+		},
+	}
+
+	for _, test := range tests {
+		t.WithNewStep(test.name, func(sCtx provider.StepCtx) {
+			// arrange
+			env := newEnvironment()
+			env.serve(test.reservations, test.rentals, test.payments)
+			// act
+			findings, err := env.reconciler(sCtx, app.ReconcilerConfig{}).Scan(context.Background())
+			// assert
+			sCtx.Require().NoError(err)
+			sCtx.Require().Equal(test.findings, findings)
+		})
+	}
+}
+
+func (s *ReconcilerSuite) TestScanPages(t provider.T) {
+	t.Epic("Reconciliation")
+	t.Severity(allure.NORMAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("every page is scanned", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment()
+		next := &pagination.Cursor{ID: 1}
+		first := pagination.Request{Limit: pagination.MaxLimit}
+		second := pagination.Request{Limit: pagination.MaxLimit, Cursor: next}
+
+		env.carsAPI.On("GetReservations", ctx, first).
+			Return([]models.CarReservation{reservation("car", "rental", "")}, pagination.Page{Next: next}, nil)
+		env.carsAPI.On("GetReservations", ctx, second).
+			Return([]models.CarReservation{reservation("other car", "other rental", "")}, pagination.Page{}, nil)
+		env.rentalAPI.On("GetRentals", ctx, first).
+			Return([]models.Rental{rental("rental", "car", "payment", models.RentalReserved)}, pagination.Page{Next: next}, nil)
+		env.rentalAPI.On("GetRentals", ctx, second).
+			Return([]models.Rental{rental("other rental", "other car", "other payment", models.RentalReserved)}, pagination.Page{}, nil)
+		env.paymentAPI.On("GetPayments", ctx, models.PaymentPaid, first).
+			Return([]models.Payment{payment("payment", "rental")}, pagination.Page{Next: next}, nil)
+		env.paymentAPI.On("GetPayments", ctx, models.PaymentPaid, second).
+			Return([]models.Payment{payment("orphan", "")}, pagination.Page{}, nil)
+		env.paymentAPI.On("GetPayments", ctx, models.PaymentAuthorized, first).Return([]models.Payment{}, pagination.Page{}, nil)
+		env.paymentAPI.On("GetPayments", ctx, models.PaymentPartiallyRefunded, first).Return([]models.Payment{}, pagination.Page{}, nil)
+		// act
+		findings, err := env.reconciler(sCtx, app.ReconcilerConfig{}).Scan(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal([]reconciler.Finding{{Kind: reconciler.OrphanedPayment, PaymentUID: "orphan"}}, findings)
+		env.carsAPI.AssertNumberOfCalls(sCtx, "GetReservations", 2)
+		env.rentalAPI.AssertNumberOfCalls(sCtx, "GetRentals", 2)
+		env.paymentAPI.AssertNumberOfCalls(sCtx, "GetPayments", 4)
+	})
+
+	t.WithNewStep("failed page fails the scan", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment()
+		unavailable := errors.New("rental service unavailable")
+
+		env.carsAPI.On("GetReservations", ctx, mock.Anything).Return([]models.CarReservation{}, pagination.Page{}, nil)
+		env.rentalAPI.On("GetRentals", ctx, mock.Anything).Return([]models.Rental{}, pagination.Page{}, unavailable)
+		// act
+		_, err := env.reconciler(sCtx, app.ReconcilerConfig{}).Scan(ctx)
+		// assert
+		sCtx.Require().ErrorIs(err, unavailable)
+		env.paymentAPI.AssertNotCalled(sCtx, "GetPayments", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func (s *ReconcilerSuite) TestReconcile(t provider.T) {
+	t.Epic("Reconciliation")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+	reservations := []models.CarReservation{
+		reservation("car", "canceled rental", "gateway"),
+		reservation("other car", "missing rental", ""),
+	}
+	rentals := []models.Rental{
+		rental("canceled rental", "car", "canceled payment", models.RentalCanceled),
+		rental("rental", "rented car", "payment", models.RentalReserved),
+	}
+	payments := []models.Payment{payment("payment", "rental"), payment("orphan", "")}
+
+	t.WithNewStep("dry run only reports", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment()
+		env.serve(reservations, rentals, payments)
+		config := applyAll()
+		config.Mode = reconciler.ModeDryRun
+		// act
+		report, err := env.reconciler(sCtx, config).Reconcile(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(map[reconciler.Kind]int{
+			reconciler.OrphanedCarLock:   2,
+			reconciler.OrphanedPayment:   1,
+			reconciler.UnlockedRentedCar: 1,
+		}, report.Found)
+		sCtx.Require().Empty(report.Repaired)
+		sCtx.Require().Empty(report.Failed)
+		env.carsAPI.AssertNotCalled(sCtx, "UnlockCar", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		env.carsAPI.AssertNotCalled(sCtx, "LockCar", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		env.paymentAPI.AssertNotCalled(sCtx, "SetPaymentStatus", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.WithNewStep("apply repairs every finding", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment()
+		env.serve(reservations, rentals, payments)
+		env.carsAPI.On("UnlockCar", ctx, "car", dateFrom, dateTo, "gateway").Return(true, true, true, nil)
+		env.carsAPI.On("UnlockCar", ctx, "other car", dateFrom, dateTo, "missing rental").Return(true, true, false, nil)
+		env.carsAPI.On("LockCar", ctx, "rented car", dateFrom, dateTo, models.CarLock{RentalUID: "rental", Owner: "reconciler"}).
+			Return(models.Car{}, true, true, nil)
+		env.paymentAPI.On("SetPaymentStatus", ctx, "orphan", models.PaymentCanceled).Return(true, true, true, nil)
+		// act
+		report, err := env.reconciler(sCtx, applyAll()).Reconcile(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(report.Found, report.Repaired)
+		sCtx.Require().Empty(report.Failed)
+		env.carsAPI.AssertExpectations(sCtx)
+		env.paymentAPI.AssertExpectations(sCtx)
+	})
+
+	t.WithNewStep("disabled repairs are not applied", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment()
+		env.serve(reservations, rentals, payments)
+		env.paymentAPI.On("SetPaymentStatus", ctx, "orphan", models.PaymentCanceled).Return(true, true, true, nil)
+		config := app.ReconcilerConfig{Mode: reconciler.ModeApply}
+		config.Repairs.CancelOrphanedPayments = true
+		// act
+		report, err := env.reconciler(sCtx, config).Reconcile(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(map[reconciler.Kind]int{reconciler.OrphanedPayment: 1}, report.Repaired)
+		env.carsAPI.AssertNotCalled(sCtx, "UnlockCar", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		env.carsAPI.AssertNotCalled(sCtx, "LockCar", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.WithNewStep("refused repairs are counted as failed", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment()
+		env.serve(reservations, rentals, payments)
+		env.carsAPI.On("UnlockCar", ctx, "car", dateFrom, dateTo, "gateway").Return(true, false, false, nil)
+		env.carsAPI.On("UnlockCar", ctx, "other car", dateFrom, dateTo, "missing rental").Return(false, false, false, nil)
+		env.carsAPI.On("LockCar", ctx, "rented car", dateFrom, dateTo, mock.Anything).Return(models.Car{}, true, false, nil)
+		env.paymentAPI.On("SetPaymentStatus", ctx, "orphan", models.PaymentCanceled).Return(false, false, false, errors.New("timeout"))
+		// act
+		report, err := env.reconciler(sCtx, applyAll()).Reconcile(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Empty(report.Repaired)
+		sCtx.Require().Equal(report.Found, report.Failed)
+	})
+
+	t.WithNewStep("ownerless locks are released by force or attached to their rental", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment()
+		env.serve(
+			[]models.CarReservation{reservation("car", "", ""), reservation("rented car", "", "")},
+			[]models.Rental{rental("rental", "rented car", "payment", models.RentalInProgress)},
+			[]models.Payment{payment("payment", "rental")},
+		)
+		env.carsAPI.On("ForceUnlockCar", ctx, "car", dateFrom, dateTo).Return(true, true, nil)
+		env.carsAPI.On("AttachRental", ctx, "rented car", dateFrom, dateTo, "rental").Return(true, nil)
+		// act
+		report, err := env.reconciler(sCtx, applyAll()).Reconcile(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(map[reconciler.Kind]int{
+			reconciler.OrphanedCarLock:  1,
+			reconciler.OwnerlessCarLock: 1,
+		}, report.Repaired)
+		sCtx.Require().Empty(report.Failed)
+		env.carsAPI.AssertExpectations(sCtx)
+		env.carsAPI.AssertNotCalled(sCtx, "UnlockCar", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.WithNewStep("only persisting findings are acted upon", func(sCtx provider.StepCtx) {
+		// arrange
+		env := newEnvironment()
+		env.carsAPI.On("GetReservations", ctx, mock.Anything).Return(reservations, pagination.Page{}, nil).Once()
+		env.carsAPI.On("GetReservations", ctx, mock.Anything).Return(reservations[:1], pagination.Page{}, nil).Once()
+		env.rentalAPI.On("GetRentals", ctx, mock.Anything).Return(rentals[:1], pagination.Page{}, nil)
+		env.paymentAPI.On("GetPayments", ctx, mock.Anything, mock.Anything).Return([]models.Payment{}, pagination.Page{}, nil)
+		env.carsAPI.On("UnlockCar", ctx, "car", dateFrom, dateTo, "gateway").Return(true, true, true, nil)
+		config := applyAll()
+		config.ConfirmDelay = time.Millisecond
+		// act
+		report, err := env.reconciler(sCtx, config).Reconcile(ctx)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(map[reconciler.Kind]int{reconciler.OrphanedCarLock: 1}, report.Found)
+		sCtx.Require().Equal(map[reconciler.Kind]int{reconciler.OrphanedCarLock: 1}, report.Repaired)
+		env.carsAPI.AssertNumberOfCalls(sCtx, "UnlockCar", 1)
+	})
+}
+
+func TestReconciler(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(ReconcilerSuite))
+}
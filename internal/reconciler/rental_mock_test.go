@@ -0,0 +1,17 @@
+package reconciler_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/stretchr/testify/mock"
+)
+
+type rentalApiMock struct {
+	mock.Mock
+}
+
+func (api *rentalApiMock) GetRentals(ctx context.Context, page pagination.Request) (res []models.Rental, info pagination.Page, err error) {
+	args := api.Called(ctx, page)
+	return args.Get(0).([]models.Rental), args.Get(1).(pagination.Page), args.Error(2)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/Inspirate789/ds-lab2/internal/models"
 	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
 	"github.com/Inspirate789/ds-lab2/internal/rental/delivery"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/pkg/errors"
 	"github.com/sony/gobreaker/v2"
 	"go.uber.org/multierr"
@@ -15,6 +16,8 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -30,8 +33,8 @@ type RequestBacklog interface {
 }
 
 type rentals struct {
-	items      []models.Rental
-	totalCount uint64
+	items []models.Rental
+	info  pagination.Page
 }
 
 type rental struct {
@@ -118,12 +121,12 @@ func (api *RentalsAPI) HealthCheck(ctx context.Context) (err error) {
 
 }
 
-func (api *RentalsAPI) getUserRentals(ctx context.Context, username string, offset, limit uint64) ([]models.Rental, uint64, error) {
-	endpoint := api.baseURL + fmt.Sprintf("/api/v1/rentals?offset=%d&limit=%d", offset, limit)
+func (api *RentalsAPI) getUserRentals(ctx context.Context, username string, page pagination.Request) ([]models.Rental, pagination.Page, error) {
+	endpoint := api.baseURL + "/api/v1/rentals?" + page.Values().Encode()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
-		return nil, 0, err
+		return nil, pagination.Page{}, err
 	}
 
 	req.Header.Set("X-User-Name", username)
@@ -135,48 +138,82 @@ func (api *RentalsAPI) getUserRentals(ctx context.Context, username string, offs
 			err = errors.Wrap(err, ErrServiceUnavailable)
 		}
 
-		return nil, 0, err
+		return nil, pagination.Page{}, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, 0, err
+		return nil, pagination.Page{}, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, 0, errors.New(string(body))
+		return nil, pagination.Page{}, errors.New(string(body))
 	}
 
 	var rentals delivery.RentalsDTO
 
 	err = json.Unmarshal(body, &rentals)
 	if err != nil {
-		return nil, 0, err
+		return nil, pagination.Page{}, err
 	}
 
-	model, err := rentals.ToModel()
-	if err != nil {
-		return nil, 0, err
-	}
-
-	return model, rentals.Count, nil
+	return rentals.ToModel()
 }
 
-func (api *RentalsAPI) GetUserRentals(ctx context.Context, username string, offset, limit uint64) ([]models.Rental, uint64, error) {
+func (api *RentalsAPI) GetUserRentals(ctx context.Context, username string, page pagination.Request) ([]models.Rental, pagination.Page, error) {
 	res, err := api.rentalsCB.Execute(func() (rentals, error) {
-		items, totalCount, err := api.getUserRentals(ctx, username, offset, limit)
+		items, info, err := api.getUserRentals(ctx, username, page)
 		return rentals{
-			items:      items,
-			totalCount: totalCount,
+			items: items,
+			info:  info,
 		}, err
 	})
 	if err != nil {
 		api.logger.Warn(err.Error())
-		return make([]models.Rental, 0), 0, nil
+		return make([]models.Rental, 0), pagination.Page{}, nil
 	}
 
-	return res.items, res.totalCount, nil
+	return res.items, res.info, nil
+}
+
+// GetRentals lists the rentals of all users; it bypasses the circuit breaker, as callers need the actual data.
+func (api *RentalsAPI) GetRentals(ctx context.Context, page pagination.Request) ([]models.Rental, pagination.Page, error) {
+	endpoint := api.baseURL + "/api/v1/rentals/all?" + page.Values().Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = errors.Wrap(err, ErrServiceUnavailable)
+		}
+
+		return nil, pagination.Page{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, pagination.Page{}, errors.New(string(body))
+	}
+
+	var rentals delivery.RentalsDTO
+
+	err = json.Unmarshal(body, &rentals)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	return rentals.ToModel()
 }
 
 func (api *RentalsAPI) getUserRental(ctx context.Context, rentalUID, username string) (res models.Rental, found, permitted bool, err error) {
@@ -299,12 +336,16 @@ func (api *RentalsAPI) CreateRental(ctx context.Context, properties models.Renta
 	return model, nil
 }
 
-func (api *RentalsAPI) SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found bool, err error) {
-	endpoint := api.baseURL + "/api/v1/rentals/" + rentalUID + "/status"
+func (api *RentalsAPI) GetExpiredReservations(ctx context.Context, before time.Time, limit uint64) ([]models.Rental, error) {
+	query := url.Values{
+		"before": {before.Format(time.RFC3339)},
+		"limit":  {strconv.FormatUint(limit, 10)},
+	}
+	endpoint := api.baseURL + "/api/v1/rentals/reservations/expired?" + query.Encode()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewBufferString(fmt.Sprint(status)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	resp, err := api.client.Do(req)
@@ -314,11 +355,60 @@ func (api *RentalsAPI) SetRentalStatus(ctx context.Context, rentalUID string, st
 			err = errors.Wrap(err, ErrServiceUnavailable)
 		}
 
-		return false, multierr.Combine(err, api.backlog.Push(ctx, req))
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(string(body))
+	}
+
+	var rentals delivery.RentalsDTO
+
+	err = json.Unmarshal(body, &rentals)
+	if err != nil {
+		return nil, err
+	}
+
+	model, _, err := rentals.ToModel()
+
+	return model, err
+}
+
+// SetSurchargePayment attaches the surcharge to the rental. It is not retried through the backlog,
+// the gateway cancels a surcharge it can't attach.
+func (api *RentalsAPI) SetSurchargePayment(ctx context.Context, rentalUID, paymentUID string) (found bool, err error) {
+	endpoint := api.baseURL + "/api/v1/rentals/" + rentalUID + "/surcharge"
+
+	body, err := json.Marshal(delivery.SurchargeDTO{PaymentUID: paymentUID})
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = errors.Wrap(err, ErrServiceUnavailable)
+		}
+
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
 	if err != nil {
 		return false, err
 	}
@@ -331,3 +421,54 @@ func (api *RentalsAPI) SetRentalStatus(ctx context.Context, rentalUID string, st
 
 	return true, nil
 }
+
+func (api *RentalsAPI) SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found, allowed, changed bool, err error) {
+	return api.SetRentalStatusFrom(ctx, rentalUID, "", status)
+}
+
+// SetRentalStatusFrom changes the rental status if it is expected (any status if empty). Status changes
+// are not retried through the backlog: the gateway rolls back the steps before a failed change instead.
+func (api *RentalsAPI) SetRentalStatusFrom(ctx context.Context, rentalUID string, expected, status models.RentalStatus) (found, allowed, changed bool, err error) {
+	endpoint := api.baseURL + "/api/v1/rentals/" + rentalUID + "/status"
+	if expected != "" {
+		endpoint += "?expected=" + url.QueryEscape(string(expected))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewBufferString(fmt.Sprint(status)))
+	if err != nil {
+		return false, false, false, err
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		var DNSError *net.DNSError
+		if errors.As(err, &DNSError) {
+			err = errors.Wrap(err, ErrServiceUnavailable)
+		}
+
+		return false, false, false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, false, false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, false, false, nil
+	} else if resp.StatusCode == http.StatusConflict {
+		return true, false, false, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return false, false, false, errors.New(string(body))
+	}
+
+	var dto delivery.RentalStatusUpdateDTO
+
+	err = json.Unmarshal(body, &dto)
+	if err != nil {
+		return false, false, false, err
+	}
+
+	return true, true, dto.Changed, nil
+}
@@ -0,0 +1,239 @@
+package api_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/rental/api"
+	"github.com/Inspirate789/ds-lab2/internal/rental/delivery"
+	"github.com/Inspirate789/ds-lab2/pkg/contract"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+const contractPath = "../../../contracts/gateway-rentals.json"
+
+const (
+	rentalUID        = "8d5d3c36-2c4e-4b57-9a8d-7b0f5e4c1a20"
+	unknownRentalUID = "e1c2f4b0-6d3a-4f7e-9b21-5c8a0d9e7f43"
+	username         = "Test Max"
+	carUID           = "109b42f3-198d-4c89-9276-a7520a7120ab"
+	paymentUID       = "238c1b7e-3f5d-4a1c-8e9b-6d2f0a4c5b71"
+	surchargeUID     = "5a9e3d21-7c4b-4f80-a6d2-1e8b9c0f3a54"
+)
+
+var properties = models.RentalProperties{
+	Username:   username,
+	PaymentUID: paymentUID,
+	CarUID:     carUID,
+	DateFrom:   time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	DateTo:     time.Date(2030, 1, 5, 0, 0, 0, 0, time.UTC),
+	Status:     models.RentalReserved,
+}
+
+var (
+	noRentals    = contract.State{Name: "no rentals"}
+	rentalExists = contract.State{
+		Name: "rental exists",
+		Params: map[string]string{
+			"rentalUid":  rentalUID,
+			"username":   username,
+			"carUid":     carUID,
+			"paymentUid": paymentUID,
+			"dateFrom":   properties.DateFrom.Format(time.DateOnly),
+			"dateTo":     properties.DateTo.Format(time.DateOnly),
+			"status":     string(models.RentalReserved),
+		},
+	}
+	rentalNotExists = contract.State{
+		Name:   "rental does not exist",
+		Params: map[string]string{"rentalUid": unknownRentalUID},
+	}
+)
+
+type ContractSuite struct {
+	suite.Suite
+}
+
+func (s *ContractSuite) TestGatewayContract(t provider.T) {
+	t.Epic("Contracts")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	consumer := contract.NewConsumer("gateway", "rentals")
+	rentalAPI := api.New("http://rentals", consumer.Client(), nil, 1, logger)
+	rental := models.Rental{
+		ID:               1,
+		RentalUID:        rentalUID,
+		RentalProperties: properties,
+	}
+
+	t.WithNewStep("create a rental", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("create a rental", noRentals, http.StatusOK, delivery.NewRentalDTO(rental), "rentalUid")
+		// act
+		res, err := rentalAPI.CreateRental(ctx, properties)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Equal(rental, res)
+	})
+
+	t.WithNewStep("get a rental of the user", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("get a rental of the user", rentalExists, http.StatusOK, delivery.NewRentalDTO(rental))
+		// act
+		res, found, permitted, err := rentalAPI.GetUserRental(ctx, rentalUID, username)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(permitted)
+		sCtx.Require().Equal(rental, res)
+	})
+
+	t.WithNewStep("get a rental of another user", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("get a rental of another user", rentalExists, http.StatusForbidden, nil)
+		// act
+		_, found, permitted, err := rentalAPI.GetUserRental(ctx, rentalUID, "Another User")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().False(permitted)
+	})
+
+	t.WithNewStep("get an unknown rental", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("get an unknown rental", rentalNotExists, http.StatusNotFound, nil)
+		// act
+		_, found, permitted, err := rentalAPI.GetUserRental(ctx, unknownRentalUID, username)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+		sCtx.Require().False(permitted)
+	})
+
+	t.WithNewStep("list rentals of the user", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("list rentals of the user", rentalExists, http.StatusOK, delivery.RentalsDTO{
+			Items: []delivery.RentalDTO{delivery.NewRentalDTO(rental)},
+			Count: 1,
+		})
+		// act
+		rentals, info, err := rentalAPI.GetUserRentals(ctx, username, pagination.Request{Limit: 10})
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Equal([]models.Rental{rental}, rentals)
+		sCtx.Require().EqualValues(1, info.TotalCount)
+	})
+
+	t.WithNewStep("list expired reservations", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("list expired reservations", rentalExists, http.StatusOK, delivery.RentalsDTO{
+			Items: []delivery.RentalDTO{delivery.NewRentalDTO(rental)},
+			Count: 1,
+		})
+		// act
+		rentals, err := rentalAPI.GetExpiredReservations(ctx, time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC), 10)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().Equal([]models.Rental{rental}, rentals)
+	})
+
+	t.WithNewStep("start a reserved rental", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("start a reserved rental", rentalExists, http.StatusOK, delivery.RentalStatusUpdateDTO{Changed: true})
+		// act
+		found, allowed, changed, err := rentalAPI.SetRentalStatusFrom(ctx, rentalUID, models.RentalReserved, models.RentalInProgress)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().True(changed)
+	})
+
+	t.WithNewStep("finish a rental which is not in progress", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("finish a rental which is not in progress", rentalExists, http.StatusConflict, nil)
+		// act
+		found, allowed, changed, err := rentalAPI.SetRentalStatusFrom(ctx, rentalUID, models.RentalInProgress, models.RentalFinished)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().False(changed)
+	})
+
+	t.WithNewStep("reserve a reserved rental", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("reserve a reserved rental", rentalExists, http.StatusOK, delivery.RentalStatusUpdateDTO{Changed: false})
+		// act
+		found, allowed, changed, err := rentalAPI.SetRentalStatus(ctx, rentalUID, models.RentalReserved)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+		sCtx.Require().True(allowed)
+		sCtx.Require().False(changed)
+	})
+
+	t.WithNewStep("cancel an unknown rental", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("cancel an unknown rental", rentalNotExists, http.StatusNotFound, nil)
+		// act
+		found, allowed, changed, err := rentalAPI.SetRentalStatus(ctx, unknownRentalUID, models.RentalCanceled)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().False(changed)
+	})
+
+	t.WithNewStep("set the surcharge payment", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("set the surcharge payment", rentalExists, http.StatusOK, nil)
+		// act
+		found, err := rentalAPI.SetSurchargePayment(ctx, rentalUID, surchargeUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().True(found)
+	})
+
+	t.WithNewStep("set the surcharge payment of an unknown rental", func(sCtx provider.StepCtx) {
+		// arrange
+		consumer.Expect("set the surcharge payment of an unknown rental", rentalNotExists, http.StatusNotFound, nil)
+		// act
+		found, err := rentalAPI.SetSurchargePayment(ctx, unknownRentalUID, surchargeUID)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(consumer.Done())
+		sCtx.Require().False(found)
+	})
+
+	// act
+	err := consumer.Contract().Save(contractPath)
+	// assert
+	t.Require().NoError(err)
+}
+
+func TestContract(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(ContractSuite))
+}
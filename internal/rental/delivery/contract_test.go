@@ -0,0 +1,88 @@
+package delivery_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
+	"github.com/Inspirate789/ds-lab2/internal/rental/delivery"
+	"github.com/Inspirate789/ds-lab2/internal/rental/repository"
+	"github.com/Inspirate789/ds-lab2/internal/rental/usecase"
+	"github.com/Inspirate789/ds-lab2/pkg/contract"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+const contractPath = "../../../contracts/gateway-rentals.json"
+
+type ContractSuite struct {
+	suite.Suite
+}
+
+// setUp brings the repository to the provider state and maps the uids of the consumer to the generated ones.
+func setUp(repo *repository.MemoryRepository, state contract.State) (replacements map[string]string, err error) {
+	switch state.Name {
+	case "no rentals", "rental does not exist":
+		return nil, nil
+	case "rental exists":
+		properties, err := delivery.RentalPropertiesDTO{
+			Username:   state.Params["username"],
+			PaymentUID: state.Params["paymentUid"],
+			CarUID:     state.Params["carUid"],
+			DateFrom:   state.Params["dateFrom"],
+			DateTo:     state.Params["dateTo"],
+			Status:     models.RentalStatus(state.Params["status"]),
+		}.ToModel()
+		if err != nil {
+			return nil, err
+		}
+
+		rental, err := repo.CreateRental(context.Background(), properties)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]string{state.Params["rentalUid"]: rental.RentalUID}, nil
+	default:
+		return nil, fmt.Errorf("unknown provider state %q", state.Name)
+	}
+}
+
+func (s *ContractSuite) TestGatewayContract(t provider.T) {
+	t.Epic("Contracts")
+	t.Severity(allure.CRITICAL)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	c, err := contract.Load(contractPath)
+	t.Require().NoError(err)
+
+	for _, interaction := range c.Interactions {
+		t.WithNewStep(interaction.Description, func(sCtx provider.StepCtx) {
+			// arrange
+			repo := repository.NewMemoryRepository(logger)
+			replacements, err := setUp(repo, interaction.State)
+			sCtx.Require().NoError(err)
+			webApp, err := app.NewFiberApp(
+				app.WebConfig{PathPrefix: "/api/v1/rentals"},
+				delivery.New(usecase.New(repo, logger), logger),
+				logger,
+			)
+			sCtx.Require().NoError(err)
+			// act
+			err = contract.Verify(webApp, interaction, replacements)
+			// assert
+			sCtx.Require().NoError(err)
+		})
+	}
+}
+
+func TestContract(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(ContractSuite))
+}
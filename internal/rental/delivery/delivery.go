@@ -5,18 +5,22 @@ import (
 	"github.com/Inspirate789/ds-lab2/internal/models"
 	"github.com/Inspirate789/ds-lab2/internal/pkg/app"
 	"github.com/Inspirate789/ds-lab2/internal/rental/delivery/errors"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/gofiber/fiber/v2"
 	"log/slog"
-	"math"
-	"strconv"
+	"time"
 )
 
 type UseCase interface {
 	app.HealthChecker
-	GetUserRentals(ctx context.Context, username string, offset, limit uint64) (res []models.Rental, totalCount uint64, err error)
+	GetUserRentals(ctx context.Context, username string, page pagination.Request) (res []models.Rental, info pagination.Page, err error)
 	GetUserRental(ctx context.Context, rentalUID, username string) (res models.Rental, found, permitted bool, err error)
+	GetRentals(ctx context.Context, page pagination.Request) (res []models.Rental, info pagination.Page, err error)
 	CreateRental(ctx context.Context, properties models.RentalProperties) (res models.Rental, err error)
-	SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found bool, err error)
+	GetExpiredReservations(ctx context.Context, before time.Time, limit uint64) (res []models.Rental, err error)
+	SetRentalStatusFrom(ctx context.Context, rentalUID string, expected, status models.RentalStatus) (found, allowed, changed bool, err error)
+	SetSurchargePayment(ctx context.Context, rentalUID, paymentUID string) (found bool, err error)
+	GetUserRentalStatusHistory(ctx context.Context, rentalUID, username string) (res []models.RentalStatusChange, found, permitted bool, err error)
 }
 
 type Delivery struct {
@@ -38,31 +42,65 @@ func (d *Delivery) HealthCheck(ctx context.Context) error {
 func (d *Delivery) AddHandlers(router fiber.Router) {
 	router.Get("/", d.getRentals)
 	router.Post("/", d.createRental)
+	router.Get("/all", d.getAllRentals)
+	router.Get("/reservations/expired", d.getExpiredReservations)
 	router.Get("/:rentalUID", d.getRental)
 	router.Put("/:rentalUID/status", d.updateRentalStatus)
+	router.Put("/:rentalUID/surcharge", d.setSurchargePayment)
+	router.Get("/:rentalUID/history", d.getRentalStatusHistory)
 }
 
 func (d *Delivery) getRentals(ctx *fiber.Ctx) error {
-	offset, err := strconv.ParseUint(ctx.Query("offset"), 10, 64)
+	page, err := pagination.ParseRequest(ctx.Query("offset"), ctx.Query("limit"), ctx.Query("cursor"))
 	if err != nil {
-		d.logger.Debug("rentals offset not set, use default 0")
-		offset = 0
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPage.Map())
 	}
 
-	limit, err := strconv.ParseUint(ctx.Query("limit"), 10, 64)
+	username := ctx.Get("X-User-Name")
+
+	rentals, info, err := d.useCase.GetUserRentals(ctx.Context(), username, page)
 	if err != nil {
-		d.logger.Debug("rentals limit not set, return all rentals")
-		limit = math.MaxInt64
+		return err
 	}
 
-	username := ctx.Get("X-User-Name")
+	return ctx.Status(fiber.StatusOK).JSON(NewRentalsDTO(rentals, info))
+}
+
+func (d *Delivery) getAllRentals(ctx *fiber.Ctx) error {
+	page, err := pagination.ParseRequest(ctx.Query("offset"), ctx.Query("limit"), ctx.Query("cursor"))
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPage.Map())
+	}
 
-	rentals, totalCount, err := d.useCase.GetUserRentals(ctx.Context(), username, offset, limit)
+	rentals, info, err := d.useCase.GetRentals(ctx.Context(), page)
 	if err != nil {
 		return err
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(NewRentalsDTO(rentals, totalCount))
+	return ctx.Status(fiber.StatusOK).JSON(NewRentalsDTO(rentals, info))
+}
+
+func (d *Delivery) getExpiredReservations(ctx *fiber.Ctx) error {
+	before, err := time.Parse(time.RFC3339, ctx.Query("before"))
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidExpiryTime.Map())
+	}
+
+	page, err := pagination.ParseRequest("", ctx.Query("limit"), "")
+	if err != nil {
+		d.logger.Error(err.Error())
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidPage.Map())
+	}
+
+	rentals, err := d.useCase.GetExpiredReservations(ctx.Context(), before, page.Limit)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewRentalsDTO(rentals, pagination.Page{TotalCount: uint64(len(rentals))}))
 }
 
 func (d *Delivery) createRental(ctx *fiber.Ctx) error {
@@ -107,8 +145,35 @@ func (d *Delivery) getRental(ctx *fiber.Ctx) error {
 func (d *Delivery) updateRentalStatus(ctx *fiber.Ctx) error {
 	rentalUID := ctx.Params("rentalUID")
 	status := models.RentalStatus(ctx.Body())
+	expected := models.RentalStatus(ctx.Query("expected"))
 
-	found, err := d.useCase.SetRentalStatus(ctx.Context(), rentalUID, status)
+	if !status.Valid() || (expected != "" && !expected.Valid()) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidRentalStatus.Map())
+	}
+
+	found, allowed, changed, err := d.useCase.SetRentalStatusFrom(ctx.Context(), rentalUID, expected, status)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrRentalNotFound.Map())
+	} else if !allowed {
+		return ctx.Status(fiber.StatusConflict).JSON(errors.ErrRentalStatusConflict.Map())
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(RentalStatusUpdateDTO{Changed: changed})
+}
+
+func (d *Delivery) setSurchargePayment(ctx *fiber.Ctx) error {
+	rentalUID := ctx.Params("rentalUID")
+
+	var dto SurchargeDTO
+
+	err := ctx.BodyParser(&dto)
+	if err != nil || dto.PaymentUID == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(errors.ErrInvalidSurchargeRequest.Map())
+	}
+
+	found, err := d.useCase.SetSurchargePayment(ctx.Context(), rentalUID, dto.PaymentUID)
 	if err != nil {
 		return err
 	} else if !found {
@@ -117,3 +182,19 @@ func (d *Delivery) updateRentalStatus(ctx *fiber.Ctx) error {
 
 	return ctx.SendStatus(fiber.StatusOK)
 }
+
+func (d *Delivery) getRentalStatusHistory(ctx *fiber.Ctx) error {
+	rentalUID := ctx.Params("rentalUID")
+	username := ctx.Get("X-User-Name")
+
+	history, found, permitted, err := d.useCase.GetUserRentalStatusHistory(ctx.Context(), rentalUID, username)
+	if err != nil {
+		return err
+	} else if !found {
+		return ctx.Status(fiber.StatusNotFound).JSON(errors.ErrRentalNotFound.Map())
+	} else if !permitted {
+		return ctx.Status(fiber.StatusForbidden).JSON(errors.ErrRentalNotPermitted.Map())
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(NewRentalStatusHistoryDTO(history))
+}
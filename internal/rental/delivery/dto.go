@@ -2,26 +2,29 @@ package delivery
 
 import (
 	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"time"
 )
 
 type RentalPropertiesDTO struct {
-	Username   string              `json:"username"`
-	PaymentUID string              `json:"paymentUid"`
-	CarUID     string              `json:"carUid"`
-	DateFrom   string              `json:"dateFrom"`
-	DateTo     string              `json:"dateTo"`
-	Status     models.RentalStatus `json:"status"`
+	Username       string              `json:"username"`
+	PaymentUID     string              `json:"paymentUid"`
+	CarUID         string              `json:"carUid"`
+	DateFrom       string              `json:"dateFrom"`
+	DateTo         string              `json:"dateTo"`
+	Status         models.RentalStatus `json:"status"`
+	PricingVersion string              `json:"pricingVersion,omitempty"`
 }
 
 func NewRentalPropertiesDTO(properties models.RentalProperties) RentalPropertiesDTO {
 	return RentalPropertiesDTO{
-		Username:   properties.Username,
-		PaymentUID: properties.PaymentUID,
-		CarUID:     properties.CarUID,
-		DateFrom:   properties.DateFrom.Format(time.DateOnly),
-		DateTo:     properties.DateTo.Format(time.DateOnly),
-		Status:     properties.Status,
+		Username:       properties.Username,
+		PaymentUID:     properties.PaymentUID,
+		CarUID:         properties.CarUID,
+		DateFrom:       properties.DateFrom.Format(time.DateOnly),
+		DateTo:         properties.DateTo.Format(time.DateOnly),
+		Status:         properties.Status,
+		PricingVersion: properties.PricingVersion,
 	}
 }
 
@@ -37,25 +40,48 @@ func (rental RentalPropertiesDTO) ToModel() (models.RentalProperties, error) {
 	}
 
 	return models.RentalProperties{
-		Username:   rental.Username,
-		PaymentUID: rental.PaymentUID,
-		CarUID:     rental.CarUID,
-		DateFrom:   dateFrom,
-		DateTo:     dateTo,
-		Status:     rental.Status,
+		Username:       rental.Username,
+		PaymentUID:     rental.PaymentUID,
+		CarUID:         rental.CarUID,
+		DateFrom:       dateFrom,
+		DateTo:         dateTo,
+		Status:         rental.Status,
+		PricingVersion: rental.PricingVersion,
 	}, nil
 }
 
 type RentalDTO struct {
-	ID        int64  `json:"id"`
-	RentalUID string `json:"rentalUid"`
+	ID                  int64  `json:"id"`
+	RentalUID           string `json:"rentalUid"`
+	PickedUpAt          string `json:"pickedUpAt,omitempty"`
+	ReturnedAt          string `json:"returnedAt,omitempty"`
+	SurchargePaymentUID string `json:"surchargePaymentUid,omitempty"`
 	RentalPropertiesDTO
 }
 
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
 func NewRentalDTO(rental models.Rental) RentalDTO {
 	return RentalDTO{
 		ID:                  rental.ID,
 		RentalUID:           rental.RentalUID,
+		PickedUpAt:          formatTimestamp(rental.PickedUpAt),
+		ReturnedAt:          formatTimestamp(rental.ReturnedAt),
+		SurchargePaymentUID: rental.SurchargePaymentUID,
 		RentalPropertiesDTO: NewRentalPropertiesDTO(rental.RentalProperties),
 	}
 }
@@ -66,42 +92,120 @@ func (rental RentalDTO) ToModel() (models.Rental, error) {
 		return models.Rental{}, err
 	}
 
+	pickedUpAt, err := parseTimestamp(rental.PickedUpAt)
+	if err != nil {
+		return models.Rental{}, err
+	}
+
+	returnedAt, err := parseTimestamp(rental.ReturnedAt)
+	if err != nil {
+		return models.Rental{}, err
+	}
+
 	return models.Rental{
-		ID:               rental.ID,
-		RentalUID:        rental.RentalUID,
-		RentalProperties: properties,
+		ID:                  rental.ID,
+		RentalUID:           rental.RentalUID,
+		PickedUpAt:          pickedUpAt,
+		ReturnedAt:          returnedAt,
+		SurchargePaymentUID: rental.SurchargePaymentUID,
+		RentalProperties:    properties,
 	}, nil
 }
 
+type SurchargeDTO struct {
+	PaymentUID string `json:"paymentUid"`
+}
+
 type RentalsDTO struct {
 	Items []RentalDTO `json:"items"`
 	Count uint64      `json:"count"`
+	Next  string      `json:"next,omitempty"`
+	Prev  string      `json:"prev,omitempty"`
 }
 
-func NewRentalsDTO(rentals []models.Rental, totalCount uint64) RentalsDTO {
+func NewRentalsDTO(rentals []models.Rental, info pagination.Page) RentalsDTO {
 	items := make([]RentalDTO, 0, len(rentals))
 
 	for _, rental := range rentals {
 		items = append(items, NewRentalDTO(rental))
 	}
 
-	return RentalsDTO{
+	dto := RentalsDTO{
 		Items: items,
-		Count: totalCount,
+		Count: info.TotalCount,
+	}
+
+	if info.Next != nil {
+		dto.Next = info.Next.String()
+	}
+
+	if info.Prev != nil {
+		dto.Prev = info.Prev.String()
 	}
+
+	return dto
 }
 
-func (rentals RentalsDTO) ToModel() ([]models.Rental, error) {
+func (rentals RentalsDTO) ToModel() ([]models.Rental, pagination.Page, error) {
 	res := make([]models.Rental, 0, len(rentals.Items))
 
 	for _, rental := range rentals.Items {
 		model, err := rental.ToModel()
 		if err != nil {
-			return nil, err
+			return nil, pagination.Page{}, err
 		}
 
 		res = append(res, model)
 	}
 
-	return res, nil
+	info := pagination.Page{TotalCount: rentals.Count}
+
+	if rentals.Next != "" {
+		next, err := pagination.ParseCursor(rentals.Next)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+
+		info.Next = &next
+	}
+
+	if rentals.Prev != "" {
+		prev, err := pagination.ParseCursor(rentals.Prev)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+
+		info.Prev = &prev
+	}
+
+	return res, info, nil
+}
+
+// RentalStatusUpdateDTO tells whether the rental status changed, so a repeated update can be told apart.
+type RentalStatusUpdateDTO struct {
+	Changed bool `json:"changed"`
+}
+
+type RentalStatusChangeDTO struct {
+	From      models.RentalStatus `json:"from,omitempty"`
+	To        models.RentalStatus `json:"to"`
+	ChangedAt time.Time           `json:"changedAt"`
+}
+
+type RentalStatusHistoryDTO struct {
+	Items []RentalStatusChangeDTO `json:"items"`
+}
+
+func NewRentalStatusHistoryDTO(history []models.RentalStatusChange) RentalStatusHistoryDTO {
+	items := make([]RentalStatusChangeDTO, 0, len(history))
+
+	for _, change := range history {
+		items = append(items, RentalStatusChangeDTO{
+			From:      change.From,
+			To:        change.To,
+			ChangedAt: change.ChangedAt,
+		})
+	}
+
+	return RentalStatusHistoryDTO{Items: items}
 }
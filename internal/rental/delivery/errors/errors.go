@@ -11,8 +11,13 @@ func (e RentalError) Map() map[string]any {
 }
 
 const (
-	ErrRentalNotFound       RentalError = "rental not found"
-	ErrRentalNotPermitted   RentalError = "rental not permitted"
-	ErrInvalidRentalRequest RentalError = "invalid rental request"
-	ErrConvertRentalRequest RentalError = "rental request conversion failed"
+	ErrRentalNotFound          RentalError = "rental not found"
+	ErrRentalNotPermitted      RentalError = "rental not permitted"
+	ErrInvalidRentalRequest    RentalError = "invalid rental request"
+	ErrConvertRentalRequest    RentalError = "rental request conversion failed"
+	ErrInvalidPage             RentalError = "invalid page request"
+	ErrInvalidRentalStatus     RentalError = "invalid rental status"
+	ErrRentalStatusConflict    RentalError = "rental status transition not allowed"
+	ErrInvalidExpiryTime       RentalError = "invalid reservation expiry time"
+	ErrInvalidSurchargeRequest RentalError = "invalid surcharge request"
 )
@@ -0,0 +1,183 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/rental/usecase"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/google/uuid"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"time"
+)
+
+// ConformanceSuite holds the behaviour every repository implementation must have.
+type ConformanceSuite struct {
+	suite.Suite
+	repo usecase.Repository
+}
+
+func (s *ConformanceSuite) newRental(t provider.T, username string, status models.RentalStatus, from time.Time) models.Rental {
+	rental, err := s.repo.CreateRental(context.Background(), models.RentalProperties{
+		Username:       username,
+		PaymentUID:     uuid.NewString(),
+		CarUID:         uuid.NewString(),
+		DateFrom:       from,
+		DateTo:         from.AddDate(0, 0, 3),
+		Status:         status,
+		PricingVersion: "v1",
+	})
+	t.Require().NoError(err)
+
+	return rental
+}
+
+func (s *ConformanceSuite) TestCreateAndGetRental(t provider.T) {
+	t.Epic("Rentals")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	username := uuid.NewString()
+	from := time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+	// act
+	created := s.newRental(t, username, models.RentalReserved, from)
+	stored, found, err := s.repo.GetRental(ctx, created.RentalUID)
+	t.Require().NoError(err)
+	_, userFound, permitted, err := s.repo.GetUserRental(ctx, created.RentalUID, username)
+	t.Require().NoError(err)
+	_, otherFound, otherPermitted, err := s.repo.GetUserRental(ctx, created.RentalUID, "other")
+	t.Require().NoError(err)
+	_, unknownFound, err := s.repo.GetRental(ctx, uuid.NewString())
+	t.Require().NoError(err)
+	history, err := s.repo.GetRentalStatusHistory(ctx, created.RentalUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().True(found)
+	t.Require().Equal(created.RentalUID, stored.RentalUID)
+	t.Require().Equal(username, stored.Username)
+	t.Require().Equal(models.RentalReserved, stored.Status)
+	t.Require().Equal("v1", stored.PricingVersion)
+	t.Require().True(from.Equal(stored.DateFrom))
+	t.Require().True(stored.PickedUpAt.IsZero())
+	t.Require().True(userFound)
+	t.Require().True(permitted)
+	t.Require().True(otherFound)
+	t.Require().False(otherPermitted)
+	t.Require().False(unknownFound)
+	t.Require().Len(history, 1)
+	t.Require().Equal(models.RentalStatusChange{To: models.RentalReserved}, models.RentalStatusChange{From: history[0].From, To: history[0].To})
+}
+
+func (s *ConformanceSuite) TestUpdateRentalStatusChecksVersion(t provider.T) {
+	t.Epic("Rentals")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	rental := s.newRental(t, uuid.NewString(), models.RentalReserved, time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC))
+	// act
+	updated, err := s.repo.UpdateRentalStatus(ctx, rental, models.RentalInProgress)
+	t.Require().NoError(err)
+	stale, err := s.repo.UpdateRentalStatus(ctx, rental, models.RentalCanceled)
+	t.Require().NoError(err)
+	stored, _, err := s.repo.GetRental(ctx, rental.RentalUID)
+	t.Require().NoError(err)
+	history, err := s.repo.GetRentalStatusHistory(ctx, rental.RentalUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().True(updated)
+	t.Require().False(stale)
+	t.Require().Equal(models.RentalInProgress, stored.Status)
+	t.Require().Equal(rental.Version+1, stored.Version)
+	t.Require().False(stored.PickedUpAt.IsZero())
+	t.Require().True(stored.ReturnedAt.IsZero())
+	t.Require().Len(history, 2)
+	t.Require().Equal(models.RentalReserved, history[1].From)
+	t.Require().Equal(models.RentalInProgress, history[1].To)
+}
+
+func (s *ConformanceSuite) TestGetUserRentalsPages(t provider.T) {
+	t.Epic("Rentals")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	username := uuid.NewString()
+	from := time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC)
+	rentals := make([]string, 0, 3)
+
+	for i := range 3 {
+		rentals = append(rentals, s.newRental(t, username, models.RentalReserved, from.AddDate(0, 0, i)).RentalUID)
+	}
+
+	s.newRental(t, uuid.NewString(), models.RentalReserved, from)
+	// act
+	first, firstInfo, err := s.repo.GetUserRentals(ctx, username, pagination.Request{Limit: 2})
+	t.Require().NoError(err)
+	second, secondInfo, err := s.repo.GetUserRentals(ctx, username, pagination.Request{Limit: 2, Cursor: firstInfo.Next})
+	t.Require().NoError(err)
+	back, _, err := s.repo.GetUserRentals(ctx, username, pagination.Request{Limit: 2, Cursor: secondInfo.Prev})
+	t.Require().NoError(err)
+	// assert
+	t.Require().Equal(uint64(3), firstInfo.TotalCount)
+	t.Require().Equal(rentals[:2], rentalUIDs(first))
+	t.Require().Nil(firstInfo.Prev)
+	t.Require().Equal(rentals[2:], rentalUIDs(second))
+	t.Require().Nil(secondInfo.Next)
+	t.Require().Equal(rentals[:2], rentalUIDs(back))
+}
+
+func (s *ConformanceSuite) TestGetExpiredReservations(t provider.T) {
+	t.Epic("Rentals")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	username := uuid.NewString()
+	from := time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC)
+	expired := s.newRental(t, username, models.RentalReserved, from)
+	started := s.newRental(t, username, models.RentalInProgress, from)
+	upcoming := s.newRental(t, username, models.RentalReserved, from.AddDate(0, 0, 2))
+	// act
+	rentals, err := s.repo.GetExpiredReservations(ctx, from.AddDate(0, 0, 1), pagination.MaxLimit)
+	t.Require().NoError(err)
+	// assert
+	uids := rentalUIDs(rentals)
+	t.Require().Contains(uids, expired.RentalUID)
+	t.Require().NotContains(uids, started.RentalUID)
+	t.Require().NotContains(uids, upcoming.RentalUID)
+	t.Require().False(started.PickedUpAt.IsZero())
+}
+
+func (s *ConformanceSuite) TestSetSurchargePayment(t provider.T) {
+	t.Epic("Rentals")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	rental := s.newRental(t, uuid.NewString(), models.RentalFinished, time.Date(2030, 5, 1, 0, 0, 0, 0, time.UTC))
+	paymentUID := uuid.NewString()
+	// act
+	found, err := s.repo.SetSurchargePayment(ctx, rental.RentalUID, paymentUID)
+	t.Require().NoError(err)
+	unknown, err := s.repo.SetSurchargePayment(ctx, uuid.NewString(), paymentUID)
+	t.Require().NoError(err)
+	stored, _, err := s.repo.GetRental(ctx, rental.RentalUID)
+	t.Require().NoError(err)
+	// assert
+	t.Require().True(found)
+	t.Require().False(unknown)
+	t.Require().Equal(paymentUID, stored.SurchargePaymentUID)
+}
+
+func rentalUIDs(rentals []models.Rental) []string {
+	uids := make([]string, 0, len(rentals))
+
+	for _, rental := range rentals {
+		uids = append(uids, rental.RentalUID)
+	}
+
+	return uids
+}
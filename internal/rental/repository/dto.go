@@ -1,68 +1,101 @@
 package repository
 
 import (
+	"database/sql"
 	"github.com/Inspirate789/ds-lab2/internal/models"
 	"time"
 )
 
 type RentalPropertiesDTO struct {
-	Username   string              `db:"username"`
-	PaymentUID string              `db:"payment_uid"`
-	CarUID     string              `db:"car_uid"`
-	DateFrom   time.Time           `db:"date_from"`
-	DateTo     time.Time           `db:"date_to"`
-	Status     models.RentalStatus `db:"status"`
-	TotalCount uint64              `db:"total_count"`
+	Username       string              `db:"username"`
+	PaymentUID     string              `db:"payment_uid"`
+	CarUID         string              `db:"car_uid"`
+	DateFrom       time.Time           `db:"date_from"`
+	DateTo         time.Time           `db:"date_to"`
+	Status         models.RentalStatus `db:"status"`
+	PricingVersion string              `db:"pricing_version"`
 }
 
 func NewRentalPropertiesDTO(properties models.RentalProperties) RentalPropertiesDTO {
 	return RentalPropertiesDTO{
-		Username:   properties.Username,
-		PaymentUID: properties.PaymentUID,
-		CarUID:     properties.CarUID,
-		DateFrom:   properties.DateFrom,
-		DateTo:     properties.DateTo,
-		Status:     properties.Status,
+		Username:       properties.Username,
+		PaymentUID:     properties.PaymentUID,
+		CarUID:         properties.CarUID,
+		DateFrom:       properties.DateFrom,
+		DateTo:         properties.DateTo,
+		Status:         properties.Status,
+		PricingVersion: properties.PricingVersion,
 	}
 }
 
 func (rental RentalPropertiesDTO) ToModel() models.RentalProperties {
 	return models.RentalProperties{
-		Username:   rental.Username,
-		PaymentUID: rental.PaymentUID,
-		CarUID:     rental.CarUID,
-		DateFrom:   rental.DateFrom,
-		DateTo:     rental.DateTo,
-		Status:     rental.Status,
+		Username:       rental.Username,
+		PaymentUID:     rental.PaymentUID,
+		CarUID:         rental.CarUID,
+		DateFrom:       rental.DateFrom,
+		DateTo:         rental.DateTo,
+		Status:         rental.Status,
+		PricingVersion: rental.PricingVersion,
 	}
 }
 
 type RentalDTO struct {
-	ID        int64  `db:"id"`
-	RentalUID string `db:"rental_uid"`
+	ID                  int64          `db:"id"`
+	RentalUID           string         `db:"rental_uid"`
+	Version             int64          `db:"version"`
+	PickedUpAt          sql.NullTime   `db:"picked_up_at"`
+	ReturnedAt          sql.NullTime   `db:"returned_at"`
+	SurchargePaymentUID sql.NullString `db:"surcharge_payment_uid"`
 	RentalPropertiesDTO
 }
 
 func (rental RentalDTO) ToModel() models.Rental {
 	return models.Rental{
-		ID:               rental.ID,
-		RentalUID:        rental.RentalUID,
-		RentalProperties: rental.RentalPropertiesDTO.ToModel(),
+		ID:                  rental.ID,
+		RentalUID:           rental.RentalUID,
+		Version:             rental.Version,
+		PickedUpAt:          rental.PickedUpAt.Time,
+		ReturnedAt:          rental.ReturnedAt.Time,
+		SurchargePaymentUID: rental.SurchargePaymentUID.String,
+		RentalProperties:    rental.RentalPropertiesDTO.ToModel(),
 	}
 }
 
 type RentalsDTO []RentalDTO
 
-func (rentals RentalsDTO) ToModel() ([]models.Rental, uint64) {
+func (rentals RentalsDTO) ToModel() []models.Rental {
 	result := make([]models.Rental, 0, len(rentals))
 
 	for _, rental := range rentals {
 		result = append(result, rental.ToModel())
 	}
 
-	if len(rentals) != 0 {
-		return result, rentals[0].TotalCount
-	} else {
-		return result, 0
+	return result
+}
+
+type RentalStatusChangeDTO struct {
+	From      sql.NullString      `db:"status_from"`
+	To        models.RentalStatus `db:"status_to"`
+	ChangedAt time.Time           `db:"changed_at"`
+}
+
+func (change RentalStatusChangeDTO) ToModel() models.RentalStatusChange {
+	return models.RentalStatusChange{
+		From:      models.RentalStatus(change.From.String),
+		To:        change.To,
+		ChangedAt: change.ChangedAt,
+	}
+}
+
+type RentalStatusHistoryDTO []RentalStatusChangeDTO
+
+func (history RentalStatusHistoryDTO) ToModel() []models.RentalStatusChange {
+	result := make([]models.RentalStatusChange, 0, len(history))
+
+	for _, change := range history {
+		result = append(result, change.ToModel())
 	}
+
+	return result
 }
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/google/uuid"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryRepository keeps the rentals in memory with the semantics of SqlxRepository, for tests and demos
+// without a database. Events are not published.
+type MemoryRepository struct {
+	mu      sync.RWMutex
+	rentals []models.Rental // in id order
+	history map[string][]models.RentalStatusChange
+	lastID  int64
+	logger  *slog.Logger
+}
+
+func NewMemoryRepository(logger *slog.Logger) *MemoryRepository {
+	return &MemoryRepository{
+		history: make(map[string][]models.RentalStatusChange),
+		logger:  logger,
+	}
+}
+
+func (r *MemoryRepository) HealthCheck(context.Context) error {
+	return nil
+}
+
+func (r *MemoryRepository) GetUserRentals(_ context.Context, username string, page pagination.Request) ([]models.Rental, pagination.Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rentals := make([]models.Rental, 0)
+
+	for _, rental := range r.rentals {
+		if rental.Username == username {
+			rentals = append(rentals, rental)
+		}
+	}
+
+	return paginateRentals(rentals, page)
+}
+
+func (r *MemoryRepository) GetRentals(_ context.Context, page pagination.Request) ([]models.Rental, pagination.Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return paginateRentals(r.rentals, page)
+}
+
+func paginateRentals(rentals []models.Rental, page pagination.Request) ([]models.Rental, pagination.Page, error) {
+	id := func(rental models.Rental) int64 { return rental.ID }
+	res, info := pagination.Paginate(pagination.Window(rentals, page, id), page, id)
+	info.TotalCount = uint64(len(rentals))
+
+	return res, info, nil
+}
+
+func (r *MemoryRepository) GetExpiredReservations(_ context.Context, before time.Time, limit uint64) ([]models.Rental, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]models.Rental, 0)
+
+	for _, rental := range r.rentals {
+		if rental.Status == models.RentalReserved && rental.DateFrom.Before(before) {
+			res = append(res, rental)
+		}
+	}
+
+	slices.SortStableFunc(res, func(a, b models.Rental) int { return a.DateFrom.Compare(b.DateFrom) })
+
+	return res[:min(uint64(len(res)), limit)], nil
+}
+
+func (r *MemoryRepository) CreateRental(_ context.Context, properties models.RentalProperties) (models.Rental, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	rental := models.Rental{
+		ID:               r.lastID,
+		RentalUID:        uuid.New().String(),
+		RentalProperties: properties,
+	}
+
+	now := time.Now()
+	if rental.Status == models.RentalInProgress {
+		rental.PickedUpAt = now
+	}
+
+	r.rentals = append(r.rentals, rental)
+	r.history[rental.RentalUID] = []models.RentalStatusChange{{To: rental.Status, ChangedAt: now}}
+
+	return rental, nil
+}
+
+func (r *MemoryRepository) GetRental(_ context.Context, rentalUID string) (models.Rental, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.rental(rentalUID)
+	if i < 0 {
+		return models.Rental{}, false, nil
+	}
+
+	return r.rentals[i], true, nil
+}
+
+func (r *MemoryRepository) GetUserRental(_ context.Context, rentalUID, username string) (res models.Rental, found, permitted bool, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.rental(rentalUID)
+	if i < 0 {
+		return models.Rental{}, false, false, nil
+	} else if r.rentals[i].Username != username {
+		return models.Rental{}, true, false, nil
+	}
+
+	return r.rentals[i], true, true, nil
+}
+
+func (r *MemoryRepository) UpdateRentalStatus(_ context.Context, rental models.Rental, status models.RentalStatus) (updated bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.rental(rental.RentalUID)
+	if i < 0 || r.rentals[i].Version != rental.Version {
+		return false, nil
+	}
+
+	stored := &r.rentals[i]
+	now := time.Now()
+
+	switch status {
+	case models.RentalInProgress:
+		stored.PickedUpAt = now
+	case models.RentalFinished:
+		stored.ReturnedAt = now
+	}
+
+	r.history[stored.RentalUID] = append(r.history[stored.RentalUID], models.RentalStatusChange{
+		From:      rental.Status,
+		To:        status,
+		ChangedAt: now,
+	})
+	stored.Status = status
+	stored.Version++
+
+	return true, nil
+}
+
+func (r *MemoryRepository) SetSurchargePayment(_ context.Context, rentalUID, paymentUID string) (found bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.rental(rentalUID)
+	if i < 0 {
+		return false, nil
+	}
+
+	r.rentals[i].SurchargePaymentUID = paymentUID
+
+	return true, nil
+}
+
+func (r *MemoryRepository) GetRentalStatusHistory(_ context.Context, rentalUID string) ([]models.RentalStatusChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append(make([]models.RentalStatusChange, 0), r.history[rentalUID]...), nil
+}
+
+func (r *MemoryRepository) rental(rentalUID string) int {
+	return slices.IndexFunc(r.rentals, func(rental models.Rental) bool { return rental.RentalUID == rentalUID })
+}
@@ -1,14 +1,40 @@
 package repository
 
 const (
-	// WARNING: when OFFSET is at least as great as the number of rows returned from the base query, no rows are returned.
-	// So we get no full_count, either. If that's a rare case, just run a second query for the count in this case.
-	selectRentalsQuery = `select *, count(*) over () as total_count from rentals where username = $3 offset $1 limit $2;`
-	selectRentalQuery  = `select * from rentals where rental_uid = $1 limit 1;`
-	insertRentalQuery  = `
-		insert into rentals(rental_uid, username, payment_uid, car_uid, date_from, date_to, status) 
-		values (:rental_uid, :username, :payment_uid, :car_uid, :date_from, :date_to, :status) 
+	selectRentalsQuery             = `select * from rentals where username = $1 and id > $2 and id < $3 order by id offset $4 limit $5;`
+	selectRentalsBackwardQuery     = `select * from rentals where username = $1 and id > $2 and id < $3 order by id desc offset $4 limit $5;`
+	countRentalsQuery              = `select count(*) from rentals where username = $1;`
+	selectAllRentalsQuery          = `select * from rentals where id > $1 and id < $2 order by id offset $3 limit $4;`
+	selectAllRentalsBackwardQuery  = `select * from rentals where id > $1 and id < $2 order by id desc offset $3 limit $4;`
+	countAllRentalsQuery           = `select count(*) from rentals;`
+	selectExpiredReservationsQuery = `
+		select * from rentals
+		where status = 'RESERVED' and date_from < $1
+		order by date_from
+		limit $2;
+	`
+	selectRentalQuery = `select * from rentals where rental_uid = $1 limit 1;`
+	insertRentalQuery = `
+		insert into rentals(rental_uid, username, payment_uid, car_uid, date_from, date_to, status, pricing_version, picked_up_at) 
+		values (
+			:rental_uid, :username, :payment_uid, :car_uid, :date_from, :date_to, :status, :pricing_version,
+			case when :status = 'IN_PROGRESS' then now() end
+		) 
 		returning *;
 	`
-	updateRentalStatusQuery = `update rentals set status = $2 where rental_uid = $1;`
+	updateRentalStatusQuery = `
+		update rentals set
+			status = $3,
+			version = version + 1,
+			picked_up_at = case when $3 = 'IN_PROGRESS' then now() else picked_up_at end,
+			returned_at = case when $3 = 'FINISHED' then now() else returned_at end
+		where rental_uid = $1 and version = $2;
+	`
+	updateSurchargePaymentQuery = `update rentals set surcharge_payment_uid = $2 where rental_uid = $1 returning *;`
+	insertStatusChangeQuery     = `insert into rental_status_history(rental_uid, status_from, status_to) values ($1, $2, $3);`
+	selectStatusHistoryQuery    = `
+		select status_from, status_to, changed_at from rental_status_history
+		where rental_uid = $1
+		order by id;
+	`
 )
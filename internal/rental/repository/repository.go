@@ -5,18 +5,21 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/outbox"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"github.com/Inspirate789/ds-lab2/pkg/sqlxutils"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"log/slog"
+	"time"
 )
 
 type SqlxRepository struct {
-	db     *sqlx.DB
+	db     *sqlxutils.DB
 	logger *slog.Logger
 }
 
-func NewSqlxRepository(db *sqlx.DB, logger *slog.Logger) *SqlxRepository {
+func NewSqlxRepository(db *sqlxutils.DB, logger *slog.Logger) *SqlxRepository {
 	return &SqlxRepository{
 		db:     db,
 		logger: logger,
@@ -27,19 +30,63 @@ func (r *SqlxRepository) HealthCheck(ctx context.Context) error {
 	return r.db.PingContext(ctx)
 }
 
-func (r *SqlxRepository) GetUserRentals(ctx context.Context, username string, offset, limit uint64) ([]models.Rental, uint64, error) {
+func (r *SqlxRepository) GetUserRentals(ctx context.Context, username string, page pagination.Request) ([]models.Rental, pagination.Page, error) {
+	query := selectRentalsQuery
+	if page.Backward() {
+		query = selectRentalsBackwardQuery
+	}
+
+	after, before := page.Bounds()
 	rentals := make(RentalsDTO, 0)
 
-	err := sqlxutils.Select(ctx, r.db, &rentals, selectRentalsQuery, offset, limit, username)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, 0, nil
-	} else if err != nil {
-		return nil, 0, err
+	err := sqlxutils.Select(ctx, r.db.Reader(), &rentals, query, username, after, before, page.Offset, page.Limit+1)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	rentals, info := pagination.Paginate(rentals, page, func(rental RentalDTO) int64 { return rental.ID })
+
+	err = sqlxutils.Get(ctx, r.db.Reader(), &info.TotalCount, countRentalsQuery, username)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	return rentals.ToModel(), info, nil
+}
+
+func (r *SqlxRepository) GetRentals(ctx context.Context, page pagination.Request) ([]models.Rental, pagination.Page, error) {
+	query := selectAllRentalsQuery
+	if page.Backward() {
+		query = selectAllRentalsBackwardQuery
+	}
+
+	after, before := page.Bounds()
+	rentals := make(RentalsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db.Reader(), &rentals, query, after, before, page.Offset, page.Limit+1)
+	if err != nil {
+		return nil, pagination.Page{}, err
 	}
 
-	model, totalCount := rentals.ToModel()
+	rentals, info := pagination.Paginate(rentals, page, func(rental RentalDTO) int64 { return rental.ID })
+
+	err = sqlxutils.Get(ctx, r.db.Reader(), &info.TotalCount, countAllRentalsQuery)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
 
-	return model, totalCount, nil
+	return rentals.ToModel(), info, nil
+}
+
+func (r *SqlxRepository) GetExpiredReservations(ctx context.Context, before time.Time, limit uint64) ([]models.Rental, error) {
+	rentals := make(RentalsDTO, 0)
+
+	err := sqlxutils.Select(ctx, r.db, &rentals, selectExpiredReservationsQuery, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return rentals.ToModel(), nil
 }
 
 func (r *SqlxRepository) CreateRental(ctx context.Context, properties models.RentalProperties) (models.Rental, error) {
@@ -49,7 +96,19 @@ func (r *SqlxRepository) CreateRental(ctx context.Context, properties models.Ren
 		RentalPropertiesDTO: NewRentalPropertiesDTO(properties),
 	}
 
-	err := sqlxutils.NamedGet(ctx, r.db, &dto, insertRentalQuery, &dto)
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		err := sqlxutils.NamedGet(ctx, tx, &dto, insertRentalQuery, &dto)
+		if err != nil {
+			return err
+		}
+
+		_, err = sqlxutils.Exec(ctx, tx, insertStatusChangeQuery, dto.RentalUID, nil, dto.Status)
+		if err != nil {
+			return err
+		}
+
+		return writeRentalEvent(ctx, tx, models.EventRentalCreated, dto.ToModel(), "")
+	})
 	if err != nil {
 		return models.Rental{}, err
 	}
@@ -57,6 +116,19 @@ func (r *SqlxRepository) CreateRental(ctx context.Context, properties models.Ren
 	return dto.ToModel(), nil
 }
 
+func (r *SqlxRepository) GetRental(ctx context.Context, rentalUID string) (models.Rental, bool, error) {
+	var dto RentalDTO
+
+	err := sqlxutils.Get(ctx, r.db, &dto, selectRentalQuery, rentalUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Rental{}, false, nil
+	} else if err != nil {
+		return models.Rental{}, false, err
+	}
+
+	return dto.ToModel(), true, nil
+}
+
 func (r *SqlxRepository) GetUserRental(ctx context.Context, rentalUID, username string) (res models.Rental, found, permitted bool, err error) {
 	var dto RentalDTO
 
@@ -72,16 +144,80 @@ func (r *SqlxRepository) GetUserRental(ctx context.Context, rentalUID, username
 	return dto.ToModel(), true, true, nil
 }
 
-func (r *SqlxRepository) SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found bool, err error) {
-	res, err := sqlxutils.Exec(ctx, r.db, updateRentalStatusQuery, rentalUID, status)
-	if err != nil {
-		return false, err
-	}
+func (r *SqlxRepository) UpdateRentalStatus(ctx context.Context, rental models.Rental, status models.RentalStatus) (updated bool, err error) {
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		updated = false // the transaction may be run again
+
+		res, err := sqlxutils.Exec(ctx, tx, updateRentalStatusQuery, rental.RentalUID, rental.Version, status)
+		if err != nil {
+			return err
+		}
+
+		rowsCount, err := res.RowsAffected()
+		if err != nil {
+			return err
+		} else if rowsCount == 0 {
+			return nil
+		}
+
+		_, err = sqlxutils.Exec(ctx, tx, insertStatusChangeQuery, rental.RentalUID, rental.Status, status)
+		if err != nil {
+			return err
+		}
+
+		changed := rental
+		changed.Status = status
+
+		err = writeRentalEvent(ctx, tx, models.RentalEventType(status), changed, rental.Status)
+		if err != nil {
+			return err
+		}
+
+		updated = true
+
+		return nil
+	})
+
+	return updated, err
+}
+
+func (r *SqlxRepository) SetSurchargePayment(ctx context.Context, rentalUID, paymentUID string) (found bool, err error) {
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		found = false // the transaction may be run again
+
+		var dto RentalDTO
+
+		err := sqlxutils.Get(ctx, tx, &dto, updateSurchargePaymentQuery, rentalUID, paymentUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		found = true
+
+		return writeRentalEvent(ctx, tx, models.EventRentalSurchargeSet, dto.ToModel(), "")
+	})
+
+	return found, err
+}
+
+func writeRentalEvent(ctx context.Context, tx *sqlx.Tx, eventType string, rental models.Rental, previous models.RentalStatus) error {
+	return outbox.Write(ctx, tx, outbox.Event{
+		AggregateType: models.AggregateRental,
+		AggregateUID:  rental.RentalUID,
+		Type:          eventType,
+		Payload:       models.NewRentalEvent(rental, previous),
+	})
+}
+
+func (r *SqlxRepository) GetRentalStatusHistory(ctx context.Context, rentalUID string) ([]models.RentalStatusChange, error) {
+	history := make(RentalStatusHistoryDTO, 0)
 
-	rowsCount, err := res.RowsAffected()
+	err := sqlxutils.Select(ctx, r.db.Reader(), &history, selectStatusHistoryQuery, rentalUID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return rowsCount != 0, err
+	return history.ToModel(), nil
 }
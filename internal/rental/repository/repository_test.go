@@ -0,0 +1,40 @@
+package repository_test
+
+import (
+	"github.com/Inspirate789/ds-lab2/internal/rental/repository"
+	"github.com/Inspirate789/ds-lab2/pkg/migrations"
+	"github.com/Inspirate789/ds-lab2/pkg/postgrestest"
+	"github.com/Inspirate789/ds-lab2/pkg/sqlxutils"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+type SqlxRepositorySuite struct {
+	ConformanceSuite
+	dsn string
+	db  *sqlx.DB
+}
+
+func (s *SqlxRepositorySuite) BeforeAll(t provider.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	err := migrations.Do(s.dsn, "../../../migrations/rental", logger)
+	t.Require().NoError(err)
+
+	s.db, err = sqlx.Connect("postgres", s.dsn)
+	t.Require().NoError(err)
+
+	s.repo = repository.NewSqlxRepository(sqlxutils.NewDB(s.db, nil), logger)
+}
+
+func (s *SqlxRepositorySuite) AfterAll(t provider.T) {
+	t.Require().NoError(s.db.Close())
+}
+
+func TestSqlxRepository(t *testing.T) {
+	suite.RunSuite(t, &SqlxRepositorySuite{dsn: postgrestest.Start(t, "rentals")})
+}
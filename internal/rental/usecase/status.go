@@ -0,0 +1,20 @@
+package usecase
+
+import "github.com/Inspirate789/ds-lab2/internal/models"
+
+// transitions lists the statuses a rental may move to from each status.
+// FINISHED and CANCELED are terminal.
+var transitions = map[models.RentalStatus][]models.RentalStatus{
+	models.RentalReserved:   {models.RentalInProgress, models.RentalCanceled},
+	models.RentalInProgress: {models.RentalFinished, models.RentalCanceled},
+}
+
+func canTransition(from, to models.RentalStatus) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
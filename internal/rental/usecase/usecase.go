@@ -3,15 +3,22 @@ package usecase
 import (
 	"context"
 	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
 	"log/slog"
+	"time"
 )
 
 type Repository interface {
 	HealthCheck(ctx context.Context) error
-	GetUserRentals(ctx context.Context, username string, offset, limit uint64) (res []models.Rental, totalCount uint64, err error)
+	GetUserRentals(ctx context.Context, username string, page pagination.Request) (res []models.Rental, info pagination.Page, err error)
 	GetUserRental(ctx context.Context, rentalUID, username string) (res models.Rental, found, permitted bool, err error)
+	GetRentals(ctx context.Context, page pagination.Request) (res []models.Rental, info pagination.Page, err error)
+	GetExpiredReservations(ctx context.Context, before time.Time, limit uint64) (res []models.Rental, err error)
 	CreateRental(ctx context.Context, properties models.RentalProperties) (res models.Rental, err error)
-	SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found bool, err error)
+	GetRental(ctx context.Context, rentalUID string) (res models.Rental, found bool, err error)
+	UpdateRentalStatus(ctx context.Context, rental models.Rental, status models.RentalStatus) (updated bool, err error)
+	SetSurchargePayment(ctx context.Context, rentalUID, paymentUID string) (found bool, err error)
+	GetRentalStatusHistory(ctx context.Context, rentalUID string) (res []models.RentalStatusChange, err error)
 }
 
 type UseCase struct {
@@ -30,18 +37,78 @@ func (u *UseCase) HealthCheck(ctx context.Context) error {
 	return u.repo.HealthCheck(ctx)
 }
 
-func (u *UseCase) GetUserRentals(ctx context.Context, username string, offset, limit uint64) (res []models.Rental, totalCount uint64, err error) {
-	return u.repo.GetUserRentals(ctx, username, offset, limit)
+func (u *UseCase) GetUserRentals(ctx context.Context, username string, page pagination.Request) (res []models.Rental, info pagination.Page, err error) {
+	return u.repo.GetUserRentals(ctx, username, page)
 }
 
 func (u *UseCase) GetUserRental(ctx context.Context, rentalUID, username string) (res models.Rental, found, permitted bool, err error) {
 	return u.repo.GetUserRental(ctx, rentalUID, username)
 }
 
+func (u *UseCase) GetRentals(ctx context.Context, page pagination.Request) (res []models.Rental, info pagination.Page, err error) {
+	return u.repo.GetRentals(ctx, page)
+}
+
+func (u *UseCase) GetExpiredReservations(ctx context.Context, before time.Time, limit uint64) (res []models.Rental, err error) {
+	return u.repo.GetExpiredReservations(ctx, before, limit)
+}
+
 func (u *UseCase) CreateRental(ctx context.Context, properties models.RentalProperties) (res models.Rental, err error) {
 	return u.repo.CreateRental(ctx, properties)
 }
 
-func (u *UseCase) SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found bool, err error) {
-	return u.repo.SetRentalStatus(ctx, rentalUID, status)
+func (u *UseCase) SetRentalStatus(ctx context.Context, rentalUID string, status models.RentalStatus) (found, allowed, changed bool, err error) {
+	return u.SetRentalStatusFrom(ctx, rentalUID, "", status)
+}
+
+// SetRentalStatusFrom moves the rental to the status only if it is currently in the expected one
+// (any status, if expected is empty). A rental already in the status is reported as unchanged.
+func (u *UseCase) SetRentalStatusFrom(ctx context.Context, rentalUID string, expected, status models.RentalStatus) (found, allowed, changed bool, err error) {
+	const maxAttempts = 3
+
+	for range maxAttempts {
+		rental, found, err := u.repo.GetRental(ctx, rentalUID)
+		if err != nil || !found {
+			return false, false, false, err
+		}
+
+		if rental.Status == status {
+			return true, true, false, nil
+		} else if expected != "" && rental.Status != expected {
+			return true, false, false, nil
+		} else if !canTransition(rental.Status, status) {
+			return true, false, false, nil
+		}
+
+		updated, err := u.repo.UpdateRentalStatus(ctx, rental, status)
+		if err != nil {
+			return true, false, false, err
+		} else if updated {
+			return true, true, true, nil
+		}
+
+		u.logger.Debug("rental status changed concurrently, retry",
+			slog.String("rental_uid", rentalUID),
+			slog.String("status", string(status)),
+		)
+	}
+
+	u.logger.Warn("give up changing rental status after concurrent updates", slog.String("rental_uid", rentalUID))
+
+	return true, false, false, nil
+}
+
+func (u *UseCase) SetSurchargePayment(ctx context.Context, rentalUID, paymentUID string) (found bool, err error) {
+	return u.repo.SetSurchargePayment(ctx, rentalUID, paymentUID)
+}
+
+func (u *UseCase) GetUserRentalStatusHistory(ctx context.Context, rentalUID, username string) (res []models.RentalStatusChange, found, permitted bool, err error) {
+	_, found, permitted, err = u.repo.GetUserRental(ctx, rentalUID, username)
+	if err != nil || !found || !permitted {
+		return nil, found, permitted, err
+	}
+
+	res, err = u.repo.GetRentalStatusHistory(ctx, rentalUID)
+
+	return res, true, true, err
 }
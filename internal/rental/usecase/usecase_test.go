@@ -0,0 +1,257 @@
+package usecase_test
+
+import (
+	"context"
+	"github.com/Inspirate789/ds-lab2/internal/models"
+	"github.com/Inspirate789/ds-lab2/internal/rental/repository"
+	"github.com/Inspirate789/ds-lab2/internal/rental/usecase"
+	"github.com/google/uuid"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+const username = "Test Max"
+
+// racingRepository reports every status update as lost to a concurrent one.
+type racingRepository struct {
+	*repository.MemoryRepository
+}
+
+func (r racingRepository) UpdateRentalStatus(context.Context, models.Rental, models.RentalStatus) (bool, error) {
+	return false, nil
+}
+
+func newLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+}
+
+// rentalIn creates a rental and moves it to the status.
+func rentalIn(t provider.StepCtx, useCase *usecase.UseCase, status models.RentalStatus) models.Rental {
+	ctx := context.Background()
+
+	initial := models.RentalReserved
+	if status == models.RentalInProgress || status == models.RentalFinished {
+		initial = models.RentalInProgress
+	}
+
+	rental, err := useCase.CreateRental(ctx, models.RentalProperties{
+		Username:   username,
+		PaymentUID: uuid.NewString(),
+		CarUID:     uuid.NewString(),
+		DateFrom:   time.Now().AddDate(0, 0, 1),
+		DateTo:     time.Now().AddDate(0, 0, 3),
+		Status:     initial,
+	})
+	t.Require().NoError(err)
+
+	if status != initial {
+		_, allowed, changed, err := useCase.SetRentalStatus(ctx, rental.RentalUID, status)
+		t.Require().NoError(err)
+		t.Require().True(allowed)
+		t.Require().True(changed)
+	}
+
+	return rental
+}
+
+func statusOf(t provider.StepCtx, useCase *usecase.UseCase, rentalUID string) models.RentalStatus {
+	rental, found, _, err := useCase.GetUserRental(context.Background(), rentalUID, username)
+	t.Require().NoError(err)
+	t.Require().True(found)
+
+	return rental.Status
+}
+
+type UseCaseSuite struct {
+	suite.Suite
+}
+
+func (s *UseCaseSuite) TestSetRentalStatus(t provider.T) {
+	t.Epic("Rentals")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+	statuses := []models.RentalStatus{
+		models.RentalReserved,
+		models.RentalInProgress,
+		models.RentalFinished,
+		models.RentalCanceled,
+	}
+
+	tests := []struct {
+		from, to         models.RentalStatus
+		allowed, changed bool
+	}{
+		{from: models.RentalReserved, to: models.RentalReserved, allowed: true},
+		{from: models.RentalReserved, to: models.RentalInProgress, allowed: true, changed: true},
+		{from: models.RentalReserved, to: models.RentalFinished},
+		{from: models.RentalReserved, to: models.RentalCanceled, allowed: true, changed: true},
+		{from: models.RentalInProgress, to: models.RentalReserved},
+		{from: models.RentalInProgress, to: models.RentalInProgress, allowed: true},
+		{from: models.RentalInProgress, to: models.RentalFinished, allowed: true, changed: true},
+		{from: models.RentalInProgress, to: models.RentalCanceled, allowed: true, changed: true},
+		{from: models.RentalFinished, to: models.RentalReserved},
+		{from: models.RentalFinished, to: models.RentalInProgress},
+		{from: models.RentalFinished, to: models.RentalFinished, allowed: true},
+		{from: models.RentalFinished, to: models.RentalCanceled},
+		{from: models.RentalCanceled, to: models.RentalReserved},
+		{from: models.RentalCanceled, to: models.RentalInProgress},
+		{from: models.RentalCanceled, to: models.RentalFinished},
+		{from: models.RentalCanceled, to: models.RentalCanceled, allowed: true},
+	}
+	t.Require().Len(tests, len(statuses)*len(statuses))
+
+	for _, test := range tests {
+		t.WithNewStep(string(test.from)+" to "+string(test.to), func(sCtx provider.StepCtx) {
+			// arrange
+			useCase := usecase.New(repository.NewMemoryRepository(newLogger()), newLogger())
+			rental := rentalIn(sCtx, useCase, test.from)
+			// act
+			found, allowed, changed, err := useCase.SetRentalStatus(ctx, rental.RentalUID, test.to)
+			// assert
+			sCtx.Require().NoError(err)
+			sCtx.Require().True(found)
+			sCtx.Require().Equal(test.allowed, allowed)
+			sCtx.Require().Equal(test.changed, changed)
+
+			want := test.from
+			if test.changed {
+				want = test.to
+			}
+
+			sCtx.Require().Equal(want, statusOf(sCtx, useCase, rental.RentalUID))
+		})
+	}
+
+	t.WithNewStep("unknown rental", func(sCtx provider.StepCtx) {
+		// arrange
+		useCase := usecase.New(repository.NewMemoryRepository(newLogger()), newLogger())
+		// act
+		found, allowed, changed, err := useCase.SetRentalStatus(ctx, uuid.NewString(), models.RentalCanceled)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().False(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().False(changed)
+	})
+
+	t.WithNewStep("concurrent updates win every attempt", func(sCtx provider.StepCtx) {
+		// arrange
+		repo := repository.NewMemoryRepository(newLogger())
+		rental := rentalIn(sCtx, usecase.New(repo, newLogger()), models.RentalReserved)
+		useCase := usecase.New(racingRepository{repo}, newLogger())
+		// act
+		found, allowed, changed, err := useCase.SetRentalStatus(ctx, rental.RentalUID, models.RentalCanceled)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().True(found)
+		sCtx.Require().False(allowed)
+		sCtx.Require().False(changed)
+		sCtx.Require().Equal(models.RentalReserved, statusOf(sCtx, useCase, rental.RentalUID))
+	})
+}
+
+func (s *UseCaseSuite) TestSetRentalStatusFrom(t provider.T) {
+	t.Epic("Rentals")
+	t.Severity(allure.CRITICAL)
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name             string
+		from             models.RentalStatus
+		expected, to     models.RentalStatus
+		allowed, changed bool
+	}{{
+		name:     "expected status matches",
+		from:     models.RentalReserved,
+		expected: models.RentalReserved,
+		to:       models.RentalCanceled,
+		allowed:  true,
+		changed:  true,
+	}, {
+		name:     "rental picked up meanwhile",
+		from:     models.RentalInProgress,
+		expected: models.RentalReserved,
+		to:       models.RentalCanceled,
+	}, {
+		name:     "rental in the status already",
+		from:     models.RentalCanceled,
+		expected: models.RentalReserved,
+		to:       models.RentalCanceled,
+		allowed:  true,
+	}, {
+		name:     "transition not allowed from the expected status",
+		from:     models.RentalReserved,
+		expected: models.RentalReserved,
+		to:       models.RentalFinished,
+	}}
+
+	for _, test := range tests {
+		t.WithNewStep(test.name, func(sCtx provider.StepCtx) {
+			// arrange
+			useCase := usecase.New(repository.NewMemoryRepository(newLogger()), newLogger())
+			rental := rentalIn(sCtx, useCase, test.from)
+			// act
+			_, allowed, changed, err := useCase.SetRentalStatusFrom(ctx, rental.RentalUID, test.expected, test.to)
+			// assert
+			sCtx.Require().NoError(err)
+			sCtx.Require().Equal(test.allowed, allowed)
+			sCtx.Require().Equal(test.changed, changed)
+		})
+	}
+}
+
+func (s *UseCaseSuite) TestGetUserRentalStatusHistory(t provider.T) {
+	t.Epic("Rentals")
+	t.Severity(allure.NORMAL)
+
+	ctx := context.Background()
+
+	t.WithNewStep("history lists every transition in order", func(sCtx provider.StepCtx) {
+		// arrange
+		useCase := usecase.New(repository.NewMemoryRepository(newLogger()), newLogger())
+		rental := rentalIn(sCtx, useCase, models.RentalReserved)
+		_, _, _, err := useCase.SetRentalStatus(ctx, rental.RentalUID, models.RentalInProgress)
+		sCtx.Require().NoError(err)
+		_, _, _, err = useCase.SetRentalStatus(ctx, rental.RentalUID, models.RentalFinished)
+		sCtx.Require().NoError(err)
+		// act
+		history, found, permitted, err := useCase.GetUserRentalStatusHistory(ctx, rental.RentalUID, username)
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().True(found)
+		sCtx.Require().True(permitted)
+
+		transitions := make([]models.RentalStatus, 0, len(history))
+		for _, change := range history {
+			transitions = append(transitions, change.To)
+		}
+
+		sCtx.Require().Equal([]models.RentalStatus{models.RentalReserved, models.RentalInProgress, models.RentalFinished}, transitions)
+	})
+
+	t.WithNewStep("history of another user's rental", func(sCtx provider.StepCtx) {
+		// arrange
+		useCase := usecase.New(repository.NewMemoryRepository(newLogger()), newLogger())
+		rental := rentalIn(sCtx, useCase, models.RentalReserved)
+		// act
+		history, found, permitted, err := useCase.GetUserRentalStatusHistory(ctx, rental.RentalUID, "Another User")
+		// assert
+		sCtx.Require().NoError(err)
+		sCtx.Require().True(found)
+		sCtx.Require().False(permitted)
+		sCtx.Require().Empty(history)
+	})
+}
+
+func TestUseCase(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(UseCaseSuite))
+}
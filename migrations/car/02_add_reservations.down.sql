@@ -0,0 +1,7 @@
+ALTER TABLE cars ADD COLUMN availability BOOLEAN NOT NULL DEFAULT true;
+
+UPDATE cars c
+SET availability = false
+WHERE EXISTS (select 1 from car_reservations r where r.car_uid = c.car_uid and r.period @> now());
+
+DROP TABLE car_reservations;
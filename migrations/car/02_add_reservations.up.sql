@@ -0,0 +1,19 @@
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE car_reservations
+(
+    id      SERIAL PRIMARY KEY,
+    car_uid uuid      NOT NULL REFERENCES cars (car_uid) ON DELETE CASCADE,
+    period  tstzrange NOT NULL
+        CHECK (NOT isempty(period)),
+    EXCLUDE USING gist (car_uid WITH =, period WITH &&)
+);
+
+-- The flag has no dates, so the cars in rent stay reserved from now on until the reservation is released;
+-- the reconciler replaces these reservations with the periods of the rentals kept by the rental service.
+INSERT INTO car_reservations(car_uid, period)
+SELECT car_uid, tstzrange(now(), '9999-12-31')
+FROM cars
+WHERE NOT availability;
+
+ALTER TABLE cars DROP COLUMN availability;
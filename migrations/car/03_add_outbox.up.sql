@@ -0,0 +1,13 @@
+CREATE TABLE outbox
+(
+    id             BIGSERIAL PRIMARY KEY,
+    event_uid      uuid UNIQUE              NOT NULL,
+    aggregate_type VARCHAR(40)              NOT NULL,
+    aggregate_uid  uuid                     NOT NULL,
+    event_type     VARCHAR(80)              NOT NULL,
+    payload        JSONB                    NOT NULL,
+    created_at     TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    published_at   TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX outbox_unpublished_idx ON outbox (id) WHERE published_at IS NULL;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS car_reservations_rental_uid_idx;
+
+ALTER TABLE car_reservations
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS owner,
+    DROP COLUMN IF EXISTS rental_uid;
@@ -0,0 +1,6 @@
+ALTER TABLE car_reservations
+    ADD COLUMN rental_uid uuid,
+    ADD COLUMN owner      VARCHAR(80),
+    ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX car_reservations_rental_uid_idx ON car_reservations (rental_uid);
@@ -4,3 +4,4 @@ export PGPASSWORD=postgres
 psql -d cars -c "GRANT ALL ON SCHEMA public TO program;"
 psql -d rentals -c "GRANT ALL ON SCHEMA public TO program;"
 psql -d payments -c "GRANT ALL ON SCHEMA public TO program;"
+psql -d notifications -c "GRANT ALL ON SCHEMA public TO program;"
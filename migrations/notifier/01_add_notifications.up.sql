@@ -0,0 +1,41 @@
+CREATE TABLE notification_preferences
+(
+    username             VARCHAR(80) PRIMARY KEY,
+    email                VARCHAR(254) NOT NULL DEFAULT '',
+    booking_confirmation BOOLEAN      NOT NULL DEFAULT true,
+    pickup_reminder      BOOLEAN      NOT NULL DEFAULT true,
+    overdue_warning      BOOLEAN      NOT NULL DEFAULT true,
+    refund_receipt       BOOLEAN      NOT NULL DEFAULT true
+);
+
+-- Rentals as seen through the rental events, to address payment notifications and schedule reminders
+CREATE TABLE rentals
+(
+    rental_uid            uuid PRIMARY KEY,
+    username              VARCHAR(80)              NOT NULL,
+    car_uid               uuid                     NOT NULL,
+    payment_uid           uuid                     NOT NULL,
+    surcharge_payment_uid uuid,
+    date_from             TIMESTAMP WITH TIME ZONE NOT NULL,
+    date_to               TIMESTAMP WITH TIME ZONE NOT NULL,
+    status                VARCHAR(20)              NOT NULL
+);
+
+CREATE INDEX rentals_payment_uid_idx ON rentals (payment_uid);
+CREATE INDEX rentals_surcharge_payment_uid_idx ON rentals (surcharge_payment_uid);
+
+CREATE TABLE notifications
+(
+    id               SERIAL PRIMARY KEY,
+    notification_uid uuid UNIQUE              NOT NULL,
+    key              TEXT UNIQUE              NOT NULL,
+    username         VARCHAR(80)              NOT NULL,
+    kind             VARCHAR(40)              NOT NULL
+        CHECK (kind IN ('BOOKING_CONFIRMATION', 'PICKUP_REMINDER', 'OVERDUE_WARNING', 'REFUND_RECEIPT')),
+    recipient        VARCHAR(254)             NOT NULL,
+    subject          TEXT                     NOT NULL,
+    body             TEXT                     NOT NULL,
+    sent_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX notifications_username_idx ON notifications (username);
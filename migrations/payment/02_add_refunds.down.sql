@@ -0,0 +1,9 @@
+DROP TABLE refunds;
+
+UPDATE payments SET status = 'CANCELED' WHERE status = 'REFUNDED';
+UPDATE payments SET status = 'PAID' WHERE status = 'PARTIALLY_REFUNDED';
+
+ALTER TABLE payments
+    DROP CONSTRAINT payments_status_check,
+    ADD CONSTRAINT payments_status_check
+        CHECK (status IN ('PAID', 'CANCELED'));
@@ -0,0 +1,16 @@
+ALTER TABLE payments
+    DROP CONSTRAINT payments_status_check,
+    ADD CONSTRAINT payments_status_check
+        CHECK (status IN ('PAID', 'CANCELED', 'REFUNDED', 'PARTIALLY_REFUNDED'));
+
+CREATE TABLE refunds
+(
+    id          SERIAL PRIMARY KEY,
+    refund_uid  uuid                     NOT NULL UNIQUE,
+    payment_uid uuid                     NOT NULL,
+    amount      INT                      NOT NULL CHECK (amount > 0),
+    reason      TEXT                     NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX refunds_payment_uid_idx ON refunds (payment_uid);
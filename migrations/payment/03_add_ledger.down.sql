@@ -0,0 +1,7 @@
+DROP TABLE ledger_entries;
+DROP FUNCTION ledger_entries_immutable();
+
+ALTER TABLE payments
+    DROP COLUMN currency,
+    DROP COLUMN created_at,
+    DROP COLUMN updated_at;
@@ -0,0 +1,60 @@
+ALTER TABLE payments
+    ADD COLUMN currency   CHAR(3)                  NOT NULL DEFAULT 'RUB',
+    ADD COLUMN created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+-- Double-entry ledger: every transaction is a set of entries summing up to zero (debit > 0, credit < 0)
+CREATE TABLE ledger_entries
+(
+    id              SERIAL PRIMARY KEY,
+    entry_uid       uuid                     NOT NULL UNIQUE,
+    transaction_uid uuid                     NOT NULL,
+    payment_uid     uuid                     NOT NULL,
+    kind            VARCHAR(20)              NOT NULL
+        CHECK (kind IN ('CHARGE', 'REFUND', 'FEE', 'VOID')),
+    account         VARCHAR(20)              NOT NULL
+        CHECK (account IN ('CUSTOMER', 'REVENUE', 'FEES')),
+    amount          BIGINT                   NOT NULL CHECK (amount <> 0),
+    currency        CHAR(3)                  NOT NULL,
+    description     TEXT                     NOT NULL DEFAULT '',
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ledger_entries_payment_uid_idx ON ledger_entries (payment_uid);
+
+CREATE FUNCTION ledger_entries_immutable() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'ledger entries are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_entries_immutable
+    BEFORE UPDATE OR DELETE
+    ON ledger_entries
+    FOR EACH ROW
+EXECUTE FUNCTION ledger_entries_immutable();
+
+-- Backfill the ledger of existing payments and refunds (amounts in kopecks)
+CREATE TEMPORARY TABLE ledger_backfill AS
+SELECT gen_random_uuid() AS transaction_uid, payment_uid, 'CHARGE' AS kind, price::BIGINT * 100 AS amount, '' AS description, 1 AS ord
+FROM payments
+UNION ALL
+SELECT gen_random_uuid(), payment_uid, 'REFUND', -amount::BIGINT * 100, reason, 2
+FROM refunds
+UNION ALL
+SELECT gen_random_uuid(), payment_uid, 'VOID', -balance, '', 3
+FROM (SELECT p.payment_uid,
+             (p.price - coalesce((SELECT sum(r.amount) FROM refunds r WHERE r.payment_uid = p.payment_uid), 0))::BIGINT *
+             100 AS balance
+      FROM payments p
+      WHERE p.status = 'CANCELED') AS canceled
+WHERE balance > 0;
+
+INSERT INTO ledger_entries(entry_uid, transaction_uid, payment_uid, kind, account, amount, currency, description)
+SELECT gen_random_uuid(), transaction_uid, payment_uid, kind, account, amount * sign, 'RUB', description
+FROM ledger_backfill,
+     (VALUES ('CUSTOMER', 1), ('REVENUE', -1)) AS accounts(account, sign)
+ORDER BY ord, transaction_uid, sign DESC;
+
+DROP TABLE ledger_backfill;
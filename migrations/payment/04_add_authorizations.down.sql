@@ -0,0 +1,10 @@
+DROP INDEX payments_authorized_idx;
+
+-- Ledger entries are immutable, so the ledger constraints keep the authorization kinds and accounts
+-- and uncaptured authorizations are canceled
+UPDATE payments SET status = 'CANCELED' WHERE status = 'AUTHORIZED';
+
+ALTER TABLE payments
+    DROP CONSTRAINT payments_status_check,
+    ADD CONSTRAINT payments_status_check
+        CHECK (status IN ('PAID', 'CANCELED', 'REFUNDED', 'PARTIALLY_REFUNDED'));
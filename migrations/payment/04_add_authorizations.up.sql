@@ -0,0 +1,14 @@
+ALTER TABLE payments
+    DROP CONSTRAINT payments_status_check,
+    ADD CONSTRAINT payments_status_check
+        CHECK (status IN ('AUTHORIZED', 'PAID', 'CANCELED', 'REFUNDED', 'PARTIALLY_REFUNDED'));
+
+ALTER TABLE ledger_entries
+    DROP CONSTRAINT ledger_entries_kind_check,
+    ADD CONSTRAINT ledger_entries_kind_check
+        CHECK (kind IN ('AUTHORIZATION', 'CAPTURE', 'CHARGE', 'REFUND', 'FEE', 'VOID')),
+    DROP CONSTRAINT ledger_entries_account_check,
+    ADD CONSTRAINT ledger_entries_account_check
+        CHECK (account IN ('CUSTOMER', 'REVENUE', 'FEES', 'HOLDS', 'AUTHORIZATIONS'));
+
+CREATE INDEX payments_authorized_idx ON payments (created_at) WHERE status = 'AUTHORIZED';
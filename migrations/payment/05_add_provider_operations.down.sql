@@ -0,0 +1 @@
+DROP TABLE provider_operations;
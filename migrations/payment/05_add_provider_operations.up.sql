@@ -0,0 +1,19 @@
+CREATE TABLE provider_operations
+(
+    id            SERIAL PRIMARY KEY,
+    operation_uid uuid                     NOT NULL UNIQUE,
+    payment_uid   uuid                     NOT NULL,
+    kind          VARCHAR(20)              NOT NULL
+        CHECK (kind IN ('CHARGE', 'REFUND')),
+    amount        BIGINT                   NOT NULL CHECK (amount > 0),
+    currency      CHAR(3)                  NOT NULL,
+    reason        TEXT                     NOT NULL DEFAULT '',
+    status        VARCHAR(20)              NOT NULL
+        CHECK (status IN ('PENDING', 'APPROVED', 'DECLINED')),
+    external_ref  TEXT                     NOT NULL DEFAULT '',
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX provider_operations_payment_uid_idx ON provider_operations (payment_uid);
+CREATE INDEX provider_operations_pending_idx ON provider_operations (created_at) WHERE status = 'PENDING';
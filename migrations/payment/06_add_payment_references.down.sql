@@ -0,0 +1,10 @@
+ALTER TABLE provider_operations DROP CONSTRAINT provider_operations_payment_uid_fkey;
+ALTER TABLE ledger_entries DROP CONSTRAINT ledger_entries_payment_uid_fkey;
+ALTER TABLE refunds DROP CONSTRAINT refunds_payment_uid_fkey;
+
+DROP INDEX payments_rental_uid_idx;
+
+ALTER TABLE payments
+    DROP CONSTRAINT payments_payment_uid_key,
+    DROP COLUMN rental_uid,
+    DROP COLUMN external_ref;
@@ -0,0 +1,38 @@
+-- A payment uid is not guaranteed to be unique before this migration. The rows of a duplicated uid
+-- can't be told apart by the ledger and the refunds, so they are reported instead of being merged.
+DO
+$$
+    DECLARE
+        duplicates TEXT;
+    BEGIN
+        SELECT string_agg(payment_uid::TEXT, ', ')
+        INTO duplicates
+        FROM (SELECT payment_uid FROM payments GROUP BY payment_uid HAVING count(*) > 1 ORDER BY payment_uid LIMIT 20) d;
+
+        IF duplicates IS NOT NULL THEN
+            RAISE EXCEPTION 'payments with duplicate uids: %', duplicates
+                USING HINT = 'keep one row of every payment uid, then force version 5 and migrate again (see docs/migrations.md)';
+        END IF;
+    END
+$$;
+
+ALTER TABLE payments
+    ADD CONSTRAINT payments_payment_uid_key UNIQUE (payment_uid),
+    ADD COLUMN rental_uid   uuid,
+    ADD COLUMN external_ref TEXT;
+
+CREATE INDEX payments_rental_uid_idx ON payments (rental_uid);
+
+UPDATE payments p
+SET external_ref = o.external_ref
+FROM provider_operations o
+WHERE o.payment_uid = p.payment_uid
+  AND o.kind = 'CHARGE'
+  AND o.status = 'APPROVED';
+
+ALTER TABLE refunds
+    ADD CONSTRAINT refunds_payment_uid_fkey FOREIGN KEY (payment_uid) REFERENCES payments (payment_uid);
+ALTER TABLE ledger_entries
+    ADD CONSTRAINT ledger_entries_payment_uid_fkey FOREIGN KEY (payment_uid) REFERENCES payments (payment_uid);
+ALTER TABLE provider_operations
+    ADD CONSTRAINT provider_operations_payment_uid_fkey FOREIGN KEY (payment_uid) REFERENCES payments (payment_uid);
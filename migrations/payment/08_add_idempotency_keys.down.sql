@@ -0,0 +1,3 @@
+ALTER TABLE payments
+    DROP CONSTRAINT payments_idempotency_key_key,
+    DROP COLUMN idempotency_key;
@@ -0,0 +1,3 @@
+ALTER TABLE payments
+    ADD COLUMN idempotency_key TEXT,
+    ADD CONSTRAINT payments_idempotency_key_key UNIQUE (idempotency_key);
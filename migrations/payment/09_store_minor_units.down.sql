@@ -0,0 +1,14 @@
+-- The fractions of major units are lost
+ALTER TABLE payments
+    DROP CONSTRAINT payments_price_check,
+    ALTER COLUMN price TYPE INT USING price /
+                                    (CASE WHEN currency IN ('JPY', 'KRW', 'VND', 'ISK', 'CLP') THEN 1 ELSE 100 END);
+
+-- A refund of less than a major unit can't be stored in major units, it is rounded up to one
+ALTER TABLE refunds
+    ALTER COLUMN amount TYPE INT USING greatest(amount /
+                                                (CASE WHEN currency IN ('JPY', 'KRW', 'VND', 'ISK', 'CLP') THEN 1 ELSE 100 END),
+                                                1);
+
+ALTER TABLE refunds
+    DROP COLUMN currency;
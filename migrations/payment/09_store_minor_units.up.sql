@@ -0,0 +1,19 @@
+-- Payment prices and refund amounts are stored in minor units of their currency, like the ledger.
+-- The currencies listed have no minor units, as in internal/models/money.go
+ALTER TABLE refunds
+    ADD COLUMN currency CHAR(3);
+
+UPDATE refunds r
+SET currency = p.currency
+FROM payments p
+WHERE p.payment_uid = r.payment_uid;
+
+ALTER TABLE refunds
+    ALTER COLUMN currency SET NOT NULL,
+    ALTER COLUMN amount TYPE BIGINT USING amount::BIGINT *
+                                        (CASE WHEN currency IN ('JPY', 'KRW', 'VND', 'ISK', 'CLP') THEN 1 ELSE 100 END);
+
+ALTER TABLE payments
+    ALTER COLUMN price TYPE BIGINT USING price::BIGINT *
+                                       (CASE WHEN currency IN ('JPY', 'KRW', 'VND', 'ISK', 'CLP') THEN 1 ELSE 100 END),
+    ADD CONSTRAINT payments_price_check CHECK (price >= 0);
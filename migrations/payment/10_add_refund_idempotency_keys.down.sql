@@ -0,0 +1,3 @@
+ALTER TABLE provider_operations
+    DROP CONSTRAINT provider_operations_idempotency_key_key,
+    DROP COLUMN idempotency_key;
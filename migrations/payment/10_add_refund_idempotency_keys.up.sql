@@ -0,0 +1,3 @@
+ALTER TABLE provider_operations
+    ADD COLUMN idempotency_key TEXT,
+    ADD CONSTRAINT provider_operations_idempotency_key_key UNIQUE (idempotency_key);
@@ -0,0 +1,3 @@
+DROP TABLE rental_status_history;
+
+ALTER TABLE rentals DROP COLUMN version;
@@ -0,0 +1,16 @@
+ALTER TABLE rentals ADD COLUMN version INT NOT NULL DEFAULT 0;
+
+CREATE TABLE rental_status_history
+(
+    id          SERIAL PRIMARY KEY,
+    rental_uid  uuid                     NOT NULL REFERENCES rentals (rental_uid) ON DELETE CASCADE,
+    status_from VARCHAR(20),
+    status_to   VARCHAR(20)              NOT NULL,
+    changed_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX rental_status_history_rental_uid_idx ON rental_status_history (rental_uid);
+
+INSERT INTO rental_status_history(rental_uid, status_from, status_to)
+SELECT rental_uid, NULL, status
+FROM rentals;
@@ -0,0 +1,7 @@
+DROP INDEX rentals_reserved_date_from_idx;
+
+UPDATE rentals SET status = 'CANCELED' WHERE status = 'RESERVED';
+
+ALTER TABLE rentals DROP CONSTRAINT rentals_status_check;
+ALTER TABLE rentals ADD CONSTRAINT rentals_status_check
+    CHECK (status IN ('IN_PROGRESS', 'FINISHED', 'CANCELED'));
@@ -0,0 +1,5 @@
+ALTER TABLE rentals DROP CONSTRAINT rentals_status_check;
+ALTER TABLE rentals ADD CONSTRAINT rentals_status_check
+    CHECK (status IN ('RESERVED', 'IN_PROGRESS', 'FINISHED', 'CANCELED'));
+
+CREATE INDEX rentals_reserved_date_from_idx ON rentals (date_from) WHERE status = 'RESERVED';
@@ -0,0 +1,4 @@
+ALTER TABLE rentals
+    DROP COLUMN picked_up_at,
+    DROP COLUMN returned_at,
+    DROP COLUMN surcharge_payment_uid;
@@ -0,0 +1,4 @@
+ALTER TABLE rentals
+    ADD COLUMN picked_up_at          TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN returned_at           TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN surcharge_payment_uid uuid;
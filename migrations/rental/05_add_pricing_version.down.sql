@@ -0,0 +1,2 @@
+ALTER TABLE rentals
+    DROP COLUMN pricing_version;
@@ -0,0 +1,2 @@
+ALTER TABLE rentals
+    ADD COLUMN pricing_version TEXT NOT NULL DEFAULT '';
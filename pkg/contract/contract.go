@@ -0,0 +1,337 @@
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// UpdateEnv is the environment variable which makes the consumer tests rewrite the contracts.
+const UpdateEnv = "UPDATE_CONTRACTS"
+
+// Contract lists the interactions a consumer relies on; the provider replays them to verify it.
+type Contract struct {
+	Consumer     string        `json:"consumer"`
+	Provider     string        `json:"provider"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Description string   `json:"description"`
+	State       State    `json:"providerState"`
+	Request     Request  `json:"request"`
+	Response    Response `json:"response"`
+}
+
+// State is the data the provider must hold before the request. The params are the example
+// values the consumer used; the provider replaces the ones it generates.
+type State struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+type Request struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   string            `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// Response is the part of the response the consumer relies on. The body matches any response body
+// containing it; the Generated fields (dot-separated paths) are matched by type only.
+type Response struct {
+	Status    int             `json:"status"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Generated []string        `json:"generated,omitempty"`
+}
+
+func Load(path string) (Contract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Contract{}, err
+	}
+
+	var contract Contract
+
+	err = json.Unmarshal(data, &contract)
+	if err != nil {
+		return Contract{}, fmt.Errorf("parse contract %s: %w", path, err)
+	}
+
+	return contract, nil
+}
+
+func (c Contract) marshal() ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Save checks that the contract at the path did not change. The contract is written instead if
+// UpdateEnv is set, so a consumer change is reviewed together with the contract it makes.
+func (c Contract) Save(path string) error {
+	data, err := c.marshal()
+	if err != nil {
+		return err
+	}
+
+	if os.Getenv(UpdateEnv) != "" {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(path, data, 0o644)
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read contract (run the tests with %s=1 to write it): %w", UpdateEnv, err)
+	} else if !bytes.Equal(saved, data) {
+		return fmt.Errorf("contract %s is outdated; run the tests with %s=1 to update it", path, UpdateEnv)
+	}
+
+	return nil
+}
+
+// Consumer is an http.RoundTripper which records the requests of a consumer client
+// and answers them with the expected responses.
+type Consumer struct {
+	contract Contract
+	expected *Interaction
+	err      error
+}
+
+func NewConsumer(consumer, provider string) *Consumer {
+	return &Consumer{
+		contract: Contract{
+			Consumer:     consumer,
+			Provider:     provider,
+			Interactions: make([]Interaction, 0),
+		},
+	}
+}
+
+func (c *Consumer) Client() *http.Client {
+	return &http.Client{Transport: c}
+}
+
+// Expect sets the response to the next request. The body is marshaled to JSON unless it is nil.
+func (c *Consumer) Expect(description string, state State, status int, body any, generated ...string) {
+	response := Response{
+		Status:    status,
+		Generated: generated,
+	}
+
+	if body != nil {
+		response.Body, c.err = json.Marshal(body)
+	}
+
+	c.expected = &Interaction{
+		Description: description,
+		State:       state,
+		Response:    response,
+	}
+}
+
+func (c *Consumer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.expected == nil {
+		return nil, fmt.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+	}
+
+	interaction := *c.expected
+	c.expected = nil
+
+	request, err := NewRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction.Request = request
+	c.contract.Interactions = append(c.contract.Interactions, interaction)
+
+	return &http.Response{
+		Status:     http.StatusText(interaction.Response.Status),
+		StatusCode: interaction.Response.Status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(interaction.Response.Body)),
+		Request:    req,
+	}, nil
+}
+
+// Done reports an expected response no request was made for.
+func (c *Consumer) Done() error {
+	if c.err != nil {
+		return c.err
+	} else if c.expected != nil {
+		return fmt.Errorf("expected request %q not made", c.expected.Description)
+	}
+
+	return nil
+}
+
+func (c *Consumer) Contract() Contract {
+	return c.contract
+}
+
+// NewRequest records the request as the client sent it, without the host.
+func NewRequest(req *http.Request) (Request, error) {
+	request := Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query().Encode(),
+	}
+
+	if len(req.Header) != 0 {
+		request.Headers = make(map[string]string, len(req.Header))
+		for key, values := range req.Header {
+			request.Headers[key] = strings.Join(values, ", ")
+		}
+	}
+
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return Request{}, err
+		}
+
+		request.Body = string(body)
+	}
+
+	return request, nil
+}
+
+type App interface {
+	Test(req *http.Request, msTimeout ...int) (*http.Response, error)
+}
+
+// Verify sends the request of the interaction to the provider app and checks the response.
+// The replacements map the example values of the consumer to the ones the provider generated for the state.
+func Verify(app App, interaction Interaction, replacements map[string]string) error {
+	pairs := make([]string, 0, 2*len(replacements))
+	for example, actual := range replacements {
+		pairs = append(pairs, example, actual)
+	}
+
+	replacer := strings.NewReplacer(pairs...)
+
+	target := "http://provider" + replacer.Replace(interaction.Request.Path)
+	if interaction.Request.Query != "" {
+		target += "?" + replacer.Replace(interaction.Request.Query)
+	}
+
+	req, err := http.NewRequest(interaction.Request.Method, target, strings.NewReader(replacer.Replace(interaction.Request.Body)))
+	if err != nil {
+		return err
+	}
+
+	for key, value := range interaction.Request.Headers {
+		req.Header.Set(key, replacer.Replace(value))
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != interaction.Response.Status {
+		return fmt.Errorf("%s: status %d, expected %d: %s", interaction.Description, resp.StatusCode, interaction.Response.Status, body)
+	} else if len(interaction.Response.Body) == 0 {
+		return nil
+	}
+
+	var expected, actual any
+
+	err = json.Unmarshal([]byte(replacer.Replace(string(interaction.Response.Body))), &expected)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(body, &actual)
+	if err != nil {
+		return fmt.Errorf("%s: parse response body %s: %w", interaction.Description, body, err)
+	}
+
+	err = match(expected, actual, "", interaction.Response.Generated)
+	if err != nil {
+		return fmt.Errorf("%s: %w", interaction.Description, err)
+	}
+
+	return nil
+}
+
+// match checks that actual contains expected; the values at the generated paths only need the same type.
+func match(expected, actual any, path string, generated []string) error {
+	if slices.Contains(generated, path) {
+		if fmt.Sprintf("%T", expected) != fmt.Sprintf("%T", actual) {
+			return fmt.Errorf("%s: got %T, expected %T", path, actual, expected)
+		}
+
+		return nil
+	}
+
+	switch expected := expected.(type) {
+	case map[string]any:
+		actual, ok := actual.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: got %T, expected an object", path, actual)
+		}
+
+		for key, value := range expected {
+			err := match(value, actual[key], join(path, key), generated)
+			if err != nil {
+				return err
+			}
+		}
+	case []any:
+		actual, ok := actual.([]any)
+		if !ok {
+			return fmt.Errorf("%s: got %T, expected an array", path, actual)
+		} else if len(actual) != len(expected) {
+			return fmt.Errorf("%s: got %d items, expected %d", path, len(actual), len(expected))
+		}
+
+		for i, value := range expected {
+			err := match(value, actual[i], join(path, fmt.Sprint(i)), generated)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		if expected != actual {
+			return fmt.Errorf("%s: got %v, expected %v", path, actual, expected)
+		}
+	}
+
+	return nil
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
@@ -0,0 +1,135 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+const Usage = `usage: migrate <command>
+
+commands:
+  up             apply all pending migrations
+  down N         roll back N migrations
+  goto V         migrate up or down to version V
+  force V        set version V without running migrations, clearing the dirty flag
+  status         print the current version
+  create NAME    add empty up and down migrations named NAME`
+
+// RunCommand runs a migrate subcommand of a service binary.
+func RunCommand(ctx context.Context, args []string, connString, migrationsPath string, logger *slog.Logger) error {
+	if len(args) == 0 {
+		return fmt.Errorf("migrate command not set\n%s", Usage)
+	}
+
+	command, args := args[0], args[1:]
+
+	if command == "create" {
+		if len(args) != 1 {
+			return fmt.Errorf("create takes a migration name\n%s", Usage)
+		}
+
+		up, down, err := Create(migrationsPath, args[0])
+		if err != nil {
+			return err
+		}
+
+		logger.Info(fmt.Sprintf("created %s and %s", up, down))
+
+		return nil
+	}
+
+	var arg int
+
+	switch command {
+	case "up", "status":
+		if len(args) != 0 {
+			return fmt.Errorf("%s takes no arguments\n%s", command, Usage)
+		}
+	case "down", "goto", "force":
+		if len(args) != 1 {
+			return fmt.Errorf("%s takes a number\n%s", command, Usage)
+		}
+
+		var err error
+		arg, err = strconv.Atoi(args[0])
+		if err != nil || arg < 0 {
+			return fmt.Errorf("invalid number %q\n%s", args[0], Usage)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", command, Usage)
+	}
+
+	m, err := New(connString, migrationsPath, logger)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch command {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx, arg)
+	case "goto":
+		return m.Goto(ctx, uint(arg))
+	case "force":
+		return m.Force(ctx, arg)
+	default:
+		version, dirty, err := m.Status()
+		if err != nil {
+			return err
+		}
+
+		logger.Info(fmt.Sprintf("current database migration version is %d, dirty: %t", version, dirty))
+
+		return nil
+	}
+}
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_.+\.(up|down)\.sql$`)
+
+// Create adds empty up and down migrations numbered after the last migration in the directory.
+func Create(migrationsPath, name string) (up, down string, err error) {
+	entries, err := os.ReadDir(migrationsPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	next := 0
+
+	for _, entry := range entries {
+		match := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return "", "", err
+		}
+
+		next = max(next, version+1)
+	}
+
+	prefix := filepath.Join(migrationsPath, fmt.Sprintf("%02d_%s", next, name))
+	up, down = prefix+".up.sql", prefix+".down.sql"
+
+	for _, path := range []string{up, down} {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+
+		err = file.Close()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return up, down, nil
+}
@@ -1,50 +1,187 @@
 package migrations
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	_ "github.com/lib/pq"
 	"log/slog"
+	"strings"
 )
 
-func Do(connString, migrationsPath string, logger *slog.Logger) error {
+// lockID serializes the migrations of a database, so replicas starting together do not race.
+const lockID = 0x6d696772617465
+
+const (
+	tryLockQuery = `select pg_try_advisory_lock($1);`
+	lockQuery    = `select pg_advisory_lock($1);`
+	unlockQuery  = `select pg_advisory_unlock($1);`
+)
+
+// Migrator runs the migrations of a database while holding its migration lock.
+type Migrator struct {
+	m      *migrate.Migrate
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func New(connString, migrationsPath string, logger *slog.Logger) (*Migrator, error) {
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		return nil, err
+	}
+
 	m, err := migrate.New("file://"+migrationsPath, connString)
 	if err != nil {
-		return err
+		_ = db.Close()
+		return nil, err
 	}
 
-	version, dirty, err := m.Version()
-	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+	m.Log = migrateLogger{logger}
+
+	return &Migrator{
+		m:      m,
+		db:     db,
+		logger: logger,
+	}, nil
+}
+
+func (m *Migrator) Close() error {
+	sourceErr, dbErr := m.m.Close()
+
+	return errors.Join(sourceErr, dbErr, m.db.Close())
+}
+
+// Do applies the pending migrations.
+func Do(connString, migrationsPath string, logger *slog.Logger) error {
+	m, err := New(connString, migrationsPath, logger)
+	if err != nil {
 		return err
-	} else if dirty {
-		return fmt.Errorf("current database migration version %d is dirty", version)
 	}
 
-	logger.Info(fmt.Sprintf("current database migration version is %d; migrate up", version))
+	return errors.Join(m.Up(context.Background()), m.Close())
+}
 
-	err = m.Up()
-	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		rollbackErr := m.Force(int(version))
-		if rollbackErr != nil {
-			logger.Warn(err.Error() + "; rollback")
-			logger.Warn("rollback migration")
-			return rollbackErr
-		} else {
-			logger.Warn("rollback migration")
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.run(ctx, "migrate up", m.m.Up)
+}
+
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("invalid number of migrations to roll back: %d", steps)
+	}
+
+	return m.run(ctx, fmt.Sprintf("roll back %d migrations", steps), func() error {
+		return m.m.Steps(-steps)
+	})
+}
+
+func (m *Migrator) Goto(ctx context.Context, version uint) error {
+	return m.run(ctx, fmt.Sprintf("migrate to version %d", version), func() error {
+		return m.m.Migrate(version)
+	})
+}
+
+// Force sets the version without running migrations, to clear the dirty flag after
+// a failed migration was repaired by hand.
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	return m.withLock(ctx, func() error {
+		err := m.m.Force(version)
+		if err != nil {
 			return err
 		}
-	} else if errors.Is(err, migrate.ErrNoChange) {
-		logger.Info("current database migration version is up to date")
-	} else {
-		version, dirty, err = m.Version()
+
+		m.logger.Warn(fmt.Sprintf("forced database migration version %d", version))
+
+		return nil
+	})
+}
+
+func (m *Migrator) Status() (version uint, dirty bool, err error) {
+	version, dirty, err = m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+
+	return version, dirty, err
+}
+
+func (m *Migrator) run(ctx context.Context, action string, f func() error) error {
+	return m.withLock(ctx, func() error {
+		version, dirty, err := m.Status()
 		if err != nil {
 			return err
 		} else if dirty {
-			return fmt.Errorf("database migration version %d is dirty", version)
+			return fmt.Errorf("current database migration version %d is dirty; repair it and run migrate force", version)
 		}
 
-		logger.Info(fmt.Sprintf("migrated to version %d", version))
+		m.logger.Info(fmt.Sprintf("current database migration version is %d; %s", version, action))
+
+		err = f()
+		if errors.Is(err, migrate.ErrNoChange) {
+			m.logger.Info("current database migration version is up to date")
+			return nil
+		} else if err != nil {
+			// a failed migration leaves the version dirty; it is not forced back, so the
+			// half-applied migration is not hidden from the next run
+			return err
+		}
+
+		version, _, err = m.Status()
+		if err != nil {
+			return err
+		}
+
+		m.logger.Info(fmt.Sprintf("migrated to version %d", version))
+
+		return nil
+	})
+}
+
+func (m *Migrator) withLock(ctx context.Context, f func() error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
 	}
+	defer conn.Close()
+
+	var locked bool
+
+	err = conn.QueryRowContext(ctx, tryLockQuery, lockID).Scan(&locked)
+	if err != nil {
+		return err
+	}
+
+	if !locked {
+		m.logger.Info("waiting for the database migration lock")
+
+		_, err = conn.ExecContext(ctx, lockQuery, lockID)
+		if err != nil {
+			return err
+		}
+	}
+
+	defer func() {
+		_, unlockErr := conn.ExecContext(context.Background(), unlockQuery, lockID)
+		err = errors.Join(err, unlockErr)
+	}()
+
+	return f()
+}
+
+type migrateLogger struct {
+	logger *slog.Logger
+}
+
+// Printf receives a line per applied migration, as verbose output is off.
+func (l migrateLogger) Printf(format string, v ...any) {
+	l.logger.Info("migrate: " + strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
 
-	return nil
+func (l migrateLogger) Verbose() bool {
+	return false
 }
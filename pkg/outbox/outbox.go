@@ -0,0 +1,187 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/Inspirate789/ds-lab2/pkg/sqlxutils"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/segmentio/kafka-go"
+	"log/slog"
+	"time"
+)
+
+const (
+	insertEventQuery = `
+		insert into outbox(event_uid, aggregate_type, aggregate_uid, event_type, payload)
+		values ($1, $2, $3, $4, $5);
+	`
+	lockRelayQuery               = `select pg_try_advisory_xact_lock($1);`
+	selectUnpublishedEventsQuery = `select * from outbox where published_at is null order by id limit $1;`
+	markEventsPublishedQuery     = `update outbox set published_at = now() where id = any($1);`
+)
+
+// relayLockID serializes the relays of a database, so events leave the outbox in insertion order.
+const relayLockID = 0x6f7574626f78
+
+// TypeHeader is the kafka message header holding the event type.
+const TypeHeader = "event-type"
+
+// Event is a domain event written to the outbox of the service in the transaction of the state change.
+type Event struct {
+	AggregateType string
+	AggregateUID  string
+	Type          string
+	Payload       any
+}
+
+// Message is the envelope events are published to kafka in, keyed by the aggregate uid.
+type Message struct {
+	EventUID      string          `json:"eventUid"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregateType"`
+	AggregateUID  string          `json:"aggregateUid"`
+	OccurredAt    time.Time       `json:"occurredAt"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+type eventDTO struct {
+	ID            int64        `db:"id"`
+	EventUID      string       `db:"event_uid"`
+	AggregateType string       `db:"aggregate_type"`
+	AggregateUID  string       `db:"aggregate_uid"`
+	EventType     string       `db:"event_type"`
+	Payload       []byte       `db:"payload"`
+	CreatedAt     time.Time    `db:"created_at"`
+	PublishedAt   sql.NullTime `db:"published_at"`
+}
+
+func Write(ctx context.Context, tx *sqlx.Tx, event Event) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = sqlxutils.Exec(ctx, tx, insertEventQuery,
+		uuid.New().String(), event.AggregateType, event.AggregateUID, event.Type, payload,
+	)
+
+	return err
+}
+
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Relay publishes outbox events to kafka. An event is marked as published only after kafka
+// acknowledged it, so it is delivered at least once; consumers deduplicate by the event uid.
+type Relay struct {
+	db        *sqlx.DB
+	writer    MessageWriter
+	batchSize uint64
+	logger    *slog.Logger
+}
+
+func NewRelay(db *sqlx.DB, writer MessageWriter, batchSize uint64, logger *slog.Logger) *Relay {
+	if batchSize == 0 {
+		batchSize = 100
+	}
+
+	return &Relay{
+		db:        db,
+		writer:    writer,
+		batchSize: batchSize,
+		logger:    logger,
+	}
+}
+
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		r.logger.Warn("outbox relay interval not set, events are not published")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				published, err := r.Publish(ctx)
+				if err != nil {
+					r.logger.Error(err.Error())
+				}
+
+				if err != nil || uint64(published) < r.batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Publish sends the next batch of unpublished events and returns its size.
+func (r *Relay) Publish(ctx context.Context) (published int, err error) {
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+		published = 0 // the transaction may be run again
+
+		var locked bool
+
+		err := sqlxutils.Get(ctx, tx, &locked, lockRelayQuery, relayLockID)
+		if err != nil || !locked {
+			return err
+		}
+
+		events := make([]eventDTO, 0)
+
+		err = sqlxutils.Select(ctx, tx, &events, selectUnpublishedEventsQuery, r.batchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		messages := make([]kafka.Message, 0, len(events))
+		ids := make([]int64, 0, len(events))
+
+		for _, event := range events {
+			value, err := json.Marshal(Message{
+				EventUID:      event.EventUID,
+				Type:          event.EventType,
+				AggregateType: event.AggregateType,
+				AggregateUID:  event.AggregateUID,
+				OccurredAt:    event.CreatedAt,
+				Payload:       event.Payload,
+			})
+			if err != nil {
+				return err
+			}
+
+			messages = append(messages, kafka.Message{
+				Key:     []byte(event.AggregateUID),
+				Value:   value,
+				Headers: []kafka.Header{{Key: TypeHeader, Value: []byte(event.EventType)}},
+			})
+			ids = append(ids, event.ID)
+		}
+
+		err = r.writer.WriteMessages(ctx, messages...)
+		if err != nil {
+			return err
+		}
+
+		_, err = sqlxutils.Exec(ctx, tx, markEventsPublishedQuery, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+
+		published = len(events)
+
+		return nil
+	})
+
+	return published, err
+}
@@ -0,0 +1,261 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Inspirate789/ds-lab2/pkg/migrations"
+	"github.com/Inspirate789/ds-lab2/pkg/outbox"
+	"github.com/Inspirate789/ds-lab2/pkg/postgrestest"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"github.com/segmentio/kafka-go"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writer records the messages it is given; it fails them while err is set.
+type writer struct {
+	mu       sync.Mutex
+	err      error
+	messages []kafka.Message
+}
+
+func (w *writer) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	w.messages = append(w.messages, msgs...)
+
+	return nil
+}
+
+func (w *writer) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.err = err
+}
+
+func (w *writer) written() []kafka.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]kafka.Message(nil), w.messages...)
+}
+
+type RelaySuite struct {
+	suite.Suite
+	dsn    string
+	db     *sqlx.DB
+	logger *slog.Logger
+}
+
+func (s *RelaySuite) BeforeAll(t provider.T) {
+	s.logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	// every service has the same outbox table, the cars schema is the smallest one
+	err := migrations.Do(s.dsn, "../../migrations/car", s.logger)
+	t.Require().NoError(err)
+
+	s.db, err = sqlx.Connect("postgres", s.dsn)
+	t.Require().NoError(err)
+}
+
+func (s *RelaySuite) BeforeEach(t provider.T) {
+	_, err := s.db.Exec("truncate outbox;")
+	t.Require().NoError(err)
+}
+
+func (s *RelaySuite) AfterAll(t provider.T) {
+	t.Require().NoError(s.db.Close())
+}
+
+// write commits the events to the outbox.
+func (s *RelaySuite) write(t provider.T, events ...outbox.Event) {
+	ctx := context.Background()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	t.Require().NoError(err)
+
+	for _, event := range events {
+		t.Require().NoError(outbox.Write(ctx, tx, event))
+	}
+
+	t.Require().NoError(tx.Commit())
+}
+
+func event(aggregateUID, eventType string) outbox.Event {
+	return outbox.Event{
+		AggregateType: "rental",
+		AggregateUID:  aggregateUID,
+		Type:          eventType,
+		Payload:       map[string]string{"status": eventType},
+	}
+}
+
+func decode(t provider.T, message kafka.Message) outbox.Message {
+	var res outbox.Message
+	t.Require().NoError(json.Unmarshal(message.Value, &res))
+
+	return res
+}
+
+func (s *RelaySuite) TestPublish(t provider.T) {
+	t.Epic("Events")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	aggregateUID := uuid.NewString()
+	s.write(t, event(aggregateUID, "RENTAL_RESERVED"))
+	w := new(writer)
+	relay := outbox.NewRelay(s.db, w, 0, s.logger)
+	// act
+	published, err := relay.Publish(ctx)
+	t.Require().NoError(err)
+	republished, err := relay.Publish(ctx)
+	t.Require().NoError(err)
+	// assert
+	t.Require().Equal(1, published)
+	t.Require().Zero(republished)
+
+	messages := w.written()
+	t.Require().Len(messages, 1)
+	t.Require().Equal(aggregateUID, string(messages[0].Key))
+	t.Require().Equal([]kafka.Header{{Key: outbox.TypeHeader, Value: []byte("RENTAL_RESERVED")}}, messages[0].Headers)
+
+	message := decode(t, messages[0])
+	t.Require().NoError(uuid.Validate(message.EventUID))
+	t.Require().Equal("RENTAL_RESERVED", message.Type)
+	t.Require().Equal("rental", message.AggregateType)
+	t.Require().Equal(aggregateUID, message.AggregateUID)
+	t.Require().WithinDuration(time.Now(), message.OccurredAt, time.Minute)
+	t.Require().JSONEq(`{"status": "RENTAL_RESERVED"}`, string(message.Payload))
+}
+
+func (s *RelaySuite) TestPublishBatches(t provider.T) {
+	t.Epic("Events")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	aggregateUID := uuid.NewString()
+	s.write(t, event(aggregateUID, "RENTAL_RESERVED"), event(aggregateUID, "RENTAL_STARTED"))
+	s.write(t, event(aggregateUID, "RENTAL_FINISHED"))
+	w := new(writer)
+	relay := outbox.NewRelay(s.db, w, 2, s.logger)
+	// act
+	first, err := relay.Publish(ctx)
+	t.Require().NoError(err)
+	second, err := relay.Publish(ctx)
+	t.Require().NoError(err)
+	third, err := relay.Publish(ctx)
+	t.Require().NoError(err)
+	// assert
+	t.Require().Equal([]int{2, 1, 0}, []int{first, second, third})
+
+	types := make([]string, 0, 3)
+	for _, message := range w.written() {
+		types = append(types, decode(t, message).Type)
+	}
+
+	t.Require().Equal([]string{"RENTAL_RESERVED", "RENTAL_STARTED", "RENTAL_FINISHED"}, types)
+}
+
+func (s *RelaySuite) TestPublishFailure(t provider.T) {
+	t.Epic("Events")
+	t.Severity(allure.CRITICAL)
+
+	// arrange
+	ctx := context.Background()
+	s.write(t, event(uuid.NewString(), "RENTAL_RESERVED"))
+	w := new(writer)
+	w.fail(errors.New("kafka unavailable"))
+	relay := outbox.NewRelay(s.db, w, 0, s.logger)
+	// act
+	failed, failErr := relay.Publish(ctx)
+	w.fail(nil)
+	published, err := relay.Publish(ctx)
+	t.Require().NoError(err)
+	// assert
+	t.Require().Error(failErr)
+	t.Require().Zero(failed)
+	t.Require().Equal(1, published)
+	t.Require().Len(w.written(), 1)
+}
+
+func (s *RelaySuite) TestPublishLocked(t provider.T) {
+	t.Epic("Events")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx := context.Background()
+	s.write(t, event(uuid.NewString(), "RENTAL_RESERVED"))
+
+	// another relay is publishing meanwhile, it holds the relay lock of the database
+	tx, err := s.db.BeginTxx(ctx, nil)
+	t.Require().NoError(err)
+	defer tx.Rollback() //nolint:errcheck
+
+	var locked bool
+	t.Require().NoError(tx.GetContext(ctx, &locked, "select pg_try_advisory_xact_lock($1);", 0x6f7574626f78))
+	t.Require().True(locked)
+
+	w := new(writer)
+	relay := outbox.NewRelay(s.db, w, 0, s.logger)
+	// act
+	published, err := relay.Publish(ctx)
+	t.Require().NoError(err)
+	// assert
+	t.Require().Zero(published)
+	t.Require().Empty(w.written())
+}
+
+func (s *RelaySuite) TestRun(t provider.T) {
+	t.Epic("Events")
+	t.Severity(allure.NORMAL)
+
+	// arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.write(t, event(uuid.NewString(), "RENTAL_RESERVED"), event(uuid.NewString(), "RENTAL_RESERVED"))
+	w := new(writer)
+	relay := outbox.NewRelay(s.db, w, 1, s.logger)
+	// act
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	deadline := time.Now().Add(3 * time.Second)
+	for len(w.written()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	// assert
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("relay is not stopped")
+	}
+
+	t.Require().Len(w.written(), 2)
+}
+
+func TestRelay(t *testing.T) {
+	suite.RunSuite(t, &RelaySuite{dsn: postgrestest.Start(t, "outbox")})
+}
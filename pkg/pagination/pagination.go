@@ -0,0 +1,194 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/url"
+	"strconv"
+)
+
+type PaginationError string
+
+func (e PaginationError) Error() string {
+	return string(e)
+}
+
+const (
+	ErrInvalidCursor PaginationError = "invalid page cursor"
+	ErrInvalidLimit  PaginationError = "invalid page limit"
+)
+
+const MaxLimit = 100
+
+// Cursor points at the row a keyset page starts after (or ends before, if Backward is set).
+type Cursor struct {
+	ID       int64 `json:"id"`
+	Backward bool  `json:"b,omitempty"`
+}
+
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func ParseCursor(token string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, errors.Wrap(err, ErrInvalidCursor.Error())
+	}
+
+	var c Cursor
+
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return Cursor{}, errors.Wrap(err, ErrInvalidCursor.Error())
+	}
+
+	return c, nil
+}
+
+// Request selects a page by offset or, when Cursor is set, by keyset.
+type Request struct {
+	Offset uint64
+	Limit  uint64
+	Cursor *Cursor
+}
+
+func ParseRequest(offset, limit, cursor string) (Request, error) {
+	req := Request{Limit: MaxLimit}
+
+	if limit != "" {
+		var err error
+		req.Limit, err = strconv.ParseUint(limit, 10, 64)
+		if err != nil || req.Limit == 0 || req.Limit > MaxLimit {
+			return Request{}, ErrInvalidLimit
+		}
+	}
+
+	if cursor != "" {
+		c, err := ParseCursor(cursor)
+		if err != nil {
+			return Request{}, err
+		}
+
+		req.Cursor = &c
+	} else if offset != "" {
+		var err error
+		req.Offset, err = strconv.ParseUint(offset, 10, 64)
+		if err != nil {
+			return Request{}, errors.Wrap(err, "parse page offset")
+		}
+	}
+
+	return req, nil
+}
+
+func (r Request) Backward() bool {
+	return r.Cursor != nil && r.Cursor.Backward
+}
+
+// Bounds returns the exclusive id range the page is searched in.
+func (r Request) Bounds() (after, before int64) {
+	const maxID = 1<<63 - 1
+
+	switch {
+	case r.Cursor == nil:
+		return 0, maxID
+	case r.Cursor.Backward:
+		return 0, r.Cursor.ID
+	default:
+		return r.Cursor.ID, maxID
+	}
+}
+
+// Values returns the url query parameters describing the request.
+func (r Request) Values() url.Values {
+	query := url.Values{"limit": {strconv.FormatUint(r.Limit, 10)}}
+
+	if r.Cursor != nil {
+		query.Set("cursor", r.Cursor.String())
+	} else {
+		query.Set("offset", strconv.FormatUint(r.Offset, 10))
+	}
+
+	return query
+}
+
+// Page describes the neighbourhood of a returned page.
+type Page struct {
+	TotalCount uint64
+	Next       *Cursor
+	Prev       *Cursor
+}
+
+// Paginate trims the lookahead row fetched along with the page (repositories select Limit+1 rows,
+// in descending id order for backward cursors) and builds the cursors of the neighbouring pages.
+func Paginate[T any](items []T, req Request, id func(T) int64) ([]T, Page) {
+	hasMore := uint64(len(items)) > req.Limit
+	if hasMore {
+		items = items[:req.Limit]
+	}
+
+	var hasNext, hasPrev bool
+
+	switch {
+	case req.Cursor == nil:
+		hasNext, hasPrev = hasMore, req.Offset != 0
+	case req.Cursor.Backward:
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+
+		hasNext, hasPrev = true, hasMore
+	default:
+		hasNext, hasPrev = hasMore, true
+	}
+
+	var page Page
+
+	if len(items) == 0 {
+		return items, page
+	}
+
+	if hasNext {
+		page.Next = &Cursor{ID: id(items[len(items)-1])}
+	}
+
+	if hasPrev {
+		page.Prev = &Cursor{ID: id(items[0]), Backward: true}
+	}
+
+	return items, page
+}
+
+// Window picks the rows a repository query selects for the request out of items sorted by id:
+// up to Limit+1 rows within the bounds after the offset, in descending id order for backward cursors.
+func Window[T any](items []T, req Request, id func(T) int64) []T {
+	after, before := req.Bounds()
+	res := make([]T, 0, min(uint64(len(items)), req.Limit+1))
+
+	for i := range items {
+		item := items[i]
+		if req.Backward() {
+			item = items[len(items)-1-i]
+		}
+
+		if id(item) <= after || id(item) >= before {
+			continue
+		}
+
+		res = append(res, item)
+	}
+
+	if req.Offset >= uint64(len(res)) {
+		return res[:0]
+	}
+
+	res = res[req.Offset:]
+	if uint64(len(res)) > req.Limit+1 {
+		res = res[:req.Limit+1]
+	}
+
+	return res
+}
@@ -0,0 +1,318 @@
+package pagination_test
+
+import (
+	"encoding/base64"
+	"github.com/Inspirate789/ds-lab2/pkg/pagination"
+	"github.com/ozontech/allure-go/pkg/allure"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"strconv"
+	"testing"
+)
+
+type row struct {
+	id int64
+}
+
+func rowID(r row) int64 {
+	return r.id
+}
+
+// rows returns the rows with the ids from 1 to n.
+func rows(n int64) []row {
+	res := make([]row, 0, n)
+	for id := int64(1); id <= n; id++ {
+		res = append(res, row{id: id})
+	}
+
+	return res
+}
+
+func ids(items []row) []int64 {
+	res := make([]int64, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.id)
+	}
+
+	return res
+}
+
+type PaginationSuite struct {
+	suite.Suite
+}
+
+func (s *PaginationSuite) TestCursor(t provider.T) {
+	t.Epic("Pagination")
+	t.Severity(allure.CRITICAL)
+
+	t.WithNewStep("encode and decode", func(sCtx provider.StepCtx) {
+		for _, cursor := range []pagination.Cursor{{ID: 1}, {ID: 42, Backward: true}, {ID: 1<<63 - 1}} {
+			// act
+			res, err := pagination.ParseCursor(cursor.String())
+			// assert
+			sCtx.Require().NoError(err)
+			sCtx.Require().Equal(cursor, res)
+		}
+	})
+
+	t.WithNewStep("url safe token", func(sCtx provider.StepCtx) {
+		// act
+		token := pagination.Cursor{ID: 1<<63 - 1, Backward: true}.String()
+		// assert
+		sCtx.Require().NotContains(token, "+")
+		sCtx.Require().NotContains(token, "/")
+		sCtx.Require().NotContains(token, "=")
+	})
+
+	t.WithNewStep("invalid cursors", func(sCtx provider.StepCtx) {
+		for _, token := range []string{
+			"not base64!",
+			base64.RawURLEncoding.EncodeToString([]byte("not json")),
+			base64.RawURLEncoding.EncodeToString([]byte(`{"id":"1"}`)),
+			base64.StdEncoding.EncodeToString([]byte(`{"id":1}`)),
+		} {
+			// act
+			_, err := pagination.ParseCursor(token)
+			// assert
+			sCtx.Require().Error(err, token)
+			sCtx.Require().Contains(err.Error(), pagination.ErrInvalidCursor.Error())
+		}
+	})
+
+	t.WithNewStep("tampered cursor", func(sCtx provider.StepCtx) {
+		// arrange
+		token := []byte(pagination.Cursor{ID: 42}.String())
+		token[len(token)/2] ^= 0x20
+		// act
+		_, err := pagination.ParseCursor(string(token))
+		// assert
+		sCtx.Require().Error(err)
+		sCtx.Require().Contains(err.Error(), pagination.ErrInvalidCursor.Error())
+	})
+}
+
+func (s *PaginationSuite) TestParseRequest(t provider.T) {
+	t.Epic("Pagination")
+	t.Severity(allure.CRITICAL)
+
+	cursor := pagination.Cursor{ID: 7, Backward: true}
+
+	cases := []struct {
+		name                  string
+		offset, limit, cursor string
+		want                  pagination.Request
+		err                   string
+	}{{
+		name: "defaults",
+		want: pagination.Request{Limit: pagination.MaxLimit},
+	}, {
+		name:   "offset and limit",
+		offset: "20",
+		limit:  "10",
+		want:   pagination.Request{Offset: 20, Limit: 10},
+	}, {
+		name:  "max limit",
+		limit: strconv.Itoa(pagination.MaxLimit),
+		want:  pagination.Request{Limit: pagination.MaxLimit},
+	}, {
+		name:  "limit above max",
+		limit: strconv.Itoa(pagination.MaxLimit + 1),
+		err:   pagination.ErrInvalidLimit.Error(),
+	}, {
+		name:  "zero limit",
+		limit: "0",
+		err:   pagination.ErrInvalidLimit.Error(),
+	}, {
+		name:  "negative limit",
+		limit: "-1",
+		err:   pagination.ErrInvalidLimit.Error(),
+	}, {
+		name:   "invalid offset",
+		offset: "first",
+		err:    "parse page offset",
+	}, {
+		name:   "cursor takes precedence over offset",
+		offset: "first",
+		limit:  "5",
+		cursor: cursor.String(),
+		want:   pagination.Request{Limit: 5, Cursor: &cursor},
+	}, {
+		name:   "invalid cursor",
+		cursor: "garbage!",
+		err:    pagination.ErrInvalidCursor.Error(),
+	}}
+
+	for _, c := range cases {
+		t.WithNewStep(c.name, func(sCtx provider.StepCtx) {
+			// act
+			res, err := pagination.ParseRequest(c.offset, c.limit, c.cursor)
+			// assert
+			if c.err != "" {
+				sCtx.Require().Error(err)
+				sCtx.Require().Contains(err.Error(), c.err)
+				return
+			}
+
+			sCtx.Require().NoError(err)
+			sCtx.Require().Equal(c.want, res)
+		})
+	}
+}
+
+func (s *PaginationSuite) TestRequest(t provider.T) {
+	t.Epic("Pagination")
+	t.Severity(allure.NORMAL)
+
+	t.WithNewStep("bounds", func(sCtx provider.StepCtx) {
+		// act
+		afterFirst, beforeFirst := pagination.Request{Limit: 1}.Bounds()
+		afterNext, beforeNext := pagination.Request{Limit: 1, Cursor: &pagination.Cursor{ID: 5}}.Bounds()
+		afterPrev, beforePrev := pagination.Request{Limit: 1, Cursor: &pagination.Cursor{ID: 5, Backward: true}}.Bounds()
+		// assert
+		sCtx.Require().Equal([]int64{0, 1<<63 - 1}, []int64{afterFirst, beforeFirst})
+		sCtx.Require().Equal([]int64{5, 1<<63 - 1}, []int64{afterNext, beforeNext})
+		sCtx.Require().Equal([]int64{0, 5}, []int64{afterPrev, beforePrev})
+	})
+
+	t.WithNewStep("query values", func(sCtx provider.StepCtx) {
+		// arrange
+		cursor := pagination.Cursor{ID: 5}
+		// act
+		offset := pagination.Request{Offset: 10, Limit: 5}.Values()
+		keyset := pagination.Request{Offset: 10, Limit: 5, Cursor: &cursor}.Values()
+		// assert
+		sCtx.Require().Equal("10", offset.Get("offset"))
+		sCtx.Require().Equal("5", offset.Get("limit"))
+		sCtx.Require().Equal(cursor.String(), keyset.Get("cursor"))
+		sCtx.Require().False(keyset.Has("offset"))
+	})
+}
+
+// page runs the request against the rows the way a repository does.
+func page(items []row, req pagination.Request) ([]row, pagination.Page) {
+	return pagination.Paginate(pagination.Window(items, req, rowID), req, rowID)
+}
+
+func (s *PaginationSuite) TestPaginate(t provider.T) {
+	t.Epic("Pagination")
+	t.Severity(allure.CRITICAL)
+
+	cases := []struct {
+		name       string
+		rows       int64
+		req        pagination.Request
+		want       []int64
+		next, prev *pagination.Cursor
+	}{{
+		name: "empty table",
+		req:  pagination.Request{Limit: 3},
+		want: []int64{},
+	}, {
+		name: "single page",
+		rows: 3,
+		req:  pagination.Request{Limit: 3},
+		want: []int64{1, 2, 3},
+	}, {
+		name: "first of several pages",
+		rows: 7,
+		req:  pagination.Request{Limit: 3},
+		want: []int64{1, 2, 3},
+		next: &pagination.Cursor{ID: 3},
+	}, {
+		name: "page by offset",
+		rows: 7,
+		req:  pagination.Request{Offset: 3, Limit: 3},
+		want: []int64{4, 5, 6},
+		next: &pagination.Cursor{ID: 6},
+		prev: &pagination.Cursor{ID: 4, Backward: true},
+	}, {
+		name: "offset past the end",
+		rows: 7,
+		req:  pagination.Request{Offset: 10, Limit: 3},
+		want: []int64{},
+	}, {
+		name: "next page by cursor",
+		rows: 7,
+		req:  pagination.Request{Limit: 3, Cursor: &pagination.Cursor{ID: 3}},
+		want: []int64{4, 5, 6},
+		next: &pagination.Cursor{ID: 6},
+		prev: &pagination.Cursor{ID: 4, Backward: true},
+	}, {
+		name: "last page by cursor",
+		rows: 7,
+		req:  pagination.Request{Limit: 3, Cursor: &pagination.Cursor{ID: 6}},
+		want: []int64{7},
+		prev: &pagination.Cursor{ID: 7, Backward: true},
+	}, {
+		name: "last page ends at the limit",
+		rows: 6,
+		req:  pagination.Request{Limit: 3, Cursor: &pagination.Cursor{ID: 3}},
+		want: []int64{4, 5, 6},
+		prev: &pagination.Cursor{ID: 4, Backward: true},
+	}, {
+		name: "previous page by cursor",
+		rows: 7,
+		req:  pagination.Request{Limit: 3, Cursor: &pagination.Cursor{ID: 7, Backward: true}},
+		want: []int64{4, 5, 6},
+		next: &pagination.Cursor{ID: 6},
+		prev: &pagination.Cursor{ID: 4, Backward: true},
+	}, {
+		name: "first page by backward cursor",
+		rows: 7,
+		req:  pagination.Request{Limit: 3, Cursor: &pagination.Cursor{ID: 4, Backward: true}},
+		want: []int64{1, 2, 3},
+		next: &pagination.Cursor{ID: 3},
+	}, {
+		name: "cursor past the end",
+		rows: 7,
+		req:  pagination.Request{Limit: 3, Cursor: &pagination.Cursor{ID: 7}},
+		want: []int64{},
+	}, {
+		name: "max limit",
+		rows: pagination.MaxLimit + 1,
+		req:  pagination.Request{Limit: pagination.MaxLimit},
+		want: ids(rows(pagination.MaxLimit)),
+		next: &pagination.Cursor{ID: pagination.MaxLimit},
+	}}
+
+	for _, c := range cases {
+		t.WithNewStep(c.name, func(sCtx provider.StepCtx) {
+			// act
+			res, info := page(rows(c.rows), c.req)
+			// assert
+			sCtx.Require().Equal(c.want, ids(res))
+			sCtx.Require().Equal(c.next, info.Next, "next")
+			sCtx.Require().Equal(c.prev, info.Prev, "prev")
+		})
+	}
+
+	t.WithNewStep("walk forward and back", func(sCtx provider.StepCtx) {
+		// arrange
+		items := rows(10)
+		req := pagination.Request{Limit: 4}
+		var forward [][]int64
+		// act
+		for {
+			res, info := page(items, req)
+			forward = append(forward, ids(res))
+
+			if info.Next == nil {
+				break
+			}
+
+			req = pagination.Request{Limit: 4, Cursor: info.Next}
+		}
+
+		_, last := page(items, req)
+		back, _ := page(items, pagination.Request{Limit: 4, Cursor: last.Prev})
+		// assert
+		sCtx.Require().Equal([][]int64{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10}}, forward)
+		sCtx.Require().Equal([]int64{5, 6, 7, 8}, ids(back))
+	})
+}
+
+func TestPagination(t *testing.T) {
+	t.Parallel()
+
+	suite.RunSuite(t, new(PaginationSuite))
+}
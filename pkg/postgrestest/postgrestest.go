@@ -0,0 +1,52 @@
+// Package postgrestest runs disposable Postgres databases for the repository tests.
+package postgrestest
+
+import (
+	"context"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"testing"
+)
+
+// Image matches the Postgres version of docker-compose.yaml.
+const Image = "postgres:17"
+
+// Start runs a Postgres container with the database for the test and returns its connection string.
+// The container is removed once the test finishes; the test is skipped if Docker is not available.
+func Start(t *testing.T, database string) string {
+	t.Helper()
+	skipWithoutDocker(t)
+
+	ctx := context.Background()
+
+	container, err := postgres.Run(ctx, Image,
+		postgres.WithDatabase(database),
+		postgres.WithUsername("postgres"),
+		postgres.WithPassword("postgres"),
+		postgres.BasicWaitStrategies(),
+	)
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Fatalf("start postgres: %v", err)
+	}
+
+	dsn, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatalf("get postgres connection string: %v", err)
+	}
+
+	return dsn
+}
+
+// skipWithoutDocker skips the test if Docker is not running; testcontainers panics if it finds no Docker host at all.
+func skipWithoutDocker(t *testing.T) {
+	t.Helper()
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Skipf("Docker is not available: %v", r)
+		}
+	}()
+
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+}
@@ -131,7 +131,8 @@ func (backlog *KafkaRequestBacklog) HandleRequest(ctx context.Context, do func(*
 		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, rawRequest.Method, rawRequest.URL, bytes.NewBuffer(rawRequest.Body))
+	// the request is finished even if the handling is canceled, so a stopped retryer doesn't leave it half-sent
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), rawRequest.Method, rawRequest.URL, bytes.NewBuffer(rawRequest.Body))
 	if err != nil {
 		return err
 	}
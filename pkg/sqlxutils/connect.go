@@ -0,0 +1,98 @@
+package sqlxutils
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PoolOptions struct {
+	MaxOpenConns     int
+	MaxIdleConns     int
+	ConnMaxLifetime  time.Duration
+	ConnMaxIdleTime  time.Duration
+	StatementTimeout time.Duration // sent to postgres as the statement_timeout of each connection
+	ConnectAttempts  int
+	ConnectBackoff   time.Duration // doubled after every failed attempt
+}
+
+// Connect opens the database and pings it until it answers or the attempts are exhausted.
+func Connect(ctx context.Context, driverName, dsn string, options PoolOptions, logger *slog.Logger) (*sqlx.DB, error) {
+	if options.StatementTimeout > 0 {
+		var err error
+		dsn, err = withStatementTimeout(dsn, options.StatementTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sqlx.Open(driverName, dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "open database")
+	}
+
+	db.SetMaxOpenConns(options.MaxOpenConns)
+	if options.MaxIdleConns > 0 { // zero would disable the idle pool instead of keeping the default
+		db.SetMaxIdleConns(options.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(options.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(options.ConnMaxIdleTime)
+
+	attempts := max(options.ConnectAttempts, 1)
+	backoff := options.ConnectBackoff
+
+	for attempt := 1; ; attempt++ {
+		err = db.PingContext(ctx)
+		if err == nil {
+			return db, nil
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		logger.Warn("database not available, retrying",
+			slog.Int("attempt", attempt),
+			slog.Duration("backoff", backoff),
+			slog.String("error", err.Error()),
+		)
+
+		select {
+		case <-ctx.Done():
+			_ = db.Close()
+			return nil, errors.Wrap(ctx.Err(), "connect to database")
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+
+	_ = db.Close()
+
+	return nil, errors.Wrapf(err, "connect to database after %d attempts", attempts)
+}
+
+// withStatementTimeout adds the statement_timeout run-time parameter to a URL or key/value dsn.
+func withStatementTimeout(dsn string, timeout time.Duration) (string, error) {
+	value := strconv.FormatInt(timeout.Milliseconds(), 10)
+
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return strings.TrimSpace(dsn + " statement_timeout=" + value), nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", errors.Wrap(err, "parse connection string")
+	}
+
+	query := u.Query()
+	query.Set("statement_timeout", value)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
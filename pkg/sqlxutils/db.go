@@ -0,0 +1,38 @@
+package sqlxutils
+
+import (
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/multierr"
+)
+
+// DB is the primary database with an optional read replica. Queries and transactions go to the
+// primary; reads that tolerate replication lag can be sent to Reader.
+type DB struct {
+	*sqlx.DB
+	replica *sqlx.DB
+}
+
+func NewDB(primary, replica *sqlx.DB) *DB {
+	return &DB{
+		DB:      primary,
+		replica: replica,
+	}
+}
+
+// Reader returns the replica if one is configured and the primary otherwise.
+func (db *DB) Reader() sqlx.QueryerContext {
+	if db.replica != nil {
+		return db.replica
+	}
+
+	return db.DB
+}
+
+func (db *DB) Close() error {
+	err := db.DB.Close()
+	if db.replica != nil {
+		err = multierr.Combine(err, db.replica.Close())
+	}
+
+	return err
+}
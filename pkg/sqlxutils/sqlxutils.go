@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"go.uber.org/multierr"
+	"time"
 )
 
 func sqlErr(err error, query string, args ...interface{}) error {
@@ -78,7 +80,29 @@ type txRunner interface {
 	BeginTxx(context.Context, *sql.TxOptions) (*sqlx.Tx, error)
 }
 
+// Transactions failed on a serialization failure or a deadlock are run again from the start,
+// so f must not have side effects outside of the transaction that break on a retry.
+const (
+	txAttempts = 3
+	txBackoff  = 20 * time.Millisecond
+)
+
 func RunTx(ctx context.Context, db txRunner, level sql.IsolationLevel, f txFunc) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = runTx(ctx, db, level, f)
+		if err == nil || attempt == txAttempts || !retryableTxErr(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * txBackoff):
+		}
+	}
+}
+
+func runTx(ctx context.Context, db txRunner, level sql.IsolationLevel, f txFunc) (err error) {
 	var tx *sqlx.Tx
 
 	tx, err = db.BeginTxx(ctx, &sql.TxOptions{Isolation: level})
@@ -96,3 +120,17 @@ func RunTx(ctx context.Context, db txRunner, level sql.IsolationLevel, f txFunc)
 
 	return f(tx)
 }
+
+func retryableTxErr(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == serializationFailure || pqErr.Code == deadlockDetected
+}
+
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)